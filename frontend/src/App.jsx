@@ -1,19 +1,28 @@
-import { BrowserRouter as Router, Routes, Route, Navigate } from 'react-router-dom'
+import { BrowserRouter as Router, Routes, Route, Navigate, useLocation } from 'react-router-dom'
 import { useAuthStore } from './store/authStore'
 import Login from './pages/Login'
 import Register from './pages/Register'
+import ForgotPassword from './pages/ForgotPassword'
+import ResetPassword from './pages/ResetPassword'
+import VerifyEmail from './pages/VerifyEmail'
+import SsoCallback from './pages/SsoCallback'
+import OAuthAuthorize from './pages/OAuthAuthorize'
+import DeviceLogin from './pages/DeviceLogin'
 import Dashboard from './pages/Dashboard'
 import Layout from './components/Layout'
 import { Toaster } from '@/components/ui/toaster'
 
+// Pages that need a login send the user back to them afterwards, e.g. an OAuth consent request
 function PrivateRoute({ children }) {
   const { token } = useAuthStore()
-  return token ? children : <Navigate to="/login" />
+  const location = useLocation()
+  return token ? children : <Navigate to="/login" state={{ from: location.pathname + location.search }} />
 }
 
 function PublicRoute({ children }) {
   const { token } = useAuthStore()
-  return !token ? children : <Navigate to="/dashboard" />
+  const location = useLocation()
+  return !token ? children : <Navigate to={location.state?.from || '/dashboard'} />
 }
 
 function App() {
@@ -35,6 +44,38 @@ function App() {
           </PublicRoute>
         } />
         
+        <Route path="/forgot-password" element={
+          <PublicRoute>
+            <ForgotPassword />
+          </PublicRoute>
+        } />
+
+        <Route path="/reset-password" element={
+          <PublicRoute>
+            <ResetPassword />
+          </PublicRoute>
+        } />
+        
+        <Route path="/verify-email" element={<VerifyEmail />} />
+
+        <Route path="/sso/callback" element={
+          <PublicRoute>
+            <SsoCallback />
+          </PublicRoute>
+        } />
+
+        <Route path="/oauth/authorize" element={
+          <PrivateRoute>
+            <OAuthAuthorize />
+          </PrivateRoute>
+        } />
+
+        <Route path="/device" element={
+          <PrivateRoute>
+            <DeviceLogin />
+          </PrivateRoute>
+        } />
+
         <Route path="/dashboard" element={
           <PrivateRoute>
             <Layout>
@@ -0,0 +1,89 @@
+import api from './axios'
+
+// User administration; only accounts with the admin role can call these
+export const adminAPI = {
+  listUsers: async (params) => {
+    const response = await api.get('/admin/users', { params })
+    return response.data
+  },
+
+  getUser: async (id) => {
+    const response = await api.get(`/admin/users/${id}`)
+    return response.data
+  },
+
+  activateUser: async (id) => {
+    const response = await api.post(`/admin/users/${id}/activate`)
+    return response.data
+  },
+
+  deactivateUser: async (id) => {
+    const response = await api.post(`/admin/users/${id}/deactivate`)
+    return response.data
+  },
+
+  setStorageLimit: async (id, storageLimit) => {
+    const response = await api.put(`/admin/users/${id}/storage-limit`, { storage_limit: storageLimit })
+    return response.data
+  },
+
+  setRoles: async (id, roles) => {
+    const response = await api.put(`/admin/users/${id}/roles`, { roles })
+    return response.data
+  },
+
+  forceLogout: async (id) => {
+    const response = await api.post(`/admin/users/${id}/logout`)
+    return response.data
+  },
+
+  impersonate: async (id) => {
+    const response = await api.post(`/admin/users/${id}/impersonate`)
+    return response.data
+  },
+
+  setWorkspaceStorageLimit: async (id, storageLimit) => {
+    const response = await api.put(`/admin/workspaces/${id}/storage-limit`, { storage_limit: storageLimit })
+    return response.data
+  },
+
+  // Storage plans
+  listPlans: async () => {
+    const response = await api.get('/admin/plans')
+    return response.data
+  },
+
+  createPlan: async (plan) => {
+    const response = await api.post('/admin/plans', plan)
+    return response.data
+  },
+
+  updatePlan: async (id, plan) => {
+    const response = await api.put(`/admin/plans/${id}`, plan)
+    return response.data
+  },
+
+  setUserPlan: async (id, planId) => {
+    const response = await api.put(`/admin/users/${id}/plan`, { plan_id: planId })
+    return response.data
+  },
+
+  setWorkspacePlan: async (id, planId) => {
+    const response = await api.put(`/admin/workspaces/${id}/plan`, { plan_id: planId })
+    return response.data
+  },
+
+  // Audit log of every user
+  getAuditLog: async (params) => {
+    const response = await api.get('/admin/audit', { params })
+    return response.data
+  },
+
+  exportAuditLog: async (params) => {
+    const response = await api.get('/admin/audit/export', {
+      params,
+      responseType: 'blob',
+    })
+    return response
+  },
+}
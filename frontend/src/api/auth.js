@@ -11,6 +11,116 @@ export const authAPI = {
     return response.data
   },
 
+  loginMFA: async (mfaToken, code) => {
+    const response = await api.post('/auth/login/mfa', { mfa_token: mfaToken, code })
+    return response.data
+  },
+
+  oidcConfig: async () => {
+    const response = await api.get('/auth/oidc')
+    return response.data
+  },
+
+  oidcAuthorize: async () => {
+    const response = await api.post('/auth/oidc/authorize')
+    return response.data
+  },
+
+  oidcCallback: async (code, state) => {
+    const response = await api.post('/auth/oidc/callback', { code, state })
+    return response.data
+  },
+
+  refresh: async (refreshToken) => {
+    const response = await api.post('/auth/refresh', { token: refreshToken })
+    return response.data
+  },
+
+  logout: async (refreshToken) => {
+    const response = await api.post('/auth/logout', { refresh_token: refreshToken })
+    return response.data
+  },
+
+  logoutAll: async () => {
+    const response = await api.post('/auth/logout-all')
+    return response.data
+  },
+
+  changePassword: async (data) => {
+    const response = await api.post('/auth/password', data)
+    return response.data
+  },
+
+  forgotPassword: async (email) => {
+    const response = await api.post('/auth/password/forgot', { email })
+    return response.data
+  },
+
+  resetPassword: async (token, newPassword) => {
+    const response = await api.post('/auth/password/reset', { token, new_password: newPassword })
+    return response.data
+  },
+
+  verifyEmail: async (token) => {
+    const response = await api.post('/auth/email/verify', { token })
+    return response.data
+  },
+
+  resendVerification: async () => {
+    const response = await api.post('/auth/email/verify/resend')
+    return response.data
+  },
+
+  enrollTOTP: async () => {
+    const response = await api.post('/auth/2fa/enroll')
+    return response.data
+  },
+
+  confirmTOTP: async (code) => {
+    const response = await api.post('/auth/2fa/confirm', { code })
+    return response.data
+  },
+
+  disableTOTP: async (code) => {
+    const response = await api.post('/auth/2fa/disable', { code })
+    return response.data
+  },
+
+  createAccessToken: async (data) => {
+    const response = await api.post('/auth/tokens', data)
+    return response.data
+  },
+
+  listAccessTokens: async () => {
+    const response = await api.get('/auth/tokens')
+    return response.data
+  },
+
+  revokeAccessToken: async (tokenId) => {
+    const response = await api.delete(`/auth/tokens/${tokenId}`)
+    return response.data
+  },
+
+  listSessions: async () => {
+    const response = await api.get('/auth/sessions')
+    return response.data
+  },
+
+  revokeSession: async (sessionId) => {
+    const response = await api.delete(`/auth/sessions/${sessionId}`)
+    return response.data
+  },
+
+  getDeviceAuthorization: async (userCode) => {
+    const response = await api.get('/auth/device', { params: { user_code: userCode } })
+    return response.data
+  },
+
+  verifyDevice: async (userCode, approve) => {
+    const response = await api.post('/auth/device/verify', { user_code: userCode, approve })
+    return response.data
+  },
+
   verify: async () => {
     const response = await api.post('/auth/verify')
     return response.data
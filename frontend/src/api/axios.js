@@ -22,10 +22,43 @@ api.interceptors.request.use(
   }
 )
 
+// Concurrent 401s share one refresh, since a refresh token can only be used once
+let refreshPromise = null
+
+const refreshTokens = async () => {
+  const { refreshToken, setTokens } = useAuthStore.getState()
+  if (!refreshToken) {
+    throw new Error('No refresh token')
+  }
+  const response = await axios.post('/api/v1/auth/refresh', { token: refreshToken })
+  setTokens(response.data.data.token, response.data.data.refresh_token)
+  return response.data.data.token
+}
+
 // Response interceptor to handle errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const originalRequest = error.config
+    // A failed login is a wrong password or code, not an expired session
+    if (originalRequest?.url?.startsWith('/auth/login') || originalRequest?.url?.startsWith('/auth/oidc')) {
+      return Promise.reject(error)
+    }
+    if (error.response?.status === 401 && originalRequest && !originalRequest._retry) {
+      originalRequest._retry = true
+      try {
+        refreshPromise = refreshPromise || refreshTokens().finally(() => {
+          refreshPromise = null
+        })
+        const token = await refreshPromise
+        originalRequest.headers.Authorization = `Bearer ${token}`
+        return api(originalRequest)
+      } catch (refreshError) {
+        useAuthStore.getState().logout()
+        window.location.href = '/login'
+        return Promise.reject(refreshError)
+      }
+    }
     if (error.response?.status === 401) {
       useAuthStore.getState().logout()
       window.location.href = '/login'
@@ -0,0 +1,25 @@
+import api from './axios'
+
+export const exportsAPI = {
+  list: async () => {
+    const response = await api.get('/exports')
+    return response.data
+  },
+
+  get: async (exportId) => {
+    const response = await api.get(`/exports/${exportId}`)
+    return response.data
+  },
+
+  request: async (includeVersions = false) => {
+    const response = await api.post('/exports', { include_versions: includeVersions })
+    return response.data
+  },
+
+  download: async (exportId) => {
+    const response = await api.get(`/exports/${exportId}/download`, {
+      responseType: 'blob',
+    })
+    return response
+  },
+}
@@ -1,18 +1,24 @@
 import api from './axios'
 
 export const filesAPI = {
-  list: async (parentId = null) => {
+  list: async (parentId = null, workspaceId = null) => {
     const params = parentId ? { parent_id: parentId } : {}
+    if (workspaceId) {
+      params.workspace_id = workspaceId
+    }
     const response = await api.get('/files/', { params })
     return response.data
   },
 
-  upload: async (file, parentId = null) => {
+  upload: async (file, parentId = null, workspaceId = null) => {
     const formData = new FormData()
     formData.append('file', file)
     if (parentId) {
       formData.append('parent_id', parentId)
     }
+    if (workspaceId) {
+      formData.append('workspace_id', workspaceId)
+    }
     
     const response = await api.post('/files/upload', formData, {
       headers: {
@@ -39,10 +45,11 @@ export const filesAPI = {
     return response.data
   },
 
-  createFolder: async (name, parentId = null) => {
+  createFolder: async (name, parentId = null, workspaceId = null) => {
     const response = await api.post('/files/folders', {
       name,
       parent_id: parentId,
+      workspace_id: workspaceId || undefined,
     })
     return response.data
   },
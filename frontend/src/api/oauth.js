@@ -0,0 +1,38 @@
+import api from './axios'
+
+export const oauthAPI = {
+  getAuthorization: async (params) => {
+    const response = await api.get('/oauth/authorize', { params })
+    return response.data
+  },
+
+  authorize: async (decision) => {
+    const response = await api.post('/oauth/authorize', decision)
+    return response.data
+  },
+
+  createClient: async (data) => {
+    const response = await api.post('/oauth/clients', data)
+    return response.data
+  },
+
+  listClients: async () => {
+    const response = await api.get('/oauth/clients')
+    return response.data
+  },
+
+  revokeClient: async (clientId) => {
+    const response = await api.delete(`/oauth/clients/${clientId}`)
+    return response.data
+  },
+
+  listConsents: async () => {
+    const response = await api.get('/oauth/consents')
+    return response.data
+  },
+
+  revokeConsent: async (clientId) => {
+    const response = await api.delete(`/oauth/consents/${clientId}`)
+    return response.data
+  },
+}
@@ -10,4 +10,35 @@ export const usersAPI = {
     const response = await api.put('/users/me', data)
     return response.data
   },
+
+  getMyPlan: async () => {
+    const response = await api.get('/users/me/plan')
+    return response.data
+  },
+
+  // Account deletion, cancellable until the scheduled date
+  requestDeletion: async () => {
+    const response = await api.post('/users/me/deletion')
+    return response.data
+  },
+
+  cancelDeletion: async () => {
+    const response = await api.delete('/users/me/deletion')
+    return response.data
+  },
+
+  // Audit log of the signed-in user; params filter by action, outcome, from, to, page and limit
+  getAuditLog: async (params) => {
+    const response = await api.get('/users/me/audit', { params })
+    return response.data
+  },
+
+  // Same filters as getAuditLog; the file is JSON Lines
+  exportAuditLog: async (params) => {
+    const response = await api.get('/users/me/audit/export', {
+      params,
+      responseType: 'blob',
+    })
+    return response
+  },
 }
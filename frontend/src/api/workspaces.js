@@ -0,0 +1,44 @@
+import api from './axios'
+
+export const workspacesAPI = {
+  list: async () => {
+    const response = await api.get('/workspaces')
+    return response.data
+  },
+
+  get: async (workspaceId) => {
+    const response = await api.get(`/workspaces/${workspaceId}`)
+    return response.data
+  },
+
+  create: async (name) => {
+    const response = await api.post('/workspaces', { name })
+    return response.data
+  },
+
+  rename: async (workspaceId, name) => {
+    const response = await api.put(`/workspaces/${workspaceId}`, { name })
+    return response.data
+  },
+
+  delete: async (workspaceId) => {
+    const response = await api.delete(`/workspaces/${workspaceId}`)
+    return response.data
+  },
+
+  // Members
+  addMember: async (workspaceId, email, role) => {
+    const response = await api.post(`/workspaces/${workspaceId}/members`, { email, role })
+    return response.data
+  },
+
+  setMemberRole: async (workspaceId, userId, role) => {
+    const response = await api.put(`/workspaces/${workspaceId}/members/${userId}`, { role })
+    return response.data
+  },
+
+  removeMember: async (workspaceId, userId) => {
+    const response = await api.delete(`/workspaces/${workspaceId}/members/${userId}`)
+    return response.data
+  },
+}
@@ -1,6 +1,8 @@
-import { LogOut, HardDrive } from 'lucide-react'
+import { LogOut, HardDrive, MailWarning } from 'lucide-react'
 import { useAuthStore } from '../store/authStore'
+import { authAPI } from '../api/auth'
 import { useNavigate } from 'react-router-dom'
+import { useToast } from '@/hooks/use-toast'
 import {
   DropdownMenu,
   DropdownMenuContent,
@@ -14,14 +16,36 @@ import { Button } from '@/components/ui/button'
 import { Progress } from '@/components/ui/progress'
 
 export default function Layout({ children }) {
-  const { user, logout } = useAuthStore()
+  const { user, refreshToken, logout } = useAuthStore()
   const navigate = useNavigate()
+  const { toast } = useToast()
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    try {
+      await authAPI.logout(refreshToken)
+    } catch (error) {
+      console.error('Failed to revoke session:', error)
+    }
     logout()
     navigate('/login')
   }
 
+  const handleResendVerification = async () => {
+    try {
+      await authAPI.resendVerification()
+      toast({
+        title: 'Email enviado',
+        description: 'Revisa tu bandeja de entrada',
+      })
+    } catch (error) {
+      toast({
+        variant: 'destructive',
+        title: 'Error',
+        description: error.response?.data?.error || 'No se pudo enviar el email',
+      })
+    }
+  }
+
   const formatBytes = (bytes) => {
     if (bytes === 0) return '0 Bytes'
     const k = 1024
@@ -113,6 +137,25 @@ export default function Layout({ children }) {
         </div>
       </header>
 
+      {/* Email verification notice */}
+      {user && (!user.email_verified || user.pending_email) && (
+        <div className="border-b bg-yellow-50 dark:bg-yellow-950/40">
+          <div className="w-full px-4 sm:px-6 lg:px-8">
+            <div className="max-w-7xl mx-auto py-2 flex items-center gap-2 text-sm">
+              <MailWarning className="w-4 h-4 text-yellow-600" />
+              <span className="flex-1">
+                {user.pending_email
+                  ? `Confirma tu nuevo email (${user.pending_email}) con el enlace que te enviamos.`
+                  : 'Confirma tu email con el enlace que te enviamos.'}
+              </span>
+              <Button variant="link" size="sm" className="h-auto p-0" onClick={handleResendVerification}>
+                Reenviar
+              </Button>
+            </div>
+          </div>
+        </div>
+      )}
+
       {/* Storage Bar */}
       {user && (
         <div className="border-b bg-muted/40">
@@ -11,27 +11,38 @@ import {
 import { Progress } from '@/components/ui/progress'
 import { useToast } from '@/hooks/use-toast'
 import { AlertCircle, File, Loader2, Upload, X } from 'lucide-react'
-import { useRef, useState } from 'react'
+import { useEffect, useRef, useState } from 'react'
 import { filesAPI } from '../api/files'
+import { usersAPI } from '../api/users'
 import { useAuthStore } from '../store/authStore'
 
-const MAX_FILE_SIZE = 500 * 1024 * 1024 // 500MB
+// Hasta conocer el plan del usuario se usa el límite del plan gratuito
+const DEFAULT_MAX_FILE_SIZE = 500 * 1024 * 1024 // 500MB
 
 export default function UploadModal({ open, onClose, onSuccess, parentId }) {
   const [selectedFile, setSelectedFile] = useState(null)
   const [uploading, setUploading] = useState(false)
   const [uploadProgress, setUploadProgress] = useState(0)
   const [error, setError] = useState('')
+  const [maxFileSize, setMaxFileSize] = useState(DEFAULT_MAX_FILE_SIZE)
   const fileInputRef = useRef(null)
   const { toast } = useToast()
   const refreshUser = useAuthStore((state) => state.refreshUser)
 
+  useEffect(() => {
+    if (!open) return
+    usersAPI
+      .getMyPlan()
+      .then((response) => setMaxFileSize(response.data.max_file_size))
+      .catch(() => setMaxFileSize(DEFAULT_MAX_FILE_SIZE))
+  }, [open])
+
   const handleFileSelect = (e) => {
     const file = e.target.files?.[0]
     if (file) {
-      // Validar tamaño (500MB)
-      if (file.size > MAX_FILE_SIZE) {
-        setError(`El archivo es demasiado grande (máximo ${formatBytes(MAX_FILE_SIZE)})`)
+      // Validar tamaño según el plan
+      if (file.size > maxFileSize) {
+        setError(`El archivo es demasiado grande (máximo ${formatBytes(maxFileSize)})`)
         setSelectedFile(null)
         return
       }
@@ -108,8 +119,8 @@ export default function UploadModal({ open, onClose, onSuccess, parentId }) {
 
     const file = e.dataTransfer.files?.[0]
     if (file) {
-      if (file.size > MAX_FILE_SIZE) {
-        setError(`El archivo es demasiado grande (máximo ${formatBytes(MAX_FILE_SIZE)})`)
+      if (file.size > maxFileSize) {
+        setError(`El archivo es demasiado grande (máximo ${formatBytes(maxFileSize)})`)
         return
       }
       setSelectedFile(file)
@@ -134,7 +145,7 @@ export default function UploadModal({ open, onClose, onSuccess, parentId }) {
             Subir Archivo
           </DialogTitle>
           <DialogDescription>
-            Selecciona un archivo para subir a tu almacenamiento (máximo {formatBytes(MAX_FILE_SIZE)}).
+            Selecciona un archivo para subir a tu almacenamiento (máximo {formatBytes(maxFileSize)}).
           </DialogDescription>
         </DialogHeader>
 
@@ -202,7 +213,7 @@ export default function UploadModal({ open, onClose, onSuccess, parentId }) {
                     Haz clic o arrastra un archivo aquí
                   </p>
                   <p className="text-sm text-muted-foreground mt-1">
-                    Máximo {formatBytes(MAX_FILE_SIZE)}
+                    Máximo {formatBytes(maxFileSize)}
                   </p>
                 </div>
               </div>
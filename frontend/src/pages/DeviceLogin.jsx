@@ -0,0 +1,165 @@
+import { useEffect, useState } from 'react'
+import { Link, useSearchParams } from 'react-router-dom'
+import { Cloud, AlertCircle, CheckCircle2, KeyRound, Loader2, Monitor } from 'lucide-react'
+import { authAPI } from '../api/auth'
+import { Button } from '@/components/ui/button'
+import { Input } from '@/components/ui/input'
+import { Label } from '@/components/ui/label'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from '@/components/ui/card'
+
+// Approves a login started by the CLI or another device without a browser, which shows the code
+export default function DeviceLogin() {
+  const [searchParams] = useSearchParams()
+
+  const [userCode, setUserCode] = useState(searchParams.get('user_code') || '')
+  const [device, setDevice] = useState(null)
+  const [result, setResult] = useState('')
+  const [error, setError] = useState('')
+  const [loading, setLoading] = useState(false)
+
+  const lookup = async (code) => {
+    setLoading(true)
+    setError('')
+
+    try {
+      const response = await authAPI.getDeviceAuthorization(code)
+      setDevice(response.data)
+    } catch (err) {
+      setError(err.response?.data?.error === 'invalid or expired code'
+        ? 'El código no es válido o ya expiró'
+        : 'No se pudo verificar el código')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  useEffect(() => {
+    if (userCode) lookup(userCode)
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [])
+
+  const handleSubmit = (e) => {
+    e.preventDefault()
+    lookup(userCode)
+  }
+
+  const decide = async (approve) => {
+    setLoading(true)
+    setError('')
+
+    try {
+      await authAPI.verifyDevice(userCode, approve)
+      setResult(approve
+        ? 'Dispositivo autorizado. Ya puedes volver a la terminal.'
+        : 'Inicio de sesión rechazado.')
+    } catch (err) {
+      setError(err.response?.data?.error || 'No se pudo completar la autorización')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-primary to-primary/80 px-4">
+      <div className="w-full max-w-md">
+        {/* Header */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-background rounded-full mb-4 shadow-lg">
+            <Cloud className="w-10 h-10 text-primary" />
+          </div>
+          <h1 className="text-3xl font-bold text-primary-foreground mb-2">
+            CloudBox
+          </h1>
+        </div>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>Conectar un dispositivo</CardTitle>
+            <CardDescription>
+              Ingresa el código que muestra tu dispositivo para iniciar sesión en él
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {error && (
+              <Alert variant="destructive">
+                <AlertCircle className="h-4 w-4" />
+                <AlertDescription>{error}</AlertDescription>
+              </Alert>
+            )}
+
+            {result ? (
+              <Alert>
+                <CheckCircle2 className="h-4 w-4" />
+                <AlertDescription>{result}</AlertDescription>
+              </Alert>
+            ) : device ? (
+              <div className="space-y-2 text-sm">
+                <div className="flex items-center gap-2 font-medium">
+                  <Monitor className="h-4 w-4" />
+                  {device.user_agent || 'Dispositivo desconocido'}
+                </div>
+                <p className="text-muted-foreground">
+                  Desde {device.ip_address} · {new Date(device.created_at).toLocaleString()}
+                </p>
+                <p className="text-muted-foreground">
+                  Autoriza solo si iniciaste este inicio de sesión. El dispositivo tendrá acceso completo a tu cuenta.
+                </p>
+              </div>
+            ) : (
+              <form onSubmit={handleSubmit} className="space-y-4">
+                <div className="space-y-2">
+                  <Label htmlFor="user_code">Código</Label>
+                  <div className="relative">
+                    <KeyRound className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                    <Input
+                      id="user_code"
+                      value={userCode}
+                      onChange={(e) => {
+                        setUserCode(e.target.value.toUpperCase())
+                        setError('')
+                      }}
+                      className="pl-10 font-mono tracking-widest"
+                      placeholder="XXXX-XXXX"
+                      autoFocus
+                      required
+                      disabled={loading}
+                    />
+                  </div>
+                </div>
+                <Button type="submit" className="w-full" disabled={loading}>
+                  {loading && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+                  Continuar
+                </Button>
+              </form>
+            )}
+          </CardContent>
+          <CardFooter className="flex justify-end gap-2">
+            {device && !result ? (
+              <>
+                <Button variant="outline" onClick={() => decide(false)} disabled={loading}>
+                  Rechazar
+                </Button>
+                <Button onClick={() => decide(true)} disabled={loading}>
+                  {loading && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+                  Autorizar
+                </Button>
+              </>
+            ) : (
+              <Link to="/dashboard" className="text-sm font-medium text-primary hover:underline">
+                Volver a CloudBox
+              </Link>
+            )}
+          </CardFooter>
+        </Card>
+      </div>
+    </div>
+  )
+}
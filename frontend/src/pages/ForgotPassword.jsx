@@ -0,0 +1,122 @@
+import { useState } from 'react'
+import { Link } from 'react-router-dom'
+import { Cloud, Mail, AlertCircle, CheckCircle2, Loader2 } from 'lucide-react'
+import { authAPI } from '../api/auth'
+import { Button } from '@/components/ui/button'
+import { Input } from '@/components/ui/input'
+import { Label } from '@/components/ui/label'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from '@/components/ui/card'
+
+export default function ForgotPassword() {
+  const [email, setEmail] = useState('')
+  const [error, setError] = useState('')
+  const [sent, setSent] = useState(false)
+  const [loading, setLoading] = useState(false)
+
+  const handleSubmit = async (e) => {
+    e.preventDefault()
+    setLoading(true)
+    setError('')
+
+    try {
+      await authAPI.forgotPassword(email)
+      setSent(true)
+    } catch (err) {
+      setError(err.response?.data?.error || 'Error al solicitar el restablecimiento')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-primary to-primary/80 px-4">
+      <div className="w-full max-w-md">
+        {/* Header */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-background rounded-full mb-4 shadow-lg">
+            <Cloud className="w-10 h-10 text-primary" />
+          </div>
+          <h1 className="text-3xl font-bold text-primary-foreground mb-2">
+            CloudBox
+          </h1>
+          <p className="text-primary-foreground/80">
+            Recupera el acceso a tu cuenta
+          </p>
+        </div>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>¿Olvidaste tu contraseña?</CardTitle>
+            <CardDescription>
+              Te enviaremos un enlace para elegir una nueva
+            </CardDescription>
+          </CardHeader>
+          <CardContent>
+            {sent ? (
+              <Alert>
+                <CheckCircle2 className="h-4 w-4" />
+                <AlertDescription>
+                  Si el email está registrado, recibirás un enlace en unos minutos.
+                </AlertDescription>
+              </Alert>
+            ) : (
+              <form onSubmit={handleSubmit} className="space-y-4">
+                {error && (
+                  <Alert variant="destructive">
+                    <AlertCircle className="h-4 w-4" />
+                    <AlertDescription>{error}</AlertDescription>
+                  </Alert>
+                )}
+
+                <div className="space-y-2">
+                  <Label htmlFor="email">Email</Label>
+                  <div className="relative">
+                    <Mail className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                    <Input
+                      id="email"
+                      type="email"
+                      name="email"
+                      value={email}
+                      onChange={(e) => {
+                        setEmail(e.target.value)
+                        setError('')
+                      }}
+                      className="pl-10"
+                      placeholder="tu@email.com"
+                      required
+                      disabled={loading}
+                    />
+                  </div>
+                </div>
+
+                <Button type="submit" className="w-full" disabled={loading}>
+                  {loading ? (
+                    <>
+                      <Loader2 className="mr-2 h-4 w-4 animate-spin" />
+                      Enviando...
+                    </>
+                  ) : (
+                    'Enviar enlace'
+                  )}
+                </Button>
+              </form>
+            )}
+          </CardContent>
+          <CardFooter className="flex justify-center">
+            <Link to="/login" className="text-sm font-medium text-primary hover:underline">
+              Volver a iniciar sesión
+            </Link>
+          </CardFooter>
+        </Card>
+      </div>
+    </div>
+  )
+}
@@ -1,6 +1,6 @@
-import { useState } from 'react'
-import { Link, useNavigate } from 'react-router-dom'
-import { Cloud, Mail, Lock, AlertCircle, Loader2 } from 'lucide-react'
+import { useEffect, useState } from 'react'
+import { Link, useLocation, useNavigate } from 'react-router-dom'
+import { Cloud, Mail, Lock, KeyRound, AlertCircle, Loader2, Building2 } from 'lucide-react'
 import { authAPI } from '../api/auth'
 import { useAuthStore } from '../store/authStore'
 import { Button } from '@/components/ui/button'
@@ -16,16 +16,40 @@ import {
   CardTitle,
 } from '@/components/ui/card'
 
+// Repeated failures are throttled by the server, which answers 429 with a Retry-After header
+function loginError(err, fallback) {
+  if (err.response?.status === 429) {
+    const seconds = Number(err.response.headers?.['retry-after'])
+    if (!seconds) return 'Demasiados intentos fallidos. Intenta de nuevo más tarde.'
+    const wait = seconds >= 60 ? `${Math.ceil(seconds / 60)} min` : `${seconds} s`
+    return `Demasiados intentos fallidos. Intenta de nuevo en ${wait}.`
+  }
+  return err.response?.data?.error || fallback
+}
+
 export default function Login() {
   const navigate = useNavigate()
+  const location = useLocation()
   const setAuth = useAuthStore((state) => state.setAuth)
+  const redirectTo = location.state?.from || '/dashboard'
 
   const [formData, setFormData] = useState({
     email: '',
     password: '',
   })
-  const [error, setError] = useState('')
+  // A single sign-on login of a user with 2FA continues here with the code step
+  const [mfaToken, setMfaToken] = useState(location.state?.mfaToken || '')
+  const [code, setCode] = useState('')
+  const [error, setError] = useState(location.state?.error || '')
   const [loading, setLoading] = useState(false)
+  const [sso, setSso] = useState(null)
+
+  useEffect(() => {
+    authAPI
+      .oidcConfig()
+      .then((response) => setSso(response.data?.enabled ? response.data : null))
+      .catch(() => setSso(null))
+  }, [])
 
   const handleChange = (e) => {
     setFormData({
@@ -42,12 +66,52 @@ export default function Login() {
 
     try {
       const response = await authAPI.login(formData)
+      if (response.success && response.data.mfa_required) {
+        setMfaToken(response.data.mfa_token)
+      } else if (response.success) {
+        setAuth(response.data.token, response.data.user, response.data.refresh_token)
+        navigate(redirectTo)
+      }
+    } catch (err) {
+      setError(loginError(err, 'Error al iniciar sesión'))
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  const handleSsoLogin = async () => {
+    setLoading(true)
+    setError('')
+
+    try {
+      const response = await authAPI.oidcAuthorize()
+      // Checked on the way back, so that only logins started here are completed
+      sessionStorage.setItem('oidc_state', response.data.state)
+      window.location.href = response.data.authorization_url
+    } catch (err) {
+      setError(err.response?.data?.error || 'No se pudo iniciar el inicio de sesión único')
+      setLoading(false)
+    }
+  }
+
+  const handleMfaSubmit = async (e) => {
+    e.preventDefault()
+    setLoading(true)
+    setError('')
+
+    try {
+      const response = await authAPI.loginMFA(mfaToken, code)
       if (response.success) {
-        setAuth(response.data.token, response.data.user)
-        navigate('/dashboard')
+        setAuth(response.data.token, response.data.user, response.data.refresh_token)
+        navigate(redirectTo)
       }
     } catch (err) {
-      setError(err.response?.data?.error || 'Error al iniciar sesión')
+      setError(loginError(err, 'Código incorrecto'))
+      // The challenge is gone once it expires or runs out of attempts
+      if (err.response?.data?.error === 'invalid or expired MFA token') {
+        setMfaToken('')
+        setCode('')
+      }
     } finally {
       setLoading(false)
     }
@@ -78,61 +142,139 @@ export default function Login() {
             </CardDescription>
           </CardHeader>
           <CardContent>
-            <form onSubmit={handleSubmit} className="space-y-4">
-              {error && (
-                <Alert variant="destructive">
-                  <AlertCircle className="h-4 w-4" />
-                  <AlertDescription>{error}</AlertDescription>
-                </Alert>
-              )}
-
-              <div className="space-y-2">
-                <Label htmlFor="email">Email</Label>
-                <div className="relative">
-                  <Mail className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
-                  <Input
-                    id="email"
-                    type="email"
-                    name="email"
-                    value={formData.email}
-                    onChange={handleChange}
-                    className="pl-10"
-                    placeholder="tu@email.com"
-                    required
-                    disabled={loading}
-                  />
+            {mfaToken ? (
+              <form onSubmit={handleMfaSubmit} className="space-y-4">
+                {error && (
+                  <Alert variant="destructive">
+                    <AlertCircle className="h-4 w-4" />
+                    <AlertDescription>{error}</AlertDescription>
+                  </Alert>
+                )}
+
+                <div className="space-y-2">
+                  <Label htmlFor="code">Código de verificación</Label>
+                  <div className="relative">
+                    <KeyRound className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                    <Input
+                      id="code"
+                      name="code"
+                      value={code}
+                      onChange={(e) => {
+                        setCode(e.target.value)
+                        setError('')
+                      }}
+                      className="pl-10"
+                      placeholder="123456"
+                      autoComplete="one-time-code"
+                      autoFocus
+                      required
+                      disabled={loading}
+                    />
+                  </div>
+                  <p className="text-xs text-muted-foreground">
+                    Ingresa el código de tu app de autenticación o uno de tus códigos de recuperación
+                  </p>
                 </div>
-              </div>
-
-              <div className="space-y-2">
-                <Label htmlFor="password">Contraseña</Label>
-                <div className="relative">
-                  <Lock className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
-                  <Input
-                    id="password"
-                    type="password"
-                    name="password"
-                    value={formData.password}
-                    onChange={handleChange}
-                    className="pl-10"
-                    placeholder="••••••••"
-                    required
-                    disabled={loading}
-                  />
+
+                <Button type="submit" className="w-full" disabled={loading}>
+                  {loading ? (
+                    <>
+                      <Loader2 className="mr-2 h-4 w-4 animate-spin" />
+                      Verificando...
+                    </>
+                ) : (
+                    'Verificar'
+                  )}
+                </Button>
+              </form>
+            ) : (
+              <form onSubmit={handleSubmit} className="space-y-4">
+                {error && (
+                  <Alert variant="destructive">
+                    <AlertCircle className="h-4 w-4" />
+                    <AlertDescription>{error}</AlertDescription>
+                  </Alert>
+                )}
+
+                <div className="space-y-2">
+                  <Label htmlFor="email">Email</Label>
+                  <div className="relative">
+                    <Mail className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                    <Input
+                      id="email"
+                      type="email"
+                      name="email"
+                      value={formData.email}
+                      onChange={handleChange}
+                      className="pl-10"
+                      placeholder="tu@email.com"
+                      required
+                      disabled={loading}
+                    />
+                  </div>
                 </div>
-              </div>
 
-              <Button type="submit" className="w-full" disabled={loading}>
-                {loading ? (
+                <div className="space-y-2">
+                  <div className="flex items-center justify-between">
+                    <Label htmlFor="password">Contraseña</Label>
+                    <Link
+                      to="/forgot-password"
+                      className="text-xs text-muted-foreground hover:text-primary hover:underline"
+                    >
+                      ¿Olvidaste tu contraseña?
+                    </Link>
+                  </div>
+                  <div className="relative">
+                    <Lock className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                    <Input
+                      id="password"
+                      type="password"
+                      name="password"
+                      value={formData.password}
+                      onChange={handleChange}
+                      className="pl-10"
+                      placeholder="••••••••"
+                      required
+                      disabled={loading}
+                    />
+                  </div>
+                </div>
+
+                <Button type="submit" className="w-full" disabled={loading}>
+                  {loading ? (
+                    <>
+                      <Loader2 className="mr-2 h-4 w-4 animate-spin" />
+                      Iniciando sesión...
+                    </>
+                ) : (
+                    'Iniciar Sesión'
+                  )}
+                </Button>
+
+                {sso && (
                   <>
-                    <Loader2 className="mr-2 h-4 w-4 animate-spin" />
-                    Iniciando sesión...
+                    <div className="relative">
+                      <div className="absolute inset-0 flex items-center">
+                        <span className="w-full border-t" />
+                      </div>
+                      <div className="relative flex justify-center text-xs uppercase">
+                        <span className="bg-card px-2 text-muted-foreground">o</span>
+                      </div>
+                    </div>
+                    <Button
+                      type="button"
+                      variant="outline"
+                      className="w-full"
+                      onClick={handleSsoLogin}
+                      disabled={loading}
+                    >
+                      <Building2 className="mr-2 h-4 w-4" />
+                      Iniciar sesión con {sso.provider_name}
+                    </Button>
                   </>
-                ) : (
-                  'Iniciar Sesión'
                 )}
-              </Button>
-            </form>
+              </form>
+            )}
           </CardContent>
           <CardFooter className="flex justify-center">
             <p className="text-sm text-muted-foreground">
@@ -0,0 +1,158 @@
+import { useEffect, useRef, useState } from 'react'
+import { useNavigate, useSearchParams } from 'react-router-dom'
+import { Cloud, AlertCircle, Loader2, ShieldCheck } from 'lucide-react'
+import { oauthAPI } from '../api/oauth'
+import { Button } from '@/components/ui/button'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from '@/components/ui/card'
+
+const scopeLabels = {
+  'files:read': 'Ver y descargar tus archivos',
+  'files:write': 'Subir, modificar y eliminar tus archivos',
+  'user:read': 'Ver tu perfil',
+  'user:write': 'Modificar tu perfil',
+}
+
+// The authorization request parameters arrive in the URL and are passed on unchanged
+const requestParams = [
+  'response_type',
+  'client_id',
+  'redirect_uri',
+  'scope',
+  'state',
+  'code_challenge',
+  'code_challenge_method',
+]
+
+export default function OAuthAuthorize() {
+  const [searchParams] = useSearchParams()
+  const navigate = useNavigate()
+
+  const [details, setDetails] = useState(null)
+  const [error, setError] = useState('')
+  const [loading, setLoading] = useState(false)
+  const requested = useRef(false)
+
+  const request = Object.fromEntries(
+    requestParams.map((name) => [name, searchParams.get(name) || ''])
+  )
+
+  // Invalid requests the client can be told about are sent back to it
+  const handleError = (err, fallback) => {
+    const redirectURL = err.response?.data?.data?.redirect_url
+    if (redirectURL) {
+      window.location.href = redirectURL
+      return
+    }
+    setError(err.response?.data?.error || fallback)
+  }
+
+  const decide = async (approve) => {
+    setLoading(true)
+    setError('')
+
+    try {
+      const response = await oauthAPI.authorize({ ...request, approve })
+      window.location.href = response.data.redirect_url
+    } catch (err) {
+      handleError(err, 'No se pudo completar la autorización')
+      setLoading(false)
+    }
+  }
+
+  useEffect(() => {
+    if (requested.current) return
+    requested.current = true
+
+    oauthAPI
+      .getAuthorization(request)
+      .then((response) => {
+        // Scopes the user already granted are not asked for again
+        if (response.data.consented) {
+          decide(true)
+          return
+        }
+        setDetails(response.data)
+      })
+      .catch((err) => handleError(err, 'La solicitud de autorización no es válida'))
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [])
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-primary to-primary/80 px-4">
+      <div className="w-full max-w-md">
+        {/* Header */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-background rounded-full mb-4 shadow-lg">
+            <Cloud className="w-10 h-10 text-primary" />
+          </div>
+          <h1 className="text-3xl font-bold text-primary-foreground mb-2">
+            CloudBox
+          </h1>
+        </div>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>Autorizar aplicación</CardTitle>
+            {details && (
+              <CardDescription>
+                <span className="font-medium text-foreground">{details.client_name}</span>{' '}
+                quiere acceder a tu cuenta de CloudBox
+              </CardDescription>
+            )}
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {error && (
+              <Alert variant="destructive">
+                <AlertCircle className="h-4 w-4" />
+                <AlertDescription>{error}</AlertDescription>
+              </Alert>
+            )}
+
+            {details ? (
+              <ul className="space-y-2">
+                {details.scopes.map((scope) => (
+                  <li key={scope} className="flex items-center gap-2 text-sm">
+                    <ShieldCheck className="h-4 w-4 text-primary" />
+                    {scopeLabels[scope] || scope}
+                  </li>
+                ))}
+              </ul>
+            ) : (
+              !error && (
+                <div className="flex items-center gap-2 text-sm text-muted-foreground">
+                  <Loader2 className="h-4 w-4 animate-spin" />
+                  Cargando...
+                </div>
+              )
+            )}
+          </CardContent>
+          <CardFooter className="flex justify-end gap-2">
+            {details ? (
+              <>
+                <Button variant="outline" onClick={() => decide(false)} disabled={loading}>
+                  Cancelar
+                </Button>
+                <Button onClick={() => decide(true)} disabled={loading}>
+                  {loading && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+                  Autorizar
+                </Button>
+              </>
+            ) : (
+              <Button variant="outline" onClick={() => navigate('/dashboard')}>
+                Volver a CloudBox
+              </Button>
+            )}
+          </CardFooter>
+        </Card>
+      </div>
+    </div>
+  )
+}
@@ -46,7 +46,7 @@ export default function Register() {
     try {
       const response = await authAPI.register(formData)
       if (response.success) {
-        setAuth(response.data.token, response.data.user)
+        setAuth(response.data.token, response.data.user, response.data.refresh_token)
         navigate('/dashboard')
       }
     } catch (err) {
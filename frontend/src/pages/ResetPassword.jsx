@@ -0,0 +1,164 @@
+import { useState } from 'react'
+import { Link, useNavigate, useSearchParams } from 'react-router-dom'
+import { Cloud, Lock, AlertCircle, Loader2 } from 'lucide-react'
+import { authAPI } from '../api/auth'
+import { useToast } from '@/hooks/use-toast'
+import { Button } from '@/components/ui/button'
+import { Input } from '@/components/ui/input'
+import { Label } from '@/components/ui/label'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from '@/components/ui/card'
+
+export default function ResetPassword() {
+  const navigate = useNavigate()
+  const { toast } = useToast()
+  const [searchParams] = useSearchParams()
+  const token = searchParams.get('token') || ''
+
+  const [formData, setFormData] = useState({
+    password: '',
+    confirmPassword: '',
+  })
+  const [error, setError] = useState('')
+  const [loading, setLoading] = useState(false)
+
+  const handleChange = (e) => {
+    setFormData({
+      ...formData,
+      [e.target.name]: e.target.value,
+    })
+    setError('')
+  }
+
+  const handleSubmit = async (e) => {
+    e.preventDefault()
+
+    if (formData.password !== formData.confirmPassword) {
+      setError('Las contraseñas no coinciden')
+      return
+    }
+    if (formData.password.length < 8) {
+      setError('La contraseña debe tener al menos 8 caracteres')
+      return
+    }
+
+    setLoading(true)
+    setError('')
+
+    try {
+      await authAPI.resetPassword(token, formData.password)
+      toast({
+        title: 'Contraseña restablecida',
+        description: 'Ya puedes iniciar sesión con tu nueva contraseña',
+      })
+      navigate('/login')
+    } catch (err) {
+      setError(err.response?.data?.error || 'Error al restablecer la contraseña')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-primary to-primary/80 px-4">
+      <div className="w-full max-w-md">
+        {/* Header */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-background rounded-full mb-4 shadow-lg">
+            <Cloud className="w-10 h-10 text-primary" />
+          </div>
+          <h1 className="text-3xl font-bold text-primary-foreground mb-2">
+            CloudBox
+          </h1>
+          <p className="text-primary-foreground/80">
+            Elige una nueva contraseña
+          </p>
+        </div>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>Restablecer contraseña</CardTitle>
+            <CardDescription>
+              Se cerrará la sesión en todos tus dispositivos
+            </CardDescription>
+          </CardHeader>
+          <CardContent>
+            <form onSubmit={handleSubmit} className="space-y-4">
+              {!token && (
+                <Alert variant="destructive">
+                  <AlertCircle className="h-4 w-4" />
+                  <AlertDescription>El enlace no es válido</AlertDescription>
+                </Alert>
+              )}
+              {error && (
+                <Alert variant="destructive">
+                  <AlertCircle className="h-4 w-4" />
+                  <AlertDescription>{error}</AlertDescription>
+                </Alert>
+              )}
+
+              <div className="space-y-2">
+                <Label htmlFor="password">Nueva contraseña</Label>
+                <div className="relative">
+                  <Lock className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                  <Input
+                    id="password"
+                    type="password"
+                    name="password"
+                    value={formData.password}
+                    onChange={handleChange}
+                    className="pl-10"
+                    placeholder="••••••••"
+                    required
+                    disabled={loading || !token}
+                  />
+                </div>
+              </div>
+
+              <div className="space-y-2">
+                <Label htmlFor="confirmPassword">Confirmar contraseña</Label>
+                <div className="relative">
+                  <Lock className="absolute left-3 top-1/2 -translate-y-1/2 text-muted-foreground w-4 h-4" />
+                  <Input
+                    id="confirmPassword"
+                    type="password"
+                    name="confirmPassword"
+                    value={formData.confirmPassword}
+                    onChange={handleChange}
+                    className="pl-10"
+                    placeholder="••••••••"
+                    required
+                    disabled={loading || !token}
+                  />
+                </div>
+              </div>
+
+              <Button type="submit" className="w-full" disabled={loading || !token}>
+                {loading ? (
+                  <>
+                    <Loader2 className="mr-2 h-4 w-4 animate-spin" />
+                    Guardando...
+                  </>
+                ) : (
+                  'Restablecer contraseña'
+                )}
+              </Button>
+            </form>
+          </CardContent>
+          <CardFooter className="flex justify-center">
+            <Link to="/forgot-password" className="text-sm font-medium text-primary hover:underline">
+              Solicitar un nuevo enlace
+            </Link>
+          </CardFooter>
+        </Card>
+      </div>
+    </div>
+  )
+}
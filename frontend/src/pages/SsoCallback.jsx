@@ -0,0 +1,96 @@
+import { useEffect, useRef, useState } from 'react'
+import { Link, useNavigate, useSearchParams } from 'react-router-dom'
+import { Cloud, AlertCircle, Loader2 } from 'lucide-react'
+import { authAPI } from '../api/auth'
+import { useAuthStore } from '../store/authStore'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import {
+  Card,
+  CardContent,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from '@/components/ui/card'
+
+export default function SsoCallback() {
+  const [searchParams] = useSearchParams()
+  const navigate = useNavigate()
+  const setAuth = useAuthStore((state) => state.setAuth)
+
+  const [error, setError] = useState('')
+  // Authorization codes are single use, so the request must not be repeated on re-render
+  const requested = useRef(false)
+
+  useEffect(() => {
+    if (requested.current) return
+    requested.current = true
+
+    const code = searchParams.get('code')
+    const state = searchParams.get('state')
+    const expectedState = sessionStorage.getItem('oidc_state')
+    sessionStorage.removeItem('oidc_state')
+
+    if (searchParams.get('error')) {
+      setError(searchParams.get('error_description') || 'El proveedor rechazó el inicio de sesión')
+      return
+    }
+    if (!code || !state || state !== expectedState) {
+      setError('El enlace de inicio de sesión no es válido o ya fue usado')
+      return
+    }
+
+    authAPI
+      .oidcCallback(code, state)
+      .then((response) => {
+        if (response.data.mfa_required) {
+          navigate('/login', { replace: true, state: { mfaToken: response.data.mfa_token } })
+          return
+        }
+        setAuth(response.data.token, response.data.user, response.data.refresh_token)
+        navigate('/dashboard', { replace: true })
+      })
+      .catch((err) => {
+        setError(err.response?.data?.error || 'No se pudo iniciar sesión')
+      })
+  }, [searchParams, navigate, setAuth])
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-primary to-primary/80 px-4">
+      <div className="w-full max-w-md">
+        {/* Header */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-background rounded-full mb-4 shadow-lg">
+            <Cloud className="w-10 h-10 text-primary" />
+          </div>
+          <h1 className="text-3xl font-bold text-primary-foreground mb-2">
+            CloudBox
+          </h1>
+        </div>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>Inicio de sesión único</CardTitle>
+          </CardHeader>
+          <CardContent>
+            {error ? (
+              <Alert variant="destructive">
+                <AlertCircle className="h-4 w-4" />
+                <AlertDescription>{error}</AlertDescription>
+              </Alert>
+            ) : (
+              <div className="flex items-center gap-2 text-sm text-muted-foreground">
+                <Loader2 className="h-4 w-4 animate-spin" />
+                Iniciando sesión...
+              </div>
+            )}
+          </CardContent>
+          <CardFooter className="flex justify-center">
+            <Link to="/login" className="text-sm font-medium text-primary hover:underline">
+              Volver al inicio de sesión
+            </Link>
+          </CardFooter>
+        </Card>
+      </div>
+    </div>
+  )
+}
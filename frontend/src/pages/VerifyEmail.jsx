@@ -0,0 +1,99 @@
+import { useEffect, useRef, useState } from 'react'
+import { Link, useSearchParams } from 'react-router-dom'
+import { Cloud, AlertCircle, CheckCircle2, Loader2 } from 'lucide-react'
+import { authAPI } from '../api/auth'
+import { useAuthStore } from '../store/authStore'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import {
+  Card,
+  CardContent,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from '@/components/ui/card'
+
+export default function VerifyEmail() {
+  const [searchParams] = useSearchParams()
+  const token = searchParams.get('token') || ''
+  const { token: accessToken, refreshToken, updateUser, setTokens } = useAuthStore()
+
+  const [status, setStatus] = useState(token ? 'loading' : 'error')
+  const [error, setError] = useState(token ? '' : 'El enlace no es válido')
+  // Tokens are single use, so the request must not be repeated on re-render
+  const requested = useRef(false)
+
+  useEffect(() => {
+    if (!token || requested.current) return
+    requested.current = true
+
+    authAPI
+      .verifyEmail(token)
+      .then(async (response) => {
+        if (accessToken) {
+          updateUser(response.data)
+          // A fresh access token carries the verified email, lifting any restrictions right away
+          if (refreshToken) {
+            const refreshed = await authAPI.refresh(refreshToken).catch(() => null)
+            if (refreshed?.success) {
+              setTokens(refreshed.data.token, refreshed.data.refresh_token)
+            }
+          }
+        }
+        setStatus('success')
+      })
+      .catch((err) => {
+        setError(err.response?.data?.error || 'No se pudo verificar el email')
+        setStatus('error')
+      })
+  }, [token, accessToken, refreshToken, updateUser, setTokens])
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-primary to-primary/80 px-4">
+      <div className="w-full max-w-md">
+        {/* Header */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-background rounded-full mb-4 shadow-lg">
+            <Cloud className="w-10 h-10 text-primary" />
+          </div>
+          <h1 className="text-3xl font-bold text-primary-foreground mb-2">
+            CloudBox
+          </h1>
+        </div>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>Verificación de email</CardTitle>
+          </CardHeader>
+          <CardContent>
+            {status === 'loading' && (
+              <div className="flex items-center gap-2 text-sm text-muted-foreground">
+                <Loader2 className="h-4 w-4 animate-spin" />
+                Verificando...
+              </div>
+            )}
+            {status === 'success' && (
+              <Alert>
+                <CheckCircle2 className="h-4 w-4" />
+                <AlertDescription>Tu email ha sido verificado.</AlertDescription>
+              </Alert>
+            )}
+            {status === 'error' && (
+              <Alert variant="destructive">
+                <AlertCircle className="h-4 w-4" />
+                <AlertDescription>{error}</AlertDescription>
+              </Alert>
+            )}
+          </CardContent>
+          <CardFooter className="flex justify-center">
+            <Link
+              to={accessToken ? '/dashboard' : '/login'}
+              className="text-sm font-medium text-primary hover:underline"
+            >
+              {accessToken ? 'Ir a mis archivos' : 'Iniciar sesión'}
+            </Link>
+          </CardFooter>
+        </Card>
+      </div>
+    </div>
+  )
+}
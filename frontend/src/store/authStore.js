@@ -5,11 +5,14 @@ export const useAuthStore = create(
   persist(
     (set) => ({
       token: null,
+      refreshToken: null,
       user: null,
 
-      setAuth: (token, user) => set({ token, user }),
+      setAuth: (token, user, refreshToken) => set({ token, user, refreshToken }),
 
-      logout: () => set({ token: null, user: null }),
+      setTokens: (token, refreshToken) => set({ token, refreshToken }),
+
+      logout: () => set({ token: null, user: null, refreshToken: null }),
 
       updateUser: (userData) => set((state) => ({
         user: { ...state.user, ...userData }
@@ -17,6 +17,11 @@ func main() {
 
 	// Setup Gin router
 	router := gin.Default()
+	// Clients reach the gateway directly, so a client's X-Forwarded-For is never trusted; the
+	// services get the real client IP from the gateway instead
+	if err := router.SetTrustedProxies(nil); err != nil {
+		log.Fatal("Failed to configure trusted proxies:", err)
+	}
 	router.Use(middleware.CORS())
 
 	// Health check
@@ -27,6 +32,9 @@ func main() {
 	// Initialize proxy handler
 	proxyHandler := handler.NewProxyHandler(cfg, logger)
 
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", proxyHandler.ProxyToAuth)
+
 	// API routes
 	api := router.Group("/api/v1")
 	{
@@ -35,7 +43,46 @@ func main() {
 		{
 			auth.POST("/register", proxyHandler.ProxyToAuth)
 			auth.POST("/login", proxyHandler.ProxyToAuth)
+			auth.POST("/login/mfa", proxyHandler.ProxyToAuth)
+			auth.POST("/refresh", proxyHandler.ProxyToAuth)
 			auth.POST("/verify", proxyHandler.ProxyToAuth)
+			auth.POST("/logout", proxyHandler.ProxyToAuth)
+			auth.POST("/logout-all", proxyHandler.ProxyToAuth)
+			auth.POST("/password", proxyHandler.ProxyToAuth)
+			auth.POST("/password/forgot", proxyHandler.ProxyToAuth)
+			auth.POST("/password/reset", proxyHandler.ProxyToAuth)
+			auth.POST("/email/verify", proxyHandler.ProxyToAuth)
+			auth.POST("/email/verify/resend", proxyHandler.ProxyToAuth)
+			auth.GET("/oidc", proxyHandler.ProxyToAuth)
+			auth.POST("/oidc/authorize", proxyHandler.ProxyToAuth)
+			auth.POST("/oidc/callback", proxyHandler.ProxyToAuth)
+			auth.POST("/device/code", proxyHandler.ProxyToAuth)
+			auth.POST("/device/token", proxyHandler.ProxyToAuth)
+			auth.GET("/device", proxyHandler.ProxyToAuth)
+			auth.POST("/device/verify", proxyHandler.ProxyToAuth)
+			auth.POST("/2fa/enroll", proxyHandler.ProxyToAuth)
+			auth.POST("/2fa/confirm", proxyHandler.ProxyToAuth)
+			auth.POST("/2fa/disable", proxyHandler.ProxyToAuth)
+			auth.POST("/tokens", proxyHandler.ProxyToAuth)
+			auth.GET("/tokens", proxyHandler.ProxyToAuth)
+			auth.DELETE("/tokens/:id", proxyHandler.ProxyToAuth)
+			auth.GET("/sessions", proxyHandler.ProxyToAuth)
+			auth.DELETE("/sessions/:id", proxyHandler.ProxyToAuth)
+		}
+
+		// OAuth 2.0 authorization server
+		oauth := api.Group("/oauth")
+		{
+			oauth.POST("/token", proxyHandler.ProxyToAuth)
+			oauth.POST("/introspect", proxyHandler.ProxyToAuth)
+			oauth.POST("/revoke", proxyHandler.ProxyToAuth)
+			oauth.GET("/authorize", proxyHandler.ProxyToAuth)
+			oauth.POST("/authorize", proxyHandler.ProxyToAuth)
+			oauth.POST("/clients", proxyHandler.ProxyToAuth)
+			oauth.GET("/clients", proxyHandler.ProxyToAuth)
+			oauth.DELETE("/clients/:id", proxyHandler.ProxyToAuth)
+			oauth.GET("/consents", proxyHandler.ProxyToAuth)
+			oauth.DELETE("/consents/:client_id", proxyHandler.ProxyToAuth)
 		}
 
 		// User routes
@@ -43,17 +90,44 @@ func main() {
 		{
 			users.GET("/me", proxyHandler.ProxyToUser)
 			users.PUT("/me", proxyHandler.ProxyToUser)
-			users.POST("/storage", proxyHandler.ProxyToUser)
+			users.GET("/me/plan", proxyHandler.ProxyToUser)
+			users.POST("/me/deletion", proxyHandler.ProxyToUser)
+			users.DELETE("/me/deletion", proxyHandler.ProxyToUser)
+			users.GET("/me/audit", proxyHandler.ProxyToUser)
+			users.GET("/me/audit/export", proxyHandler.ProxyToUser)
 			users.GET("/:id", proxyHandler.ProxyToUser)
 		}
 
+		// Admin routes
+		admin := api.Group("/admin")
+		{
+			admin.POST("/storage/reconcile", proxyHandler.ProxyToUser)
+			admin.GET("/users", proxyHandler.ProxyToUser)
+			admin.GET("/users/:id", proxyHandler.ProxyToUser)
+			admin.POST("/users/:id/activate", proxyHandler.ProxyToUser)
+			admin.POST("/users/:id/deactivate", proxyHandler.ProxyToUser)
+			admin.PUT("/users/:id/storage-limit", proxyHandler.ProxyToUser)
+			admin.PUT("/users/:id/roles", proxyHandler.ProxyToUser)
+			admin.PUT("/users/:id/plan", proxyHandler.ProxyToUser)
+			admin.POST("/users/:id/logout", proxyHandler.ProxyToAuth)
+			admin.POST("/users/:id/impersonate", proxyHandler.ProxyToAuth)
+			admin.PUT("/workspaces/:id/plan", proxyHandler.ProxyToFile)
+			admin.PUT("/workspaces/:id/storage-limit", proxyHandler.ProxyToFile)
+			admin.GET("/plans", proxyHandler.ProxyToUser)
+			admin.POST("/plans", proxyHandler.ProxyToUser)
+			admin.PUT("/plans/:id", proxyHandler.ProxyToUser)
+			admin.GET("/audit", proxyHandler.ProxyToUser)
+			admin.GET("/audit/export", proxyHandler.ProxyToUser)
+		}
+
 		// File routes
 		files := api.Group("/files")
 		{
-			files.POST("/upload", proxyHandler.UploadFile)
+			files.POST("/upload", proxyHandler.ProxyToFile)
 			files.GET("/", proxyHandler.ProxyToFile)
+			files.GET("/usage", proxyHandler.ProxyToFile)
 			files.GET("/:id/download", proxyHandler.ProxyToFile)
-			files.DELETE("/:id", proxyHandler.DeleteFile)
+			files.DELETE("/:id", proxyHandler.ProxyToFile)
 
 			// Folder routes
 			files.POST("/folders", proxyHandler.ProxyToFile)
@@ -63,7 +137,29 @@ func main() {
 			files.GET("/:id/versions", proxyHandler.ProxyToFile)
 			files.GET("/:id/versions/:version/download", proxyHandler.ProxyToFile)
 			files.POST("/:id/versions/:version/restore", proxyHandler.ProxyToFile)
-			files.DELETE("/:id/versions/:version", proxyHandler.DeleteFileVersion)
+			files.DELETE("/:id/versions/:version", proxyHandler.ProxyToFile)
+		}
+
+		// Workspace routes
+		workspaces := api.Group("/workspaces")
+		{
+			workspaces.GET("", proxyHandler.ProxyToFile)
+			workspaces.POST("", proxyHandler.ProxyToFile)
+			workspaces.GET("/:id", proxyHandler.ProxyToFile)
+			workspaces.PUT("/:id", proxyHandler.ProxyToFile)
+			workspaces.DELETE("/:id", proxyHandler.ProxyToFile)
+			workspaces.POST("/:id/members", proxyHandler.ProxyToFile)
+			workspaces.PUT("/:id/members/:user_id", proxyHandler.ProxyToFile)
+			workspaces.DELETE("/:id/members/:user_id", proxyHandler.ProxyToFile)
+		}
+
+		// Data export routes
+		exports := api.Group("/exports")
+		{
+			exports.POST("", proxyHandler.ProxyToFile)
+			exports.GET("", proxyHandler.ProxyToFile)
+			exports.GET("/:id", proxyHandler.ProxyToFile)
+			exports.GET("/:id/download", proxyHandler.ProxyToFile)
 		}
 	}
 
@@ -2,15 +2,28 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/handler"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/ldapauth"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/loginguard"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/oidc"
 	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
 	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/accountpurge"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
 	"github.com/joaquinidiarte/cloudbox/shared/config"
+	"github.com/joaquinidiarte/cloudbox/shared/jwks"
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
 	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/redisclient"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
 	"github.com/joaquinidiarte/cloudbox/shared/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -40,30 +53,213 @@ func main() {
 	// Initialize database
 	db := mongoClient.Database(cfg.MongoDatabase)
 
-	// Initialize JWT manager
+	redisClient, err := redisclient.New(cfg, logger)
+	if err != nil {
+		log.Fatal("Failed to connect to Redis:", err)
+	}
+
+	// Initialize JWT manager. With a signing key directory tokens are signed with rotating
+	// asymmetric keys, published at /.well-known/jwks.json for the other services.
 	tokenDuration, _ := time.ParseDuration(cfg.JWTExpiration)
-	jwtManager := utils.NewJWTManager(cfg.JWTSecret, tokenDuration)
+	var jwtManager *utils.JWTManager
+	var keyring *jwks.Keyring
+	if cfg.JWTSigningKeysDir != "" {
+		keyring, err = jwks.NewKeyring(cfg.JWTSigningKeysDir, cfg.JWTSigningAlgorithm, tokenDuration, logger)
+		if err != nil {
+			log.Fatal("Failed to load signing keys:", err)
+		}
+		jwtManager = utils.NewKeySetJWTManager(keyring, tokenDuration)
+	} else {
+		if err := jwks.CheckSharedSecret(cfg, "JWT_SIGNING_KEYS_DIR"); err != nil {
+			log.Fatal("Refusing to sign tokens with the shared secret:", err)
+		}
+		logger.Warn("JWT_SIGNING_KEYS_DIR is not set, signing tokens with the shared JWT_SECRET")
+		jwtManager = utils.NewJWTManager(cfg.JWTSecret, tokenDuration)
+	}
+	revocations := revocation.NewStore(redisClient, tokenDuration)
+	refreshTokenTTL, err := time.ParseDuration(cfg.RefreshTokenExpiration)
+	if err != nil {
+		refreshTokenTTL = 30 * 24 * time.Hour
+	}
+	resetTokenTTL, err := time.ParseDuration(cfg.PasswordResetExpiration)
+	if err != nil {
+		resetTokenTTL = time.Hour
+	}
+	verificationTokenTTL, err := time.ParseDuration(cfg.EmailVerificationExpiration)
+	if err != nil {
+		verificationTokenTTL = 24 * time.Hour
+	}
+	tokenTTLs := service.TokenTTLs{
+		RefreshToken:      refreshTokenTTL,
+		PasswordReset:     resetTokenTTL,
+		EmailVerification: verificationTokenTTL,
+	}
+
+	// Failed login tracking, shared through Redis when available
+	lockoutDuration, err := time.ParseDuration(cfg.LoginLockoutDuration)
+	if err != nil {
+		lockoutDuration = 15 * time.Minute
+	}
+	loginGuard := loginguard.NewGuard(
+		loginguard.NewStore(redisClient),
+		loginguard.Policy{
+			FreeAttempts:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         time.Minute,
+			LockoutThreshold: cfg.LoginMaxAttempts,
+			LockoutDuration:  lockoutDuration,
+			Window:           time.Hour,
+		},
+		loginguard.Policy{
+			FreeAttempts:     20,
+			BaseDelay:        time.Second,
+			MaxDelay:         time.Minute,
+			LockoutThreshold: cfg.LoginIPMaxAttempts,
+			LockoutDuration:  lockoutDuration,
+			Window:           time.Hour,
+		},
+	)
 
 	// Initialize layers
 	userRepo := repository.NewUserRepository(db)
-	authService := service.NewAuthService(userRepo, jwtManager)
+	if err := userRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Failed to create user indexes:", err)
+	}
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	emailVerificationRepo := repository.NewEmailVerificationRepository(db)
+	mfaChallengeRepo := repository.NewMFAChallengeRepository(db)
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	oidcStateRepo := repository.NewOIDCStateRepository(db)
+	deviceAuthorizationRepo := repository.NewDeviceAuthorizationRepository(db)
+	emailSender := mailer.New(cfg, logger)
+	auditLog := audit.NewRecorder(db, "auth-service", logger)
+	authProviders := []service.AuthProvider{service.NewPasswordProvider(userRepo)}
+	if cfg.LDAPURL != "" {
+		authProviders = append(authProviders, ldapProvider(cfg, userRepo, logger))
+	}
+	authService := service.NewAuthService(userRepo, refreshTokenRepo, sessionRepo, passwordResetRepo, emailVerificationRepo, mfaChallengeRepo, accessTokenRepo, oidcStateRepo, deviceAuthorizationRepo, jwtManager, revocations, loginGuard, authProviders, emailSender, logger, auditLog, tokenTTLs, cfg.FrontendURL, ssoConfig(cfg, logger))
 	authHandler := handler.NewAuthHandler(authService, logger)
+	oauthService := service.NewOAuthService(
+		repository.NewOAuthClientRepository(db),
+		repository.NewOAuthConsentRepository(db),
+		repository.NewOAuthCodeRepository(db),
+		repository.NewOAuthRefreshTokenRepository(db),
+		userRepo, jwtManager, revocations, logger, auditLog, refreshTokenTTL,
+	)
+	oauthHandler := handler.NewOAuthHandler(oauthService, logger)
+
+	// "auth-service rotate-keys" adds a signing key, used once it has been published for a while
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		runRotateKeysCommand(keyring)
+		return
+	}
+
+	if keyring != nil {
+		rotationInterval, err := time.ParseDuration(cfg.JWTKeyRotationInterval)
+		if err != nil {
+			rotationInterval = 30 * 24 * time.Hour
+		}
+		go keyring.Run(context.Background(), rotationInterval)
+	}
+
+	// Remove the tokens and sessions of deleted accounts
+	purgeInterval, err := time.ParseDuration(cfg.AccountPurgeInterval)
+	if err != nil {
+		purgeInterval = 5 * time.Minute
+	}
+	accountData := repository.NewAccountDataRepository(db)
+	go accountpurge.NewWorker(db, "auth-service", accountData.DeleteUserData, auditLog, logger, purgeInterval).Run(context.Background())
 
 	// Setup Gin router
 	router := gin.Default()
-	router.Use(middleware.CORS())
+	if err := middleware.TrustProxies(router, cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	router.Use(middleware.CORS(), middleware.AuditContext())
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "healthy", "service": "auth-service"})
 	})
 
+	// Public signing keys
+	if keyring != nil {
+		router.GET("/.well-known/jwks.json", handler.NewJWKSHandler(keyring).GetJWKS)
+	}
+
 	// Auth routes
 	v1 := router.Group("/api/v1/auth")
 	{
 		v1.POST("/register", authHandler.Register)
 		v1.POST("/login", authHandler.Login)
+		v1.POST("/login/mfa", authHandler.LoginMFA)
+		v1.POST("/refresh", authHandler.Refresh)
 		v1.POST("/verify", authHandler.VerifyToken)
+		v1.POST("/password/forgot", authHandler.ForgotPassword)
+		v1.POST("/password/reset", authHandler.ResetPassword)
+		v1.POST("/email/verify", authHandler.VerifyEmail)
+		v1.GET("/oidc", authHandler.GetOIDCConfig)
+		v1.POST("/oidc/authorize", authHandler.StartOIDCLogin)
+		v1.POST("/oidc/callback", authHandler.CompleteOIDCLogin)
+		v1.POST("/device/code", authHandler.StartDeviceAuthorization)
+		v1.POST("/device/token", authHandler.PollDeviceToken)
+	}
+
+	// Authenticated auth routes
+	protected := router.Group("/api/v1/auth")
+	// Account management needs a login session; personal access tokens and OAuth client tokens
+	// are not accepted
+	protected.Use(middleware.AuthMiddleware(jwtManager, revocations, nil), middleware.RequireSession())
+	{
+		protected.POST("/logout", authHandler.Logout)
+		protected.POST("/logout-all", authHandler.LogoutAll)
+		protected.POST("/password", authHandler.ChangePassword)
+		protected.POST("/email/verify/resend", authHandler.ResendVerification)
+		protected.POST("/2fa/enroll", authHandler.EnrollTOTP)
+		protected.POST("/2fa/confirm", authHandler.ConfirmTOTP)
+		protected.POST("/2fa/disable", authHandler.DisableTOTP)
+		protected.POST("/tokens", authHandler.CreateAccessToken)
+		protected.GET("/tokens", authHandler.ListAccessTokens)
+		protected.DELETE("/tokens/:id", authHandler.RevokeAccessToken)
+		protected.GET("/sessions", authHandler.ListSessions)
+		protected.DELETE("/sessions/:id", authHandler.RevokeSession)
+		protected.GET("/device", authHandler.GetDeviceAuthorization)
+		protected.POST("/device/verify", authHandler.VerifyDevice)
+	}
+
+	// Session administration for signed-in admins
+	admin := router.Group("/api/v1/admin/users")
+	admin.Use(
+		middleware.AuthMiddleware(jwtManager, revocations, nil),
+		middleware.RequireSession(),
+		middleware.RequireRole(models.RoleAdmin),
+	)
+	{
+		admin.POST("/:id/logout", authHandler.ForceLogout)
+		admin.POST("/:id/impersonate", authHandler.Impersonate)
+	}
+
+	// OAuth 2.0 endpoints called by third-party clients, which authenticate themselves
+	oauth := router.Group("/api/v1/oauth")
+	{
+		oauth.POST("/token", oauthHandler.Token)
+		oauth.POST("/introspect", oauthHandler.Introspect)
+		oauth.POST("/revoke", oauthHandler.Revoke)
+	}
+
+	// OAuth consent and client management for the signed-in user
+	oauthUser := router.Group("/api/v1/oauth")
+	oauthUser.Use(middleware.AuthMiddleware(jwtManager, revocations, nil), middleware.RequireSession())
+	{
+		oauthUser.GET("/authorize", oauthHandler.GetAuthorization)
+		oauthUser.POST("/authorize", oauthHandler.Authorize)
+		oauthUser.POST("/clients", oauthHandler.CreateClient)
+		oauthUser.GET("/clients", oauthHandler.ListClients)
+		oauthUser.DELETE("/clients/:id", oauthHandler.RevokeClient)
+		oauthUser.GET("/consents", oauthHandler.ListConsents)
+		oauthUser.DELETE("/consents/:client_id", oauthHandler.RevokeConsent)
 	}
 
 	// Start server
@@ -76,3 +272,69 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// ssoConfig sets up single sign-on when an OIDC issuer is configured
+func ssoConfig(cfg *config.Config, logger *utils.Logger) service.SSOConfig {
+	if cfg.OIDCIssuer == "" {
+		return service.SSOConfig{}
+	}
+
+	redirectURL := cfg.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(cfg.FrontendURL, "/") + "/sso/callback"
+	}
+	var allowedDomains []string
+	for _, domain := range strings.Split(cfg.OIDCAllowedDomains, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			allowedDomains = append(allowedDomains, domain)
+		}
+	}
+
+	logger.Infof("Single sign-on enabled with issuer %s", cfg.OIDCIssuer)
+	return service.SSOConfig{
+		Provider: oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			DiscoveryURL: cfg.OIDCDiscoveryURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		}, logger),
+		Issuer:          cfg.OIDCIssuer,
+		ProviderName:    cfg.OIDCProviderName,
+		AllowedDomains:  allowedDomains,
+		AutoCreateUsers: cfg.OIDCAutoCreateUsers,
+	}
+}
+
+// ldapProvider sets up password login against the configured LDAP directory
+func ldapProvider(cfg *config.Config, userRepo repository.UserRepository, logger *utils.Logger) service.AuthProvider {
+	if cfg.LDAPBindDN == "" {
+		logger.Warn("LDAP_BIND_DN is not set, looking up directory users anonymously")
+	}
+	logger.Infof("Directory login enabled with %s", cfg.LDAPURL)
+	return service.NewLDAPProvider(ldapauth.NewDirectory(ldapauth.Config{
+		URL:                cfg.LDAPURL,
+		StartTLS:           cfg.LDAPStartTLS,
+		BindDN:             cfg.LDAPBindDN,
+		BindPassword:       cfg.LDAPBindPassword,
+		BaseDN:             cfg.LDAPBaseDN,
+		UserFilter:         cfg.LDAPUserFilter,
+		EmailAttribute:     cfg.LDAPEmailAttribute,
+		UsernameAttribute:  cfg.LDAPUsernameAttribute,
+		FirstNameAttribute: cfg.LDAPFirstNameAttribute,
+		LastNameAttribute:  cfg.LDAPLastNameAttribute,
+		IDAttribute:        cfg.LDAPIDAttribute,
+	}), userRepo, logger, cfg.LDAPAutoCreateUsers)
+}
+
+func runRotateKeysCommand(keyring *jwks.Keyring) {
+	if keyring == nil {
+		log.Fatal("JWT_SIGNING_KEYS_DIR is not set")
+	}
+	kid, err := keyring.Rotate()
+	if err != nil {
+		log.Fatal("Failed to rotate signing key:", err)
+	}
+	fmt.Printf("Generated signing key %s, used for new tokens after %s\n", kid, jwks.PublishDelay)
+}
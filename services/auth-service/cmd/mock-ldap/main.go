@@ -0,0 +1,66 @@
+// mock-ldap serves a small fixed directory for trying LDAP login locally. It lives next to the
+// auth-service because it reuses its in-process test server; it must never be exposed outside
+// development.
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/ldapauth/ldaptest"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// Accounts of the directory, under dc=cloudbox,dc=local
+var entries = []ldaptest.Entry{
+	{
+		DN:       "cn=admin,dc=cloudbox,dc=local",
+		Password: "admin",
+	},
+	{
+		DN:       "uid=alice,ou=people,dc=cloudbox,dc=local",
+		Password: "alice-password",
+		Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"uid":         {"alice"},
+			"mail":        {"alice@cloudbox.local"},
+			"givenName":   {"Alice"},
+			"sn":          {"Anderson"},
+			"entryUUID":   {"6f1d6c9e-7a57-4c1c-9a57-0e4f7c2b8a01"},
+		},
+	},
+	{
+		DN:       "uid=bob,ou=people,dc=cloudbox,dc=local",
+		Password: "bob-password",
+		Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"uid":         {"bob"},
+			"mail":        {"bob@cloudbox.local"},
+			"givenName":   {"Bob"},
+			"sn":          {"Brown"},
+			"entryUUID":   {"0b8c3a43-2d1e-4f3b-8d0e-5b6f1e9c7d02"},
+		},
+	},
+}
+
+func main() {
+	logger := utils.NewLogger("mock-ldap")
+
+	addr := os.Getenv("MOCK_LDAP_ADDR")
+	if addr == "" {
+		addr = ":389"
+	}
+
+	server, err := ldaptest.Listen(addr, entries)
+	if err != nil {
+		log.Fatal("Failed to start server:", err)
+	}
+	logger.Infof("Mock LDAP directory listening on %s", addr)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	server.Close()
+}
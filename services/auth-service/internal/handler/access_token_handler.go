@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+func (h *AuthHandler) CreateAccessToken(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, err := h.authService.CreateAccessToken(c.Request.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccessTokenRequest) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to create access token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to create access token"))
+		return
+	}
+
+	h.logger.Infof("Access token %s created by user %s", response.AccessToken.ID, userID)
+	c.JSON(http.StatusCreated, models.SuccessResponse(response, "Access token created. Copy it now, it will not be shown again"))
+}
+
+func (h *AuthHandler) ListAccessTokens(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	tokens, err := h.authService.ListAccessTokens(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("Failed to list access tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to list access tokens"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(tokens, "Access tokens retrieved successfully"))
+}
+
+func (h *AuthHandler) RevokeAccessToken(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	tokenID := c.Param("id")
+	if err := h.authService.RevokeAccessToken(c.Request.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, repository.ErrAccessTokenNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to revoke access token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to revoke access token"))
+		return
+	}
+
+	h.logger.Infof("Access token %s revoked by user %s", tokenID, userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Access token revoked successfully"))
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// ForceLogout ends every session of the user, for admins
+func (h *AuthHandler) ForceLogout(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	if err := h.authService.ForceLogout(c.Request.Context(), actorID, c.Param("id")); err != nil {
+		h.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "User logged out of all sessions"))
+}
+
+// Impersonate returns an access token for acting as the user, for support admins
+func (h *AuthHandler) Impersonate(c *gin.Context) {
+	claims, exists := middleware.GetClaims(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	response, err := h.authService.Impersonate(c.Request.Context(), claims, c.Param("id"))
+	if err != nil {
+		h.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Impersonation started"))
+}
+
+func (h *AuthHandler) respondAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, service.ErrImpersonationNotAllowed), errors.Is(err, service.ErrAccountInactive):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Admin request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Admin request failed"))
+	}
+}
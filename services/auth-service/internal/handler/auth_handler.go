@@ -1,10 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
 	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
 	"github.com/joaquinidiarte/cloudbox/shared/utils"
 )
@@ -29,7 +34,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Register(c.Request.Context(), req)
+	response, err := h.authService.Register(c.Request.Context(), req, clientInfo(c))
 	if err != nil {
 		h.logger.Errorf("Registration failed: %v", err)
 		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
@@ -48,10 +53,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(c.Request.Context(), req)
+	response, challenge, err := h.authService.Login(c.Request.Context(), req, clientInfo(c))
 	if err != nil {
 		h.logger.Errorf("Login failed: %v", err)
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse(err.Error()))
+		respondLoginError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, models.SuccessResponse(challenge, "Two-factor authentication required"))
 		return
 	}
 
@@ -59,6 +68,260 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(response, "Login successful"))
 }
 
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, err := h.authService.CompleteMFALogin(c.Request.Context(), req, clientInfo(c))
+	if err != nil {
+		h.logger.Errorf("Two-factor login failed: %v", err)
+		respondLoginError(c, err)
+		return
+	}
+
+	h.logger.Infof("User logged in with two-factor authentication: %s", response.User.Email)
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Login successful"))
+}
+
+// respondLoginError answers throttled logins with 429 and a Retry-After header, and logins that
+// could not be checked because a provider or the failed attempt counters are down with 503
+func respondLoginError(c *gin.Context, err error) {
+	var throttled *service.ThrottledError
+	if errors.As(err, &throttled) {
+		seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse(err.Error()))
+		return
+	}
+	if errors.Is(err, service.ErrAuthProviderUnavailable) || errors.Is(err, service.ErrLoginGuardUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusUnauthorized, models.ErrorResponse(err.Error()))
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, err := h.authService.Refresh(c.Request.Context(), req.Token, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			h.logger.Warnf("Refresh token reuse detected, token family revoked")
+		} else {
+			h.logger.Errorf("Token refresh failed: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Token refreshed successfully"))
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, exists := middleware.GetClaims(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	// The refresh token is optional; without it only the access token is revoked
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+			return
+		}
+	}
+
+	if err := h.authService.Logout(c.Request.Context(), claims, req.RefreshToken); err != nil {
+		h.logger.Errorf("Logout failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to log out"))
+		return
+	}
+
+	h.logger.Infof("User logged out: %s", claims.UserID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Logged out successfully"))
+}
+
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	if err := h.authService.LogoutAll(c.Request.Context(), userID); err != nil {
+		h.logger.Errorf("Logout of all sessions failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to log out"))
+		return
+	}
+
+	h.logger.Infof("User logged out of all sessions: %s", userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Logged out of all sessions successfully"))
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, err := h.authService.ChangePassword(c.Request.Context(), userID, req, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrIncorrectPassword) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Password change failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to change password"))
+		return
+	}
+
+	h.logger.Infof("Password changed for user: %s", userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Password changed successfully"))
+}
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	if err := h.authService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		h.logger.Errorf("Password reset request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to request password reset"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "If the email is registered, a reset link has been sent"))
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req); err != nil {
+		if errors.Is(err, repository.ErrResetTokenInvalid) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Password reset failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to reset password"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Password reset successfully"))
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	user, err := h.authService.VerifyEmail(c.Request.Context(), req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrVerificationTokenInvalid):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		case errors.Is(err, service.ErrEmailTaken):
+			c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+		default:
+			h.logger.Errorf("Email verification failed: %v", err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to verify email"))
+		}
+		return
+	}
+
+	h.logger.Infof("Email verified for user: %s", user.ID)
+	c.JSON(http.StatusOK, models.SuccessResponse(user, "Email verified successfully"))
+}
+
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	if err := h.authService.ResendVerification(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to resend verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to send verification email"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Verification email sent"))
+}
+
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	claims, exists := middleware.GetClaims(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.logger.Errorf("Failed to list sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to list sessions"))
+		return
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, session.ToResponse(claims.SessionID))
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Sessions retrieved successfully"))
+}
+
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	sessionID := c.Param("id")
+	if err := h.authService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to revoke session: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to revoke session"))
+		return
+	}
+
+	h.logger.Infof("Session %s revoked by user %s", sessionID, userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Session revoked successfully"))
+}
+
 func (h *AuthHandler) VerifyToken(c *gin.Context) {
 	var req struct {
 		Token string `json:"token" binding:"required"`
@@ -76,3 +339,11 @@ func (h *AuthHandler) VerifyToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.SuccessResponse(claims, "Token is valid"))
 }
+
+// clientInfo describes the client of a request for the session it creates or refreshes
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// StartDeviceAuthorization is the device authorization endpoint (RFC 8628 section 3.1). Like
+// the token polling endpoint it is called by the device and answers in plain RFC JSON.
+func (h *AuthHandler) StartDeviceAuthorization(c *gin.Context) {
+	response, err := h.authService.StartDeviceAuthorization(c.Request.Context(), clientInfo(c))
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// PollDeviceToken is polled by the device until the user approves or denies the login
+func (h *AuthHandler) PollDeviceToken(c *gin.Context) {
+	var req models.DeviceTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondOAuthError(c, h.logger, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+
+	response, err := h.authService.PollDeviceToken(c.Request.Context(), req)
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+
+	// The refresh token is a regular session refresh token, used with /auth/refresh
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.OAuthTokenResponse{
+		AccessToken:  response.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    response.ExpiresAt - time.Now().Unix(),
+		RefreshToken: response.RefreshToken,
+	})
+}
+
+func (h *AuthHandler) GetDeviceAuthorization(c *gin.Context) {
+	details, err := h.authService.GetDeviceAuthorization(c.Request.Context(), c.Query("user_code"))
+	if err != nil {
+		h.respondDeviceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(details, "Device is waiting for approval"))
+}
+
+func (h *AuthHandler) VerifyDevice(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.DeviceVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	if err := h.authService.VerifyDevice(c.Request.Context(), userID, req); err != nil {
+		h.respondDeviceError(c, err)
+		return
+	}
+
+	message := "Device login denied"
+	if req.Approve {
+		message = "Device login approved"
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, message))
+}
+
+func (h *AuthHandler) respondDeviceError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrUserCodeInvalid) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+		return
+	}
+	h.logger.Errorf("Device login failed: %v", err)
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse("Device login failed"))
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/jwks"
+)
+
+type JWKSHandler struct {
+	keyring *jwks.Keyring
+}
+
+func NewJWKSHandler(keyring *jwks.Keyring) *JWKSHandler {
+	return &JWKSHandler{keyring: keyring}
+}
+
+// GetJWKS serves the public signing keys as a standard JWK set, not wrapped in an API response
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwks.CacheTTL.Seconds())))
+	c.JSON(http.StatusOK, h.keyring.JWKS())
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	enrollment, err := h.authService.EnrollTOTP(c.Request.Context(), userID)
+	if err != nil {
+		h.respondMFAError(c, "Failed to start two-factor enrollment", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(enrollment, "Scan the code with your authenticator app and confirm it"))
+}
+
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	codes, err := h.authService.ConfirmTOTP(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		h.respondMFAError(c, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	h.logger.Infof("Two-factor authentication enabled for user: %s", userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(codes, "Two-factor authentication enabled. Store the recovery codes safely"))
+}
+
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	if err := h.authService.DisableTOTP(c.Request.Context(), userID, req.Code); err != nil {
+		h.respondMFAError(c, "Failed to disable two-factor authentication", err)
+		return
+	}
+
+	h.logger.Infof("Two-factor authentication disabled for user: %s", userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Two-factor authentication disabled"))
+}
+
+// respondMFAError maps the 2FA service errors to status codes
+func (h *AuthHandler) respondMFAError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrTooManyAttempts), errors.Is(err, service.ErrLoginGuardUnavailable):
+		respondLoginError(c, err)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+	case errors.Is(err, service.ErrTOTPAlreadyEnabled),
+		errors.Is(err, service.ErrTOTPNotEnrolled),
+		errors.Is(err, service.ErrTOTPNotEnabled):
+		c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(message))
+	}
+}
@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// OAuthHandler serves the OAuth 2.0 authorization server. The token, introspection and revocation
+// endpoints are called by clients and speak plain RFC 6749 JSON; the others back the web app.
+type OAuthHandler struct {
+	oauthService *service.OAuthService
+	logger       *utils.Logger
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService, logger *utils.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: oauthService,
+		logger:       logger,
+	}
+}
+
+func (h *OAuthHandler) CreateClient(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, err := h.oauthService.CreateClient(c.Request.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidOAuthClientRequest) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to create OAuth client: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to create OAuth client"))
+		return
+	}
+
+	h.logger.Infof("OAuth client %s registered by user %s", response.Client.ID, userID)
+	c.JSON(http.StatusCreated, models.SuccessResponse(response, "OAuth client registered"))
+}
+
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	clients, err := h.oauthService.ListClients(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("Failed to list OAuth clients: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to list OAuth clients"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(clients, "OAuth clients retrieved successfully"))
+}
+
+func (h *OAuthHandler) RevokeClient(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	clientID := c.Param("id")
+	if err := h.oauthService.RevokeClient(c.Request.Context(), userID, clientID); err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to revoke OAuth client: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to revoke OAuth client"))
+		return
+	}
+
+	h.logger.Infof("OAuth client %s revoked by user %s", clientID, userID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "OAuth client revoked successfully"))
+}
+
+func (h *OAuthHandler) ListConsents(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	consents, err := h.oauthService.ListConsents(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("Failed to list OAuth consents: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to list authorized applications"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(consents, "Authorized applications retrieved successfully"))
+}
+
+func (h *OAuthHandler) RevokeConsent(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	clientID := c.Param("client_id")
+	if err := h.oauthService.RevokeConsent(c.Request.Context(), userID, clientID); err != nil {
+		if errors.Is(err, repository.ErrOAuthConsentNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to revoke OAuth consent: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to revoke access"))
+		return
+	}
+
+	h.logger.Infof("User %s revoked the access of OAuth client %s", userID, clientID)
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Access revoked successfully"))
+}
+
+// GetAuthorization validates an authorization request for the consent page, which receives the
+// request parameters in its URL and passes them on unchanged
+func (h *OAuthHandler) GetAuthorization(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.OAuthAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	details, err := h.oauthService.GetAuthorization(c.Request.Context(), userID, req)
+	if err != nil {
+		h.respondAuthorizeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(details, "Authorization request is valid"))
+}
+
+// Authorize records the user's decision and returns where to send the browser
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.OAuthDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, err := h.oauthService.Decide(c.Request.Context(), userID, req)
+	if err != nil {
+		h.respondAuthorizeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Return to the application"))
+}
+
+// respondAuthorizeError passes on where to report an error to the client, when the request was
+// valid enough to trust its redirect URI
+func (h *OAuthHandler) respondAuthorizeError(c *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		h.logger.Errorf("OAuth authorization failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Authorization failed"))
+		return
+	}
+	if oauthErr.RedirectURL != "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponseWithData(oauthErr.Error(), models.OAuthRedirectResponse{RedirectURL: oauthErr.RedirectURL}))
+		return
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse(oauthErr.Error()))
+}
+
+// Token is the token endpoint (RFC 6749 section 3.2)
+func (h *OAuthHandler) Token(c *gin.Context) {
+	var req models.OAuthTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondOAuthError(c, h.logger, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	client, err := h.oauthService.AuthenticateClient(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+	response, err := h.oauthService.Token(c.Request.Context(), client, req)
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// Introspect is the token introspection endpoint (RFC 7662)
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	var req models.OAuthTokenActionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondOAuthError(c, h.logger, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	client, err := h.oauthService.AuthenticateClient(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+	response, err := h.oauthService.Introspect(c.Request.Context(), client, req.Token)
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// Revoke is the token revocation endpoint (RFC 7009). It answers 200 for unknown tokens too.
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	var req models.OAuthTokenActionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondOAuthError(c, h.logger, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	client, err := h.oauthService.AuthenticateClient(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+	if err := h.oauthService.Revoke(c.Request.Context(), client, req.Token); err != nil {
+		respondOAuthError(c, h.logger, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials prefers HTTP basic authentication, whose values are form-encoded
+// (RFC 6749 section 2.3.1), over credentials in the request body
+func clientCredentials(c *gin.Context, clientID, clientSecret string) (string, string) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return clientID, clientSecret
+	}
+	if decoded, err := url.QueryUnescape(username); err == nil {
+		username = decoded
+	}
+	if decoded, err := url.QueryUnescape(password); err == nil {
+		password = decoded
+	}
+	return username, password
+}
+
+// respondOAuthError writes an RFC 6749 section 5.2 error response
+func respondOAuthError(c *gin.Context, logger *utils.Logger, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		logger.Errorf("OAuth request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="cloudbox"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/oidc"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+func (h *AuthHandler) GetOIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SuccessResponse(h.authService.OIDCConfig(), "Single sign-on configuration"))
+}
+
+func (h *AuthHandler) StartOIDCLogin(c *gin.Context) {
+	response, err := h.authService.StartOIDCLogin(c.Request.Context())
+	if err != nil {
+		h.respondOIDCError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Redirect to the identity provider"))
+}
+
+func (h *AuthHandler) CompleteOIDCLogin(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	response, challenge, err := h.authService.CompleteOIDCLogin(c.Request.Context(), req, clientInfo(c))
+	if err != nil {
+		h.respondOIDCError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, models.SuccessResponse(challenge, "Two-factor authentication required"))
+		return
+	}
+
+	h.logger.Infof("User logged in with single sign-on: %s", response.User.Email)
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Login successful"))
+}
+
+// respondOIDCError maps the single sign-on errors to status codes. Failures talking to the
+// provider are logged but not detailed to the client.
+func (h *AuthHandler) respondOIDCError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOIDCDisabled):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, repository.ErrOIDCStateInvalid):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+	case errors.Is(err, oidc.ErrInvalidIDToken):
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(err.Error()))
+	case errors.Is(err, service.ErrOIDCEmailNotAllowed),
+		errors.Is(err, service.ErrOIDCNoAccount),
+		errors.Is(err, service.ErrOIDCIdentityConflict),
+		errors.Is(err, service.ErrOIDCAccountUnverified),
+		errors.Is(err, service.ErrAccountInactive):
+		h.logger.Warnf("Single sign-on refused: %v", err)
+		c.JSON(http.StatusForbidden, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Single sign-on failed: %v", err)
+		c.JSON(http.StatusBadGateway, models.ErrorResponse("Single sign-on failed"))
+	}
+}
@@ -0,0 +1,177 @@
+// Package ldapauth checks passwords against an LDAP directory such as Active Directory
+package ldapauth
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials is returned when the directory has no single entry for the email or
+// refuses the password
+var ErrInvalidCredentials = errors.New("invalid directory credentials")
+
+// Config describes how to find and authenticate users in the directory
+type Config struct {
+	// URL is the ldap:// or ldaps:// address of the directory server
+	URL string
+	// StartTLS upgrades an ldap:// connection before any credentials are sent
+	StartTLS bool
+	// BindDN and BindPassword are the service account used to look up users; without them
+	// the lookup is anonymous
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of a user; %s is replaced by the escaped email
+	UserFilter string
+	// Attributes mapped onto the user. IDAttribute is a stable unique ID such as entryUUID or
+	// objectGUID; without it the DN identifies the user.
+	EmailAttribute     string
+	UsernameAttribute  string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	IDAttribute        string
+	Timeout            time.Duration
+}
+
+// Entry is a directory user whose password was accepted
+type Entry struct {
+	DN        string
+	ID        string
+	Email     string
+	Username  string
+	FirstName string
+	LastName  string
+}
+
+// Directory authenticates users with a search for their entry followed by a bind as that entry
+type Directory struct {
+	config Config
+}
+
+func NewDirectory(config Config) *Directory {
+	if config.UserFilter == "" {
+		config.UserFilter = "(mail=%s)"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.UsernameAttribute == "" {
+		config.UsernameAttribute = "uid"
+	}
+	if config.FirstNameAttribute == "" {
+		config.FirstNameAttribute = "givenName"
+	}
+	if config.LastNameAttribute == "" {
+		config.LastNameAttribute = "sn"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &Directory{config: config}
+}
+
+// Source identifies the directory in the external identities of linked users
+func (d *Directory) Source() string {
+	return strings.TrimSuffix(d.config.URL, "/") + "/" + d.config.BaseDN
+}
+
+// Authenticate looks up the entry for the email and binds as it with the password
+func (d *Directory) Authenticate(email, password string) (*Entry, error) {
+	// An empty password would be an unauthenticated bind, which servers accept for any DN
+	if email == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if d.config.BindDN != "" {
+		err = conn.Bind(d.config.BindDN, d.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bind as service account: %w", err)
+	}
+
+	attributes := []string{d.config.EmailAttribute, d.config.UsernameAttribute, d.config.FirstNameAttribute, d.config.LastNameAttribute}
+	if d.config.IDAttribute != "" {
+		attributes = append(attributes, d.config.IDAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(d.config.Timeout.Seconds()), false,
+		fmt.Sprintf(d.config.UserFilter, ldap.EscapeFilter(email)),
+		attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("search for user: %w", err)
+	}
+	// An email matching several entries is ambiguous, so nobody can log in with it
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("bind as user: %w", err)
+	}
+
+	entry := &Entry{
+		DN:        found.DN,
+		ID:        found.DN,
+		Email:     found.GetAttributeValue(d.config.EmailAttribute),
+		Username:  found.GetAttributeValue(d.config.UsernameAttribute),
+		FirstName: found.GetAttributeValue(d.config.FirstNameAttribute),
+		LastName:  found.GetAttributeValue(d.config.LastNameAttribute),
+	}
+	if d.config.IDAttribute != "" {
+		// Binary IDs such as objectGUID are kept as hex
+		if raw := found.GetRawAttributeValue(d.config.IDAttribute); len(raw) > 0 {
+			if utf8.Valid(raw) {
+				entry.ID = string(raw)
+			} else {
+				entry.ID = hex.EncodeToString(raw)
+			}
+		}
+	}
+	if entry.Email == "" {
+		entry.Email = email
+	}
+	return entry, nil
+}
+
+func (d *Directory) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: d.config.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("connect to directory: %w", err)
+	}
+	conn.SetTimeout(d.config.Timeout)
+
+	if d.config.StartTLS {
+		var serverName string
+		if parsed, err := url.Parse(d.config.URL); err == nil {
+			serverName = parsed.Hostname()
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
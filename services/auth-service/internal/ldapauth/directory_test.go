@@ -0,0 +1,151 @@
+package ldapauth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/ldapauth/ldaptest"
+)
+
+const testBaseDN = "ou=people,dc=cloudbox,dc=test"
+
+var (
+	serviceAccount = ldaptest.Entry{
+		DN:       "cn=reader,dc=cloudbox,dc=test",
+		Password: "reader-password",
+	}
+	jane = ldaptest.Entry{
+		DN:       "uid=jane," + testBaseDN,
+		Password: "jane-password",
+		Attributes: map[string][]string{
+			"uid":       {"jdoe"},
+			"mail":      {"jane@cloudbox.test"},
+			"givenName": {"Jane"},
+			"sn":        {"Doe"},
+			"entryUUID": {"5d0c7a7e-2b1f-4d8e-9a43-6c1f0e2b7d10"},
+		},
+	}
+)
+
+// startDirectory serves entries and returns a directory bound with the service account
+func startDirectory(t *testing.T, entries ...ldaptest.Entry) *Directory {
+	t.Helper()
+	server, err := ldaptest.NewServer(append([]ldaptest.Entry{serviceAccount}, entries...)...)
+	if err != nil {
+		t.Fatalf("start LDAP server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return NewDirectory(Config{
+		URL:          server.URL(),
+		BindDN:       serviceAccount.DN,
+		BindPassword: serviceAccount.Password,
+		BaseDN:       testBaseDN,
+		IDAttribute:  "entryUUID",
+		Timeout:      5 * time.Second,
+	})
+}
+
+func TestAuthenticateMapsAttributes(t *testing.T) {
+	directory := startDirectory(t, jane)
+
+	entry, err := directory.Authenticate("jane@cloudbox.test", "jane-password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := Entry{
+		DN:        jane.DN,
+		ID:        "5d0c7a7e-2b1f-4d8e-9a43-6c1f0e2b7d10",
+		Email:     "jane@cloudbox.test",
+		Username:  "jdoe",
+		FirstName: "Jane",
+		LastName:  "Doe",
+	}
+	if *entry != want {
+		t.Errorf("Authenticate = %+v, want %+v", *entry, want)
+	}
+}
+
+func TestAuthenticateWithoutIDAttributeUsesDN(t *testing.T) {
+	directory := startDirectory(t, jane)
+	directory.config.IDAttribute = ""
+
+	entry, err := directory.Authenticate("jane@cloudbox.test", "jane-password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.ID != jane.DN {
+		t.Errorf("ID = %q, want the DN %q", entry.ID, jane.DN)
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", "jane@cloudbox.test", "not-janes-password"},
+		// The test server, like real ones, accepts a bind with an empty password for any DN
+		{"empty password", "jane@cloudbox.test", ""},
+		{"unknown user", "nobody@cloudbox.test", "jane-password"},
+		{"empty email", "", "jane-password"},
+		// Unescaped, these would turn the filter into (mail=*) or (mail=*)(uid=*) and find Jane
+		{"wildcard", "*", "jane-password"},
+		{"filter injection", "*)(uid=*", "jane-password"},
+	}
+	directory := startDirectory(t, jane)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := directory.Authenticate(tt.email, tt.password)
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate = %+v, %v; want ErrInvalidCredentials", entry, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateEscapesFilterCharacters(t *testing.T) {
+	odd := ldaptest.Entry{
+		DN:       "uid=odd," + testBaseDN,
+		Password: "odd-password",
+		Attributes: map[string][]string{
+			"uid":  {"odd"},
+			"mail": {`o*d(d)\@cloudbox.test`},
+		},
+	}
+	directory := startDirectory(t, jane, odd)
+
+	entry, err := directory.Authenticate(`o*d(d)\@cloudbox.test`, "odd-password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != odd.DN {
+		t.Errorf("DN = %q, want %q", entry.DN, odd.DN)
+	}
+}
+
+func TestAuthenticateAmbiguousEmail(t *testing.T) {
+	twin := ldaptest.Entry{
+		DN:         "uid=jane2," + testBaseDN,
+		Password:   "jane-password",
+		Attributes: map[string][]string{"mail": {"jane@cloudbox.test"}},
+	}
+	directory := startDirectory(t, jane, twin)
+
+	if _, err := directory.Authenticate("jane@cloudbox.test", "jane-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthenticateServiceAccountRefused(t *testing.T) {
+	directory := startDirectory(t, jane)
+	directory.config.BindPassword = "wrong"
+
+	_, err := directory.Authenticate("jane@cloudbox.test", "jane-password")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want a service account bind error", err)
+	}
+}
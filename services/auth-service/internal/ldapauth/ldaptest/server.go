@@ -0,0 +1,266 @@
+// Package ldaptest is a small in-process LDAP server for exercising the LDAP authentication
+// provider without a real directory. It supports simple binds and searches with equality,
+// presence, and, or and not filters, which is all the provider needs.
+package ldaptest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// Protocol operations and result codes used by the server (RFC 4511)
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+
+	resultSuccess            = 0
+	resultProtocolError      = 2
+	resultSizeLimitExceeded  = 4
+	resultInvalidCredentials = 49
+	resultUnwillingToPerform = 53
+)
+
+// Filter choices (RFC 4511 section 4.5.1)
+const (
+	filterAnd      = 0
+	filterOr       = 1
+	filterNot      = 2
+	filterEquality = 3
+	filterPresent  = 7
+)
+
+// Entry is a directory entry. A simple bind as its DN succeeds with Password; an entry without
+// a password can only make unauthenticated binds.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server serves a fixed set of entries until closed
+type Server struct {
+	listener net.Listener
+	entries  []Entry
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a free loopback port
+func NewServer(entries ...Entry) (*Server, error) {
+	return Listen("127.0.0.1:0", entries)
+}
+
+// Listen starts a server on addr
+func Listen(addr string, entries []Entry) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: listener, entries: entries}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// URL is the ldap:// address of the server
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// Close stops accepting connections and waits for open ones to finish
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		packet, err := ber.ReadPacket(reader)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch request.Tag {
+		case opBindRequest:
+			responses = []*ber.Packet{s.bind(request)}
+		case opSearchRequest:
+			responses = s.search(request)
+		case opUnbindRequest:
+			return
+		case opExtendedRequest:
+			responses = []*ber.Packet{result(opExtendedResponse, resultUnwillingToPerform, "extended operations are not supported")}
+		default:
+			responses = []*ber.Packet{result(opExtendedResponse, resultProtocolError, "unsupported operation")}
+		}
+
+		for _, response := range responses {
+			message := ber.NewSequence("LDAP message")
+			message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "message ID"))
+			message.AppendChild(response)
+			if _, err := conn.Write(message.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(request *ber.Packet) *ber.Packet {
+	if len(request.Children) < 3 {
+		return result(opBindResponse, resultProtocolError, "malformed bind request")
+	}
+	name := stringValue(request.Children[1])
+	password := stringValue(request.Children[2])
+
+	// Like many real servers, a bind with a name but no password is accepted as an
+	// unauthenticated bind (RFC 4513 section 5.1.2), whether or not the name exists
+	if password == "" {
+		return result(opBindResponse, resultSuccess, "")
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, name) && entry.Password != "" && entry.Password == password {
+			return result(opBindResponse, resultSuccess, "")
+		}
+	}
+	return result(opBindResponse, resultInvalidCredentials, "invalid credentials")
+}
+
+func (s *Server) search(request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return []*ber.Packet{result(opSearchResultDone, resultProtocolError, "malformed search request")}
+	}
+	baseDN := strings.ToLower(stringValue(request.Children[0]))
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+
+	var responses []*ber.Packet
+	for _, entry := range s.entries {
+		dn := strings.ToLower(entry.DN)
+		if baseDN != "" && dn != baseDN && !strings.HasSuffix(dn, ","+baseDN) {
+			continue
+		}
+		if !matches(entry, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) == sizeLimit {
+			return append(responses, result(opSearchResultDone, resultSizeLimitExceeded, "size limit exceeded"))
+		}
+		responses = append(responses, searchEntry(entry))
+	}
+	return append(responses, result(opSearchResultDone, resultSuccess, ""))
+}
+
+func matches(entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case filterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case filterEquality:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, value := range attribute(entry, stringValue(filter.Children[0])) {
+			if strings.EqualFold(value, stringValue(filter.Children[1])) {
+				return true
+			}
+		}
+		return false
+	case filterPresent:
+		return len(attribute(entry, stringValue(filter))) > 0
+	default:
+		return false
+	}
+}
+
+func attribute(entry Entry, name string) []string {
+	if strings.EqualFold(name, "objectClass") && len(entry.Attributes["objectClass"]) == 0 {
+		return []string{"top"}
+	}
+	for key, values := range entry.Attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func searchEntry(entry Entry) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "search result entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "object name"))
+
+	attributes := ber.NewSequence("attributes")
+	for name, values := range entry.Attributes {
+		attr := ber.NewSequence("attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attr.AppendChild(set)
+		attributes.AppendChild(attr)
+	}
+	packet.AppendChild(attributes)
+	return packet
+}
+
+func result(op ber.Tag, code int64, message string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, fmt.Sprintf("result %d", code))
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "result code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnostic message"))
+	return packet
+}
+
+// stringValue reads an octet string, which is only decoded for universal tags
+func stringValue(packet *ber.Packet) string {
+	if value, ok := packet.Value.(string); ok {
+		return value
+	}
+	if packet.Data != nil {
+		return packet.Data.String()
+	}
+	return string(packet.ByteValue)
+}
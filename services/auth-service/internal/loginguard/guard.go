@@ -0,0 +1,192 @@
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Policy controls how failed attempts against one key slow down and lock further attempts
+type Policy struct {
+	// FreeAttempts failures are allowed without any delay
+	FreeAttempts int
+	// Each failure beyond FreeAttempts doubles the delay, starting at BaseDelay, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// After LockoutThreshold failures the key is locked for LockoutDuration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Failures are forgotten once Window passes without a new one
+	Window time.Duration
+}
+
+// State is the failure record of one key
+type State struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// RetryAfter is how long the key must wait before its next attempt, zero if it may try now
+func (s State) RetryAfter(p Policy, now time.Time) time.Duration {
+	if now.Before(s.LockedUntil) {
+		return s.LockedUntil.Sub(now)
+	}
+	if s.Failures <= p.FreeAttempts || now.Sub(s.LastFailure) > p.Window {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < s.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if wait := s.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// recordFailure returns the state after one more failure at now
+func (s State) recordFailure(p Policy, now time.Time) State {
+	if now.Sub(s.LastFailure) > p.Window {
+		s.Failures = 0
+	}
+	s.Failures++
+	s.LastFailure = now
+	if s.Failures >= p.LockoutThreshold {
+		s.LockedUntil = now.Add(p.LockoutDuration)
+	}
+	return s
+}
+
+// ttl is how long a state has to be kept after its last change
+func (p Policy) ttl() time.Duration {
+	if p.LockoutDuration > p.Window {
+		return p.LockoutDuration
+	}
+	return p.Window
+}
+
+// Store keeps failure states by key
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	// RecordFailure atomically records a failure and returns the previous and the new state
+	RecordFailure(ctx context.Context, key string, p Policy, now time.Time) (State, State, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Lockout describes a key that just got locked
+type Lockout struct {
+	Key   string
+	Until time.Time
+}
+
+// Guard tracks failed logins per account and per client IP. Accounts are keyed by the email
+// as typed, whether or not it exists, so its answers do not reveal registered addresses.
+type Guard struct {
+	store         Store
+	accountPolicy Policy
+	ipPolicy      Policy
+}
+
+func NewGuard(store Store, accountPolicy, ipPolicy Policy) *Guard {
+	return &Guard{
+		store:         store,
+		accountPolicy: accountPolicy,
+		ipPolicy:      ipPolicy,
+	}
+}
+
+// Check returns how long the client has to wait before trying to log in to the account
+func (g *Guard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	account, err := g.store.Get(ctx, accountKey(email))
+	if err != nil {
+		return 0, err
+	}
+	client, err := g.store.Get(ctx, ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+
+	wait := account.RetryAfter(g.accountPolicy, now)
+	if ipWait := client.RetryAfter(g.ipPolicy, now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed attempt and returns the keys it locked, if any
+func (g *Guard) RecordFailure(ctx context.Context, email, ip string) ([]Lockout, error) {
+	now := time.Now()
+	var lockouts []Lockout
+
+	for _, entry := range []struct {
+		key    string
+		policy Policy
+	}{
+		{accountKey(email), g.accountPolicy},
+		{ipKey(ip), g.ipPolicy},
+	} {
+		before, after, err := g.store.RecordFailure(ctx, entry.key, entry.policy, now)
+		if err != nil {
+			return lockouts, err
+		}
+		if !now.Before(before.LockedUntil) && now.Before(after.LockedUntil) {
+			lockouts = append(lockouts, Lockout{Key: entry.key, Until: after.LockedUntil})
+		}
+	}
+	return lockouts, nil
+}
+
+// RecordSuccess clears the account's failures. The IP keeps its record, so one valid account
+// can not be used to reset the counter while guessing others.
+func (g *Guard) RecordSuccess(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+// CheckUser returns how long a signed-in user has to wait before entering another second factor
+// code, when managing 2FA from a session rather than logging in. It uses the account policy.
+func (g *Guard) CheckUser(ctx context.Context, userID string) (time.Duration, error) {
+	state, err := g.store.Get(ctx, userKey(userID))
+	if err != nil {
+		return 0, err
+	}
+	return state.RetryAfter(g.accountPolicy, time.Now()), nil
+}
+
+// RecordUserFailure counts a wrong second factor code entered by a signed-in user and returns the
+// lockout it caused, if any
+func (g *Guard) RecordUserFailure(ctx context.Context, userID string) (*Lockout, error) {
+	now := time.Now()
+	key := userKey(userID)
+	before, after, err := g.store.RecordFailure(ctx, key, g.accountPolicy, now)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(before.LockedUntil) && now.Before(after.LockedUntil) {
+		return &Lockout{Key: key, Until: after.LockedUntil}, nil
+	}
+	return nil, nil
+}
+
+// RecordUserSuccess clears the user's second factor failures
+func (g *Guard) RecordUserSuccess(ctx context.Context, userID string) error {
+	return g.store.Reset(ctx, userKey(userID))
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func userKey(userID string) string {
+	return "user:" + userID
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
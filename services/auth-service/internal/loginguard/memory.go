@@ -0,0 +1,58 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps failure states in process memory, for development and single-instance setups
+type MemoryStore struct {
+	mu      sync.Mutex
+	states  map[string]State
+	expires map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states:  make(map[string]State),
+		expires: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, p Policy, now time.Time) (State, State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	before := s.states[key]
+	after := before.recordFailure(p, now)
+	s.states[key] = after
+	s.expires[key] = now.Add(p.ttl())
+	return before, after, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, key)
+	delete(s.expires, key)
+	return nil
+}
+
+// sweep drops states that no longer matter; callers must hold mu
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, expiresAt := range s.expires {
+		if now.After(expiresAt) {
+			delete(s.states, key)
+			delete(s.expires, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyPrefix = "cloudbox:login:"
+	// maxRetries bounds the optimistic transaction when concurrent failures hit the same key
+	maxRetries = 10
+)
+
+// RedisStore keeps failure states in Redis so that every auth-service instance shares them
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (State, error) {
+	values, err := s.client.HGetAll(ctx, keyPrefix+key).Result()
+	if err != nil {
+		return State{}, err
+	}
+	return decodeState(values), nil
+}
+
+func (s *RedisStore) RecordFailure(ctx context.Context, key string, p Policy, now time.Time) (State, State, error) {
+	key = keyPrefix + key
+	var before, after State
+
+	record := func(tx *redis.Tx) error {
+		values, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		before = decodeState(values)
+		after = before.recordFailure(p, now)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key,
+				"failures", after.Failures,
+				"last_failure", after.LastFailure.UnixMilli(),
+				"locked_until", after.LockedUntil.UnixMilli(),
+			)
+			pipe.PExpire(ctx, key, p.ttl())
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		err := s.client.Watch(ctx, record, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return before, after, err
+	}
+	return before, after, errors.New("too much contention recording login failure")
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, keyPrefix+key).Err()
+}
+
+func decodeState(values map[string]string) State {
+	var state State
+	state.Failures, _ = strconv.Atoi(values["failures"])
+	if ms, err := strconv.ParseInt(values["last_failure"], 10, 64); err == nil && ms > 0 {
+		state.LastFailure = time.UnixMilli(ms)
+	}
+	if ms, err := strconv.ParseInt(values["locked_until"], 10, 64); err == nil && ms > 0 {
+		state.LockedUntil = time.UnixMilli(ms)
+	}
+	return state
+}
+
+// NewStore returns a Redis-backed store, or an in-memory one when client is nil
+func NewStore(client *redis.Client) Store {
+	if client == nil {
+		return NewMemoryStore()
+	}
+	return NewRedisStore(client)
+}
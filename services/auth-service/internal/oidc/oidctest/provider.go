@@ -0,0 +1,148 @@
+// Package oidctest is an in-process OpenID Connect provider for exercising the relying party
+// without a real identity provider. It serves discovery, the signing keys and a token endpoint
+// that hands out whichever ID token the test registered for a code.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joaquinidiarte/cloudbox/shared/jwks"
+)
+
+// KeyID identifies the provider's signing key in the tokens it signs
+const KeyID = "oidctest"
+
+// Provider serves the provider endpoints until closed
+type Provider struct {
+	server   *httptest.Server
+	clientID string
+	key      ed25519.PrivateKey
+
+	mu     sync.Mutex
+	tokens map[string]string // code -> ID token
+}
+
+// NewProvider starts a provider for the given client
+func NewProvider(clientID string) (*Provider, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		clientID: clientID,
+		key:      key,
+		tokens:   make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// Issuer is the provider's issuer identifier, which is also its base URL
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// Close shuts the provider down
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// Claims returns valid ID token claims for the client: issued now, for five minutes, with a
+// verified email. Tests change them to produce invalid tokens.
+func (p *Provider) Claims(subject, email, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"aud":            p.clientID,
+		"sub":            subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          email,
+		"email_verified": true,
+	}
+}
+
+// Sign signs claims with the provider's key
+func (p *Provider) Sign(claims jwt.Claims) (string, error) {
+	return p.SignWith(jwt.SigningMethodEdDSA, p.key, claims)
+}
+
+// SignWith signs claims with another method and key, keeping the provider's key ID
+func (p *Provider) SignWith(method jwt.SigningMethod, key interface{}, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(key)
+}
+
+// PublicKey is the key the provider publishes
+func (p *Provider) PublicKey() ed25519.PublicKey {
+	return p.key.Public().(ed25519.PublicKey)
+}
+
+// IssueCode makes the token endpoint answer code, once, with idToken
+func (p *Provider) IssueCode(code, idToken string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[code] = idToken
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	jwk, err := jwks.NewJWK(KeyID, p.PublicKey())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, jwks.Set{Keys: []jwks.JWK{jwk}})
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostFormValue("code")
+	idToken, ok := p.tokens[code]
+	delete(p.tokens, code)
+	p.mu.Unlock()
+
+	if !ok || r.PostFormValue("client_id") != p.clientID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
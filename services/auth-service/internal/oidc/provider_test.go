@@ -0,0 +1,186 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/oidc/oidctest"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const (
+	testClientID = "cloudbox"
+	testNonce    = "nonce-1234"
+)
+
+func startProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	idp, err := oidctest.NewProvider(testClientID)
+	if err != nil {
+		t.Fatalf("start provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	rp := NewProvider(Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:3000/auth/callback",
+		Scopes:      []string{"openid", "email"},
+	}, utils.NewLogger("test"))
+	return idp, rp
+}
+
+// exchange has the provider hand out the token for a code and redeems it
+func exchange(t *testing.T, idp *oidctest.Provider, rp *Provider, token string) (*Claims, error) {
+	t.Helper()
+	idp.IssueCode("code", token)
+	return rp.Exchange(context.Background(), "code", "verifier", testNonce)
+}
+
+func sign(t *testing.T, idp *oidctest.Provider, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := idp.Sign(claims)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func TestExchange(t *testing.T) {
+	idp, rp := startProvider(t)
+	claims := idp.Claims("subject-1", "jane@example.com", testNonce)
+	claims["given_name"] = "Jane"
+
+	got, err := exchange(t, idp, rp, sign(t, idp, claims))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if got.Subject != "subject-1" || got.Email != "jane@example.com" || !got.EmailVerified || got.GivenName != "Jane" {
+		t.Errorf("Exchange = %+v", got)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "another-nonce" }},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "another-client"} }},
+		{"azp of another client", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		}},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"missing expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, rp := startProvider(t)
+			claims := idp.Claims("subject-1", "jane@example.com", testNonce)
+			tt.modify(claims)
+
+			if got, err := exchange(t, idp, rp, sign(t, idp, claims)); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Exchange = %+v, %v; want ErrInvalidIDToken", got, err)
+			}
+		})
+	}
+}
+
+func TestExchangeAcceptsOwnAuthorizedParty(t *testing.T) {
+	idp, rp := startProvider(t)
+	claims := idp.Claims("subject-1", "jane@example.com", testNonce)
+	claims["aud"] = []string{testClientID, "another-client"}
+	claims["azp"] = testClientID
+
+	if _, err := exchange(t, idp, rp, sign(t, idp, claims)); err != nil {
+		t.Errorf("Exchange: %v", err)
+	}
+}
+
+func TestExchangeRejectsUnsupportedAlgorithms(t *testing.T) {
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func(idp *oidctest.Provider, claims jwt.MapClaims) (string, error)
+	}{
+		// The published public key used as an HMAC secret
+		{"HS256 with the public key", func(idp *oidctest.Provider, claims jwt.MapClaims) (string, error) {
+			return idp.SignWith(jwt.SigningMethodHS256, []byte(idp.PublicKey()), claims)
+		}},
+		{"none", func(idp *oidctest.Provider, claims jwt.MapClaims) (string, error) {
+			return idp.SignWith(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims)
+		}},
+		{"signed by another key", func(idp *oidctest.Provider, claims jwt.MapClaims) (string, error) {
+			return idp.SignWith(jwt.SigningMethodEdDSA, otherKey, claims)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, rp := startProvider(t)
+			token, err := tt.token(idp, idp.Claims("subject-1", "jane@example.com", testNonce))
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			if got, err := exchange(t, idp, rp, token); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Exchange = %+v, %v; want ErrInvalidIDToken", got, err)
+			}
+		})
+	}
+}
+
+func TestExchangeUnknownCode(t *testing.T) {
+	_, rp := startProvider(t)
+	if _, err := rp.Exchange(context.Background(), "unknown", "verifier", testNonce); err == nil {
+		t.Error("Exchange of an unknown code succeeded")
+	}
+}
+
+func TestAuthorizationURL(t *testing.T) {
+	idp, rp := startProvider(t)
+
+	raw, err := rp.AuthorizationURL(context.Background(), "state-1", testNonce, "verifier")
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	if !strings.HasPrefix(raw, idp.Issuer()+"/authorize?") {
+		t.Fatalf("AuthorizationURL = %s", raw)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	for param, want := range map[string]string{
+		"client_id":             testClientID,
+		"state":                 "state-1",
+		"nonce":                 testNonce,
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge") == "verifier" {
+		t.Errorf("code_challenge = %q, want the S256 hash of the verifier", query.Get("code_challenge"))
+	}
+}
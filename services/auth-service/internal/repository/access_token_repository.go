@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAccessTokenNotFound is returned when the user has no active token with the given ID
+var ErrAccessTokenNotFound = errors.New("access token not found")
+
+// AccessTokenRepository defines the interface for personal access token data access.
+// Tokens are verified by the other services through shared/accesstoken.
+type AccessTokenRepository interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	FindActiveByUserID(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, id string) error
+}
+
+// MongoDBAccessTokenRepository is the MongoDB implementation of AccessTokenRepository
+type MongoDBAccessTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAccessTokenRepository creates a new MongoDB personal access token repository
+func NewAccessTokenRepository(db *mongo.Database) AccessTokenRepository {
+	return &MongoDBAccessTokenRepository{
+		collection: db.Collection("personal_access_tokens"),
+	}
+}
+
+func (r *MongoDBAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// FindActiveByUserID returns the user's tokens that are neither revoked nor expired, newest first
+func (r *MongoDBAccessTokenRepository) FindActiveByUserID(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []*models.PersonalAccessToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *MongoDBAccessTokenRepository) Revoke(ctx context.Context, userID, id string) error {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
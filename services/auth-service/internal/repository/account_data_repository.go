@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// userDataCollections are the auth-service collections holding records of a user in user_id
+var userDataCollections = []string{
+	"device_authorizations",
+	"email_verification_tokens",
+	"mfa_challenges",
+	"oauth_authorization_codes",
+	"oauth_consents",
+	"oauth_refresh_tokens",
+	"password_reset_tokens",
+	"personal_access_tokens",
+	"refresh_tokens",
+	"sessions",
+}
+
+// AccountDataRepository removes what the auth-service stores for a deleted account
+type AccountDataRepository interface {
+	DeleteUserData(ctx context.Context, userID string) error
+}
+
+// MongoDBAccountDataRepository is the MongoDB implementation of AccountDataRepository
+type MongoDBAccountDataRepository struct {
+	db *mongo.Database
+}
+
+// NewAccountDataRepository creates a new MongoDB account data repository
+func NewAccountDataRepository(db *mongo.Database) AccountDataRepository {
+	return &MongoDBAccountDataRepository{db: db}
+}
+
+// DeleteUserData deletes the user's tokens, sessions and consents, and the OAuth clients the user
+// registered together with everything issued to them
+func (r *MongoDBAccountDataRepository) DeleteUserData(ctx context.Context, userID string) error {
+	clients := r.db.Collection("oauth_clients")
+	clientIDs, err := clients.Distinct(ctx, "_id", bson.M{"owner_id": userID})
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"user_id": userID}
+	if len(clientIDs) > 0 {
+		filter = bson.M{"$or": bson.A{filter, bson.M{"client_id": bson.M{"$in": clientIDs}}}}
+	}
+	for _, name := range userDataCollections {
+		if _, err := r.db.Collection(name).DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+	}
+
+	_, err = clients.DeleteMany(ctx, bson.M{"owner_id": userID})
+	return err
+}
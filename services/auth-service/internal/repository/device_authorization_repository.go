@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrDeviceCodeInvalid is returned for device codes that are unknown or already used
+	ErrDeviceCodeInvalid = errors.New("invalid device code")
+	// ErrUserCodeInvalid is returned for user codes that are unknown, expired or already decided
+	ErrUserCodeInvalid = errors.New("invalid or expired code")
+)
+
+// DeviceAuthorizationRepository defines the interface for device login data access
+type DeviceAuthorizationRepository interface {
+	Create(ctx context.Context, authorization *models.DeviceAuthorization) error
+	FindPendingByUserCode(ctx context.Context, userCodeHash string) (*models.DeviceAuthorization, error)
+	Decide(ctx context.Context, id, userID, status string) (bool, error)
+	Poll(ctx context.Context, deviceCodeHash string) (*models.DeviceAuthorization, error)
+	SlowDown(ctx context.Context, id string, seconds int) error
+	MarkUsed(ctx context.Context, id string) (bool, error)
+}
+
+// MongoDBDeviceAuthorizationRepository is the MongoDB implementation of DeviceAuthorizationRepository
+type MongoDBDeviceAuthorizationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewDeviceAuthorizationRepository creates a new MongoDB device authorization repository
+func NewDeviceAuthorizationRepository(db *mongo.Database) DeviceAuthorizationRepository {
+	return &MongoDBDeviceAuthorizationRepository{
+		collection: db.Collection("device_authorizations"),
+	}
+}
+
+func (r *MongoDBDeviceAuthorizationRepository) Create(ctx context.Context, authorization *models.DeviceAuthorization) error {
+	_, err := r.collection.InsertOne(ctx, authorization)
+	return err
+}
+
+// FindPendingByUserCode returns an unexpired authorization still waiting for the user
+func (r *MongoDBDeviceAuthorizationRepository) FindPendingByUserCode(ctx context.Context, userCodeHash string) (*models.DeviceAuthorization, error) {
+	filter := bson.M{
+		"user_code_hash": userCodeHash,
+		"status":         models.DeviceAuthorizationPending,
+		"expires_at":     bson.M{"$gt": time.Now()},
+	}
+
+	var authorization models.DeviceAuthorization
+	err := r.collection.FindOne(ctx, filter).Decode(&authorization)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserCodeInvalid
+		}
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// Decide records the user's answer. It only succeeds once, while the authorization is pending.
+func (r *MongoDBDeviceAuthorizationRepository) Decide(ctx context.Context, id, userID, status string) (bool, error) {
+	now := time.Now()
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": models.DeviceAuthorizationPending, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"status": status, "user_id": userID, "decided_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// Poll records a poll by the device and returns the authorization as it was before, so the
+// caller can tell how long ago the previous poll was
+func (r *MongoDBDeviceAuthorizationRepository) Poll(ctx context.Context, deviceCodeHash string) (*models.DeviceAuthorization, error) {
+	filter := bson.M{"device_code_hash": deviceCodeHash, "used_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"last_polled_at": time.Now()}}
+
+	var authorization models.DeviceAuthorization
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&authorization)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDeviceCodeInvalid
+		}
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// SlowDown lengthens the polling interval of a device that polls too often
+func (r *MongoDBDeviceAuthorizationRepository) SlowDown(ctx context.Context, id string, seconds int) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"interval": seconds}})
+	return err
+}
+
+// MarkUsed completes an approved authorization. It only succeeds once.
+func (r *MongoDBDeviceAuthorizationRepository) MarkUsed(ctx context.Context, id string) (bool, error) {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": models.DeviceAuthorizationApproved, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrVerificationTokenInvalid is returned for verification tokens that are unknown, used or expired
+var ErrVerificationTokenInvalid = errors.New("invalid or expired verification token")
+
+// EmailVerificationRepository defines the interface for email verification token data access
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, token *models.EmailVerificationToken) error
+	FindValid(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+	Consume(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+	InvalidateForUser(ctx context.Context, userID string) error
+}
+
+// MongoDBEmailVerificationRepository is the MongoDB implementation of EmailVerificationRepository
+type MongoDBEmailVerificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewEmailVerificationRepository creates a new MongoDB email verification token repository
+func NewEmailVerificationRepository(db *mongo.Database) EmailVerificationRepository {
+	return &MongoDBEmailVerificationRepository{
+		collection: db.Collection("email_verification_tokens"),
+	}
+}
+
+func (r *MongoDBEmailVerificationRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// FindValid returns an unused, unexpired token without using it up
+func (r *MongoDBEmailVerificationRepository) FindValid(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var token models.EmailVerificationToken
+	err := r.collection.FindOne(ctx, filter).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrVerificationTokenInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it, in a single operation
+func (r *MongoDBEmailVerificationRepository) Consume(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+
+	var token models.EmailVerificationToken
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrVerificationTokenInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// InvalidateForUser marks every outstanding token of the user as used
+func (r *MongoDBEmailVerificationRepository) InvalidateForUser(ctx context.Context, userID string) error {
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	return err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrMFAChallengeInvalid is returned for challenges that are unknown, used, expired or out of attempts
+var ErrMFAChallengeInvalid = errors.New("invalid or expired MFA token")
+
+// MFAChallengeRepository defines the interface for MFA login challenge data access
+type MFAChallengeRepository interface {
+	Create(ctx context.Context, challenge *models.MFAChallenge) error
+	FindActive(ctx context.Context, tokenHash string, maxAttempts int) (*models.MFAChallenge, error)
+	RecordFailedAttempt(ctx context.Context, id string) error
+	MarkUsed(ctx context.Context, id string) (bool, error)
+}
+
+// MongoDBMFAChallengeRepository is the MongoDB implementation of MFAChallengeRepository
+type MongoDBMFAChallengeRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMFAChallengeRepository creates a new MongoDB MFA challenge repository
+func NewMFAChallengeRepository(db *mongo.Database) MFAChallengeRepository {
+	return &MongoDBMFAChallengeRepository{
+		collection: db.Collection("mfa_challenges"),
+	}
+}
+
+func (r *MongoDBMFAChallengeRepository) Create(ctx context.Context, challenge *models.MFAChallenge) error {
+	_, err := r.collection.InsertOne(ctx, challenge)
+	return err
+}
+
+// FindActive returns an unused, unexpired challenge that has attempts left
+func (r *MongoDBMFAChallengeRepository) FindActive(ctx context.Context, tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+		"attempts":   bson.M{"$lt": maxAttempts},
+	}
+
+	var challenge models.MFAChallenge
+	err := r.collection.FindOne(ctx, filter).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrMFAChallengeInvalid
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *MongoDBMFAChallengeRepository) RecordFailedAttempt(ctx context.Context, id string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"attempts": 1}})
+	return err
+}
+
+// MarkUsed completes a challenge. It only succeeds once per challenge.
+func (r *MongoDBMFAChallengeRepository) MarkUsed(ctx context.Context, id string) (bool, error) {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrOAuthClientNotFound is returned when no active client has the given ID
+var ErrOAuthClientNotFound = errors.New("OAuth client not found")
+
+// OAuthClientRepository defines the interface for OAuth client data access
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *models.OAuthClient) error
+	FindActiveByID(ctx context.Context, id string) (*models.OAuthClient, error)
+	FindActiveByOwner(ctx context.Context, ownerID string) ([]*models.OAuthClient, error)
+	FindByIDs(ctx context.Context, ids []string) ([]*models.OAuthClient, error)
+	Revoke(ctx context.Context, ownerID, id string) error
+}
+
+// MongoDBOAuthClientRepository is the MongoDB implementation of OAuthClientRepository
+type MongoDBOAuthClientRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOAuthClientRepository creates a new MongoDB OAuth client repository
+func NewOAuthClientRepository(db *mongo.Database) OAuthClientRepository {
+	return &MongoDBOAuthClientRepository{
+		collection: db.Collection("oauth_clients"),
+	}
+}
+
+func (r *MongoDBOAuthClientRepository) Create(ctx context.Context, client *models.OAuthClient) error {
+	_, err := r.collection.InsertOne(ctx, client)
+	return err
+}
+
+func (r *MongoDBOAuthClientRepository) FindActiveByID(ctx context.Context, id string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}}).Decode(&client)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// FindActiveByOwner returns the clients a user registered, newest first
+func (r *MongoDBOAuthClientRepository) FindActiveByOwner(ctx context.Context, ownerID string) ([]*models.OAuthClient, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"owner_id": ownerID, "revoked_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clients := []*models.OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// FindByIDs returns the clients with the given IDs, revoked or not
+func (r *MongoDBOAuthClientRepository) FindByIDs(ctx context.Context, ids []string) ([]*models.OAuthClient, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clients := []*models.OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *MongoDBOAuthClientRepository) Revoke(ctx context.Context, ownerID, id string) error {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "owner_id": ownerID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOAuthCodeInvalid is returned for authorization codes that are unknown, used or expired
+var ErrOAuthCodeInvalid = errors.New("invalid or expired authorization code")
+
+// OAuthCodeRepository defines the interface for authorization code data access
+type OAuthCodeRepository interface {
+	Create(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	Consume(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error)
+}
+
+// MongoDBOAuthCodeRepository is the MongoDB implementation of OAuthCodeRepository
+type MongoDBOAuthCodeRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOAuthCodeRepository creates a new MongoDB authorization code repository
+func NewOAuthCodeRepository(db *mongo.Database) OAuthCodeRepository {
+	return &MongoDBOAuthCodeRepository{
+		collection: db.Collection("oauth_authorization_codes"),
+	}
+}
+
+func (r *MongoDBOAuthCodeRepository) Create(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	_, err := r.collection.InsertOne(ctx, code)
+	return err
+}
+
+// Consume marks an unused, unexpired code as used and returns it, so a code is redeemed only once
+func (r *MongoDBOAuthCodeRepository) Consume(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	now := time.Now()
+	filter := bson.M{
+		"code_hash":  codeHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+
+	var code models.OAuthAuthorizationCode
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}).Decode(&code)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOAuthCodeInvalid
+		}
+		return nil, err
+	}
+	return &code, nil
+}
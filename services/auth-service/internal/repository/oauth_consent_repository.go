@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrOAuthConsentNotFound is returned when the user has not granted the client anything
+var ErrOAuthConsentNotFound = errors.New("consent not found")
+
+// OAuthConsentRepository defines the interface for OAuth consent data access
+type OAuthConsentRepository interface {
+	Grant(ctx context.Context, userID, clientID string, scopes []string) error
+	FindActive(ctx context.Context, userID, clientID string) (*models.OAuthConsent, error)
+	FindActiveByUser(ctx context.Context, userID string) ([]*models.OAuthConsent, error)
+	Revoke(ctx context.Context, userID, clientID string) error
+}
+
+// MongoDBOAuthConsentRepository is the MongoDB implementation of OAuthConsentRepository
+type MongoDBOAuthConsentRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOAuthConsentRepository creates a new MongoDB OAuth consent repository
+func NewOAuthConsentRepository(db *mongo.Database) OAuthConsentRepository {
+	return &MongoDBOAuthConsentRepository{
+		collection: db.Collection("oauth_consents"),
+	}
+}
+
+// Grant adds scopes to the user's active consent for the client, creating it if needed
+func (r *MongoDBOAuthConsentRepository) Grant(ctx context.Context, userID, clientID string, scopes []string) error {
+	now := time.Now()
+	filter := bson.M{
+		"user_id":    userID,
+		"client_id":  clientID,
+		"revoked_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"scopes": bson.M{"$each": scopes}},
+		"$set":      bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{
+			"_id":        uuid.New().String(),
+			"created_at": now,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *MongoDBOAuthConsentRepository) FindActive(ctx context.Context, userID, clientID string) (*models.OAuthConsent, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"client_id":  clientID,
+		"revoked_at": bson.M{"$exists": false},
+	}
+
+	var consent models.OAuthConsent
+	err := r.collection.FindOne(ctx, filter).Decode(&consent)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOAuthConsentNotFound
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// FindActiveByUser returns every client the user currently grants access to, most recent first
+func (r *MongoDBOAuthConsentRepository) FindActiveByUser(ctx context.Context, userID string) ([]*models.OAuthConsent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	consents := []*models.OAuthConsent{}
+	if err := cursor.All(ctx, &consents); err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+func (r *MongoDBOAuthConsentRepository) Revoke(ctx context.Context, userID, clientID string) error {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID, "client_id": clientID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOAuthConsentNotFound
+	}
+	return nil
+}
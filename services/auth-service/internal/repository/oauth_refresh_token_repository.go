@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOAuthRefreshTokenNotFound is returned for unknown OAuth refresh tokens
+var ErrOAuthRefreshTokenNotFound = errors.New("refresh token not found")
+
+// OAuthRefreshTokenRepository defines the interface for OAuth refresh token data access
+type OAuthRefreshTokenRepository interface {
+	Create(ctx context.Context, token *models.OAuthRefreshToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*models.OAuthRefreshToken, error)
+	MarkRotated(ctx context.Context, id string) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	// RevokeForClient revokes every grant of the user, or of all users when userID is empty, to the
+	// client and returns their family IDs
+	RevokeForClient(ctx context.Context, userID, clientID string) ([]string, error)
+}
+
+// MongoDBOAuthRefreshTokenRepository is the MongoDB implementation of OAuthRefreshTokenRepository
+type MongoDBOAuthRefreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOAuthRefreshTokenRepository creates a new MongoDB OAuth refresh token repository
+func NewOAuthRefreshTokenRepository(db *mongo.Database) OAuthRefreshTokenRepository {
+	return &MongoDBOAuthRefreshTokenRepository{
+		collection: db.Collection("oauth_refresh_tokens"),
+	}
+}
+
+func (r *MongoDBOAuthRefreshTokenRepository) Create(ctx context.Context, token *models.OAuthRefreshToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+func (r *MongoDBOAuthRefreshTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*models.OAuthRefreshToken, error) {
+	var token models.OAuthRefreshToken
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOAuthRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRotated records that a token was exchanged. It only succeeds for a token that is neither
+// rotated nor revoked, so two concurrent refreshes with one token cannot both win.
+func (r *MongoDBOAuthRefreshTokenRepository) MarkRotated(ctx context.Context, id string) (bool, error) {
+	filter := bson.M{
+		"_id":        id,
+		"rotated_at": bson.M{"$exists": false},
+		"revoked_at": bson.M{"$exists": false},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"rotated_at": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *MongoDBOAuthRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"family_id": familyID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+func (r *MongoDBOAuthRefreshTokenRepository) RevokeForClient(ctx context.Context, userID, clientID string) ([]string, error) {
+	filter := bson.M{"client_id": clientID, "revoked_at": bson.M{"$exists": false}}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+
+	familyIDs, err := r.collection.Distinct(ctx, "family_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}}); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(familyIDs))
+	for _, id := range familyIDs {
+		if s, ok := id.(string); ok {
+			ids = append(ids, s)
+		}
+	}
+	return ids, nil
+}
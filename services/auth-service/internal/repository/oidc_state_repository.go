@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOIDCStateInvalid is returned for login states that are unknown, used or expired
+var ErrOIDCStateInvalid = errors.New("invalid or expired login state")
+
+// OIDCStateRepository defines the interface for pending single sign-on logins
+type OIDCStateRepository interface {
+	Create(ctx context.Context, state *models.OIDCLoginState) error
+	Consume(ctx context.Context, stateHash string) (*models.OIDCLoginState, error)
+}
+
+// MongoDBOIDCStateRepository is the MongoDB implementation of OIDCStateRepository
+type MongoDBOIDCStateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOIDCStateRepository creates a new MongoDB login state repository
+func NewOIDCStateRepository(db *mongo.Database) OIDCStateRepository {
+	return &MongoDBOIDCStateRepository{
+		collection: db.Collection("oidc_login_states"),
+	}
+}
+
+func (r *MongoDBOIDCStateRepository) Create(ctx context.Context, state *models.OIDCLoginState) error {
+	_, err := r.collection.InsertOne(ctx, state)
+	return err
+}
+
+// Consume marks an unused, unexpired state as used and returns it, so that each authorization
+// response can only be redeemed once
+func (r *MongoDBOIDCStateRepository) Consume(ctx context.Context, stateHash string) (*models.OIDCLoginState, error) {
+	now := time.Now()
+	filter := bson.M{
+		"state_hash": stateHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+
+	var state models.OIDCLoginState
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}).Decode(&state)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOIDCStateInvalid
+		}
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrResetTokenInvalid is returned for reset tokens that are unknown, used or expired
+var ErrResetTokenInvalid = errors.New("invalid or expired reset token")
+
+// PasswordResetRepository defines the interface for password reset token data access
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	Consume(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	InvalidateForUser(ctx context.Context, userID string) error
+}
+
+// MongoDBPasswordResetRepository is the MongoDB implementation of PasswordResetRepository
+type MongoDBPasswordResetRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPasswordResetRepository creates a new MongoDB password reset token repository
+func NewPasswordResetRepository(db *mongo.Database) PasswordResetRepository {
+	return &MongoDBPasswordResetRepository{
+		collection: db.Collection("password_reset_tokens"),
+	}
+}
+
+func (r *MongoDBPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// Consume marks an unused, unexpired token as used and returns it. The check and the update
+// are a single operation, so a token can only be consumed once.
+func (r *MongoDBPasswordResetRepository) Consume(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+
+	var token models.PasswordResetToken
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrResetTokenInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// InvalidateForUser marks every outstanding token of the user as used
+func (r *MongoDBPasswordResetRepository) InvalidateForUser(ctx context.Context, userID string) error {
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	return err
+}
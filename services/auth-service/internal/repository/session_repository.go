@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSessionNotFound is returned when a session does not exist
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository defines the interface for session data access
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindActiveByUserID(ctx context.Context, userID string) ([]*models.Session, error)
+	Touch(ctx context.Context, id string, client models.ClientInfo, refreshToken *models.RefreshToken) error
+	FindByID(ctx context.Context, id string) (*models.Session, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeAllForUser(ctx context.Context, userID string) error
+}
+
+// MongoDBSessionRepository is the MongoDB implementation of SessionRepository
+type MongoDBSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSessionRepository creates a new MongoDB session repository
+func NewSessionRepository(db *mongo.Database) SessionRepository {
+	return &MongoDBSessionRepository{
+		collection: db.Collection("sessions"),
+	}
+}
+
+func (r *MongoDBSessionRepository) Create(ctx context.Context, session *models.Session) error {
+	_, err := r.collection.InsertOne(ctx, session)
+	return err
+}
+
+func (r *MongoDBSessionRepository) FindActiveByUserID(ctx context.Context, userID string) ([]*models.Session, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch records a refresh of the session: the client it came from and the refresh token it now uses
+func (r *MongoDBSessionRepository) Touch(ctx context.Context, id string, client models.ClientInfo, refreshToken *models.RefreshToken) error {
+	update := bson.M{
+		"$set": bson.M{
+			"user_agent":       client.UserAgent,
+			"ip_address":       client.IPAddress,
+			"refresh_token_id": refreshToken.ID,
+			"last_seen_at":     time.Now(),
+			"expires_at":       refreshToken.ExpiresAt,
+		},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}}, update)
+	return err
+}
+
+func (r *MongoDBSessionRepository) FindByID(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *MongoDBSessionRepository) Revoke(ctx context.Context, id string) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+func (r *MongoDBSessionRepository) RevokeAllForUser(ctx context.Context, userID string) error {
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
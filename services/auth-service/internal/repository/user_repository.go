@@ -3,36 +3,82 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/joaquinidiarte/cloudbox/shared/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrUserNotFound is returned when no user matches
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailTaken is returned when another account already has the email address
+	ErrEmailTaken = errors.New("email already registered")
 )
 
 // UserRepository defines the interface for user data access
 type UserRepository interface {
+	EnsureIndexes(ctx context.Context) error
 	Create(ctx context.Context, user *models.User) error
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	FindByUsername(ctx context.Context, username string) (*models.User, error)
 	FindByID(ctx context.Context, id string) (*models.User, error)
 	ExistsByEmail(ctx context.Context, email string) (bool, error)
 	ExistsByUsername(ctx context.Context, username string) (bool, error)
+	UpdatePassword(ctx context.Context, id, hashedPassword string) error
+	MarkEmailVerified(ctx context.Context, id, email string) (bool, error)
+	ConfirmEmailChange(ctx context.Context, id, email string) (bool, error)
+	SetTOTPPendingSecret(ctx context.Context, id, secret string) error
+	EnableTOTP(ctx context.Context, id, secret string, counter int64, recoveryCodes []string) (bool, error)
+	DisableTOTP(ctx context.Context, id string) error
+	UseTOTPCounter(ctx context.Context, id string, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, id, codeHash string) (bool, error)
+	FindByExternalIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+	LinkExternalIdentity(ctx context.Context, id string, identity models.ExternalIdentity) (bool, error)
 }
 
 // MongoDBUserRepository is the MongoDB implementation of UserRepository
 type MongoDBUserRepository struct {
 	collection *mongo.Collection
+	plans      *mongo.Collection
 }
 
 // NewUserRepository creates a new MongoDB user repository
 func NewUserRepository(db *mongo.Database) UserRepository {
 	return &MongoDBUserRepository{
 		collection: db.Collection("users"),
+		plans:      db.Collection("plans"),
 	}
 }
 
+// EnsureIndexes creates the unique index on email, which is what keeps two accounts from sharing
+// an address when they register or change it at the same time. It fails if some already do.
+func (r *MongoDBUserRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true),
+	})
+	return err
+}
+
+// Create inserts a new user. The user gets the storage limit of their plan as currently stored,
+// which admins may have changed from the built-in one.
 func (r *MongoDBUserRepository) Create(ctx context.Context, user *models.User) error {
-	_, err := r.collection.InsertOne(ctx, user)
+	var plan models.Plan
+	err := r.plans.FindOne(ctx, bson.M{"_id": user.Plan()}).Decode(&plan)
+	if err == nil {
+		user.StorageLimit = plan.StorageLimit
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	_, err = r.collection.InsertOne(ctx, user)
+	// Email is the only unique field besides the ID
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
 
@@ -41,7 +87,7 @@ func (r *MongoDBUserRepository) FindByEmail(ctx context.Context, email string) (
 	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -53,7 +99,7 @@ func (r *MongoDBUserRepository) FindByUsername(ctx context.Context, username str
 	err := r.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -65,7 +111,7 @@ func (r *MongoDBUserRepository) FindByID(ctx context.Context, id string) (*model
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -87,3 +133,191 @@ func (r *MongoDBUserRepository) ExistsByUsername(ctx context.Context, username s
 	}
 	return count > 0, nil
 }
+
+func (r *MongoDBUserRepository) UpdatePassword(ctx context.Context, id, hashedPassword string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"password":   hashedPassword,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// MarkEmailVerified verifies the user's current address, as long as it is still email
+func (r *MongoDBUserRepository) MarkEmailVerified(ctx context.Context, id, email string) (bool, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"email_verified":    true,
+			"email_verified_at": now,
+			"updated_at":        now,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "email": email}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ConfirmEmailChange replaces the user's address with the pending one, as long as email is
+// still the pending address
+func (r *MongoDBUserRepository) ConfirmEmailChange(ctx context.Context, id, email string) (bool, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"email":             email,
+			"email_verified":    true,
+			"email_verified_at": now,
+			"updated_at":        now,
+		},
+		"$unset": bson.M{"pending_email": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "pending_email": email}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, ErrEmailTaken
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// SetTOTPPendingSecret stores a secret that becomes active once a first code confirms it
+func (r *MongoDBUserRepository) SetTOTPPendingSecret(ctx context.Context, id, secret string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"totp_pending_secret": secret,
+			"updated_at":          time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// EnableTOTP activates the pending secret, as long as it is still the given one. counter is the
+// time step of the confirming code, which can not be used again.
+func (r *MongoDBUserRepository) EnableTOTP(ctx context.Context, id, secret string, counter int64, recoveryCodes []string) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"totp_enabled":      true,
+			"totp_secret":       secret,
+			"totp_last_counter": counter,
+			"recovery_codes":    recoveryCodes,
+			"updated_at":        time.Now(),
+		},
+		"$unset": bson.M{"totp_pending_secret": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "totp_pending_secret": secret}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *MongoDBUserRepository) DisableTOTP(ctx context.Context, id string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"totp_enabled": false,
+			"updated_at":   time.Now(),
+		},
+		"$unset": bson.M{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_counter":   "",
+			"recovery_codes":      "",
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// UseTOTPCounter records the time step of an accepted code. It fails for a step that is not newer
+// than the last accepted one, so a code can not be replayed.
+func (r *MongoDBUserRepository) UseTOTPCounter(ctx context.Context, id string, counter int64) (bool, error) {
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"totp_last_counter": bson.M{"$exists": false}},
+			bson.M{"totp_last_counter": bson.M{"$lt": counter}},
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_counter": counter}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// UseRecoveryCode removes a recovery code hash. It fails if the code was already used.
+func (r *MongoDBUserRepository) UseRecoveryCode(ctx context.Context, id, codeHash string) (bool, error) {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "recovery_codes": codeHash},
+		bson.M{"$pull": bson.M{"recovery_codes": codeHash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *MongoDBUserRepository) FindByExternalIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	filter := bson.M{"external_identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}}}
+
+	var user models.User
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkExternalIdentity adds an identity to the user, as long as the user's address is still the
+// one the provider vouched for. The provider verified that address, so it is marked verified too.
+func (r *MongoDBUserRepository) LinkExternalIdentity(ctx context.Context, id string, identity models.ExternalIdentity) (bool, error) {
+	filter := bson.M{
+		"_id":   id,
+		"email": identity.Email,
+		"external_identities": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"issuer": identity.Issuer,
+		}}},
+	}
+	update := bson.M{
+		"$push": bson.M{"external_identities": identity},
+		"$set": bson.M{
+			"email_verified": true,
+			"updated_at":     identity.LinkedAt,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
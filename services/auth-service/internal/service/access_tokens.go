@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrInvalidAccessTokenRequest is returned for unknown scopes or an expiry in the past
+var ErrInvalidAccessTokenRequest = errors.New("invalid access token request")
+
+const (
+	// accessTokenBytes is the entropy of a personal access token
+	accessTokenBytes = 32
+	// accessTokenHintLength characters after the prefix are kept to recognize a token in listings
+	accessTokenHintLength = 4
+)
+
+// CreateAccessToken issues a personal access token. The returned token is not stored and can not
+// be shown again.
+func (s *AuthService) CreateAccessToken(ctx context.Context, userID string, req models.CreateAccessTokenRequest) (*models.CreateAccessTokenResponse, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiry must be in the future", ErrInvalidAccessTokenRequest)
+	}
+
+	random, err := utils.GenerateToken(accessTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	rawToken := models.AccessTokenPrefix + random
+	hint := rawToken[:len(models.AccessTokenPrefix)+accessTokenHintLength]
+
+	token := models.NewPersonalAccessToken(userID, strings.TrimSpace(req.Name), utils.HashString(rawToken), hint, scopes, req.ExpiresAt)
+	if err := s.accessTokenRepo.Create(ctx, token); err != nil {
+		return nil, err
+	}
+	s.recordUserEvent(ctx, models.AuditAccessTokenCreate, userID, "access_token", token.ID)
+
+	return &models.CreateAccessTokenResponse{
+		Token:       rawToken,
+		AccessToken: *token,
+	}, nil
+}
+
+func (s *AuthService) ListAccessTokens(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error) {
+	return s.accessTokenRepo.FindActiveByUserID(ctx, userID)
+}
+
+func (s *AuthService) RevokeAccessToken(ctx context.Context, userID, id string) error {
+	if err := s.accessTokenRepo.Revoke(ctx, userID, id); err != nil {
+		return err
+	}
+	s.recordUserEvent(ctx, models.AuditAccessTokenRevoke, userID, "access_token", id)
+	return nil
+}
+
+// normalizeScopes checks scopes against the known ones and drops duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAccessTokenRequest, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range models.AccessTokenScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrImpersonationNotAllowed is returned for impersonating oneself or another admin
+var ErrImpersonationNotAllowed = errors.New("this user can not be impersonated")
+
+// ForceLogout ends every session of a user on behalf of an admin
+func (s *AuthService) ForceLogout(ctx context.Context, actorID, userID string) error {
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.endAllSessions(ctx, userID); err != nil {
+		return err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditAdminForceLogout,
+		ActorID:    actorID,
+		SubjectID:  userID,
+		TargetType: "user",
+		TargetID:   userID,
+	})
+	return nil
+}
+
+// Impersonate issues an access token that lets a support admin act as the user. The token has its
+// own session ID and no refresh token, and the user's account management endpoints refuse it.
+// Admins can not be impersonated, so impersonation never reaches the admin API.
+func (s *AuthService) Impersonate(ctx context.Context, actor *utils.Claims, userID string) (*models.ImpersonationResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == actor.UserID || user.HasRole(models.RoleAdmin) {
+		return nil, ErrImpersonationNotAllowed
+	}
+	if !user.IsActive {
+		return nil, ErrAccountInactive
+	}
+
+	token, expiresAt, err := s.jwtManager.GenerateImpersonation(user, uuid.New().String(), actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditAdminImpersonate,
+		ActorID:    actor.UserID,
+		SubjectID:  user.ID,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+	return &models.ImpersonationResponse{
+		Token:          token,
+		ExpiresAt:      expiresAt,
+		User:           user.ToResponse(),
+		ImpersonatorID: actor.UserID,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// Login methods recorded with login audit events
+const (
+	loginMethodPassword = "password"
+	loginMethodMFA      = "mfa"
+	loginMethodSSO      = "sso"
+	loginMethodDevice   = "device"
+	loginMethodRegister = "register"
+)
+
+// recordLogin records a login attempt. A failed attempt is attributed to the account it was made
+// against when that account exists, so users see the failures in their own audit log.
+func (s *AuthService) recordLogin(ctx context.Context, method, email string, user *models.User, loginErr error) {
+	event := models.AuditEvent{Action: models.AuditLogin, Details: map[string]string{"method": method}}
+	if loginErr != nil {
+		event.Outcome = models.AuditFailure
+		event.Details["reason"] = loginErr.Error()
+		if user == nil && email != "" {
+			user, _ = s.userRepo.FindByEmail(ctx, email)
+		}
+		if user == nil {
+			event.Details["email"] = email
+		}
+	}
+	if user != nil {
+		event.SubjectID = user.ID
+		if loginErr == nil {
+			event.ActorID = user.ID
+		}
+	}
+	s.auditLog.Record(ctx, event)
+}
+
+// recordUserEvent records an action users take on their own account
+func (s *AuthService) recordUserEvent(ctx context.Context, action, userID, targetType, targetID string) {
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     action,
+		ActorID:    userID,
+		SubjectID:  userID,
+		TargetType: targetType,
+		TargetID:   targetID,
+	})
+}
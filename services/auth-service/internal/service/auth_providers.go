@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrInvalidCredentials is returned when no provider accepts the email and password
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAuthProviderUnavailable is returned when the credentials were refused while a provider
+	// could not be asked, so they may have been right
+	ErrAuthProviderUnavailable = errors.New("authentication is temporarily unavailable, try again later")
+)
+
+// AuthProvider checks an email and password against one source of accounts
+type AuthProvider interface {
+	// Name identifies the provider in logs
+	Name() string
+	// Authenticate returns the user the credentials belong to, or ErrInvalidCredentials
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+}
+
+// PasswordProvider checks the password hash stored with the user
+type PasswordProvider struct {
+	userRepo repository.UserRepository
+}
+
+func NewPasswordProvider(userRepo repository.UserRepository) *PasswordProvider {
+	return &PasswordProvider{userRepo: userRepo}
+}
+
+func (p *PasswordProvider) Name() string {
+	return "password"
+}
+
+func (p *PasswordProvider) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := p.userRepo.FindByEmail(ctx, email)
+	// Accounts created through single sign-on or a directory have no password of their own
+	if err != nil || user.Password == "" {
+		checkDummyPassword(password)
+		return nil, ErrInvalidCredentials
+	}
+	if !utils.CheckPassword(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// authenticate asks each provider in turn until one accepts the credentials. A provider that
+// fails, such as an unreachable directory, does not keep the others from accepting them.
+func (s *AuthService) authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	unavailable := false
+	for _, provider := range s.authProviders {
+		user, err := provider.Authenticate(ctx, email, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			s.logger.Errorf("Authentication provider %s failed: %v", provider.Name(), err)
+			unavailable = true
+		}
+	}
+	if unavailable {
+		return nil, ErrAuthProviderUnavailable
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -3,32 +3,89 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/loginguard"
 	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
 	"github.com/joaquinidiarte/cloudbox/shared/utils"
 )
 
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+// The whole token family is revoked when this happens, since the token has likely leaked.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// ErrAccountInactive is returned when a deactivated user tries to log in
+var ErrAccountInactive = errors.New("account is inactive")
+
+// refreshTokenBytes is the entropy of an opaque refresh token
+const refreshTokenBytes = 32
+
 type AuthService struct {
-	userRepo   repository.UserRepository
-	jwtManager *utils.JWTManager
+	userRepo                repository.UserRepository
+	refreshTokenRepo        repository.RefreshTokenRepository
+	sessionRepo             repository.SessionRepository
+	passwordResetRepo       repository.PasswordResetRepository
+	emailVerificationRepo   repository.EmailVerificationRepository
+	mfaChallengeRepo        repository.MFAChallengeRepository
+	accessTokenRepo         repository.AccessTokenRepository
+	oidcStateRepo           repository.OIDCStateRepository
+	deviceAuthorizationRepo repository.DeviceAuthorizationRepository
+	jwtManager              *utils.JWTManager
+	revocations             revocation.Store
+	loginGuard              *loginguard.Guard
+	authProviders           []AuthProvider
+	mailer                  mailer.Mailer
+	logger                  *utils.Logger
+	auditLog                *audit.Recorder
+	tokenTTLs               TokenTTLs
+	frontendURL             string
+	sso                     SSOConfig
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtManager *utils.JWTManager) *AuthService {
+// TokenTTLs are the lifetimes of the tokens the AuthService issues, besides access tokens
+type TokenTTLs struct {
+	RefreshToken      time.Duration
+	PasswordReset     time.Duration
+	EmailVerification time.Duration
+}
+
+func NewAuthService(userRepo repository.UserRepository, refreshTokenRepo repository.RefreshTokenRepository, sessionRepo repository.SessionRepository, passwordResetRepo repository.PasswordResetRepository, emailVerificationRepo repository.EmailVerificationRepository, mfaChallengeRepo repository.MFAChallengeRepository, accessTokenRepo repository.AccessTokenRepository, oidcStateRepo repository.OIDCStateRepository, deviceAuthorizationRepo repository.DeviceAuthorizationRepository, jwtManager *utils.JWTManager, revocations revocation.Store, loginGuard *loginguard.Guard, authProviders []AuthProvider, mailer mailer.Mailer, logger *utils.Logger, auditLog *audit.Recorder, tokenTTLs TokenTTLs, frontendURL string, sso SSOConfig) *AuthService {
 	return &AuthService{
-		userRepo:   userRepo,
-		jwtManager: jwtManager,
+		userRepo:                userRepo,
+		refreshTokenRepo:        refreshTokenRepo,
+		sessionRepo:             sessionRepo,
+		passwordResetRepo:       passwordResetRepo,
+		emailVerificationRepo:   emailVerificationRepo,
+		mfaChallengeRepo:        mfaChallengeRepo,
+		accessTokenRepo:         accessTokenRepo,
+		oidcStateRepo:           oidcStateRepo,
+		deviceAuthorizationRepo: deviceAuthorizationRepo,
+		jwtManager:              jwtManager,
+		revocations:             revocations,
+		loginGuard:              loginGuard,
+		authProviders:           authProviders,
+		mailer:                  mailer,
+		logger:                  logger,
+		auditLog:                auditLog,
+		tokenTTLs:               tokenTTLs,
+		frontendURL:             frontendURL,
+		sso:                     sso,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, req models.RegisterRequest) (*models.LoginResponse, error) {
+func (s *AuthService) Register(ctx context.Context, req models.RegisterRequest, client models.ClientInfo) (*models.LoginResponse, error) {
 	// Check if email already exists
 	exists, err := s.userRepo.ExistsByEmail(ctx, req.Email)
 	if err != nil {
 		return nil, err
 	}
 	if exists {
-		return nil, errors.New("email already registered")
+		return nil, ErrEmailTaken
 	}
 
 	// Check if username already exists
@@ -59,47 +116,157 @@ func (s *AuthService) Register(ctx context.Context, req models.RegisterRequest)
 		return nil, err
 	}
 
-	// Generate token
-	token, expiresAt, err := s.jwtManager.Generate(user)
+	// The account is usable right away; a failed email can be resent later
+	if err := s.sendVerification(ctx, user, user.Email); err != nil {
+		s.logger.Errorf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+	s.recordLogin(ctx, loginMethodRegister, user.Email, user, nil)
+
+	return s.startSession(ctx, user, client)
+}
+
+// Login checks the credentials and starts a session. For users with 2FA enabled it returns an
+// MFA challenge instead, to be completed with CompleteMFALogin.
+// Repeated failures throttle further attempts per account and per client IP; unknown emails
+// are counted and answered just like wrong passwords.
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest, client models.ClientInfo) (*models.LoginResponse, *models.MFAChallengeResponse, error) {
+	if err := s.checkLoginAllowed(ctx, req.Email, client.IPAddress); err != nil {
+		s.recordLogin(ctx, loginMethodPassword, req.Email, nil, err)
+		return nil, nil, err
+	}
+
+	// Check the password with the local accounts and any configured directory
+	user, err := s.authenticate(ctx, req.Email, req.Password)
 	if err != nil {
-		return nil, err
+		s.recordLoginFailure(ctx, req.Email, client.IPAddress)
+		s.recordLogin(ctx, loginMethodPassword, req.Email, nil, err)
+		return nil, nil, err
 	}
 
-	return &models.LoginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User:      user.ToResponse(),
-	}, nil
+	// Only reported to someone who knows the password
+	if !user.IsActive {
+		s.recordLogin(ctx, loginMethodPassword, req.Email, user, ErrAccountInactive)
+		return nil, nil, ErrAccountInactive
+	}
+
+	// Failures are only cleared once the second factor is passed too
+	if user.TOTPEnabled {
+		challenge, err := s.startMFAChallenge(ctx, user)
+		return nil, challenge, err
+	}
+	s.recordLoginSuccess(ctx, req.Email)
+
+	response, err := s.startSession(ctx, user, client)
+	s.recordLogin(ctx, loginMethodPassword, req.Email, user, err)
+	return response, nil, err
 }
 
-func (s *AuthService) Login(ctx context.Context, req models.LoginRequest) (*models.LoginResponse, error) {
-	// Find user by email
-	user, err := s.userRepo.FindByEmail(ctx, req.Email)
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// The presented token is rotated and can not be used again.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client models.ClientInfo) (*models.LoginResponse, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashString(refreshToken))
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, errors.New("invalid refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, errors.New("refresh token has been revoked")
+	}
+	if stored.RotatedAt != nil {
+		return nil, s.refreshTokenReused(ctx, stored)
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, errors.New("refresh token has expired")
 	}
 
-	// Check if user is active
+	user, err := s.userRepo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, errors.New("invalid refresh token")
+	}
 	if !user.IsActive {
-		return nil, errors.New("account is inactive")
+		return nil, ErrAccountInactive
 	}
 
-	// Verify password
-	if !utils.CheckPassword(req.Password, user.Password) {
-		return nil, errors.New("invalid credentials")
+	response, newToken, err := s.generateTokens(user, stored.FamilyID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate token
-	token, expiresAt, err := s.jwtManager.Generate(user)
+	// Lost the race against another refresh with the same token: treat it as reuse
+	rotated, err := s.refreshTokenRepo.MarkRotated(ctx, stored.ID, newToken.ID)
 	if err != nil {
 		return nil, err
 	}
+	if !rotated {
+		return nil, s.refreshTokenReused(ctx, stored)
+	}
+
+	if err := s.refreshTokenRepo.Create(ctx, newToken); err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.Touch(ctx, stored.FamilyID, client, newToken); err != nil {
+		return nil, err
+	}
+	s.recordUserEvent(ctx, models.AuditTokenRefresh, user.ID, "session", stored.FamilyID)
+	return response, nil
+}
+
+// refreshTokenReused ends the session of a refresh token presented after it was rotated
+func (s *AuthService) refreshTokenReused(ctx context.Context, stored *models.RefreshToken) error {
+	if err := s.revokeSession(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditTokenRefresh,
+		Outcome:    models.AuditFailure,
+		SubjectID:  stored.UserID,
+		TargetType: "session",
+		TargetID:   stored.FamilyID,
+		Details:    map[string]string{"reason": ErrRefreshTokenReused.Error()},
+	})
+	return ErrRefreshTokenReused
+}
+
+// startSession records a new session and issues its first access and refresh token
+func (s *AuthService) startSession(ctx context.Context, user *models.User, client models.ClientInfo) (*models.LoginResponse, error) {
+	response, refreshToken, err := s.generateTokens(user, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refreshTokenRepo.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.Create(ctx, models.NewSession(refreshToken.FamilyID, user.ID, client, refreshToken)); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// generateTokens builds a token pair without storing the refresh token. An empty familyID
+// starts a new family; the family ID doubles as the session ID.
+func (s *AuthService) generateTokens(user *models.User, familyID string) (*models.LoginResponse, *models.RefreshToken, error) {
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+
+	token, expiresAt, err := s.jwtManager.Generate(user, familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawRefreshToken, err := utils.GenerateToken(refreshTokenBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken := models.NewRefreshToken(user.ID, familyID, utils.HashString(rawRefreshToken), s.tokenTTLs.RefreshToken)
 
 	return &models.LoginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User:      user.ToResponse(),
-	}, nil
+		Token:                 token,
+		ExpiresAt:             expiresAt,
+		RefreshToken:          rawRefreshToken,
+		RefreshTokenExpiresAt: refreshToken.ExpiresAt.Unix(),
+		User:                  user.ToResponse(),
+	}, refreshToken, nil
 }
 
 func (s *AuthService) VerifyToken(ctx context.Context, token string) (*utils.Claims, error) {
@@ -107,5 +274,103 @@ func (s *AuthService) VerifyToken(ctx context.Context, token string) (*utils.Cla
 	if err != nil {
 		return nil, errors.New("invalid or expired token")
 	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New("token has been revoked")
+	}
 	return claims, nil
 }
+
+// Logout ends the session of the presented access token. Tokens issued before sessions existed
+// carry no sid; for those the refresh token family is revoked if the refresh token is given.
+func (s *AuthService) Logout(ctx context.Context, claims *utils.Claims, refreshToken string) error {
+	sessionID := claims.SessionID
+	if sessionID != "" {
+		if err := s.revokeSession(ctx, sessionID); err != nil {
+			return err
+		}
+	} else if refreshToken != "" {
+		stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashString(refreshToken))
+		if err == nil && stored.UserID == claims.UserID {
+			if err := s.refreshTokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+				return err
+			}
+			sessionID = stored.FamilyID
+		}
+	}
+
+	if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	s.recordUserEvent(ctx, models.AuditLogout, claims.UserID, "session", sessionID)
+	return nil
+}
+
+// LogoutAll revokes every session, access and refresh token the user currently holds
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) error {
+	if err := s.endAllSessions(ctx, userID); err != nil {
+		return err
+	}
+	s.recordUserEvent(ctx, models.AuditLogoutAll, userID, "user", userID)
+	return nil
+}
+
+// endAllSessions revokes the user's sessions and tokens without recording why. Each active session
+// is revoked by ID as well, so a token refreshed while this runs is rejected even if it was
+// issued after the user cutoff.
+func (s *AuthService) endAllSessions(ctx context.Context, userID string) error {
+	sessions, err := s.sessionRepo.FindActiveByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.revocations.RevokeSession(ctx, session.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeUser(ctx, userID, time.Now())
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *AuthService) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	return s.sessionRepo.FindActiveByUserID(ctx, userID)
+}
+
+// RevokeSession ends one of the user's sessions, including the access tokens already issued for it
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	session, err := s.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	// Someone else's session is reported as missing so session IDs can not be probed
+	if session.UserID != userID || session.RevokedAt != nil {
+		return repository.ErrSessionNotFound
+	}
+	if err := s.revokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	s.recordUserEvent(ctx, models.AuditSessionRevoke, userID, "session", sessionID)
+	return nil
+}
+
+// revokeSession revokes the refresh token family and the access tokens of a session
+func (s *AuthService) revokeSession(ctx context.Context, sessionID string) error {
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(ctx, sessionID)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const (
+	// deviceCodeTTL is how long the user has to approve a device login
+	deviceCodeTTL = 10 * time.Minute
+	// deviceCodeBytes is the entropy of the device code the device polls with
+	deviceCodeBytes = 32
+	// devicePollInterval is the minimum number of seconds between polls; each slow_down adds
+	// deviceSlowDownSeconds to it, as RFC 8628 section 3.5 asks
+	devicePollInterval    = 5
+	deviceSlowDownSeconds = 5
+	// userCodeAlphabet has no vowels, to avoid forming words, and no characters easily confused.
+	// Eight of them, shown as XXXX-XXXX, give about 34 bits of entropy.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// StartDeviceAuthorization begins a login for a device without a browser. The device shows the
+// user code and polls PollDeviceToken with the device code until the user decides.
+func (s *AuthService) StartDeviceAuthorization(ctx context.Context, client models.ClientInfo) (*models.DeviceCodeResponse, error) {
+	deviceCode, err := utils.GenerateToken(deviceCodeBytes)
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	authorization := models.NewDeviceAuthorization(utils.HashString(deviceCode), utils.HashString(normalizeUserCode(userCode)), client, devicePollInterval, deviceCodeTTL)
+	if err := s.deviceAuthorizationRepo.Create(ctx, authorization); err != nil {
+		return nil, err
+	}
+
+	verificationURI := strings.TrimSuffix(s.frontendURL, "/") + "/device"
+	return &models.DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+// GetDeviceAuthorization describes the device waiting for the user code, so the user can check
+// it is theirs before approving
+func (s *AuthService) GetDeviceAuthorization(ctx context.Context, userCode string) (*models.DeviceAuthorizationResponse, error) {
+	authorization, err := s.deviceAuthorizationRepo.FindPendingByUserCode(ctx, utils.HashString(normalizeUserCode(userCode)))
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeviceAuthorizationResponse{
+		UserAgent: authorization.UserAgent,
+		IPAddress: authorization.IPAddress,
+		CreatedAt: authorization.CreatedAt,
+		ExpiresAt: authorization.ExpiresAt,
+	}, nil
+}
+
+// VerifyDevice approves or denies the device login waiting for the user code
+func (s *AuthService) VerifyDevice(ctx context.Context, userID string, req models.DeviceVerificationRequest) error {
+	authorization, err := s.deviceAuthorizationRepo.FindPendingByUserCode(ctx, utils.HashString(normalizeUserCode(req.UserCode)))
+	if err != nil {
+		return err
+	}
+
+	status := models.DeviceAuthorizationDenied
+	if req.Approve {
+		status = models.DeviceAuthorizationApproved
+	}
+	decided, err := s.deviceAuthorizationRepo.Decide(ctx, authorization.ID, userID, status)
+	if err != nil {
+		return err
+	}
+	if !decided {
+		return repository.ErrUserCodeInvalid
+	}
+
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditDeviceApprove,
+		ActorID:    userID,
+		SubjectID:  userID,
+		TargetType: "device_authorization",
+		TargetID:   authorization.ID,
+		Details:    map[string]string{"decision": status, "device_ip": authorization.IPAddress},
+	})
+	return nil
+}
+
+// PollDeviceToken is polled by the device. Until the user decides it returns an OAuthError with
+// authorization_pending, or slow_down when polled faster than the interval; once approved it
+// starts a session for the device like a password login does.
+func (s *AuthService) PollDeviceToken(ctx context.Context, req models.DeviceTokenRequest) (*models.LoginResponse, error) {
+	if req.GrantType != models.DeviceCodeGrantType {
+		return nil, oauthError("unsupported_grant_type", "only the device_code grant is supported")
+	}
+
+	authorization, err := s.deviceAuthorizationRepo.Poll(ctx, utils.HashString(req.DeviceCode))
+	if err != nil {
+		if errors.Is(err, repository.ErrDeviceCodeInvalid) {
+			return nil, oauthError("invalid_grant", "invalid device code")
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(authorization.ExpiresAt) {
+		return nil, oauthError("expired_token", "the device code has expired, start the login again")
+	}
+	if authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < time.Duration(authorization.Interval)*time.Second {
+		if err := s.deviceAuthorizationRepo.SlowDown(ctx, authorization.ID, deviceSlowDownSeconds); err != nil {
+			return nil, err
+		}
+		return nil, oauthError("slow_down", "polling too often")
+	}
+
+	switch authorization.Status {
+	case models.DeviceAuthorizationPending:
+		return nil, oauthError("authorization_pending", "waiting for the user to approve the login")
+	case models.DeviceAuthorizationDenied:
+		return nil, oauthError("access_denied", "the user denied the login")
+	}
+
+	used, err := s.deviceAuthorizationRepo.MarkUsed(ctx, authorization.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, oauthError("invalid_grant", "invalid device code")
+	}
+
+	user, err := s.userRepo.FindByID(ctx, authorization.UserID)
+	if err != nil || !user.IsActive {
+		return nil, oauthError("access_denied", "the account is not available")
+	}
+
+	response, err := s.startSession(ctx, user, models.ClientInfo{
+		UserAgent: authorization.UserAgent,
+		IPAddress: authorization.IPAddress,
+	})
+	s.recordLogin(ctx, loginMethodDevice, "", user, err)
+	return response, err
+}
+
+// generateUserCode returns a random user code formatted as XXXX-XXXX
+func generateUserCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// normalizeUserCode makes user code entry forgiving of case, spaces and dashes
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			return r
+		}
+		return -1
+	}, code)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrEmailAlreadyVerified is returned when a verification email is requested with nothing to verify
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	// ErrEmailTaken is returned when a pending address was registered by someone else in the meantime
+	ErrEmailTaken = repository.ErrEmailTaken
+)
+
+// verificationTokenBytes is the entropy of an email verification token
+const verificationTokenBytes = 32
+
+// VerifyEmail confirms the address a verification token was sent to. For a pending address
+// change this is when the new address replaces the old one. The token is only used up once the
+// address is confirmed, so a link that fails because the address was taken can be retried.
+func (s *AuthService) VerifyEmail(ctx context.Context, rawToken string) (*models.UserResponse, error) {
+	tokenHash := utils.HashString(rawToken)
+	token, err := s.emailVerificationRepo.FindValid(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated bool
+	switch token.Email {
+	case user.Email:
+		updated, err = s.userRepo.MarkEmailVerified(ctx, user.ID, token.Email)
+	case user.PendingEmail:
+		// The unique index on email refuses the change if someone registered the address meanwhile
+		updated, err = s.userRepo.ConfirmEmailChange(ctx, user.ID, token.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The address changed since the token was sent
+	if !updated {
+		return nil, repository.ErrVerificationTokenInvalid
+	}
+
+	// A concurrent request with the same link may have used it up first, which is fine: both
+	// confirmed the same address
+	if _, err := s.emailVerificationRepo.Consume(ctx, tokenHash); err != nil && !errors.Is(err, repository.ErrVerificationTokenInvalid) {
+		return nil, err
+	}
+
+	user, err = s.userRepo.FindByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// ResendVerification sends a new verification link for the pending address or, if there is
+// none, for the current address when it is not verified yet
+func (s *AuthService) ResendVerification(ctx context.Context, userID string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case user.PendingEmail != "":
+		return s.sendVerification(ctx, user, user.PendingEmail)
+	case !user.EmailVerified:
+		return s.sendVerification(ctx, user, user.Email)
+	default:
+		return ErrEmailAlreadyVerified
+	}
+}
+
+// sendVerification emails a verification link for email. Older links of the user stop working.
+func (s *AuthService) sendVerification(ctx context.Context, user *models.User, email string) error {
+	if err := s.emailVerificationRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	rawToken, err := utils.GenerateToken(verificationTokenBytes)
+	if err != nil {
+		return err
+	}
+	token := models.NewEmailVerificationToken(user.ID, email, utils.HashString(rawToken), s.tokenTTLs.EmailVerification)
+	if err := s.emailVerificationRepo.Create(ctx, token); err != nil {
+		return err
+	}
+
+	link := mailer.Link(s.frontendURL, "/verify-email", rawToken)
+	mailer.SendAsync(s.mailer, mailer.EmailVerificationMessage(email, user.FirstName, link, s.tokenTTLs.EmailVerification), s.logger)
+	return nil
+}
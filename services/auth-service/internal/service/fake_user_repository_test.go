@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// fakeUserRepository keeps users in memory. It implements the lookups and writes the sign-in
+// providers use; the rest of repository.UserRepository panics if called.
+type fakeUserRepository struct {
+	repository.UserRepository
+
+	mu    sync.Mutex
+	users map[string]*models.User
+}
+
+func newFakeUserRepository(users ...*models.User) *fakeUserRepository {
+	r := &fakeUserRepository{users: make(map[string]*models.User)}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *fakeUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Email, user.Email) {
+			return repository.ErrEmailTaken
+		}
+	}
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *fakeUserRepository) find(match func(*models.User) bool) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (r *fakeUserRepository) FindByID(ctx context.Context, id string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r *fakeUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return strings.EqualFold(u.Email, email) })
+}
+
+func (r *fakeUserRepository) ExistsByUsername(ctx context.Context, username string) (bool, error) {
+	_, err := r.find(func(u *models.User) bool { return u.Username == username })
+	return err == nil, nil
+}
+
+func (r *fakeUserRepository) FindByExternalIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return r.find(func(u *models.User) bool {
+		for _, identity := range u.ExternalIdentities {
+			if identity.Issuer == issuer && identity.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *fakeUserRepository) LinkExternalIdentity(ctx context.Context, id string, identity models.ExternalIdentity) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.Email != identity.Email {
+		return false, nil
+	}
+	for _, existing := range user.ExternalIdentities {
+		if existing.Issuer == identity.Issuer {
+			return false, nil
+		}
+	}
+	user.ExternalIdentities = append(user.ExternalIdentities, identity)
+	user.EmailVerified = true
+	return true, nil
+}
+
+// count returns the number of stored users
+func (r *fakeUserRepository) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.users)
+}
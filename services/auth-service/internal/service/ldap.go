@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/ldapauth"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// LDAPProvider checks passwords against an LDAP directory. Directory users are linked to the
+// account with the same email, or get one created on their first login.
+type LDAPProvider struct {
+	directory       *ldapauth.Directory
+	userRepo        repository.UserRepository
+	logger          *utils.Logger
+	autoCreateUsers bool
+}
+
+func NewLDAPProvider(directory *ldapauth.Directory, userRepo repository.UserRepository, logger *utils.Logger, autoCreateUsers bool) *LDAPProvider {
+	return &LDAPProvider{
+		directory:       directory,
+		userRepo:        userRepo,
+		logger:          logger,
+		autoCreateUsers: autoCreateUsers,
+	}
+}
+
+func (p *LDAPProvider) Name() string {
+	return "ldap"
+}
+
+func (p *LDAPProvider) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	entry, err := p.directory.Authenticate(email, password)
+	if err != nil {
+		if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	return p.resolveUser(ctx, entry)
+}
+
+// resolveUser finds the account for a directory entry: the one already linked to it, otherwise
+// the one with the same, verified email, otherwise a new one. As with single sign-on, an
+// account whose email is unverified is never linked.
+func (p *LDAPProvider) resolveUser(ctx context.Context, entry *ldapauth.Entry) (*models.User, error) {
+	source := p.directory.Source()
+	if user, err := p.userRepo.FindByExternalIdentity(ctx, source, entry.ID); err == nil {
+		return user, nil
+	}
+
+	identity := models.ExternalIdentity{
+		Issuer:   source,
+		Subject:  entry.ID,
+		Email:    entry.Email,
+		LinkedAt: time.Now(),
+	}
+
+	user, err := p.userRepo.FindByEmail(ctx, entry.Email)
+	if err == nil {
+		if !user.EmailVerified {
+			p.logger.Warnf("Directory entry %s matches user %s, whose email is not verified", entry.DN, user.ID)
+			return nil, ErrInvalidCredentials
+		}
+		linked, err := p.userRepo.LinkExternalIdentity(ctx, user.ID, identity)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			p.logger.Warnf("Directory entry %s matches user %s, which is linked to another entry", entry.DN, user.ID)
+			return nil, ErrInvalidCredentials
+		}
+		p.logger.Infof("Linked directory entry %s to user %s", entry.DN, user.ID)
+		return p.userRepo.FindByID(ctx, user.ID)
+	}
+
+	if !p.autoCreateUsers {
+		p.logger.Warnf("Directory entry %s has no account and accounts are not created on login", entry.DN)
+		return nil, ErrInvalidCredentials
+	}
+	return p.createUser(ctx, entry, identity)
+}
+
+// createUser creates an account without a password for a directory entry
+func (p *LDAPProvider) createUser(ctx context.Context, entry *ldapauth.Entry, identity models.ExternalIdentity) (*models.User, error) {
+	preferred := entry.Username
+	if preferred == "" {
+		preferred = entry.Email
+	}
+	username, err := availableUsername(ctx, p.userRepo, preferred)
+	if err != nil {
+		return nil, err
+	}
+
+	firstName := entry.FirstName
+	if firstName == "" {
+		firstName = username
+	}
+	user := models.NewUser(models.UserCreateRequest{
+		Email:     entry.Email,
+		Username:  username,
+		FirstName: firstName,
+		LastName:  entry.LastName,
+	}, "")
+	// The directory is trusted to hold the user's real address
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &identity.LinkedAt
+	user.ExternalIdentities = []models.ExternalIdentity{identity}
+
+	if err := p.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	p.logger.Infof("Created user %s on first directory login of %s", user.ID, entry.DN)
+	return user, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/ldapauth"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/ldapauth/ldaptest"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const ldapTestUUID = "9a1e4f2c-3b6d-4c8e-8f0a-1d2c3b4a5e6f"
+
+var ldapTestEntry = ldaptest.Entry{
+	DN:       "uid=jane,ou=people,dc=cloudbox,dc=test",
+	Password: "jane-password",
+	Attributes: map[string][]string{
+		"uid":       {"Jane.Doe"},
+		"mail":      {"jane@cloudbox.test"},
+		"givenName": {"Jane"},
+		"sn":        {"Doe"},
+		"entryUUID": {ldapTestUUID},
+	},
+}
+
+func newTestLDAPProvider(t *testing.T, userRepo *fakeUserRepository, autoCreate bool) *LDAPProvider {
+	t.Helper()
+	server, err := ldaptest.NewServer(ldapTestEntry)
+	if err != nil {
+		t.Fatalf("start LDAP server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	directory := ldapauth.NewDirectory(ldapauth.Config{
+		URL:         server.URL(),
+		BaseDN:      "ou=people,dc=cloudbox,dc=test",
+		IDAttribute: "entryUUID",
+		Timeout:     5 * time.Second,
+	})
+	return NewLDAPProvider(directory, userRepo, utils.NewLogger("test"), autoCreate)
+}
+
+func TestLDAPProviderCreatesUserOnFirstLogin(t *testing.T) {
+	userRepo := newFakeUserRepository()
+	provider := newTestLDAPProvider(t, userRepo, true)
+
+	user, err := provider.Authenticate(context.Background(), "jane@cloudbox.test", "jane-password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Email != "jane@cloudbox.test" || user.Username != "jane.doe" || user.FirstName != "Jane" || user.LastName != "Doe" {
+		t.Errorf("user = %s %q %q %q, want the directory attributes", user.Email, user.Username, user.FirstName, user.LastName)
+	}
+	if !user.EmailVerified || user.Password != "" {
+		t.Errorf("EmailVerified = %v, Password = %q; want a verified account without a password", user.EmailVerified, user.Password)
+	}
+	if len(user.ExternalIdentities) != 1 || user.ExternalIdentities[0].Subject != ldapTestUUID {
+		t.Errorf("ExternalIdentities = %+v, want the entryUUID", user.ExternalIdentities)
+	}
+
+	// The second login finds the same account through the linked identity
+	again, err := provider.Authenticate(context.Background(), "jane@cloudbox.test", "jane-password")
+	if err != nil {
+		t.Fatalf("second Authenticate: %v", err)
+	}
+	if again.ID != user.ID || userRepo.count() != 1 {
+		t.Errorf("second login gave user %s with %d users stored, want %s and 1", again.ID, userRepo.count(), user.ID)
+	}
+}
+
+func TestLDAPProviderWithoutAutoCreate(t *testing.T) {
+	userRepo := newFakeUserRepository()
+	provider := newTestLDAPProvider(t, userRepo, false)
+
+	if _, err := provider.Authenticate(context.Background(), "jane@cloudbox.test", "jane-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want ErrInvalidCredentials", err)
+	}
+	if userRepo.count() != 0 {
+		t.Errorf("%d users created, want none", userRepo.count())
+	}
+}
+
+func TestLDAPProviderLinksVerifiedAccount(t *testing.T) {
+	existing := models.NewUser(models.UserCreateRequest{Email: "jane@cloudbox.test", Username: "jane"}, "hash")
+	existing.EmailVerified = true
+	userRepo := newFakeUserRepository(existing)
+	provider := newTestLDAPProvider(t, userRepo, true)
+
+	user, err := provider.Authenticate(context.Background(), "jane@cloudbox.test", "jane-password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.ID != existing.ID || len(user.ExternalIdentities) != 1 {
+		t.Errorf("user = %s with %d identities, want %s linked", user.ID, len(user.ExternalIdentities), existing.ID)
+	}
+}
+
+func TestLDAPProviderDoesNotLinkUnverifiedAccount(t *testing.T) {
+	existing := models.NewUser(models.UserCreateRequest{Email: "jane@cloudbox.test", Username: "jane"}, "hash")
+	userRepo := newFakeUserRepository(existing)
+	provider := newTestLDAPProvider(t, userRepo, true)
+
+	if _, err := provider.Authenticate(context.Background(), "jane@cloudbox.test", "jane-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want ErrInvalidCredentials", err)
+	}
+	if stored, _ := userRepo.FindByID(context.Background(), existing.ID); len(stored.ExternalIdentities) != 0 {
+		t.Errorf("unverified account was linked: %+v", stored.ExternalIdentities)
+	}
+}
+
+func TestLDAPProviderRejectsBadCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", "jane@cloudbox.test", "wrong"},
+		{"empty password", "jane@cloudbox.test", ""},
+		{"unknown user", "nobody@cloudbox.test", "jane-password"},
+		{"wildcard email", "*", "jane-password"},
+	}
+	userRepo := newFakeUserRepository()
+	provider := newTestLDAPProvider(t, userRepo, true)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := provider.Authenticate(context.Background(), tt.email, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+	if userRepo.count() != 0 {
+		t.Errorf("%d users created, want none", userRepo.count())
+	}
+}
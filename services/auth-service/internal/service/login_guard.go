@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrTooManyAttempts is returned while logins are throttled after repeated failures
+	ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+	// ErrLoginGuardUnavailable is returned when failed attempts can not be checked; logins are
+	// refused rather than let through without brute-force protection
+	ErrLoginGuardUnavailable = errors.New("login is temporarily unavailable, try again later")
+)
+
+// ThrottledError carries how long the client has to wait; it matches ErrTooManyAttempts
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// checkDummyPassword spends the same time as a real password check, so that unknown emails
+// can not be told apart by how long the login takes
+func checkDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = utils.HashPassword("cloudbox-dummy-password")
+	})
+	utils.CheckPassword(password, dummyPasswordHash)
+}
+
+// checkLoginAllowed returns a ThrottledError if the account or the client IP has to wait, and
+// ErrLoginGuardUnavailable if the counter store fails
+func (s *AuthService) checkLoginAllowed(ctx context.Context, email, ip string) error {
+	wait, err := s.loginGuard.Check(ctx, email, ip)
+	if err != nil {
+		s.logger.Errorf("Failed to check login attempts: %v", err)
+		return ErrLoginGuardUnavailable
+	}
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt and emits an audit event for every lockout it causes
+func (s *AuthService) recordLoginFailure(ctx context.Context, email, ip string) {
+	lockouts, err := s.loginGuard.RecordFailure(ctx, email, ip)
+	if err != nil {
+		s.logger.Errorf("Failed to record failed login: %v", err)
+	}
+	for _, lockout := range lockouts {
+		s.auditLog.Record(ctx, models.AuditEvent{
+			Action:    models.AuditLoginLockout,
+			Outcome:   models.AuditFailure,
+			IPAddress: ip,
+			Details:   map[string]string{"key": lockout.Key, "until": lockout.Until.Format(time.RFC3339)},
+		})
+	}
+}
+
+func (s *AuthService) recordLoginSuccess(ctx context.Context, email string) {
+	if err := s.loginGuard.RecordSuccess(ctx, email); err != nil {
+		s.logger.Errorf("Failed to reset failed logins: %v", err)
+	}
+}
+
+// checkSecondFactorAllowed throttles the 2FA codes a signed-in user enters to manage 2FA, so a
+// stolen session can not guess its way to turning 2FA off
+func (s *AuthService) checkSecondFactorAllowed(ctx context.Context, userID string) error {
+	wait, err := s.loginGuard.CheckUser(ctx, userID)
+	if err != nil {
+		s.logger.Errorf("Failed to check second factor attempts: %v", err)
+		return ErrLoginGuardUnavailable
+	}
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordSecondFactorFailure counts a wrong code and records it, and any lockout it causes, in the
+// audit log under the 2FA action it was entered for
+func (s *AuthService) recordSecondFactorFailure(ctx context.Context, action, userID string) {
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     action,
+		Outcome:    models.AuditFailure,
+		ActorID:    userID,
+		SubjectID:  userID,
+		TargetType: "user",
+		TargetID:   userID,
+		Details:    map[string]string{"reason": ErrInvalidMFACode.Error()},
+	})
+
+	lockout, err := s.loginGuard.RecordUserFailure(ctx, userID)
+	if err != nil {
+		s.logger.Errorf("Failed to record failed second factor: %v", err)
+	}
+	if lockout != nil {
+		s.auditLog.Record(ctx, models.AuditEvent{
+			Action:    models.AuditLoginLockout,
+			Outcome:   models.AuditFailure,
+			SubjectID: userID,
+			Details:   map[string]string{"key": lockout.Key, "until": lockout.Until.Format(time.RFC3339)},
+		})
+	}
+}
+
+func (s *AuthService) recordSecondFactorSuccess(ctx context.Context, userID string) {
+	if err := s.loginGuard.RecordUserSuccess(ctx, userID); err != nil {
+		s.logger.Errorf("Failed to reset failed second factors: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication enrollment has not been started")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode     = errors.New("invalid authentication code")
+)
+
+const (
+	// totpIssuer is shown next to the account in authenticator apps
+	totpIssuer = "CloudBox"
+	// mfaChallengeTTL is how long the second login step can take
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is how many wrong codes a challenge tolerates before the login must restart
+	mfaMaxAttempts = 5
+	// mfaTokenBytes is the entropy of an MFA challenge token
+	mfaTokenBytes = 32
+	// recoveryCodeCount recovery codes are issued when 2FA is enabled, each with 40 bits of entropy
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5
+)
+
+// EnrollTOTP starts 2FA enrollment with a new secret. The secret is only activated by ConfirmTOTP,
+// so an abandoned enrollment does not lock the user out.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID string) (*models.TOTPEnrollmentResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetTOTPPendingSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables 2FA once the user proves their authenticator works. The recovery codes are
+// returned only here; just their hashes are stored.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID, code string) (*models.RecoveryCodesResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if err := s.checkSecondFactorAllowed(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	counter, ok := utils.ValidateTOTP(user.TOTPPendingSecret, code, time.Now())
+	if !ok {
+		s.recordSecondFactorFailure(ctx, models.AuditMFAEnable, user.ID)
+		return nil, ErrInvalidMFACode
+	}
+	s.recordSecondFactorSuccess(ctx, user.ID)
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.userRepo.EnableTOTP(ctx, user.ID, user.TOTPPendingSecret, int64(counter), hashes)
+	if err != nil {
+		return nil, err
+	}
+	// Enrollment was restarted in the meantime
+	if !enabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+	s.recordUserEvent(ctx, models.AuditMFAEnable, user.ID, "user", user.ID)
+
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP turns 2FA off. It takes a current TOTP code or a recovery code.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID, code string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+	if err := s.checkSecondFactorAllowed(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordSecondFactorFailure(ctx, models.AuditMFADisable, user.ID)
+		}
+		return err
+	}
+	s.recordSecondFactorSuccess(ctx, user.ID)
+	if err := s.userRepo.DisableTOTP(ctx, user.ID); err != nil {
+		return err
+	}
+	s.recordUserEvent(ctx, models.AuditMFADisable, user.ID, "user", user.ID)
+	return nil
+}
+
+// CompleteMFALogin finishes a login that returned an MFA challenge
+func (s *AuthService) CompleteMFALogin(ctx context.Context, req models.MFALoginRequest, client models.ClientInfo) (*models.LoginResponse, error) {
+	challenge, err := s.mfaChallengeRepo.FindActive(ctx, utils.HashString(req.MFAToken), mfaMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, repository.ErrMFAChallengeInvalid
+	}
+	if !user.IsActive {
+		s.recordLogin(ctx, loginMethodMFA, "", user, ErrAccountInactive)
+		return nil, ErrAccountInactive
+	}
+	// Guessing codes across fresh challenges counts against the account like wrong passwords
+	if err := s.checkLoginAllowed(ctx, user.Email, client.IPAddress); err != nil {
+		s.recordLogin(ctx, loginMethodMFA, "", user, err)
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(ctx, user, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(ctx, user.Email, client.IPAddress)
+			s.recordLogin(ctx, loginMethodMFA, "", user, err)
+			if err := s.mfaChallengeRepo.RecordFailedAttempt(ctx, challenge.ID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	used, err := s.mfaChallengeRepo.MarkUsed(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, repository.ErrMFAChallengeInvalid
+	}
+	s.recordLoginSuccess(ctx, user.Email)
+
+	response, err := s.startSession(ctx, user, client)
+	s.recordLogin(ctx, loginMethodMFA, "", user, err)
+	return response, err
+}
+
+// startMFAChallenge creates the challenge returned by the first login step
+func (s *AuthService) startMFAChallenge(ctx context.Context, user *models.User) (*models.MFAChallengeResponse, error) {
+	rawToken, err := utils.GenerateToken(mfaTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	challenge := models.NewMFAChallenge(user.ID, utils.HashString(rawToken), mfaChallengeTTL)
+	if err := s.mfaChallengeRepo.Create(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    rawToken,
+		ExpiresAt:   challenge.ExpiresAt.Unix(),
+	}, nil
+}
+
+// verifySecondFactor accepts a TOTP code that was not used before or an unused recovery code
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	if !user.TOTPEnabled || user.TOTPSecret == "" {
+		return ErrTOTPNotEnabled
+	}
+	code = strings.TrimSpace(code)
+
+	if counter, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		fresh, err := s.userRepo.UseTOTPCounter(ctx, user.ID, int64(counter))
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	for _, hash := range user.RecoveryCodes {
+		if !utils.CheckPassword(normalized, hash) {
+			continue
+		}
+		used, err := s.userRepo.UseRecoveryCode(ctx, user.ID, hash)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		s.logger.Infof("Recovery code used by user %s, %d left", user.ID, len(user.RecoveryCodes)-1)
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// generateRecoveryCodes returns codes formatted as XXXX-XXXX and the bcrypt hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(b)
+
+		hash, err := utils.HashPassword(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrInvalidOAuthClientRequest is returned for client registrations with bad redirect URIs or scopes
+var ErrInvalidOAuthClientRequest = errors.New("invalid OAuth client")
+
+const (
+	// oauthSecretBytes is the entropy of client secrets, authorization codes and refresh tokens
+	oauthSecretBytes = 32
+	// oauthCodeTTL is how long a client has to redeem an authorization code
+	oauthCodeTTL = time.Minute
+)
+
+// OAuthError is an error as defined by RFC 6749 section 5.2. When RedirectURL is set the
+// authorization request was valid enough to send the error back to the client.
+type OAuthError struct {
+	Code        string
+	Description string
+	RedirectURL string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthService lets users authorize third-party clients to act on their behalf with limited scopes
+type OAuthService struct {
+	clientRepo       repository.OAuthClientRepository
+	consentRepo      repository.OAuthConsentRepository
+	codeRepo         repository.OAuthCodeRepository
+	refreshTokenRepo repository.OAuthRefreshTokenRepository
+	userRepo         repository.UserRepository
+	jwtManager       *utils.JWTManager
+	revocations      revocation.Store
+	logger           *utils.Logger
+	auditLog         *audit.Recorder
+	refreshTokenTTL  time.Duration
+}
+
+func NewOAuthService(clientRepo repository.OAuthClientRepository, consentRepo repository.OAuthConsentRepository, codeRepo repository.OAuthCodeRepository, refreshTokenRepo repository.OAuthRefreshTokenRepository, userRepo repository.UserRepository, jwtManager *utils.JWTManager, revocations revocation.Store, logger *utils.Logger, auditLog *audit.Recorder, refreshTokenTTL time.Duration) *OAuthService {
+	return &OAuthService{
+		clientRepo:       clientRepo,
+		consentRepo:      consentRepo,
+		codeRepo:         codeRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		userRepo:         userRepo,
+		jwtManager:       jwtManager,
+		revocations:      revocations,
+		logger:           logger,
+		auditLog:         auditLog,
+		refreshTokenTTL:  refreshTokenTTL,
+	}
+}
+
+// CreateClient registers a client owned by the user. The secret of a confidential client is
+// returned once and not stored.
+func (s *OAuthService) CreateClient(ctx context.Context, ownerID string, req models.CreateOAuthClientRequest) (*models.CreateOAuthClientResponse, error) {
+	for _, redirectURI := range req.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return nil, err
+		}
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOAuthClientRequest, err)
+	}
+	if len(scopes) == 0 {
+		scopes = models.AccessTokenScopes
+	}
+
+	var secret, secretHash string
+	if req.Confidential {
+		if secret, err = utils.GenerateToken(oauthSecretBytes); err != nil {
+			return nil, err
+		}
+		secretHash = utils.HashString(secret)
+	}
+
+	client := models.NewOAuthClient(ownerID, strings.TrimSpace(req.Name), secretHash, req.Confidential, req.RedirectURIs, scopes)
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateOAuthClientResponse{
+		ClientSecret: secret,
+		Client:       *client,
+	}, nil
+}
+
+func (s *OAuthService) ListClients(ctx context.Context, ownerID string) ([]*models.OAuthClient, error) {
+	return s.clientRepo.FindActiveByOwner(ctx, ownerID)
+}
+
+// RevokeClient deletes a client and revokes every token issued to it
+func (s *OAuthService) RevokeClient(ctx context.Context, ownerID, clientID string) error {
+	if err := s.clientRepo.Revoke(ctx, ownerID, clientID); err != nil {
+		return err
+	}
+	return s.revokeGrants(ctx, "", clientID)
+}
+
+// ListConsents returns the clients the user has granted access to
+func (s *OAuthService) ListConsents(ctx context.Context, userID string) ([]*models.OAuthConsentResponse, error) {
+	consents, err := s.consentRepo.FindActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientIDs := make([]string, 0, len(consents))
+	for _, consent := range consents {
+		clientIDs = append(clientIDs, consent.ClientID)
+	}
+	clients, err := s.clientRepo.FindByIDs(ctx, clientIDs)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(clients))
+	for _, client := range clients {
+		names[client.ID] = client.Name
+	}
+
+	responses := make([]*models.OAuthConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		responses = append(responses, &models.OAuthConsentResponse{
+			OAuthConsent: *consent,
+			ClientName:   names[consent.ClientID],
+		})
+	}
+	return responses, nil
+}
+
+// RevokeConsent withdraws the user's consent and revokes every token the client holds for them
+func (s *OAuthService) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	if err := s.consentRepo.Revoke(ctx, userID, clientID); err != nil {
+		return err
+	}
+	if err := s.revokeGrants(ctx, userID, clientID); err != nil {
+		return err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditOAuthConsentRevoke,
+		ActorID:    userID,
+		SubjectID:  userID,
+		TargetType: "oauth_client",
+		TargetID:   clientID,
+	})
+	return nil
+}
+
+// revokeGrants revokes the refresh tokens of the client, for one user or for all when userID is
+// empty, and the access tokens issued from them
+func (s *OAuthService) revokeGrants(ctx context.Context, userID, clientID string) error {
+	familyIDs, err := s.refreshTokenRepo.RevokeForClient(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	for _, familyID := range familyIDs {
+		if err := s.revocations.RevokeSession(ctx, familyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAuthorization validates an authorization request for the consent page
+func (s *OAuthService) GetAuthorization(ctx context.Context, userID string, req models.OAuthAuthorizeRequest) (*models.OAuthAuthorizationDetails, error) {
+	client, _, scopes, err := s.validateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	consented := false
+	if consent, err := s.consentRepo.FindActive(ctx, userID, client.ID); err == nil {
+		consented = containsAll(consent.Scopes, scopes)
+	} else if !errors.Is(err, repository.ErrOAuthConsentNotFound) {
+		return nil, err
+	}
+
+	return &models.OAuthAuthorizationDetails{
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scopes:     scopes,
+		Consented:  consented,
+	}, nil
+}
+
+// Decide records the user's answer to an authorization request and returns where to send the
+// browser: back to the client with an authorization code, or with access_denied
+func (s *OAuthService) Decide(ctx context.Context, userID string, req models.OAuthDecisionRequest) (*models.OAuthRedirectResponse, error) {
+	client, redirectURI, scopes, err := s.validateAuthorizeRequest(ctx, req.OAuthAuthorizeRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.Approve {
+		return &models.OAuthRedirectResponse{
+			RedirectURL: withQuery(redirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}}),
+		}, nil
+	}
+
+	if err := s.consentRepo.Grant(ctx, userID, client.ID, scopes); err != nil {
+		return nil, err
+	}
+
+	rawCode, err := utils.GenerateToken(oauthSecretBytes)
+	if err != nil {
+		return nil, err
+	}
+	// The token request has to repeat the redirect URI exactly as it was sent here
+	code := models.NewOAuthAuthorizationCode(utils.HashString(rawCode), client.ID, userID, req.RedirectURI, req.CodeChallenge, scopes, oauthCodeTTL)
+	if err := s.codeRepo.Create(ctx, code); err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditOAuthConsent,
+		ActorID:    userID,
+		SubjectID:  userID,
+		TargetType: "oauth_client",
+		TargetID:   client.ID,
+		Details:    map[string]string{"scope": strings.Join(scopes, " ")},
+	})
+	return &models.OAuthRedirectResponse{
+		RedirectURL: withQuery(redirectURI, url.Values{"code": {rawCode}, "state": {req.State}}),
+	}, nil
+}
+
+// validateAuthorizeRequest checks an authorization request and resolves its redirect URI and
+// scopes. Errors about the client or redirect URI must not be sent to that URI; the others carry
+// a RedirectURL reporting them to the client.
+func (s *OAuthService) validateAuthorizeRequest(ctx context.Context, req models.OAuthAuthorizeRequest) (*models.OAuthClient, string, []string, error) {
+	client, err := s.clientRepo.FindActiveByID(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, "", nil, oauthError("invalid_client", "unknown client")
+		}
+		return nil, "", nil, err
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !contains(client.RedirectURIs, redirectURI) {
+		return nil, "", nil, oauthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	redirectError := func(code, description string) error {
+		return &OAuthError{
+			Code:        code,
+			Description: description,
+			RedirectURL: withQuery(redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {req.State}}),
+		}
+	}
+
+	if req.ResponseType != "code" {
+		return nil, "", nil, redirectError("unsupported_response_type", "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, "", nil, redirectError("invalid_request", "PKCE with the S256 method is required")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	scopes, err = normalizeScopes(scopes)
+	if err != nil || !containsAll(client.Scopes, scopes) {
+		return nil, "", nil, redirectError("invalid_scope", "the requested scope is unknown or not allowed for this client")
+	}
+
+	return client, redirectURI, scopes, nil
+}
+
+// validateRedirectURI accepts absolute URIs without a fragment. Plain HTTP is only allowed for
+// loopback addresses, for native and development clients.
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+		return fmt.Errorf("%w: redirect URI %q must be an absolute URL without a fragment", ErrInvalidOAuthClientRequest, redirectURI)
+	}
+	if parsed.Scheme == "http" {
+		host := parsed.Hostname()
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("%w: redirect URI %q must use https", ErrInvalidOAuthClientRequest, redirectURI)
+		}
+	} else if parsed.Scheme != "https" {
+		return fmt.Errorf("%w: redirect URI %q must use https", ErrInvalidOAuthClientRequest, redirectURI)
+	}
+	return nil
+}
+
+// withQuery adds parameters to a URL, keeping the ones it already has
+func withQuery(rawURL string, params url.Values) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(values, required []string) bool {
+	for _, r := range required {
+		if !contains(values, r) {
+			return false
+		}
+	}
+	return true
+}
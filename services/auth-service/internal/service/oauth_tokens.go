@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// AuthenticateClient checks the credentials a client sent to the token, introspection or
+// revocation endpoint. Confidential clients need their secret; public clients must not send one.
+func (s *OAuthService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	client, err := s.clientRepo.FindActiveByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, oauthError("invalid_client", "client authentication failed")
+		}
+		return nil, err
+	}
+
+	if client.Confidential {
+		if clientSecret == "" || subtle.ConstantTimeCompare([]byte(utils.HashString(clientSecret)), []byte(client.SecretHash)) != 1 {
+			return nil, oauthError("invalid_client", "client authentication failed")
+		}
+	} else if clientSecret != "" {
+		return nil, oauthError("invalid_client", "public clients have no secret")
+	}
+	return client, nil
+}
+
+// Token serves the token endpoint for the authorization_code and refresh_token grants
+func (s *OAuthService) Token(ctx context.Context, client *models.OAuthClient, req models.OAuthTokenRequest) (*models.OAuthTokenResponse, error) {
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(ctx, client, req)
+	case "refresh_token":
+		return s.refresh(ctx, client, req)
+	default:
+		return nil, oauthError("unsupported_grant_type", "only authorization_code and refresh_token are supported")
+	}
+}
+
+func (s *OAuthService) exchangeCode(ctx context.Context, client *models.OAuthClient, req models.OAuthTokenRequest) (*models.OAuthTokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, oauthError("invalid_request", "code and code_verifier are required")
+	}
+
+	code, err := s.codeRepo.Consume(ctx, utils.HashString(req.Code))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthCodeInvalid) {
+			return nil, oauthError("invalid_grant", "invalid or expired authorization code")
+		}
+		return nil, err
+	}
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "authorization code was issued for another client or redirect_uri")
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError("invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	user, err := s.activeUser(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, client.ID, "", code.Scopes, code.Scopes)
+}
+
+// refresh rotates a refresh token. Like login refresh tokens, presenting a rotated token again
+// revokes the whole grant.
+func (s *OAuthService) refresh(ctx context.Context, client *models.OAuthClient, req models.OAuthTokenRequest) (*models.OAuthTokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, oauthError("invalid_request", "refresh_token is required")
+	}
+
+	stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashString(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRefreshTokenNotFound) {
+			return nil, oauthError("invalid_grant", "invalid refresh token")
+		}
+		return nil, err
+	}
+	if stored.ClientID != client.ID || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	}
+	if stored.RotatedAt != nil {
+		return nil, s.refreshTokenReused(ctx, stored)
+	}
+
+	// The access token may be narrowed to fewer scopes; the grant itself keeps all of them
+	scopes := stored.Scopes
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		if !containsAll(stored.Scopes, requested) {
+			return nil, oauthError("invalid_scope", "the requested scope exceeds the original grant")
+		}
+		scopes = requested
+	}
+
+	user, err := s.activeUser(ctx, stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := s.refreshTokenRepo.MarkRotated(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, s.refreshTokenReused(ctx, stored)
+	}
+	return s.issueTokens(ctx, user, client.ID, stored.FamilyID, stored.Scopes, scopes)
+}
+
+func (s *OAuthService) refreshTokenReused(ctx context.Context, stored *models.OAuthRefreshToken) error {
+	if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditOAuthTokenIssue,
+		Outcome:    models.AuditFailure,
+		SubjectID:  stored.UserID,
+		TargetType: "oauth_client",
+		TargetID:   stored.ClientID,
+		Details:    map[string]string{"grant": stored.FamilyID, "reason": "refresh token reuse detected, grant revoked"},
+	})
+	return oauthError("invalid_grant", "invalid refresh token")
+}
+
+func (s *OAuthService) activeUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil || !user.IsActive {
+		return nil, oauthError("invalid_grant", "the user is no longer available")
+	}
+	return user, nil
+}
+
+// issueTokens issues an access token limited to scopes and a refresh token for the whole grant.
+// An empty familyID starts a new grant.
+func (s *OAuthService) issueTokens(ctx context.Context, user *models.User, clientID, familyID string, grantedScopes, scopes []string) (*models.OAuthTokenResponse, error) {
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+
+	accessToken, expiresAt, err := s.jwtManager.GenerateDelegated(user, familyID, clientID, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRefreshToken, err := utils.GenerateToken(oauthSecretBytes)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := models.NewOAuthRefreshToken(familyID, clientID, user.ID, utils.HashString(rawRefreshToken), grantedScopes, s.refreshTokenTTL)
+	if err := s.refreshTokenRepo.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditOAuthTokenIssue,
+		SubjectID:  user.ID,
+		TargetType: "oauth_client",
+		TargetID:   clientID,
+		Details:    map[string]string{"grant": familyID, "scope": strings.Join(scopes, " ")},
+	})
+
+	return &models.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresAt - time.Now().Unix(),
+		RefreshToken: rawRefreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// Introspect reports whether a token issued to the client is still active. Only confidential
+// clients may introspect, and tokens of other clients are reported as inactive.
+func (s *OAuthService) Introspect(ctx context.Context, client *models.OAuthClient, token string) (*models.OAuthIntrospectionResponse, error) {
+	if !client.Confidential {
+		return nil, oauthError("unauthorized_client", "only confidential clients may introspect tokens")
+	}
+
+	if claims, err := s.jwtManager.Verify(token); err == nil {
+		if claims.ClientID != client.ID {
+			return &models.OAuthIntrospectionResponse{Active: false}, nil
+		}
+		revoked, err := s.revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return &models.OAuthIntrospectionResponse{Active: false}, nil
+		}
+		return &models.OAuthIntrospectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Username:  claims.Username,
+			TokenType: "access_token",
+			Subject:   claims.UserID,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+		}, nil
+	}
+
+	stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashString(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRefreshTokenNotFound) {
+			return &models.OAuthIntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+	if stored.ClientID != client.ID || stored.RevokedAt != nil || stored.RotatedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return &models.OAuthIntrospectionResponse{Active: false}, nil
+	}
+	return &models.OAuthIntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(stored.Scopes, " "),
+		ClientID:  stored.ClientID,
+		TokenType: "refresh_token",
+		Subject:   stored.UserID,
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  stored.CreatedAt.Unix(),
+	}, nil
+}
+
+// Revoke revokes an access token, or a refresh token together with its whole grant. Unknown
+// tokens and tokens of other clients are ignored, as RFC 7009 asks.
+func (s *OAuthService) Revoke(ctx context.Context, client *models.OAuthClient, token string) error {
+	if claims, err := s.jwtManager.Verify(token); err == nil {
+		if claims.ClientID != client.ID {
+			return nil
+		}
+		if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+		s.recordRevoke(ctx, client.ID, claims.UserID, "access_token")
+		return nil
+	}
+
+	stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashString(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRefreshTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+	if stored.ClientID != client.ID {
+		return nil
+	}
+	if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	s.recordRevoke(ctx, client.ID, stored.UserID, "refresh_token")
+	return nil
+}
+
+// recordRevoke records a client revoking one of the user's tokens
+func (s *OAuthService) recordRevoke(ctx context.Context, clientID, userID, tokenType string) {
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     models.AuditOAuthTokenRevoke,
+		SubjectID:  userID,
+		TargetType: "oauth_client",
+		TargetID:   clientID,
+		Details:    map[string]string{"token_type": tokenType},
+	})
+}
+
+// revokeFamily revokes a grant's refresh tokens and the access tokens issued from them
+func (s *OAuthService) revokeFamily(ctx context.Context, familyID string) error {
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(ctx, familyID)
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against an S256 challenge (RFC 7636 section 4.6)
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/oidc"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrOIDCDisabled is returned when single sign-on is used without a configured provider
+	ErrOIDCDisabled = errors.New("single sign-on is not configured")
+	// ErrOIDCEmailNotAllowed is returned for addresses the provider did not verify or whose
+	// domain is not allowed to sign in
+	ErrOIDCEmailNotAllowed = errors.New("this email address can not sign in with single sign-on")
+	// ErrOIDCNoAccount is returned when no account matches and accounts are not created on login
+	ErrOIDCNoAccount = errors.New("no account exists for this email address")
+	// ErrOIDCIdentityConflict is returned when the account is already linked to another identity
+	// at the same provider
+	ErrOIDCIdentityConflict = errors.New("account is linked to a different single sign-on identity")
+	// ErrOIDCAccountUnverified is returned when the account with the email never verified it, so
+	// whoever registered it may not own the address
+	ErrOIDCAccountUnverified = errors.New("an account with this email exists but has not verified it; sign in with its password and verify the email first")
+)
+
+const (
+	// oidcStateTTL is how long a user has to complete a login at the provider
+	oidcStateTTL = 10 * time.Minute
+	// oidcTokenBytes is the entropy of the state, nonce and PKCE verifier
+	oidcTokenBytes = 32
+	// maxUsernameAttempts bounds the search for a free username for new accounts
+	maxUsernameAttempts = 5
+)
+
+// SSOConfig configures login with an external OpenID Connect provider
+type SSOConfig struct {
+	// Provider is nil when single sign-on is disabled
+	Provider     *oidc.Provider
+	Issuer       string
+	ProviderName string
+	// AllowedDomains restricts which email domains can sign in; empty allows all
+	AllowedDomains []string
+	// AutoCreateUsers creates an account on first login when no account has the email
+	AutoCreateUsers bool
+}
+
+// OIDCConfig tells the frontend whether single sign-on is available
+func (s *AuthService) OIDCConfig() models.OIDCConfigResponse {
+	if s.sso.Provider == nil {
+		return models.OIDCConfigResponse{Enabled: false}
+	}
+	return models.OIDCConfigResponse{Enabled: true, ProviderName: s.sso.ProviderName}
+}
+
+// StartOIDCLogin creates a pending login and returns the provider URL to send the browser to
+func (s *AuthService) StartOIDCLogin(ctx context.Context) (*models.OIDCAuthorizeResponse, error) {
+	if s.sso.Provider == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := utils.GenerateToken(oidcTokenBytes)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	authorizationURL, err := s.sso.Provider.AuthorizationURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.oidcStateRepo.Create(ctx, models.NewOIDCLoginState(utils.HashString(state), nonce, codeVerifier, oidcStateTTL)); err != nil {
+		return nil, err
+	}
+
+	return &models.OIDCAuthorizeResponse{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+	}, nil
+}
+
+// CompleteOIDCLogin redeems the provider's authorization response and logs the user in, linking
+// the identity to the account with the same verified email or creating one. Users with 2FA
+// enabled still get an MFA challenge.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, req models.OIDCCallbackRequest, client models.ClientInfo) (*models.LoginResponse, *models.MFAChallengeResponse, error) {
+	if s.sso.Provider == nil {
+		return nil, nil, ErrOIDCDisabled
+	}
+
+	state, err := s.oidcStateRepo.Consume(ctx, utils.HashString(req.State))
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := s.sso.Provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.resolveOIDCUser(ctx, claims)
+	if err != nil {
+		s.recordLogin(ctx, loginMethodSSO, claims.Email, nil, err)
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		s.recordLogin(ctx, loginMethodSSO, claims.Email, user, ErrAccountInactive)
+		return nil, nil, ErrAccountInactive
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := s.startMFAChallenge(ctx, user)
+		return nil, challenge, err
+	}
+	response, err := s.startSession(ctx, user, client)
+	s.recordLogin(ctx, loginMethodSSO, claims.Email, user, err)
+	return response, nil, err
+}
+
+// resolveOIDCUser finds the account for a provider identity: the one already linked to it,
+// otherwise the one with the same, verified email, otherwise a new one. An account whose email
+// is unverified is never linked, or someone could register the address first and share the
+// account of its owner once they sign in.
+func (s *AuthService) resolveOIDCUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	if !claims.EmailVerified || !s.emailDomainAllowed(claims.Email) {
+		return nil, ErrOIDCEmailNotAllowed
+	}
+
+	if user, err := s.userRepo.FindByExternalIdentity(ctx, s.sso.Issuer, claims.Subject); err == nil {
+		return user, nil
+	}
+
+	identity := models.ExternalIdentity{
+		Issuer:   s.sso.Issuer,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, claims.Email)
+	if err == nil {
+		if !user.EmailVerified {
+			return nil, ErrOIDCAccountUnverified
+		}
+		linked, err := s.userRepo.LinkExternalIdentity(ctx, user.ID, identity)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, ErrOIDCIdentityConflict
+		}
+		s.logger.Infof("Linked single sign-on identity to user %s", user.ID)
+		return s.userRepo.FindByID(ctx, user.ID)
+	}
+
+	if !s.sso.AutoCreateUsers {
+		return nil, ErrOIDCNoAccount
+	}
+	return s.createOIDCUser(ctx, claims, identity)
+}
+
+// createOIDCUser creates an account without a password; it can only be used through the
+// provider until the user sets a password with a reset
+func (s *AuthService) createOIDCUser(ctx context.Context, claims *oidc.Claims, identity models.ExternalIdentity) (*models.User, error) {
+	username, err := availableUsername(ctx, s.userRepo, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	if firstName == "" {
+		firstName = username
+	}
+
+	user := models.NewUser(models.UserCreateRequest{
+		Email:     claims.Email,
+		Username:  username,
+		FirstName: firstName,
+		LastName:  lastName,
+	}, "")
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &identity.LinkedAt
+	user.ExternalIdentities = []models.ExternalIdentity{identity}
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	s.logger.Infof("Created user %s on first single sign-on login", user.ID)
+	return user, nil
+}
+
+// availableUsername derives a free username from a preferred name or the local part of an email
+func availableUsername(ctx context.Context, userRepo repository.UserRepository, preferred string) (string, error) {
+	local, _, _ := strings.Cut(preferred, "@")
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return -1
+		}
+	}, local)
+	for len(base) < 3 {
+		base += "_"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for i := 0; i < maxUsernameAttempts; i++ {
+		exists, err := userRepo.ExistsByUsername(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		suffix, err := utils.GenerateToken(3)
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%s", base, strings.ToLower(suffix))
+	}
+	return "", errors.New("could not find a free username")
+}
+
+func (s *AuthService) emailDomainAllowed(email string) bool {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return false
+	}
+	if len(s.sso.AllowedDomains) == 0 {
+		return true
+	}
+	for _, allowed := range s.sso.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
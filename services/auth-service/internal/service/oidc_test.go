@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/oidc"
+	"github.com/joaquinidiarte/cloudbox/services/auth-service/internal/oidc/oidctest"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const oidcTestNonce = "nonce-1234"
+
+// ssoTest is an AuthService with single sign-on against an in-process provider
+type ssoTest struct {
+	idp      *oidctest.Provider
+	service  *AuthService
+	userRepo *fakeUserRepository
+}
+
+func newSSOTest(t *testing.T, userRepo *fakeUserRepository, allowedDomains ...string) *ssoTest {
+	t.Helper()
+	idp, err := oidctest.NewProvider("cloudbox")
+	if err != nil {
+		t.Fatalf("start provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	logger := utils.NewLogger("test")
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "cloudbox",
+		RedirectURL: "http://localhost:3000/auth/callback",
+		Scopes:      []string{"openid", "email"},
+	}, logger)
+	service := &AuthService{
+		userRepo: userRepo,
+		logger:   logger,
+		sso: SSOConfig{
+			Provider:        provider,
+			Issuer:          idp.Issuer(),
+			ProviderName:    "Test",
+			AllowedDomains:  allowedDomains,
+			AutoCreateUsers: true,
+		},
+	}
+	return &ssoTest{idp: idp, service: service, userRepo: userRepo}
+}
+
+// login redeems an ID token with the given claims and resolves the account it signs in to
+func (s *ssoTest) login(t *testing.T, claims jwt.MapClaims) (*models.User, error) {
+	t.Helper()
+	token, err := s.idp.Sign(claims)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	s.idp.IssueCode("code", token)
+
+	idClaims, err := s.service.sso.Provider.Exchange(context.Background(), "code", "verifier", oidcTestNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	return s.service.resolveOIDCUser(context.Background(), idClaims)
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	sso := newSSOTest(t, newFakeUserRepository())
+	claims := sso.idp.Claims("subject-1", "Jane.Doe@example.com", oidcTestNonce)
+	claims["name"] = "Jane Doe"
+
+	user, err := sso.login(t, claims)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if user.Username != "jane.doe" || user.FirstName != "Jane" || user.LastName != "Doe" || !user.EmailVerified {
+		t.Errorf("user = %q %q %q verified=%v", user.Username, user.FirstName, user.LastName, user.EmailVerified)
+	}
+
+	again, err := sso.login(t, sso.idp.Claims("subject-1", "Jane.Doe@example.com", oidcTestNonce))
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again.ID != user.ID || sso.userRepo.count() != 1 {
+		t.Errorf("second login gave user %s with %d users stored, want %s and 1", again.ID, sso.userRepo.count(), user.ID)
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedProviderEmail(t *testing.T) {
+	sso := newSSOTest(t, newFakeUserRepository())
+	claims := sso.idp.Claims("subject-1", "jane@example.com", oidcTestNonce)
+	claims["email_verified"] = false
+
+	if _, err := sso.login(t, claims); !errors.Is(err, ErrOIDCEmailNotAllowed) {
+		t.Errorf("login = %v, want ErrOIDCEmailNotAllowed", err)
+	}
+	if sso.userRepo.count() != 0 {
+		t.Errorf("%d users created, want none", sso.userRepo.count())
+	}
+}
+
+func TestOIDCLoginDoesNotLinkUnverifiedAccount(t *testing.T) {
+	existing := models.NewUser(models.UserCreateRequest{Email: "jane@example.com", Username: "jane"}, "hash")
+	sso := newSSOTest(t, newFakeUserRepository(existing))
+
+	if _, err := sso.login(t, sso.idp.Claims("subject-1", "jane@example.com", oidcTestNonce)); !errors.Is(err, ErrOIDCAccountUnverified) {
+		t.Errorf("login = %v, want ErrOIDCAccountUnverified", err)
+	}
+	if stored, _ := sso.userRepo.FindByID(context.Background(), existing.ID); len(stored.ExternalIdentities) != 0 {
+		t.Errorf("unverified account was linked: %+v", stored.ExternalIdentities)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	existing := models.NewUser(models.UserCreateRequest{Email: "jane@example.com", Username: "jane"}, "hash")
+	existing.EmailVerified = true
+	sso := newSSOTest(t, newFakeUserRepository(existing))
+
+	user, err := sso.login(t, sso.idp.Claims("subject-1", "jane@example.com", oidcTestNonce))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if user.ID != existing.ID || len(user.ExternalIdentities) != 1 || user.ExternalIdentities[0].Subject != "subject-1" {
+		t.Errorf("user = %s with identities %+v, want %s linked to subject-1", user.ID, user.ExternalIdentities, existing.ID)
+	}
+}
+
+func TestOIDCLoginDomainAllowList(t *testing.T) {
+	sso := newSSOTest(t, newFakeUserRepository(), "cloudbox.test")
+
+	if _, err := sso.login(t, sso.idp.Claims("subject-1", "jane@example.com", oidcTestNonce)); !errors.Is(err, ErrOIDCEmailNotAllowed) {
+		t.Errorf("login from another domain = %v, want ErrOIDCEmailNotAllowed", err)
+	}
+	// A subdomain or a lookalike is not the allowed domain
+	if _, err := sso.login(t, sso.idp.Claims("subject-2", "jane@evil.cloudbox.test", oidcTestNonce)); !errors.Is(err, ErrOIDCEmailNotAllowed) {
+		t.Errorf("login from a subdomain = %v, want ErrOIDCEmailNotAllowed", err)
+	}
+	if _, err := sso.login(t, sso.idp.Claims("subject-3", "jane@CloudBox.test", oidcTestNonce)); err != nil {
+		t.Errorf("login from the allowed domain: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrIncorrectPassword is returned when the current password given for a change is wrong
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+// resetTokenBytes is the entropy of a password reset token
+const resetTokenBytes = 32
+
+// ChangePassword sets a new password after checking the current one. Every existing session is
+// ended and a new one is started for the caller, so the caller stays logged in.
+func (s *AuthService) ChangePassword(ctx context.Context, userID string, req models.ChangePasswordRequest, client models.ClientInfo) (*models.LoginResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPassword(req.CurrentPassword, user.Password) {
+		return nil, ErrIncorrectPassword
+	}
+
+	if err := s.setPassword(ctx, user.ID, req.NewPassword); err != nil {
+		return nil, err
+	}
+	s.recordUserEvent(ctx, models.AuditPasswordChange, user.ID, "user", user.ID)
+	return s.startSession(ctx, user, client)
+}
+
+// ForgotPassword emails a reset link if an active account uses the address. It reports success
+// either way and sends in the background, so callers can not tell which addresses are registered.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil || !user.IsActive {
+		return nil
+	}
+
+	// Only the most recently requested link works
+	if err := s.passwordResetRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	rawToken, err := utils.GenerateToken(resetTokenBytes)
+	if err != nil {
+		return err
+	}
+	token := models.NewPasswordResetToken(user.ID, utils.HashString(rawToken), s.tokenTTLs.PasswordReset)
+	if err := s.passwordResetRepo.Create(ctx, token); err != nil {
+		return err
+	}
+
+	link := mailer.Link(s.frontendURL, "/reset-password", rawToken)
+	msg := mailer.PasswordResetMessage(user.Email, user.FirstName, link, s.tokenTTLs.PasswordReset)
+	mailer.SendAsync(s.mailer, msg, s.logger)
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed reset token and ends every session
+func (s *AuthService) ResetPassword(ctx context.Context, req models.ResetPasswordRequest) error {
+	token, err := s.passwordResetRepo.Consume(ctx, utils.HashString(req.Token))
+	if err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, token.UserID, req.NewPassword); err != nil {
+		return err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{Action: models.AuditPasswordReset, SubjectID: token.UserID, TargetType: "user", TargetID: token.UserID})
+	return nil
+}
+
+// setPassword stores a new password and logs the user out everywhere
+func (s *AuthService) setPassword(ctx context.Context, userID, password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.passwordResetRepo.InvalidateForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.endAllSessions(ctx, userID)
+}
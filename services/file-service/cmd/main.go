@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"log"
 	"os"
 	"time"
@@ -9,9 +11,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/handler"
 	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/scanner"
 	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/accesstoken"
+	"github.com/joaquinidiarte/cloudbox/shared/accountpurge"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
 	"github.com/joaquinidiarte/cloudbox/shared/config"
+	"github.com/joaquinidiarte/cloudbox/shared/jwks"
 	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/redisclient"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
 	"github.com/joaquinidiarte/cloudbox/shared/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -40,41 +50,172 @@ func main() {
 	logger.Info("Connected to MongoDB successfully")
 
 	db := client.Database(cfg.MongoDatabase)
+	if err := repository.CheckTransactions(ctx, db); err != nil {
+		log.Fatal("MongoDB does not support transactions:", err)
+	}
+	auditLog := audit.NewRecorder(db, "file-service", logger)
+
+	redisClient, err := redisclient.New(cfg, logger)
+	if err != nil {
+		log.Fatal("Failed to connect to Redis:", err)
+	}
 
 	// Init JWT
 	tokenDuration, _ := time.ParseDuration(cfg.JWTExpiration)
-	jwtManager := utils.NewJWTManager(cfg.JWTSecret, tokenDuration)
+	jwtManager, err := jwks.NewJWTManager(cfg, tokenDuration, logger)
+	if err != nil {
+		log.Fatal("Refusing to verify tokens with the shared secret:", err)
+	}
+	revocations := revocation.NewStore(redisClient, tokenDuration)
+	accessTokens := accesstoken.NewMongoVerifier(db)
 
 	// Layers
 	fileRepo := repository.NewFileRepository(db)
-	fileService := service.NewFileService(fileRepo, cfg.StoragePath, cfg.MaxFileSize)
+	usageRepo := repository.NewStorageUsageRepository(db)
+	eventRepo := repository.NewStorageEventRepository(db)
+	transactor := repository.NewTransactor(db)
+	workspaceRepo := repository.NewWorkspaceRepository(db)
+	planRepo := repository.NewPlanRepository(db)
+	mimePolicy := service.NewMimePolicy(cfg.AllowedMimeTypes, cfg.DeniedMimeTypes)
+
+	// Malware scanning is optional; without a scanner uploads are available immediately
+	var scanWorker *service.ScanWorker
+	if cfg.ClamAVAddress != "" {
+		scanInterval, err := time.ParseDuration(cfg.ScanInterval)
+		if err != nil {
+			scanInterval = 30 * time.Second
+		}
+		scanTimeout, err := time.ParseDuration(cfg.ClamAVTimeout)
+		if err != nil {
+			scanTimeout = 5 * time.Minute
+		}
+		clamav := scanner.NewClamAVScanner(cfg.ClamAVAddress, scanTimeout)
+		scanWorker = service.NewScanWorker(fileRepo, clamav, logger, scanInterval)
+	}
+
+	gracePeriod, err := time.ParseDuration(cfg.PlanDowngradeGracePeriod)
+	if err != nil {
+		gracePeriod = 14 * 24 * time.Hour
+	}
+	fileService := service.NewFileService(fileRepo, usageRepo, eventRepo, transactor, workspaceRepo, planRepo, logger, auditLog, cfg.StoragePath, gracePeriod, mimePolicy, scanWorker)
 	fileHandler := handler.NewFileHandler(fileService, logger)
 
+	exportExpiration, err := time.ParseDuration(cfg.DataExportExpiration)
+	if err != nil {
+		exportExpiration = 7 * 24 * time.Hour
+	}
+	exportRepo := repository.NewDataExportRepository(db)
+	if err := exportRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Failed to create data export indexes:", err)
+	}
+	exportService := service.NewExportService(exportRepo, fileRepo, workspaceRepo, logger, auditLog, cfg.StoragePath, exportExpiration, time.Minute)
+	exportHandler := handler.NewExportHandler(exportService, logger)
+
+	// "file-service fsck [-action report|delete|quarantine] [-dry-run] [-grace 1h]" checks
+	// STORAGE_PATH against the files collection and prints the report
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		runFsckCommand(fileService, os.Args[2:])
+		return
+	}
+
+	if scanWorker != nil {
+		go scanWorker.Run(context.Background())
+		logger.Infof("Malware scanning enabled using clamd at %s", cfg.ClamAVAddress)
+	}
+	go exportService.Run(context.Background())
+
+	// Remove the files, workspace memberships and exports of deleted accounts
+	purgeInterval, err := time.ParseDuration(cfg.AccountPurgeInterval)
+	if err != nil {
+		purgeInterval = 5 * time.Minute
+	}
+	purge := func(ctx context.Context, userID string) error {
+		if err := fileService.PurgeUser(ctx, userID); err != nil {
+			return err
+		}
+		return exportService.PurgeUser(ctx, userID)
+	}
+	go accountpurge.NewWorker(db, "file-service", purge, auditLog, logger, purgeInterval).Run(context.Background())
+
 	// Init Gin router
 	router := gin.Default()
-	router.Use(middleware.CORS())
+	if err := middleware.TrustProxies(router, cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	router.Use(middleware.CORS(), middleware.AuditContext())
 
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "healthy", "service": "file-service"})
 	})
 
 	v1 := router.Group("/api/v1/files")
-	v1.Use(middleware.AuthMiddleware(jwtManager))
+	v1.Use(middleware.AuthMiddleware(jwtManager, revocations, accessTokens))
 	{
-		v1.POST("/upload", fileHandler.UploadFile)
-		v1.GET("/", fileHandler.ListFiles)
-		v1.GET("/:id/download", fileHandler.DownloadFile)
-		v1.DELETE("/:id", fileHandler.DeleteFile)
+		// Adding content can be held back until the user's email is verified
+		requireVerified := middleware.RequireVerifiedEmail(cfg.RequireEmailVerification)
+		canRead := middleware.RequireScope(models.ScopeFilesRead)
+		canWrite := middleware.RequireScope(models.ScopeFilesWrite)
+
+		v1.POST("/upload", canWrite, requireVerified, fileHandler.UploadFile)
+		v1.GET("/", canRead, fileHandler.ListFiles)
+		v1.GET("/usage", canRead, fileHandler.GetUsage)
+		v1.GET("/:id/download", canRead, fileHandler.DownloadFile)
+		v1.DELETE("/:id", canWrite, fileHandler.DeleteFile)
 
 		// Folder operations
-		v1.POST("/folders", fileHandler.CreateFolder)
-		v1.GET("/folders/:id", fileHandler.GetFolderContents)
+		v1.POST("/folders", canWrite, requireVerified, fileHandler.CreateFolder)
+		v1.GET("/folders/:id", canRead, fileHandler.GetFolderContents)
 
 		// Version operations
-		v1.GET("/:id/versions", fileHandler.GetFileVersions)
-		v1.GET("/:id/versions/:version/download", fileHandler.DownloadFileVersion)
-		v1.POST("/:id/versions/:version/restore", fileHandler.RestoreFileVersion)
-		v1.DELETE("/:id/versions/:version", fileHandler.DeleteFileVersion)
+		v1.GET("/:id/versions", canRead, fileHandler.GetFileVersions)
+		v1.GET("/:id/versions/:version/download", canRead, fileHandler.DownloadFileVersion)
+		v1.POST("/:id/versions/:version/restore", canWrite, fileHandler.RestoreFileVersion)
+		v1.DELETE("/:id/versions/:version", canWrite, fileHandler.DeleteFileVersion)
+	}
+
+	// Shared workspaces. Files are stored in them through the file routes above with a
+	// workspace_id; access tokens with files:read can list workspaces.
+	workspaces := router.Group("/api/v1/workspaces")
+	workspaces.Use(middleware.AuthMiddleware(jwtManager, revocations, accessTokens))
+	{
+		canRead := middleware.RequireScope(models.ScopeFilesRead)
+
+		workspaces.GET("", canRead, fileHandler.ListWorkspaces)
+		workspaces.GET("/:id", canRead, fileHandler.GetWorkspace)
+	}
+
+	// Managing a workspace and its members needs a signed-in session; access tokens are not accepted
+	manageWorkspaces := router.Group("/api/v1/workspaces")
+	manageWorkspaces.Use(middleware.AuthMiddleware(jwtManager, revocations, nil), middleware.RequireSession())
+	{
+		manageWorkspaces.POST("", fileHandler.CreateWorkspace)
+		manageWorkspaces.PUT("/:id", fileHandler.RenameWorkspace)
+		manageWorkspaces.DELETE("/:id", fileHandler.DeleteWorkspace)
+		manageWorkspaces.POST("/:id/members", fileHandler.AddWorkspaceMember)
+		manageWorkspaces.PUT("/:id/members/:user_id", fileHandler.SetWorkspaceMemberRole)
+		manageWorkspaces.DELETE("/:id/members/:user_id", fileHandler.RemoveWorkspaceMember)
+	}
+
+	// Exports of all of a user's data, for the signed-in user only
+	exports := router.Group("/api/v1/exports")
+	exports.Use(middleware.AuthMiddleware(jwtManager, revocations, nil), middleware.RequireSession())
+	{
+		exports.POST("", exportHandler.RequestExport)
+		exports.GET("", exportHandler.ListExports)
+		exports.GET("/:id", exportHandler.GetExport)
+		exports.GET("/:id/download", exportHandler.DownloadExport)
+	}
+
+	// Workspace plans and quotas for signed-in admins
+	admin := router.Group("/api/v1/admin/workspaces")
+	admin.Use(
+		middleware.AuthMiddleware(jwtManager, revocations, nil),
+		middleware.RequireSession(),
+		middleware.RequireRole(models.RoleAdmin),
+	)
+	{
+		admin.PUT("/:id/plan", fileHandler.SetWorkspacePlan)
+		admin.PUT("/:id/storage-limit", fileHandler.SetWorkspaceStorageLimit)
 	}
 
 	port := cfg.ServicePort
@@ -86,3 +227,26 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+func runFsckCommand(fileService *service.FileService, args []string) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	action := flags.String("action", service.FsckActionReport, "what to do with problems found: report, delete or quarantine")
+	dryRun := flags.Bool("dry-run", false, "show what the action would do without changing anything")
+	grace := flags.Duration("grace", time.Hour, "skip blobs and records modified more recently than this")
+	flags.Parse(args)
+
+	report, err := fileService.Fsck(context.Background(), service.FsckOptions{
+		Action:      *action,
+		DryRun:      *dryRun,
+		GracePeriod: *grace,
+	})
+	if err != nil {
+		log.Fatal("Fsck failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal("Failed to write report:", err)
+	}
+}
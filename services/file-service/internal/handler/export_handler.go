@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+type ExportHandler struct {
+	exportService *service.ExportService
+	logger        *utils.Logger
+}
+
+func NewExportHandler(exportService *service.ExportService, logger *utils.Logger) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		logger:        logger,
+	}
+}
+
+// RequestExport starts building an archive of the user's data; clients poll the export until
+// it is ready
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.DataExportRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+			return
+		}
+	}
+
+	export, err := h.exportService.RequestExport(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.SuccessResponse(export, "Export requested"))
+}
+
+func (h *ExportHandler) ListExports(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	exports, err := h.exportService.ListExports(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(exports, ""))
+}
+
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	export, err := h.exportService.GetExport(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(export, ""))
+}
+
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	export, err := h.exportService.DownloadExport(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.FileAttachment(export.Path, fmt.Sprintf("cloudbox-export-%s.zip", export.CreatedAt.Format("2006-01-02")))
+}
+
+func (h *ExportHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrExportNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, repository.ErrExportInProgress), errors.Is(err, service.ErrExportNotReady):
+		c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Export request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Export request failed"))
+	}
+}
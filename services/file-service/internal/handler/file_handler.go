@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
 	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/service"
 	"github.com/joaquinidiarte/cloudbox/shared/middleware"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
@@ -41,10 +43,19 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		parentID = &pid
 	}
 
-	response, err := h.fileService.UploadFile(c.Request.Context(), userID, file, parentID)
+	response, err := h.fileService.UploadFile(c.Request.Context(), userID, c.PostForm("workspace_id"), file, parentID)
 	if err != nil {
 		h.logger.Errorf("Failed to upload file: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		var quotaErr *service.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, quotaExceededResponse(quotaErr))
+			return
+		}
+		status := workspaceErrorStatus(err, http.StatusBadRequest)
+		if errors.Is(err, service.ErrMimeTypeNotAllowed) {
+			status = http.StatusUnsupportedMediaType
+		}
+		c.JSON(status, models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -65,10 +76,10 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 		parentID = &pid
 	}
 
-	files, err := h.fileService.ListFiles(c.Request.Context(), userID, parentID)
+	files, err := h.fileService.ListFiles(c.Request.Context(), userID, c.Query("workspace_id"), parentID)
 	if err != nil {
 		h.logger.Errorf("Failed to list files: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(err.Error()))
+		c.JSON(workspaceErrorStatus(err, http.StatusInternalServerError), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -87,7 +98,7 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 	file, err := h.fileService.DownloadFile(c.Request.Context(), userID, fileID)
 	if err != nil {
 		h.logger.Errorf("Failed to download file: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(downloadErrorStatus(err), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -106,7 +117,7 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 	deletedSize, err := h.fileService.DeleteFile(c.Request.Context(), userID, fileID)
 	if err != nil {
 		h.logger.Errorf("Failed to delete file: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(workspaceErrorStatus(err, http.StatusBadRequest), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -114,6 +125,29 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"deleted_size": deletedSize}, "File deleted successfully"))
 }
 
+func (h *FileHandler) GetUsage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid limit"))
+		return
+	}
+
+	usage, err := h.fileService.GetUsageBreakdown(c.Request.Context(), userID, c.Query("workspace_id"), limit)
+	if err != nil {
+		h.logger.Errorf("Failed to get storage usage: %v", err)
+		c.JSON(workspaceErrorStatus(err, http.StatusBadRequest), models.ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(usage, "Storage usage retrieved successfully"))
+}
+
 func (h *FileHandler) CreateFolder(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
 	if !exists {
@@ -130,7 +164,7 @@ func (h *FileHandler) CreateFolder(c *gin.Context) {
 	folder, err := h.fileService.CreateFolder(c.Request.Context(), userID, &req)
 	if err != nil {
 		h.logger.Errorf("Failed to create folder: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(workspaceErrorStatus(err, http.StatusBadRequest), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -147,16 +181,45 @@ func (h *FileHandler) GetFolderContents(c *gin.Context) {
 
 	folderID := c.Param("id")
 
-	files, err := h.fileService.ListFiles(c.Request.Context(), userID, &folderID)
+	files, err := h.fileService.GetFolderContents(c.Request.Context(), userID, folderID)
 	if err != nil {
 		h.logger.Errorf("Failed to get folder contents: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse(err.Error()))
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
 		return
 	}
 
 	c.JSON(http.StatusOK, models.SuccessResponse(files, "Folder contents retrieved successfully"))
 }
 
+func quotaExceededResponse(err *service.QuotaExceededError) models.APIResponse {
+	return models.ErrorResponseWithData(err.Error(), models.QuotaExceededDetails{
+		Code:         "quota_exceeded",
+		StorageUsed:  err.Used,
+		StorageLimit: err.Limit,
+		Requested:    err.Requested,
+	})
+}
+
+// downloadErrorStatus maps download errors to a status code, keeping quarantined files distinguishable
+func downloadErrorStatus(err error) int {
+	if errors.Is(err, service.ErrFileQuarantined) {
+		return http.StatusForbidden
+	}
+	return workspaceErrorStatus(err, http.StatusBadRequest)
+}
+
+// workspaceErrorStatus maps workspace access errors to a status code, and anything else to fallback
+func workspaceErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, repository.ErrWorkspaceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrWorkspacePermission):
+		return http.StatusForbidden
+	default:
+		return fallback
+	}
+}
+
 /* Version operations */
 func (h *FileHandler) GetFileVersions(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
@@ -170,7 +233,7 @@ func (h *FileHandler) GetFileVersions(c *gin.Context) {
 	versions, err := h.fileService.GetFileVersions(c.Request.Context(), userID, fileID)
 	if err != nil {
 		h.logger.Errorf("Failed to get file versions: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(workspaceErrorStatus(err, http.StatusBadRequest), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -196,7 +259,7 @@ func (h *FileHandler) DownloadFileVersion(c *gin.Context) {
 	file, versionPath, err := h.fileService.DownloadFileVersion(c.Request.Context(), userID, fileID, version)
 	if err != nil {
 		h.logger.Errorf("Failed to download file version: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(downloadErrorStatus(err), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -222,7 +285,7 @@ func (h *FileHandler) RestoreFileVersion(c *gin.Context) {
 	response, err := h.fileService.RestoreFileVersion(c.Request.Context(), userID, fileID, version)
 	if err != nil {
 		h.logger.Errorf("Failed to restore file version: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(workspaceErrorStatus(err, http.StatusBadRequest), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -249,7 +312,7 @@ func (h *FileHandler) DeleteFileVersion(c *gin.Context) {
 	deletedSize, err := h.fileService.DeleteFileVersion(c.Request.Context(), userID, fileID, version)
 	if err != nil {
 		h.logger.Errorf("Failed to delete file version: %v", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		c.JSON(workspaceErrorStatus(err, http.StatusBadRequest), models.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+func (h *FileHandler) CreateWorkspace(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.WorkspaceCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	response, err := h.fileService.CreateWorkspace(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.respondWorkspaceError(c, "create workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.SuccessResponse(response, "Workspace created successfully"))
+}
+
+func (h *FileHandler) ListWorkspaces(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	workspaces, err := h.fileService.ListWorkspaces(c.Request.Context(), userID)
+	if err != nil {
+		h.respondWorkspaceError(c, "list workspaces", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(workspaces, ""))
+}
+
+func (h *FileHandler) GetWorkspace(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	response, err := h.fileService.GetWorkspace(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		h.respondWorkspaceError(c, "get workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, ""))
+}
+
+func (h *FileHandler) RenameWorkspace(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.WorkspaceUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	response, err := h.fileService.RenameWorkspace(c.Request.Context(), userID, c.Param("id"), &req)
+	if err != nil {
+		h.respondWorkspaceError(c, "rename workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Workspace updated successfully"))
+}
+
+func (h *FileHandler) DeleteWorkspace(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	if err := h.fileService.DeleteWorkspace(c.Request.Context(), userID, c.Param("id")); err != nil {
+		h.respondWorkspaceError(c, "delete workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Workspace deleted successfully"))
+}
+
+func (h *FileHandler) AddWorkspaceMember(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.WorkspaceMemberAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	response, err := h.fileService.AddWorkspaceMember(c.Request.Context(), userID, c.Param("id"), &req)
+	if err != nil {
+		h.respondWorkspaceError(c, "add workspace member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Member added successfully"))
+}
+
+func (h *FileHandler) SetWorkspaceMemberRole(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.WorkspaceMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	response, err := h.fileService.SetWorkspaceMemberRole(c.Request.Context(), userID, c.Param("id"), c.Param("user_id"), &req)
+	if err != nil {
+		h.respondWorkspaceError(c, "change workspace member role", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Member role updated successfully"))
+}
+
+// RemoveWorkspaceMember removes a member; members leave a workspace by removing themselves
+func (h *FileHandler) RemoveWorkspaceMember(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	if err := h.fileService.RemoveWorkspaceMember(c.Request.Context(), userID, c.Param("id"), c.Param("user_id")); err != nil {
+		h.respondWorkspaceError(c, "remove workspace member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Member removed successfully"))
+}
+
+// SetWorkspaceStorageLimit changes a workspace's pooled quota, for admins
+func (h *FileHandler) SetWorkspaceStorageLimit(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.WorkspaceStorageLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	response, err := h.fileService.SetWorkspaceStorageLimit(c.Request.Context(), userID, c.Param("id"), *req.StorageLimit)
+	if err != nil {
+		h.respondWorkspaceError(c, "set workspace storage limit", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Storage limit updated successfully"))
+}
+
+// SetWorkspacePlan moves a workspace to another plan, for admins
+func (h *FileHandler) SetWorkspacePlan(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var req models.PlanAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	response, err := h.fileService.SetWorkspacePlan(c.Request.Context(), userID, c.Param("id"), req.PlanID)
+	if err != nil {
+		h.respondWorkspaceError(c, "set workspace plan", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(response, "Plan updated successfully"))
+}
+
+// respondWorkspaceError maps workspace errors to a status code; unexpected errors are logged
+// and not shown to the client
+func (h *FileHandler) respondWorkspaceError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrWorkspaceNotFound),
+		errors.Is(err, repository.ErrMemberNotFound),
+		errors.Is(err, repository.ErrMemberUserNotFound),
+		errors.Is(err, repository.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, service.ErrWorkspacePermission):
+		c.JSON(http.StatusForbidden, models.ErrorResponse(err.Error()))
+	case errors.Is(err, repository.ErrAlreadyMember),
+		errors.Is(err, repository.ErrLastOwner),
+		errors.Is(err, service.ErrWorkspaceNotEmpty):
+		c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Failed to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Workspace request failed"))
+	}
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrExportNotFound is returned when no export of the user has the ID
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportInProgress is returned when requesting an export while another one is being built
+	ErrExportInProgress = errors.New("an export is already in progress")
+)
+
+// DataExportRepository stores the data export jobs. Jobs are claimed from the database, so an
+// export interrupted by a restart is built again.
+type DataExportRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	Create(ctx context.Context, export *models.DataExport) error
+	FindByID(ctx context.Context, userID, id string) (*models.DataExport, error)
+	FindByUser(ctx context.Context, userID string) ([]*models.DataExport, error)
+	ClaimNext(ctx context.Context, staleBefore time.Time) (*models.DataExport, error)
+	Complete(ctx context.Context, id, path string, size int64, expiresAt time.Time) error
+	Fail(ctx context.Context, id, reason string, expiresAt time.Time) error
+	FindExpired(ctx context.Context, now time.Time) ([]*models.DataExport, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByUser(ctx context.Context, userID string) error
+	FindUser(ctx context.Context, userID string) (*models.User, error)
+}
+
+// MongoDBDataExportRepository is the MongoDB implementation of DataExportRepository
+type MongoDBDataExportRepository struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+// NewDataExportRepository creates a new MongoDB data export repository
+func NewDataExportRepository(db *mongo.Database) DataExportRepository {
+	return &MongoDBDataExportRepository{
+		collection: db.Collection("data_exports"),
+		users:      db.Collection("users"),
+	}
+}
+
+// EnsureIndexes creates the unique index that allows one pending or running export per user
+func (r *MongoDBDataExportRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().
+			SetName("user_id_active_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{
+				"status": bson.M{"$in": bson.A{models.DataExportPending, models.DataExportRunning}},
+			}),
+	})
+	return err
+}
+
+// Create stores a pending export unless the user already has one pending or running
+func (r *MongoDBDataExportRepository) Create(ctx context.Context, export *models.DataExport) error {
+	_, err := r.collection.InsertOne(ctx, export)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExportInProgress
+	}
+	return err
+}
+
+func (r *MongoDBDataExportRepository) FindByID(ctx context.Context, userID, id string) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&export)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// FindByUser returns the user's exports, newest first
+func (r *MongoDBDataExportRepository) FindByUser(ctx context.Context, userID string) ([]*models.DataExport, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	exports := []*models.DataExport{}
+	if err := cursor.All(ctx, &exports); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// ClaimNext marks the oldest pending export as running and returns it, or nil when there is none.
+// Exports left running since before staleBefore were interrupted and are claimed again.
+func (r *MongoDBDataExportRepository) ClaimNext(ctx context.Context, staleBefore time.Time) (*models.DataExport, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.DataExportPending},
+		bson.M{"status": models.DataExportRunning, "started_at": bson.M{"$lt": staleBefore}},
+	}}
+	update := bson.M{"$set": bson.M{"status": models.DataExportRunning, "started_at": time.Now()}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"created_at": 1}).
+		SetReturnDocument(options.After)
+
+	var export models.DataExport
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&export)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *MongoDBDataExportRepository) Complete(ctx context.Context, id, path string, size int64, expiresAt time.Time) error {
+	return r.finish(ctx, id, bson.M{
+		"status":     models.DataExportReady,
+		"path":       path,
+		"size":       size,
+		"expires_at": expiresAt,
+	})
+}
+
+func (r *MongoDBDataExportRepository) Fail(ctx context.Context, id, reason string, expiresAt time.Time) error {
+	return r.finish(ctx, id, bson.M{
+		"status":     models.DataExportFailed,
+		"error":      reason,
+		"expires_at": expiresAt,
+	})
+}
+
+func (r *MongoDBDataExportRepository) finish(ctx context.Context, id string, fields bson.M) error {
+	fields["completed_at"] = time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrExportNotFound
+	}
+	return nil
+}
+
+// FindExpired returns the finished exports past their expiry
+func (r *MongoDBDataExportRepository) FindExpired(ctx context.Context, now time.Time) ([]*models.DataExport, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var exports []*models.DataExport
+	if err := cursor.All(ctx, &exports); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *MongoDBDataExportRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *MongoDBDataExportRepository) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// FindUser reads the account being exported from the user-service's collection
+func (r *MongoDBDataExportRepository) FindUser(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
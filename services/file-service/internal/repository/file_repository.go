@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/joaquinidiarte/cloudbox/shared/models"
 	"go.mongodb.org/mongo-driver/bson"
@@ -10,27 +11,43 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrFileNotFound is returned when no file matches the given ID
+var ErrFileNotFound = errors.New("file not found")
+
 // FileRepository defines the interface for file data access
 type FileRepository interface {
 	Create(ctx context.Context, file *models.File) error
-	FindByUserID(ctx context.Context, userID string, parentID *string) ([]*models.File, error)
+	FindByOwner(ctx context.Context, userID, workspaceID string, parentID *string) ([]*models.File, error)
 	FindByID(ctx context.Context, id string) (*models.File, error)
-	FindByOriginalName(ctx context.Context, userID, originalName string, parentID *string) (*models.File, error)
+	FindByOriginalName(ctx context.Context, userID, workspaceID, originalName string, parentID *string) (*models.File, error)
+	CountByWorkspace(ctx context.Context, workspaceID string) (int64, error)
+	FindAllByOwner(ctx context.Context, userID, workspaceID string) ([]*models.File, error)
+	DeleteByOwner(ctx context.Context, userID, workspaceID string) (int64, error)
 	Delete(ctx context.Context, id string) error
 	AddVersion(ctx context.Context, id string, version models.FileVersion, currentVersion int, path, mimeType string, size int64) error
 	UpdateCurrentVersion(ctx context.Context, id string, version int, path, mimeType string, size int64) error
 	DeleteVersion(ctx context.Context, id string, version int) error
+	FindPendingScans(ctx context.Context, now time.Time, limit int64) ([]*models.File, error)
+	UpdateVersionScan(ctx context.Context, id string, version int, status, scanResult string, scannedAt time.Time) error
+	DeferVersionScan(ctx context.Context, id string, version int, scanResult string, nextScanAt time.Time) error
+	UsageBreakdown(ctx context.Context, userID, workspaceID string, largestLimit int) (*models.StorageUsageBreakdown, error)
+	ForEach(ctx context.Context, fn func(*models.File) error) error
+	FindByVersionPath(ctx context.Context, path string) (*models.File, error)
+	ClearParent(ctx context.Context, id string) error
+	Quarantine(ctx context.Context, id string) error
 }
 
 // MongoDBFileRepository is the MongoDB implementation of FileRepository
 type MongoDBFileRepository struct {
-	collection *mongo.Collection
+	collection  *mongo.Collection
+	quarantined *mongo.Collection
 }
 
 // NewFileRepository creates a new MongoDB file repository
 func NewFileRepository(db *mongo.Database) FileRepository {
 	return &MongoDBFileRepository{
-		collection: db.Collection("files"),
+		collection:  db.Collection("files"),
+		quarantined: db.Collection("quarantined_files"),
 	}
 }
 
@@ -39,8 +56,17 @@ func (r *MongoDBFileRepository) Create(ctx context.Context, file *models.File) e
 	return err
 }
 
-func (r *MongoDBFileRepository) FindByUserID(ctx context.Context, userID string, parentID *string) ([]*models.File, error) {
-	filter := bson.M{"user_id": userID}
+// ownerFilter matches the files of a workspace or, with an empty workspaceID, the user's personal files
+func ownerFilter(userID, workspaceID string) bson.M {
+	if workspaceID != "" {
+		return bson.M{"workspace_id": workspaceID}
+	}
+	return bson.M{"user_id": userID, "workspace_id": bson.M{"$exists": false}}
+}
+
+// FindByOwner lists the files in a folder of a workspace or of the user's personal storage
+func (r *MongoDBFileRepository) FindByOwner(ctx context.Context, userID, workspaceID string, parentID *string) ([]*models.File, error) {
+	filter := ownerFilter(userID, workspaceID)
 	if parentID != nil {
 		filter["parent_id"] = *parentID
 	} else {
@@ -65,20 +91,19 @@ func (r *MongoDBFileRepository) FindByID(ctx context.Context, id string) (*model
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&file)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("file not found")
+			return nil, ErrFileNotFound
 		}
 		return nil, err
 	}
 	return &file, nil
 }
 
-// FindByOriginalName finds a file by user ID and original name
-func (r *MongoDBFileRepository) FindByOriginalName(ctx context.Context, userID, originalName string, parentID *string) (*models.File, error) {
-	filter := bson.M{
-		"user_id":       userID,
-		"original_name": originalName,
-		"is_folder":     false,
-	}
+// FindByOriginalName finds a file by original name in a folder of a workspace or of the user's
+// personal storage
+func (r *MongoDBFileRepository) FindByOriginalName(ctx context.Context, userID, workspaceID, originalName string, parentID *string) (*models.File, error) {
+	filter := ownerFilter(userID, workspaceID)
+	filter["original_name"] = originalName
+	filter["is_folder"] = false
 	if parentID != nil {
 		filter["parent_id"] = *parentID
 	} else {
@@ -96,13 +121,18 @@ func (r *MongoDBFileRepository) FindByOriginalName(ctx context.Context, userID,
 	return &file, nil
 }
 
+// CountByWorkspace counts the files and folders a workspace owns
+func (r *MongoDBFileRepository) CountByWorkspace(ctx context.Context, workspaceID string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"workspace_id": workspaceID})
+}
+
 func (r *MongoDBFileRepository) Delete(ctx context.Context, id string) error {
 	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
 		return err
 	}
 	if result.DeletedCount == 0 {
-		return errors.New("file not found")
+		return ErrFileNotFound
 	}
 	return nil
 }
@@ -124,7 +154,7 @@ func (r *MongoDBFileRepository) AddVersion(ctx context.Context, id string, versi
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("file not found")
+		return ErrFileNotFound
 	}
 	return nil
 }
@@ -147,7 +177,7 @@ func (r *MongoDBFileRepository) UpdateCurrentVersion(ctx context.Context, id str
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("file not found")
+		return ErrFileNotFound
 	}
 	return nil
 }
@@ -162,7 +192,162 @@ func (r *MongoDBFileRepository) DeleteVersion(ctx context.Context, id string, ve
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("file not found")
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// FindPendingScans returns files that have at least one version waiting for a malware scan whose
+// retry, if an earlier attempt failed, is due by now
+func (r *MongoDBFileRepository) FindPendingScans(ctx context.Context, now time.Time, limit int64) ([]*models.File, error) {
+	filter := bson.M{"versions": bson.M{"$elemMatch": bson.M{
+		"scan_status": models.ScanStatusPending,
+		"$or": []bson.M{
+			{"next_scan_at": bson.M{"$exists": false}},
+			{"next_scan_at": bson.M{"$lte": now}},
+		},
+	}}}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"updated_at": 1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var files []*models.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (r *MongoDBFileRepository) UpdateVersionScan(ctx context.Context, id string, version int, status, scanResult string, scannedAt time.Time) error {
+	filter := bson.M{"_id": id, "versions.version": version}
+	update := bson.M{
+		"$set": bson.M{
+			"versions.$.scan_status": status,
+			"versions.$.scan_result": scanResult,
+			"versions.$.scanned_at":  scannedAt,
+		},
+		"$unset": bson.M{"versions.$.next_scan_at": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("version not found")
+	}
+	return nil
+}
+
+// DeferVersionScan counts a failed scan attempt of a pending version and schedules the next one
+func (r *MongoDBFileRepository) DeferVersionScan(ctx context.Context, id string, version int, scanResult string, nextScanAt time.Time) error {
+	filter := bson.M{"_id": id, "versions.version": version}
+	update := bson.M{
+		"$set": bson.M{
+			"versions.$.scan_result":  scanResult,
+			"versions.$.next_scan_at": nextScanAt,
+		},
+		"$inc": bson.M{"versions.$.scan_attempts": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("version not found")
+	}
+	return nil
+}
+
+// ForEach streams every file and folder record to fn, stopping at the first error
+func (r *MongoDBFileRepository) ForEach(ctx context.Context, fn func(*models.File) error) error {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file models.File
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		if err := fn(&file); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// FindByVersionPath finds the file that has a version stored at path, or nil if none does
+func (r *MongoDBFileRepository) FindByVersionPath(ctx context.Context, path string) (*models.File, error) {
+	var file models.File
+	err := r.collection.FindOne(ctx, bson.M{"versions.path": path}).Decode(&file)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ClearParent moves a file or folder to the root of its owner's tree
+func (r *MongoDBFileRepository) ClearParent(ctx context.Context, id string) error {
+	update := bson.M{
+		"$unset":       bson.M{"parent_id": ""},
+		"$currentDate": bson.M{"updated_at": true},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrFileNotFound
 	}
 	return nil
 }
+
+// Quarantine moves a file record out of the files collection into quarantined_files
+func (r *MongoDBFileRepository) Quarantine(ctx context.Context, id string) error {
+	file, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.quarantined.ReplaceOne(ctx, bson.M{"_id": id}, file, options.Replace().SetUpsert(true)); err != nil {
+		return err
+	}
+	return r.Delete(ctx, id)
+}
+
+// FindAllByOwner returns every file and folder of a workspace or of the user's personal storage
+func (r *MongoDBFileRepository) FindAllByOwner(ctx context.Context, userID, workspaceID string) ([]*models.File, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, ownerFilter(userID, workspaceID), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	files := []*models.File{}
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// DeleteByOwner deletes every file and folder record of a workspace or of the user's personal
+// storage, leaving the blobs to the caller
+func (r *MongoDBFileRepository) DeleteByOwner(ctx context.Context, userID, workspaceID string) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, ownerFilter(userID, workspaceID))
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mimeCategories maps a MIME type regex to a usage category, checked in order
+var mimeCategories = []struct {
+	category string
+	pattern  string
+}{
+	{"image", "^image/"},
+	{"video", "^video/"},
+	{"audio", "^audio/"},
+	{"archive", "^application/(zip|gzip|x-gzip|x-tar|x-7z-compressed|x-rar-compressed|vnd\\.rar|x-bzip2|x-xz)"},
+	{"document", "^(text/|application/(pdf|msword|rtf|json|xml|vnd\\.ms-|vnd\\.openxmlformats-officedocument|vnd\\.oasis\\.opendocument))"},
+}
+
+// UsageBreakdown aggregates the stored bytes of a user's personal files, or of a workspace, by
+// top-level folder, MIME category and current vs old versions, and lists the largest files by
+// total stored size
+func (r *MongoDBFileRepository) UsageBreakdown(ctx context.Context, userID, workspaceID string, largestLimit int) (*models.StorageUsageBreakdown, error) {
+	storedBytes := bson.M{"$sum": "$versions.size"}
+
+	totals := bson.A{
+		bson.M{"$group": bson.M{"_id": nil, "bytes": bson.M{"$sum": storedBytes}, "count": bson.M{"$sum": 1}}},
+	}
+
+	byFolder := bson.A{
+		bson.M{"$graphLookup": bson.M{
+			"from":                    r.collection.Name(),
+			"startWith":               "$parent_id",
+			"connectFromField":        "parent_id",
+			"connectToField":          "_id",
+			"as":                      "ancestors",
+			"restrictSearchWithMatch": ownerFilter(userID, workspaceID),
+		}},
+		// The top-level folder is the ancestor that has no parent of its own
+		bson.M{"$addFields": bson.M{"top": bson.M{"$first": bson.M{"$filter": bson.M{
+			"input": "$ancestors",
+			"cond":  bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$$this.parent_id", nil}}, nil}},
+		}}}}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$parent_id", nil}}, nil}}, "then": "root"},
+					// A broken parent chain means some ancestor folder was deleted
+					bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$top._id", nil}}, nil}}, "then": "orphaned"},
+				},
+				"default": "$top._id",
+			}},
+			"name":  bson.M{"$first": "$top.name"},
+			"bytes": bson.M{"$sum": storedBytes},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": bson.M{"bytes": -1}},
+	}
+
+	branches := bson.A{}
+	for _, c := range mimeCategories {
+		branches = append(branches, bson.M{
+			"case": bson.M{"$regexMatch": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$versions.mime_type", ""}},
+				"regex": c.pattern,
+			}},
+			"then": c.category,
+		})
+	}
+	byCategory := bson.A{
+		bson.M{"$unwind": "$versions"},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"$switch": bson.M{"branches": branches, "default": "other"}},
+			"bytes": bson.M{"$sum": "$versions.size"},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": bson.M{"bytes": -1}},
+	}
+
+	byVersion := bson.A{
+		bson.M{"$unwind": "$versions"},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$versions.version", "$current_version"}}, "current", "old"}},
+			"bytes": bson.M{"$sum": "$versions.size"},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+
+	largest := bson.A{
+		bson.M{"$project": bson.M{
+			"original_name": 1,
+			"parent_id":     1,
+			"mime_type":     1,
+			"size":          1,
+			"total_size":    storedBytes,
+			"version_count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$versions", bson.A{}}}},
+		}},
+		bson.M{"$sort": bson.D{{Key: "total_size", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": largestLimit},
+	}
+
+	match := ownerFilter(userID, workspaceID)
+	match["is_folder"] = false
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"totals":      totals,
+			"by_folder":   byFolder,
+			"by_category": byCategory,
+			"by_version":  byVersion,
+			"largest":     largest,
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Totals     []models.UsageBucket `bson:"totals"`
+		ByFolder   []models.UsageBucket `bson:"by_folder"`
+		ByCategory []models.UsageBucket `bson:"by_category"`
+		ByVersion  []models.UsageBucket `bson:"by_version"`
+		Largest    []models.LargestFile `bson:"largest"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	breakdown := &models.StorageUsageBreakdown{
+		ByFolder:        []models.UsageBucket{},
+		ByCategory:      []models.UsageBucket{},
+		CurrentVersions: models.UsageBucket{Key: "current"},
+		OldVersions:     models.UsageBucket{Key: "old"},
+		Largest:         []models.LargestFile{},
+	}
+	if len(results) == 0 {
+		return breakdown, nil
+	}
+
+	result := results[0]
+	if len(result.Totals) > 0 {
+		breakdown.TotalBytes = result.Totals[0].Bytes
+		breakdown.FileCount = result.Totals[0].Count
+	}
+	if result.ByFolder != nil {
+		breakdown.ByFolder = result.ByFolder
+	}
+	if result.ByCategory != nil {
+		breakdown.ByCategory = result.ByCategory
+	}
+	for _, bucket := range result.ByVersion {
+		if bucket.Key == "current" {
+			breakdown.CurrentVersions = bucket
+		} else {
+			breakdown.OldVersions = bucket
+		}
+	}
+	if result.Largest != nil {
+		breakdown.Largest = result.Largest
+	}
+	return breakdown, nil
+}
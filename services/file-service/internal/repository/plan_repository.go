@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrPlanNotFound is returned when no plan has the ID
+var ErrPlanNotFound = errors.New("plan not found")
+
+// PlanRepository reads the storage plans managed by the user-service
+type PlanRepository interface {
+	FindByID(ctx context.Context, id string) (*models.Plan, error)
+}
+
+// MongoDBPlanRepository is the MongoDB implementation of PlanRepository
+type MongoDBPlanRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPlanRepository creates a new MongoDB plan repository
+func NewPlanRepository(db *mongo.Database) PlanRepository {
+	return &MongoDBPlanRepository{
+		collection: db.Collection("plans"),
+	}
+}
+
+func (r *MongoDBPlanRepository) FindByID(ctx context.Context, id string) (*models.Plan, error) {
+	var plan models.Plan
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StorageEventRepository is the outbox the file-service writes storage usage changes to.
+// Events are created in the same transaction as the file change they describe.
+type StorageEventRepository interface {
+	Create(ctx context.Context, event *models.StorageEvent) error
+}
+
+// MongoDBStorageEventRepository is the MongoDB implementation of StorageEventRepository
+type MongoDBStorageEventRepository struct {
+	collection *mongo.Collection
+}
+
+// NewStorageEventRepository creates a new MongoDB storage event repository
+func NewStorageEventRepository(db *mongo.Database) StorageEventRepository {
+	return &MongoDBStorageEventRepository{
+		collection: db.Collection("storage_events"),
+	}
+}
+
+func (r *MongoDBStorageEventRepository) Create(ctx context.Context, event *models.StorageEvent) error {
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StorageUsageRepository keeps a byte counter per user and per workspace that uploads reserve
+// against atomically, so concurrent uploads cannot together exceed the storage limit. Counters
+// are keyed by the owner ID; user and workspace IDs are both UUIDs, so they never collide.
+//
+// An upload's bytes are charged when it reserves them, before they are in the files collection,
+// so each counter also lists its open reservations for the reconciliation to leave alone. Every
+// other change to a counter is made in the same transaction as the file change it accounts for.
+// Every write increments rev, so a reader can tell whether a counter changed since it read it.
+type StorageUsageRepository interface {
+	GetUserQuota(ctx context.Context, userID string) (*UserQuota, error)
+	GetUsage(ctx context.Context, ownerID string) (int64, error)
+	Reserve(ctx context.Context, ownerID, reservationID string, size, limit int64) (used int64, ok bool, err error)
+	// Commit closes a reservation whose bytes have been stored; they stay charged
+	Commit(ctx context.Context, ownerID, reservationID string) error
+	// Cancel closes a reservation whose bytes were not stored and gives them back.
+	// It does nothing if the reservation was already committed or cancelled.
+	Cancel(ctx context.Context, ownerID, reservationID string, size int64) error
+	// Release gives back the bytes of deleted files
+	Release(ctx context.Context, ownerID string, size int64) error
+	Delete(ctx context.Context, ownerID string) error
+}
+
+// MongoDBStorageUsageRepository is the MongoDB implementation of StorageUsageRepository
+type MongoDBStorageUsageRepository struct {
+	usage *mongo.Collection
+	files *mongo.Collection
+	users *mongo.Collection
+}
+
+// NewStorageUsageRepository creates a new MongoDB storage usage repository
+func NewStorageUsageRepository(db *mongo.Database) StorageUsageRepository {
+	return &MongoDBStorageUsageRepository{
+		usage: db.Collection("storage_usage"),
+		files: db.Collection("files"),
+		users: db.Collection("users"),
+	}
+}
+
+// UserQuota is the part of a user that decides what they may store
+type UserQuota struct {
+	PlanID       string             `bson:"plan_id"`
+	StorageLimit int64              `bson:"storage_limit"`
+	QuotaGrace   *models.QuotaGrace `bson:"quota_grace"`
+}
+
+func (r *MongoDBStorageUsageRepository) GetUserQuota(ctx context.Context, userID string) (*UserQuota, error) {
+	var quota UserQuota
+	opts := options.FindOne().SetProjection(bson.M{"plan_id": 1, "storage_limit": 1, "quota_grace": 1})
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&quota)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	if quota.PlanID == "" {
+		quota.PlanID = models.DefaultUserPlanID
+	}
+	return &quota, nil
+}
+
+// GetUsage returns the bytes currently charged to a user or workspace
+func (r *MongoDBStorageUsageRepository) GetUsage(ctx context.Context, ownerID string) (int64, error) {
+	if err := r.ensureSeeded(ctx, ownerID); err != nil {
+		return 0, err
+	}
+
+	var doc struct {
+		Used int64 `bson:"used"`
+	}
+	if err := r.usage.FindOne(ctx, bson.M{"_id": ownerID}).Decode(&doc); err != nil {
+		return 0, err
+	}
+	return doc.Used, nil
+}
+
+// Reserve adds size to the owner's counter only if the result stays within limit, and opens a
+// reservation for it. It returns the usage before the reservation and whether it succeeded.
+func (r *MongoDBStorageUsageRepository) Reserve(ctx context.Context, ownerID, reservationID string, size, limit int64) (int64, bool, error) {
+	if err := r.ensureSeeded(ctx, ownerID); err != nil {
+		return 0, false, err
+	}
+
+	filter := bson.M{"_id": ownerID, "used": bson.M{"$lte": limit - size}}
+	update := bson.M{
+		"$inc":  bson.M{"used": size, "rev": 1},
+		"$push": bson.M{"reservations": models.StorageReservation{ID: reservationID, Size: size, CreatedAt: time.Now()}},
+	}
+
+	var doc struct {
+		Used int64 `bson:"used"`
+	}
+	err := r.usage.FindOneAndUpdate(ctx, filter, update).Decode(&doc)
+	if err == nil {
+		return doc.Used, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return 0, false, err
+	}
+
+	// The filter did not match, so the reservation would exceed the limit
+	if err := r.usage.FindOne(ctx, bson.M{"_id": ownerID}).Decode(&doc); err != nil {
+		return 0, false, err
+	}
+	return doc.Used, false, nil
+}
+
+func (r *MongoDBStorageUsageRepository) Commit(ctx context.Context, ownerID, reservationID string) error {
+	_, err := r.usage.UpdateOne(
+		ctx,
+		bson.M{"_id": ownerID, "reservations.id": reservationID},
+		bson.M{
+			"$pull": bson.M{"reservations": bson.M{"id": reservationID}},
+			"$inc":  bson.M{"rev": 1},
+		},
+	)
+	return err
+}
+
+func (r *MongoDBStorageUsageRepository) Cancel(ctx context.Context, ownerID, reservationID string, size int64) error {
+	_, err := r.usage.UpdateOne(
+		ctx,
+		bson.M{"_id": ownerID, "reservations.id": reservationID},
+		bson.M{
+			"$pull": bson.M{"reservations": bson.M{"id": reservationID}},
+			"$inc":  bson.M{"used": -size, "rev": 1},
+		},
+	)
+	return err
+}
+
+func (r *MongoDBStorageUsageRepository) Release(ctx context.Context, ownerID string, size int64) error {
+	_, err := r.usage.UpdateOne(ctx, bson.M{"_id": ownerID}, bson.M{"$inc": bson.M{"used": -size, "rev": 1}})
+	return err
+}
+
+// ensureSeeded creates the owner's counter from the files collection the first time it is needed.
+// Workspace files are charged to the workspace only, never to the user who uploaded them.
+func (r *MongoDBStorageUsageRepository) ensureSeeded(ctx context.Context, ownerID string) error {
+	count, err := r.usage.CountDocuments(ctx, bson.M{"_id": ownerID})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"is_folder": false,
+			"$or": bson.A{
+				bson.M{"workspace_id": ownerID},
+				bson.M{"user_id": ownerID, "workspace_id": bson.M{"$exists": false}},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$sum": "$versions.size"}}}}},
+	}
+	cursor, err := r.files.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return err
+	}
+
+	var used int64
+	if len(results) > 0 {
+		used = results[0].Total
+	}
+
+	// Another upload may have seeded the counter concurrently; keep whichever came first
+	_, err = r.usage.InsertOne(ctx, bson.M{"_id": ownerID, "used": used})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the counter of a user or workspace whose files are all gone
+func (r *MongoDBStorageUsageRepository) Delete(ctx context.Context, ownerID string) error {
+	_, err := r.usage.DeleteOne(ctx, bson.M{"_id": ownerID})
+	return err
+}
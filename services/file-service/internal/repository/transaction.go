@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrTransactionsUnsupported is returned when MongoDB is a standalone server, which has no transactions
+var ErrTransactionsUnsupported = errors.New("MongoDB must run as a replica set: storage changes are written in transactions")
+
+// Transactor runs writes to several collections as one MongoDB transaction
+type Transactor interface {
+	// Run calls fn in a transaction. It is retried as a whole on transient errors, so fn
+	// must be safe to run again, and every write in it must use the context it is given.
+	Run(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// MongoDBTransactor is the MongoDB implementation of Transactor
+type MongoDBTransactor struct {
+	client *mongo.Client
+}
+
+// NewTransactor creates a new MongoDB transactor
+func NewTransactor(db *mongo.Database) Transactor {
+	return &MongoDBTransactor{
+		client: db.Client(),
+	}
+}
+
+func (t *MongoDBTransactor) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// CheckTransactions returns ErrTransactionsUnsupported unless the server is a replica set
+// member or a mongos, the deployments that support transactions
+func CheckTransactions(ctx context.Context, db *mongo.Database) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrTransactionsUnsupported
+	}
+	return nil
+}
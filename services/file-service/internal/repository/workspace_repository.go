@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrWorkspaceNotFound is returned when no workspace matches, or the user is not a member
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	// ErrMemberNotFound is returned when the user is not a member of the workspace
+	ErrMemberNotFound = errors.New("workspace member not found")
+	// ErrAlreadyMember is returned when adding a user who is a member already
+	ErrAlreadyMember = errors.New("user is already a member of the workspace")
+	// ErrLastOwner is returned when a change would leave the workspace without an owner
+	ErrLastOwner = errors.New("a workspace must keep at least one owner")
+	// ErrMemberUserNotFound is returned when adding an email no account uses
+	ErrMemberUserNotFound = errors.New("no user with this email")
+)
+
+// WorkspaceRepository stores shared workspaces with their members. Membership is read on every
+// request, so changes apply to access immediately.
+type WorkspaceRepository interface {
+	Create(ctx context.Context, workspace *models.Workspace) error
+	FindByID(ctx context.Context, id string) (*models.Workspace, error)
+	FindByMember(ctx context.Context, userID string) ([]*models.Workspace, error)
+	Rename(ctx context.Context, id, name string) error
+	SetStorageLimit(ctx context.Context, id string, limit int64) error
+	SetPlan(ctx context.Context, id string, plan *models.Plan, grace *models.QuotaGrace) error
+	AddMember(ctx context.Context, id string, member models.WorkspaceMember) error
+	SetMemberRole(ctx context.Context, id, userID, role string) error
+	RemoveMember(ctx context.Context, id, userID string) error
+	Delete(ctx context.Context, id string) error
+	FindUserIDByEmail(ctx context.Context, email string) (string, error)
+}
+
+// MongoDBWorkspaceRepository is the MongoDB implementation of WorkspaceRepository
+type MongoDBWorkspaceRepository struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+// NewWorkspaceRepository creates a new MongoDB workspace repository
+func NewWorkspaceRepository(db *mongo.Database) WorkspaceRepository {
+	return &MongoDBWorkspaceRepository{
+		collection: db.Collection("workspaces"),
+		users:      db.Collection("users"),
+	}
+}
+
+func (r *MongoDBWorkspaceRepository) Create(ctx context.Context, workspace *models.Workspace) error {
+	_, err := r.collection.InsertOne(ctx, workspace)
+	return err
+}
+
+func (r *MongoDBWorkspaceRepository) FindByID(ctx context.Context, id string) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&workspace)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// FindByMember returns the workspaces the user is a member of, by name
+func (r *MongoDBWorkspaceRepository) FindByMember(ctx context.Context, userID string) ([]*models.Workspace, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"members.user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	workspaces := []*models.Workspace{}
+	if err := cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+func (r *MongoDBWorkspaceRepository) Rename(ctx context.Context, id, name string) error {
+	return r.update(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"name": name}}, ErrWorkspaceNotFound)
+}
+
+func (r *MongoDBWorkspaceRepository) SetStorageLimit(ctx context.Context, id string, limit int64) error {
+	return r.update(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"storage_limit": limit}}, ErrWorkspaceNotFound)
+}
+
+// SetPlan moves the workspace to plan, taking over its storage limit. A nil grace clears any
+// earlier one.
+func (r *MongoDBWorkspaceRepository) SetPlan(ctx context.Context, id string, plan *models.Plan, grace *models.QuotaGrace) error {
+	update := bson.M{"$set": bson.M{"plan_id": plan.ID, "storage_limit": plan.StorageLimit}}
+	if grace != nil {
+		update["$set"].(bson.M)["quota_grace"] = grace
+	} else {
+		update["$unset"] = bson.M{"quota_grace": ""}
+	}
+	return r.update(ctx, bson.M{"_id": id}, update, ErrWorkspaceNotFound)
+}
+
+func (r *MongoDBWorkspaceRepository) AddMember(ctx context.Context, id string, member models.WorkspaceMember) error {
+	filter := bson.M{"_id": id, "members.user_id": bson.M{"$ne": member.UserID}}
+	err := r.update(ctx, filter, bson.M{"$push": bson.M{"members": member}}, ErrAlreadyMember)
+	if errors.Is(err, ErrAlreadyMember) {
+		return r.notFoundOr(ctx, id, err)
+	}
+	return err
+}
+
+// SetMemberRole changes a member's role. Demoting an owner only succeeds while another owner
+// remains, which the filter checks atomically.
+func (r *MongoDBWorkspaceRepository) SetMemberRole(ctx context.Context, id, userID, role string) error {
+	filter := bson.M{"_id": id, "members.user_id": userID}
+	if role != models.WorkspaceRoleOwner {
+		filter["$or"] = otherOwnerOrNotOwner(userID)
+	}
+	update := bson.M{"$set": bson.M{"members.$[member].role": role}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"member.user_id": userID}},
+	})
+
+	result, err := r.collection.UpdateOne(ctx, filter, r.touch(update), opts)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.memberErr(ctx, id, userID)
+	}
+	return nil
+}
+
+// RemoveMember removes a member, unless they are the last owner
+func (r *MongoDBWorkspaceRepository) RemoveMember(ctx context.Context, id, userID string) error {
+	filter := bson.M{
+		"_id":             id,
+		"members.user_id": userID,
+		"$or":             otherOwnerOrNotOwner(userID),
+	}
+	err := r.update(ctx, filter, bson.M{"$pull": bson.M{"members": bson.M{"user_id": userID}}}, ErrLastOwner)
+	if errors.Is(err, ErrLastOwner) {
+		return r.memberErr(ctx, id, userID)
+	}
+	return err
+}
+
+func (r *MongoDBWorkspaceRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+// FindUserIDByEmail looks up a registered user to add as a member
+func (r *MongoDBWorkspaceRepository) FindUserIDByEmail(ctx context.Context, email string) (string, error) {
+	var user struct {
+		ID string `bson:"_id"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	err := r.users.FindOne(ctx, bson.M{"email": email}, opts).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", ErrMemberUserNotFound
+		}
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// otherOwnerOrNotOwner matches a workspace where userID is not an owner or another owner exists
+func otherOwnerOrNotOwner(userID string) bson.A {
+	return bson.A{
+		bson.M{"members": bson.M{"$elemMatch": bson.M{"user_id": userID, "role": bson.M{"$ne": models.WorkspaceRoleOwner}}}},
+		bson.M{"members": bson.M{"$elemMatch": bson.M{"user_id": bson.M{"$ne": userID}, "role": models.WorkspaceRoleOwner}}},
+	}
+}
+
+// update applies update to the workspace matching filter, returning notMatched if there is none
+func (r *MongoDBWorkspaceRepository) update(ctx context.Context, filter, update bson.M, notMatched error) error {
+	result, err := r.collection.UpdateOne(ctx, filter, r.touch(update))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return notMatched
+	}
+	return nil
+}
+
+// touch adds setting updated_at to an update
+func (r *MongoDBWorkspaceRepository) touch(update bson.M) bson.M {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["updated_at"] = time.Now()
+	update["$set"] = set
+	return update
+}
+
+// memberErr explains why an update filtered by membership matched nothing
+func (r *MongoDBWorkspaceRepository) memberErr(ctx context.Context, id, userID string) error {
+	workspace, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if workspace.MemberRole(userID) == "" {
+		return ErrMemberNotFound
+	}
+	return ErrLastOwner
+}
+
+// notFoundOr returns ErrWorkspaceNotFound if the workspace is gone, and err otherwise
+func (r *MongoDBWorkspaceRepository) notFoundOr(ctx context.Context, id string, err error) error {
+	if _, findErr := r.FindByID(ctx, id); findErr != nil {
+		return findErr
+	}
+	return err
+}
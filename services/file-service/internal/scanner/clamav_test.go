@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test string, detected by every scanner
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd is a loopback clamd speaking the INSTREAM protocol. It reports streams containing
+// the EICAR string as infected and refuses streams over maxSize like StreamMaxLength does.
+type fakeClamd struct {
+	listener net.Listener
+	maxSize  int
+	hang     bool        // Read the stream but never reply
+	received chan []byte // The first stream, for tests to inspect
+}
+
+func startFakeClamd(t *testing.T, maxSize int, hang bool) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	d := &fakeClamd{listener: listener, maxSize: maxSize, hang: hang, received: make(chan []byte, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go d.serve()
+	return d
+}
+
+func (d *fakeClamd) address() string {
+	return d.listener.Addr().String()
+}
+
+func (d *fakeClamd) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+
+	command := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var stream bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(&stream, conn, int64(n)); err != nil {
+			return
+		}
+	}
+	select {
+	case d.received <- stream.Bytes():
+	default:
+	}
+
+	switch {
+	case d.hang:
+		// Hold the connection until the client gives up
+		io.Copy(io.Discard, conn)
+	case stream.Len() > d.maxSize:
+		conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+	case bytes.Contains(stream.Bytes(), []byte(eicar)):
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+	default:
+		conn.Write([]byte("stream: OK\x00"))
+	}
+}
+
+func TestClamAVScannerClean(t *testing.T) {
+	d := startFakeClamd(t, 1<<20, false)
+	scanner := NewClamAVScanner(d.address(), time.Second)
+
+	// More than one chunk, to check the stream is reassembled
+	content := strings.Repeat("clean content ", 2*chunkSize/14)
+	result, err := scanner.Scan(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if result.Infected || result.Signature != "" {
+		t.Errorf("Scan = %+v, want clean", result)
+	}
+	if got := <-d.received; string(got) != content {
+		t.Errorf("clamd received %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestClamAVScannerInfected(t *testing.T) {
+	d := startFakeClamd(t, 1<<20, false)
+	scanner := NewClamAVScanner(d.address(), time.Second)
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("Scan = %+v, want infected with Eicar-Test-Signature", result)
+	}
+}
+
+func TestClamAVScannerSizeLimit(t *testing.T) {
+	d := startFakeClamd(t, 1024, false)
+	scanner := NewClamAVScanner(d.address(), time.Second)
+
+	_, err := scanner.Scan(context.Background(), strings.NewReader(strings.Repeat("x", 4096)))
+	if !errors.Is(err, ErrScanRejected) {
+		t.Fatalf("Scan error = %v, want ErrScanRejected", err)
+	}
+	if !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("Scan error = %v, want the clamd message", err)
+	}
+}
+
+func TestClamAVScannerTimeout(t *testing.T) {
+	d := startFakeClamd(t, 1<<20, true)
+
+	scanner := NewClamAVScanner(d.address(), 100*time.Millisecond)
+	start := time.Now()
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("content")); err == nil {
+		t.Fatal("Scan succeeded without a reply")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Scan took %s, want it to stop after the timeout", elapsed)
+	}
+
+	// A context deadline takes precedence over the scanner's timeout
+	scanner = NewClamAVScanner(d.address(), time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := scanner.Scan(ctx, strings.NewReader("content")); err == nil {
+		t.Fatal("Scan succeeded without a reply")
+	}
+}
+
+func TestClamAVScannerUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	if _, err := NewClamAVScanner(address, time.Second).Scan(context.Background(), strings.NewReader("content")); err == nil {
+		t.Fatal("Scan succeeded without a daemon")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		err       error
+	}{
+		{"stream: OK", false, "", nil},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND", true, "Win.Test.EICAR_HDB-1", nil},
+		{"INSTREAM size limit exceeded. ERROR", false, "", ErrScanRejected},
+	}
+	for _, tt := range tests {
+		result, err := parseReply(tt.reply)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("parseReply(%q) error = %v, want %v", tt.reply, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("parseReply(%q) = %+v, %v", tt.reply, result, err)
+		}
+	}
+
+	if _, err := parseReply("garbage"); err == nil {
+		t.Error("parseReply accepted an unknown reply")
+	}
+}
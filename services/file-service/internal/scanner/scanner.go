@@ -0,0 +1,18 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Result is the outcome of scanning a single blob
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected threat, empty when clean
+}
+
+// Scanner inspects uploaded content for malware.
+// An error means the content could not be scanned and the scan should be retried.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// recordFileEvent audits an action on a file. The file's owner is the subject, so actions of
+// other workspace members on it show up in the owner's audit log as well.
+func (s *FileService) recordFileEvent(ctx context.Context, action, userID string, file *models.FileResponse, version int) {
+	details := map[string]string{"name": file.OriginalName}
+	if file.WorkspaceID != "" {
+		details["workspace_id"] = file.WorkspaceID
+	}
+	if version > 0 {
+		details["version"] = strconv.Itoa(version)
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     action,
+		ActorID:    userID,
+		SubjectID:  file.UserID,
+		TargetType: "file",
+		TargetID:   file.ID,
+		Details:    details,
+	})
+}
+
+// recordWorkspaceEvent audits a change to a workspace's members. The member is the subject.
+func (s *FileService) recordWorkspaceEvent(ctx context.Context, action, userID, workspaceID, memberID string, details map[string]string) {
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     action,
+		ActorID:    userID,
+		SubjectID:  memberID,
+		TargetType: "workspace",
+		TargetID:   workspaceID,
+		Details:    details,
+	})
+}
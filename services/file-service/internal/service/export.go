@@ -0,0 +1,440 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrExportNotReady is returned when downloading an export that is not built, failed or expired
+var ErrExportNotReady = errors.New("export is not ready for download")
+
+const (
+	// exportsDir is where export archives are written, relative to the storage path
+	exportsDir = ".exports"
+	// exportStaleAfter is how long an export can be running before it is assumed to be
+	// interrupted and built again
+	exportStaleAfter = time.Hour
+	// maxFolderDepth bounds the folder nesting followed when laying out an archive
+	maxFolderDepth = 64
+)
+
+// ExportService builds downloadable archives of everything a user stores: profile.json with the
+// account and workspace memberships, files.json with the metadata of every file and folder, the
+// current version of each file under files/ and, when asked for, every version under versions/.
+// Only personal storage is exported; workspace files belong to the workspace.
+type ExportService struct {
+	exportRepo    repository.DataExportRepository
+	fileRepo      repository.FileRepository
+	workspaceRepo repository.WorkspaceRepository
+	logger        *utils.Logger
+	auditLog      *audit.Recorder
+	storagePath   string
+	expiration    time.Duration
+	interval      time.Duration
+	wake          chan struct{}
+}
+
+func NewExportService(exportRepo repository.DataExportRepository, fileRepo repository.FileRepository, workspaceRepo repository.WorkspaceRepository, logger *utils.Logger, auditLog *audit.Recorder, storagePath string, expiration, interval time.Duration) *ExportService {
+	return &ExportService{
+		exportRepo:    exportRepo,
+		fileRepo:      fileRepo,
+		workspaceRepo: workspaceRepo,
+		logger:        logger,
+		auditLog:      auditLog,
+		storagePath:   storagePath,
+		expiration:    expiration,
+		interval:      interval,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// RequestExport queues an export of the user's data. A user can have one export in progress.
+func (s *ExportService) RequestExport(ctx context.Context, userID string, req *models.DataExportRequest) (*models.DataExport, error) {
+	export := models.NewDataExport(userID, req.IncludeVersions)
+	if err := s.exportRepo.Create(ctx, export); err != nil {
+		return nil, err
+	}
+	s.recordExportEvent(ctx, models.AuditDataExportRequest, export)
+	s.Notify()
+	return export, nil
+}
+
+func (s *ExportService) ListExports(ctx context.Context, userID string) ([]*models.DataExport, error) {
+	return s.exportRepo.FindByUser(ctx, userID)
+}
+
+func (s *ExportService) GetExport(ctx context.Context, userID, id string) (*models.DataExport, error) {
+	return s.exportRepo.FindByID(ctx, userID, id)
+}
+
+// DownloadExport returns a ready export of the user, whose archive is at its Path
+func (s *ExportService) DownloadExport(ctx context.Context, userID, id string) (*models.DataExport, error) {
+	export, err := s.exportRepo.FindByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != models.DataExportReady || (export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt)) {
+		return nil, ErrExportNotReady
+	}
+	s.recordExportEvent(ctx, models.AuditDataExportDownload, export)
+	return export, nil
+}
+
+func (s *ExportService) recordExportEvent(ctx context.Context, action string, export *models.DataExport) {
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     action,
+		ActorID:    export.UserID,
+		SubjectID:  export.UserID,
+		TargetType: "data_export",
+		TargetID:   export.ID,
+		Details:    map[string]string{"include_versions": strconv.FormatBool(export.IncludeVersions)},
+	})
+}
+
+// PurgeUser deletes the exports of a deleted user with their archives
+func (s *ExportService) PurgeUser(ctx context.Context, userID string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+	if err := os.RemoveAll(filepath.Join(s.storagePath, exportsDir, userID)); err != nil {
+		return err
+	}
+	return s.exportRepo.DeleteByUser(ctx, userID)
+}
+
+// Notify asks the worker to build pending exports without waiting for the next tick
+func (s *ExportService) Notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run builds pending exports and removes expired ones until ctx is cancelled
+func (s *ExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.buildPending(ctx)
+		s.removeExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *ExportService) buildPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		export, err := s.exportRepo.ClaimNext(ctx, time.Now().Add(-exportStaleAfter))
+		if err != nil {
+			s.logger.Errorf("Failed to claim a pending export: %v", err)
+			return
+		}
+		if export == nil {
+			return
+		}
+		s.build(ctx, export)
+	}
+}
+
+func (s *ExportService) build(ctx context.Context, export *models.DataExport) {
+	expiresAt := time.Now().Add(s.expiration)
+
+	archivePath, size, err := s.writeArchive(ctx, export)
+	if err != nil {
+		s.logger.Errorf("Failed to build export %s of user %s: %v", export.ID, export.UserID, err)
+		if err := s.exportRepo.Fail(ctx, export.ID, "the export could not be built", expiresAt); err != nil {
+			s.logger.Errorf("Failed to record the failure of export %s: %v", export.ID, err)
+		}
+		return
+	}
+
+	if err := s.exportRepo.Complete(ctx, export.ID, archivePath, size, expiresAt); err != nil {
+		s.logger.Errorf("Failed to record export %s: %v", export.ID, err)
+		s.removeBlob(archivePath)
+		return
+	}
+	s.logger.Infof("Export %s of user %s is ready (%d bytes)", export.ID, export.UserID, size)
+}
+
+func (s *ExportService) removeExpired(ctx context.Context) {
+	exports, err := s.exportRepo.FindExpired(ctx, time.Now())
+	if err != nil {
+		s.logger.Errorf("Failed to find expired exports: %v", err)
+		return
+	}
+	for _, export := range exports {
+		if export.Path != "" {
+			s.removeBlob(export.Path)
+		}
+		if err := s.exportRepo.Delete(ctx, export.ID); err != nil {
+			s.logger.Errorf("Failed to delete expired export %s: %v", export.ID, err)
+		}
+	}
+}
+
+func (s *ExportService) removeBlob(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Errorf("Failed to remove export archive %s: %v", path, err)
+	}
+}
+
+// exportedFile is an entry of files.json. Path is where the current version is in the archive,
+// under files/; it is empty for content that was left out because it is quarantined or missing.
+type exportedFile struct {
+	models.FileResponse
+	Path     string            `json:"path,omitempty"`
+	Versions []exportedVersion `json:"versions,omitempty"`
+}
+
+type exportedVersion struct {
+	models.FileVersionResponse
+	Path string `json:"path,omitempty"`
+}
+
+type exportedWorkspace struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type exportedProfile struct {
+	User       models.UserResponse `json:"user"`
+	Workspaces []exportedWorkspace `json:"workspaces"`
+	ExportedAt time.Time           `json:"exported_at"`
+}
+
+// writeArchive writes the export's zip archive and returns its path and size. The archive is
+// written under a temporary name, so a partial one is never served.
+func (s *ExportService) writeArchive(ctx context.Context, export *models.DataExport) (string, int64, error) {
+	user, err := s.exportRepo.FindUser(ctx, export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+	workspaces, err := s.workspaceRepo.FindByMember(ctx, export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+	files, err := s.fileRepo.FindAllByOwner(ctx, export.UserID, "")
+	if err != nil {
+		return "", 0, err
+	}
+
+	dir := filepath.Join(s.storagePath, exportsDir, export.UserID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(dir, export.ID+"-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	archive := zip.NewWriter(tmp)
+	if err := s.writeContents(ctx, archive, export, user, workspaces, files); err != nil {
+		return "", 0, err
+	}
+	if err := archive.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	target := filepath.Join(dir, export.ID+".zip")
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", 0, err
+	}
+	return target, info.Size(), nil
+}
+
+func (s *ExportService) writeContents(ctx context.Context, archive *zip.Writer, export *models.DataExport, user *models.User, workspaces []*models.Workspace, files []*models.File) error {
+	now := time.Now()
+
+	profile := exportedProfile{User: user.ToResponse(), Workspaces: []exportedWorkspace{}, ExportedAt: now}
+	for _, workspace := range workspaces {
+		for _, member := range workspace.Members {
+			if member.UserID == export.UserID {
+				profile.Workspaces = append(profile.Workspaces, exportedWorkspace{
+					ID:      workspace.ID,
+					Name:    workspace.Name,
+					Role:    member.Role,
+					AddedAt: member.AddedAt,
+				})
+			}
+		}
+	}
+	if err := writeJSON(archive, "profile.json", profile, now); err != nil {
+		return err
+	}
+
+	layout := newArchiveLayout(files)
+	entries := make([]exportedFile, 0, len(files))
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry := exportedFile{FileResponse: file.ToResponse()}
+		filePath := layout.path(file, 0)
+
+		if file.IsFolder {
+			entry.Path = "files/" + filePath + "/"
+			if _, err := archive.CreateHeader(&zip.FileHeader{Name: entry.Path, Modified: file.UpdatedAt}); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			continue
+		}
+
+		if current := file.FindVersion(file.CurrentVersion); current == nil || current.IsDownloadable() {
+			name := "files/" + filePath
+			if s.addBlob(archive, name, file.Path, file.UpdatedAt) {
+				entry.Path = name
+			}
+		}
+
+		if export.IncludeVersions {
+			for _, version := range file.GetVersionResponses() {
+				exported := exportedVersion{FileVersionResponse: version}
+				stored := file.FindVersion(version.Version)
+				if stored.IsDownloadable() {
+					name := fmt.Sprintf("versions/%s/v%d-%s", filePath, version.Version, path.Base(filePath))
+					if s.addBlob(archive, name, stored.Path, stored.UploadedAt) {
+						exported.Path = name
+					}
+				}
+				entry.Versions = append(entry.Versions, exported)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return writeJSON(archive, "files.json", entries, now)
+}
+
+// addBlob copies a stored blob into the archive, reporting whether it was added. Blobs that
+// can not be read are left out rather than failing the whole export.
+func (s *ExportService) addBlob(archive *zip.Writer, name, blobPath string, modified time.Time) bool {
+	src, err := os.Open(blobPath)
+	if err != nil {
+		s.logger.Warnf("Leaving %s out of an export: %v", blobPath, err)
+		return false
+	}
+	defer src.Close()
+
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		s.logger.Errorf("Failed to add %s to an export: %v", blobPath, err)
+		return false
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		s.logger.Errorf("Failed to add %s to an export: %v", blobPath, err)
+		return false
+	}
+	return true
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}, modified time.Time) error {
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(dst)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// archiveLayout places files at their folder path in the archive, with names made safe and
+// unique
+type archiveLayout struct {
+	files map[string]*models.File
+	paths map[string]string
+	used  map[string]bool
+}
+
+func newArchiveLayout(files []*models.File) *archiveLayout {
+	layout := &archiveLayout{
+		files: make(map[string]*models.File, len(files)),
+		paths: make(map[string]string, len(files)),
+		used:  make(map[string]bool, len(files)),
+	}
+	for _, file := range files {
+		layout.files[file.ID] = file
+	}
+	return layout
+}
+
+// path returns the file's path in the archive. Files whose folder is gone are placed at the top.
+func (l *archiveLayout) path(file *models.File, depth int) string {
+	if p, ok := l.paths[file.ID]; ok {
+		return p
+	}
+
+	dir := ""
+	if file.ParentID != nil && depth < maxFolderDepth {
+		if parent, ok := l.files[*file.ParentID]; ok && parent.IsFolder {
+			dir = l.path(parent, depth+1)
+		}
+	}
+
+	name := file.OriginalName
+	if file.IsFolder {
+		name = file.Name
+	}
+	p := l.unique(path.Join(dir, archiveName(name)))
+	l.paths[file.ID] = p
+	return p
+}
+
+// unique adds a counter to p when another file already has it, e.g. "report (2).pdf"
+func (l *archiveLayout) unique(p string) string {
+	candidate := p
+	ext := path.Ext(p)
+	for n := 2; l.used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(p, ext), n, ext)
+	}
+	l.used[candidate] = true
+	return candidate
+}
+
+// archiveName makes a file or folder name safe to use as one archive path element
+func archiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
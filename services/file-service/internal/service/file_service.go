@@ -11,27 +11,84 @@ import (
 	"time"
 
 	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrFileQuarantined is returned when a version is blocked by malware scanning
+	ErrFileQuarantined = errors.New("file is quarantined")
+	// ErrUnauthorizedFile is returned for files the user can not access
+	ErrUnauthorizedFile = errors.New("unauthorized access to file")
+	// ErrParentNotFound is returned when the parent folder does not exist in the same storage
+	ErrParentNotFound = errors.New("parent folder not found")
 )
 
 type FileService struct {
-	fileRepo    repository.FileRepository
-	storagePath string
-	maxFileSize int64
+	fileRepo             repository.FileRepository
+	usageRepo            repository.StorageUsageRepository
+	eventRepo            repository.StorageEventRepository
+	transactor           repository.Transactor
+	workspaceRepo        repository.WorkspaceRepository
+	planRepo             repository.PlanRepository
+	logger               *utils.Logger
+	auditLog             *audit.Recorder
+	storagePath          string
+	downgradeGracePeriod time.Duration
+	mimePolicy           *MimePolicy
+	scanWorker           *ScanWorker // nil when malware scanning is disabled
 }
 
-func NewFileService(fileRepo repository.FileRepository, storagePath string, maxFileSize int64) *FileService {
+func NewFileService(fileRepo repository.FileRepository, usageRepo repository.StorageUsageRepository, eventRepo repository.StorageEventRepository, transactor repository.Transactor, workspaceRepo repository.WorkspaceRepository, planRepo repository.PlanRepository, logger *utils.Logger, auditLog *audit.Recorder, storagePath string, downgradeGracePeriod time.Duration, mimePolicy *MimePolicy, scanWorker *ScanWorker) *FileService {
 	return &FileService{
-		fileRepo:    fileRepo,
-		storagePath: storagePath,
-		maxFileSize: maxFileSize,
+		fileRepo:             fileRepo,
+		usageRepo:            usageRepo,
+		eventRepo:            eventRepo,
+		transactor:           transactor,
+		workspaceRepo:        workspaceRepo,
+		planRepo:             planRepo,
+		logger:               logger,
+		auditLog:             auditLog,
+		storagePath:          storagePath,
+		downgradeGracePeriod: downgradeGracePeriod,
+		mimePolicy:           mimePolicy,
+		scanWorker:           scanWorker,
 	}
 }
 
-func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader *multipart.FileHeader, parentID *string) (*models.FileResponse, error) {
-	// Check file size
-	if fileHeader.Size > s.maxFileSize {
-		return nil, fmt.Errorf("file size exceeds maximum allowed size of %d bytes", s.maxFileSize)
+// initialScanStatus quarantines new versions when a scanner is configured
+func (s *FileService) initialScanStatus() string {
+	if s.scanWorker == nil {
+		return ""
+	}
+	return models.ScanStatusPending
+}
+
+func (s *FileService) notifyScanner() {
+	if s.scanWorker != nil {
+		s.scanWorker.Notify()
+	}
+}
+
+// UploadFile stores a file in the user's personal storage or, with a workspaceID, in a workspace
+// the user can edit. A file with the same name in the same folder gets a new version.
+func (s *FileService) UploadFile(ctx context.Context, userID, workspaceID string, fileHeader *multipart.FileHeader, parentID *string) (_ *models.FileResponse, err error) {
+	scope, err := s.resolveScope(ctx, userID, workspaceID, models.WorkspaceRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkParent(ctx, scope, parentID); err != nil {
+		return nil, err
+	}
+
+	// The plan of the user or workspace decides the file size, storage and versions allowed
+	plan, limit, err := s.ownerPlan(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if fileHeader.Size > plan.MaxFileSize {
+		return nil, fmt.Errorf("file size exceeds maximum allowed size of %d bytes on the %s plan", plan.MaxFileSize, plan.Name)
 	}
 
 	// Open uploaded file
@@ -41,8 +98,28 @@ func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader
 	}
 	defer src.Close()
 
+	// Detect the real content type instead of trusting the client's Content-Type
+	mimeType, err := DetectMimeType(src, fileHeader.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mimePolicy.Check(mimeType); err != nil {
+		return nil, err
+	}
+
+	// Every stored version counts against the quota, so new versions are charged in full
+	res, err := s.reserveStorage(ctx, scope.ownerID(), limit, fileHeader.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			s.cancelReservation(res)
+		}
+	}()
+
 	// Check if file with same name exists (for versioning)
-	existingFile, err := s.fileRepo.FindByOriginalName(ctx, userID, fileHeader.Filename, parentID)
+	existingFile, err := s.fileRepo.FindByOriginalName(ctx, userID, scope.workspaceID(), fileHeader.Filename, parentID)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +127,7 @@ func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader
 	var response *models.FileResponse
 	if existingFile != nil {
 		// File with same name exists - create new version
-		response, err = s.addNewVersion(ctx, existingFile, fileHeader, src)
+		response, err = s.addNewVersion(ctx, existingFile, plan, res, fileHeader, src, mimeType)
 		if err != nil {
 			return nil, err
 		}
@@ -58,15 +135,15 @@ func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader
 		// Reset file pointer
 		src.Seek(0, 0)
 
-		// Create user directory
-		userDir := filepath.Join(s.storagePath, userID)
-		if err := os.MkdirAll(userDir, 0755); err != nil {
+		// Create the user's or workspace's directory
+		ownerDir := filepath.Join(s.storagePath, scope.ownerID())
+		if err := os.MkdirAll(ownerDir, 0755); err != nil {
 			return nil, err
 		}
 
 		// Generate unique filename
 		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), fileHeader.Filename)
-		filePath := filepath.Join(userDir, filename)
+		filePath := filepath.Join(ownerDir, filename)
 
 		// Save file to disk
 		dst, err := os.Create(filePath)
@@ -76,23 +153,28 @@ func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader
 		defer dst.Close()
 
 		if _, err := io.Copy(dst, src); err != nil {
-			os.Remove(filePath)
+			s.removeBlob(filePath)
 			return nil, err
 		}
 
 		// Create file record
 		file := models.NewFile(
 			userID,
+			scope.workspaceID(),
 			filename,
 			fileHeader.Filename,
 			filePath,
 			fileHeader.Size,
-			fileHeader.Header.Get("Content-Type"),
+			mimeType,
+			s.initialScanStatus(),
 			parentID,
 		)
 
-		if err := s.fileRepo.Create(ctx, file); err != nil {
-			os.Remove(filePath)
+		err = s.changeStorage(ctx, file, fileHeader.Size, models.StorageEventUpload, res, func(ctx context.Context) error {
+			return s.fileRepo.Create(ctx, file)
+		})
+		if err != nil {
+			s.removeBlob(filePath)
 			return nil, err
 		}
 
@@ -100,21 +182,52 @@ func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader
 		response = &resp
 	}
 
+	s.notifyScanner()
+	s.recordFileEvent(ctx, models.AuditFileUpload, userID, response, response.CurrentVersion)
 	return response, nil
 }
 
-func (c *FileService) ListFiles(ctx context.Context, userID string, parentID *string) ([]*models.FileResponse, error) {
-	files, err := c.fileRepo.FindByUserID(ctx, userID, parentID)
+// ListFiles lists a folder of the user's personal storage or, with a workspaceID, of a workspace
+func (s *FileService) ListFiles(ctx context.Context, userID, workspaceID string, parentID *string) ([]*models.FileResponse, error) {
+	scope, err := s.resolveScope(ctx, userID, workspaceID, models.WorkspaceRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.fileRepo.FindByOwner(ctx, userID, scope.workspaceID(), parentID)
+	if err != nil {
+		return nil, err
+	}
+	return toResponses(files), nil
+}
+
+// GetFolderContents lists a folder, in whichever storage it belongs to
+func (s *FileService) GetFolderContents(ctx context.Context, userID, folderID string) ([]*models.FileResponse, error) {
+	folder, err := s.fileRepo.FindByID(ctx, folderID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.authorizeFile(ctx, userID, folder, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+	if !folder.IsFolder {
+		return nil, errors.New("not a folder")
+	}
 
+	files, err := s.fileRepo.FindByOwner(ctx, folder.UserID, folder.WorkspaceID, &folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toResponses(files), nil
+}
+
+func toResponses(files []*models.File) []*models.FileResponse {
 	responses := make([]*models.FileResponse, len(files))
 	for i, file := range files {
 		response := file.ToResponse()
 		responses[i] = &response
 	}
-	return responses, nil
+	return responses
 }
 
 func (s *FileService) DownloadFile(ctx context.Context, userID, fileID string) (*models.File, error) {
@@ -123,14 +236,24 @@ func (s *FileService) DownloadFile(ctx context.Context, userID, fileID string) (
 		return nil, err
 	}
 
-	if file.UserID != userID && !file.IsPublic {
-		return nil, errors.New("unauthorized access to file")
+	if !file.IsPublic {
+		if err := s.authorizeFile(ctx, userID, file, models.WorkspaceRoleViewer); err != nil {
+			return nil, err
+		}
 	}
 
 	if file.IsFolder {
 		return nil, errors.New("cannot download a folder")
 	}
 
+	if current := file.FindVersion(file.CurrentVersion); current != nil {
+		if err := checkDownloadable(current); err != nil {
+			return nil, err
+		}
+	}
+
+	response := file.ToResponse()
+	s.recordFileEvent(ctx, models.AuditFileDownload, userID, &response, file.CurrentVersion)
 	return file, nil
 }
 
@@ -140,8 +263,8 @@ func (s *FileService) DeleteFile(ctx context.Context, userID, fileID string) (in
 		return 0, err
 	}
 
-	if file.UserID != userID {
-		return 0, errors.New("unauthorized access to file")
+	if err := s.authorizeFile(ctx, userID, file, models.WorkspaceRoleEditor); err != nil {
+		return 0, err
 	}
 
 	// Calculate total size (current version + all versions)
@@ -155,28 +278,56 @@ func (s *FileService) DeleteFile(ctx context.Context, userID, fileID string) (in
 		}
 	}
 
-	// Delete file from disk
+	// Delete from database
+	err = s.changeStorage(ctx, file, -totalSize, models.StorageEventDelete, nil, func(ctx context.Context) error {
+		return s.fileRepo.Delete(ctx, fileID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete file from disk only once no record points to it; blobs left behind by a crash
+	// in between are picked up by fsck as orphans
 	if !file.IsFolder && file.Path != "" {
-		os.Remove(file.Path)
+		s.removeBlob(file.Path)
 		// Delete all version files
 		for _, v := range file.Versions {
 			if v.Path != file.Path {
-				os.Remove(v.Path)
+				s.removeBlob(v.Path)
 			}
 		}
 	}
 
-	err = s.fileRepo.Delete(ctx, fileID)
+	response := file.ToResponse()
+	s.recordFileEvent(ctx, models.AuditFileDelete, userID, &response, 0)
+	return totalSize, nil
+}
+
+// maxLargestFiles caps the largest files list of the usage breakdown
+const maxLargestFiles = 100
+
+func (s *FileService) GetUsageBreakdown(ctx context.Context, userID, workspaceID string, largestLimit int) (*models.StorageUsageBreakdown, error) {
+	if largestLimit <= 0 || largestLimit > maxLargestFiles {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxLargestFiles)
+	}
+	scope, err := s.resolveScope(ctx, userID, workspaceID, models.WorkspaceRoleViewer)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	return totalSize, nil
+	return s.fileRepo.UsageBreakdown(ctx, userID, scope.workspaceID(), largestLimit)
 }
 
 /* Folder operations */
 func (s *FileService) CreateFolder(ctx context.Context, userID string, req *models.FolderCreateRequest) (*models.FileResponse, error) {
-	folder := models.NewFolder(userID, req.Name, req.ParentID)
+	scope, err := s.resolveScope(ctx, userID, req.WorkspaceID, models.WorkspaceRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkParent(ctx, scope, req.ParentID); err != nil {
+		return nil, err
+	}
+
+	folder := models.NewFolder(userID, scope.workspaceID(), req.Name, req.ParentID)
 
 	if err := s.fileRepo.Create(ctx, folder); err != nil {
 		return nil, err
@@ -187,19 +338,19 @@ func (s *FileService) CreateFolder(ctx context.Context, userID string, req *mode
 }
 
 /* Version operations */
-func (s *FileService) addNewVersion(ctx context.Context, existingFile *models.File, fileHeader *multipart.FileHeader, src multipart.File) (*models.FileResponse, error) {
+func (s *FileService) addNewVersion(ctx context.Context, existingFile *models.File, plan *models.Plan, res *reservation, fileHeader *multipart.FileHeader, src multipart.File, mimeType string) (*models.FileResponse, error) {
 	// Reset file pointer
 	src.Seek(0, 0)
 
-	// Create user directory
-	userDir := filepath.Join(s.storagePath, existingFile.UserID)
-	if err := os.MkdirAll(userDir, 0755); err != nil {
+	// Create the user's or workspace's directory
+	ownerDir := filepath.Join(s.storagePath, existingFile.StorageOwnerID())
+	if err := os.MkdirAll(ownerDir, 0755); err != nil {
 		return nil, err
 	}
 
 	// Generate unique filename for new version
 	filename := fmt.Sprintf("%d_%s", time.Now().Unix(), fileHeader.Filename)
-	filePath := filepath.Join(userDir, filename)
+	filePath := filepath.Join(ownerDir, filename)
 
 	// Save file to disk
 	dst, err := os.Create(filePath)
@@ -209,7 +360,7 @@ func (s *FileService) addNewVersion(ctx context.Context, existingFile *models.Fi
 	defer dst.Close()
 
 	if _, err := io.Copy(dst, src); err != nil {
-		os.Remove(filePath)
+		s.removeBlob(filePath)
 		return nil, err
 	}
 
@@ -219,13 +370,17 @@ func (s *FileService) addNewVersion(ctx context.Context, existingFile *models.Fi
 		Version:    newVersionNumber,
 		Size:       fileHeader.Size,
 		Path:       filePath,
-		MimeType:   fileHeader.Header.Get("Content-Type"),
+		MimeType:   mimeType,
 		UploadedAt: time.Now(),
+		ScanStatus: s.initialScanStatus(),
 	}
 
 	// Add version to database
-	if err := s.fileRepo.AddVersion(ctx, existingFile.ID, newVersion, newVersionNumber, filePath, newVersion.MimeType, fileHeader.Size); err != nil {
-		os.Remove(filePath)
+	err = s.changeStorage(ctx, existingFile, fileHeader.Size, models.StorageEventNewVersion, res, func(ctx context.Context) error {
+		return s.fileRepo.AddVersion(ctx, existingFile.ID, newVersion, newVersionNumber, filePath, newVersion.MimeType, fileHeader.Size)
+	})
+	if err != nil {
+		s.removeBlob(filePath)
 		return nil, err
 	}
 
@@ -235,6 +390,14 @@ func (s *FileService) addNewVersion(ctx context.Context, existingFile *models.Fi
 		return nil, err
 	}
 
+	// Drop the oldest versions beyond what the plan keeps
+	if plan.MaxVersions > 0 && len(updatedFile.Versions) > plan.MaxVersions {
+		s.pruneVersions(ctx, updatedFile, plan.MaxVersions)
+		if updatedFile, err = s.fileRepo.FindByID(ctx, existingFile.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	response := updatedFile.ToResponse()
 	return &response, nil
 }
@@ -245,8 +408,8 @@ func (s *FileService) GetFileVersions(ctx context.Context, userID, fileID string
 		return nil, err
 	}
 
-	if file.UserID != userID {
-		return nil, errors.New("unauthorized access to file")
+	if err := s.authorizeFile(ctx, userID, file, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
 	}
 
 	if file.IsFolder {
@@ -262,8 +425,10 @@ func (s *FileService) DownloadFileVersion(ctx context.Context, userID, fileID st
 		return nil, "", err
 	}
 
-	if file.UserID != userID && !file.IsPublic {
-		return nil, "", errors.New("unauthorized access to file")
+	if !file.IsPublic {
+		if err := s.authorizeFile(ctx, userID, file, models.WorkspaceRoleViewer); err != nil {
+			return nil, "", err
+		}
 	}
 
 	if file.IsFolder {
@@ -271,19 +436,18 @@ func (s *FileService) DownloadFileVersion(ctx context.Context, userID, fileID st
 	}
 
 	// Find the requested version
-	var versionPath string
-	for _, v := range file.Versions {
-		if v.Version == version {
-			versionPath = v.Path
-			break
-		}
+	targetVersion := file.FindVersion(version)
+	if targetVersion == nil {
+		return nil, "", errors.New("version not found")
 	}
 
-	if versionPath == "" {
-		return nil, "", errors.New("version not found")
+	if err := checkDownloadable(targetVersion); err != nil {
+		return nil, "", err
 	}
 
-	return file, versionPath, nil
+	response := file.ToResponse()
+	s.recordFileEvent(ctx, models.AuditFileVersionDownload, userID, &response, version)
+	return file, targetVersion.Path, nil
 }
 
 func (s *FileService) RestoreFileVersion(ctx context.Context, userID, fileID string, version int) (*models.FileResponse, error) {
@@ -292,8 +456,8 @@ func (s *FileService) RestoreFileVersion(ctx context.Context, userID, fileID str
 		return nil, err
 	}
 
-	if file.UserID != userID {
-		return nil, errors.New("unauthorized access to file")
+	if err := s.authorizeFile(ctx, userID, file, models.WorkspaceRoleEditor); err != nil {
+		return nil, err
 	}
 
 	if file.IsFolder {
@@ -325,6 +489,7 @@ func (s *FileService) RestoreFileVersion(ctx context.Context, userID, fileID str
 	}
 
 	response := updatedFile.ToResponse()
+	s.recordFileEvent(ctx, models.AuditFileVersionRestore, userID, &response, version)
 	return &response, nil
 }
 
@@ -334,8 +499,8 @@ func (s *FileService) DeleteFileVersion(ctx context.Context, userID, fileID stri
 		return 0, err
 	}
 
-	if file.UserID != userID {
-		return 0, errors.New("unauthorized access to file")
+	if err := s.authorizeFile(ctx, userID, file, models.WorkspaceRoleEditor); err != nil {
+		return 0, err
 	}
 
 	if file.IsFolder {
@@ -366,12 +531,40 @@ func (s *FileService) DeleteFileVersion(ctx context.Context, userID, fileID stri
 	}
 
 	// Delete from database
-	if err := s.fileRepo.DeleteVersion(ctx, fileID, version); err != nil {
+	err = s.changeStorage(ctx, file, -versionSize, models.StorageEventDeleteVersion, nil, func(ctx context.Context) error {
+		return s.fileRepo.DeleteVersion(ctx, fileID, version)
+	})
+	if err != nil {
 		return 0, err
 	}
 
 	// Delete file from disk
-	os.Remove(versionPath)
+	s.removeBlob(versionPath)
 
+	response := file.ToResponse()
+	s.recordFileEvent(ctx, models.AuditFileVersionDelete, userID, &response, version)
 	return versionSize, nil
 }
+
+// checkDownloadable blocks versions that are still quarantined or failed the malware scan
+func checkDownloadable(v *models.FileVersion) error {
+	if v.IsDownloadable() {
+		return nil
+	}
+	switch v.ScanStatus {
+	case models.ScanStatusPending:
+		return fmt.Errorf("%w: version %d is still being scanned", ErrFileQuarantined, v.Version)
+	case models.ScanStatusInfected:
+		return fmt.Errorf("%w: version %d is infected (%s)", ErrFileQuarantined, v.Version, v.ScanResult)
+	default:
+		return fmt.Errorf("%w: version %d could not be scanned", ErrFileQuarantined, v.Version)
+	}
+}
+
+// removeBlob deletes a stored file from disk. Failures leave an orphaned blob behind, so they
+// are logged for the fsck command to pick up rather than silently dropped.
+func (s *FileService) removeBlob(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Errorf("Failed to remove blob %s: %v", path, err)
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// Actions the fsck can take on the problems it finds
+const (
+	FsckActionReport     = "report"
+	FsckActionDelete     = "delete"
+	FsckActionQuarantine = "quarantine"
+)
+
+// Kinds of problems reported by the fsck
+const (
+	IssueOrphanedBlob   = "orphaned_blob"   // File on disk that no record points to
+	IssueDanglingRecord = "dangling_record" // Record whose blobs are all missing
+	IssueMissingVersion = "missing_version" // Record with some, but not all, version blobs missing
+	IssueOrphanedChild  = "orphaned_child"  // Record whose parent folder no longer exists
+)
+
+// quarantineDir is where quarantined blobs are moved, relative to the storage path
+const quarantineDir = ".quarantine"
+
+type FsckOptions struct {
+	Action string
+	DryRun bool
+	// Anything written more recently than this is skipped, because an upload may still be
+	// between writing the blob and creating its record
+	GracePeriod time.Duration
+}
+
+type FsckIssue struct {
+	Kind        string `json:"kind"`
+	Path        string `json:"path,omitempty"`
+	FileID      string `json:"file_id,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	Versions    []int  `json:"versions,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Action      string `json:"action,omitempty"` // What was done, or would be done in a dry run
+	Error       string `json:"error,omitempty"`
+}
+
+type FsckReport struct {
+	StartedAt      time.Time   `json:"started_at"`
+	FinishedAt     time.Time   `json:"finished_at"`
+	Action         string      `json:"action"`
+	DryRun         bool        `json:"dry_run"`
+	RecordsScanned int         `json:"records_scanned"`
+	BlobsScanned   int         `json:"blobs_scanned"`
+	SkippedRecent  int         `json:"skipped_recent"`
+	Issues         []FsckIssue `json:"issues"`
+}
+
+// Fsck cross-checks STORAGE_PATH against the files collection and optionally repairs what it finds.
+// Every candidate is re-checked right before it is acted on, so it is safe to run alongside uploads.
+func (s *FileService) Fsck(ctx context.Context, opts FsckOptions) (*FsckReport, error) {
+	if opts.Action == "" {
+		opts.Action = FsckActionReport
+	}
+	switch opts.Action {
+	case FsckActionReport, FsckActionDelete, FsckActionQuarantine:
+	default:
+		return nil, errors.New("action must be report, delete or quarantine")
+	}
+
+	report := &FsckReport{
+		StartedAt: time.Now(),
+		Action:    opts.Action,
+		DryRun:    opts.DryRun,
+		Issues:    []FsckIssue{},
+	}
+	cutoff := report.StartedAt.Add(-opts.GracePeriod)
+
+	// Records are read before the disk walk: a blob uploaded in between then shows up as
+	// orphaned, but it is either inside the grace period or found again by the re-check
+	referenced := make(map[string]bool)
+	folders := make(map[string]bool)
+	var withParent []*models.File
+	var suspect []*models.File
+
+	err := s.fileRepo.ForEach(ctx, func(file *models.File) error {
+		report.RecordsScanned++
+		if file.IsFolder {
+			folders[file.ID] = true
+		}
+		if file.ParentID != nil {
+			withParent = append(withParent, file)
+		}
+		for _, v := range file.Versions {
+			referenced[absPath(v.Path)] = true
+		}
+		if !file.IsFolder && len(missingVersions(file)) > 0 {
+			suspect = append(suspect, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range suspect {
+		if file.UpdatedAt.After(cutoff) {
+			report.SkippedRecent++
+			continue
+		}
+		if issue := s.fsckRecord(ctx, file.ID, opts); issue != nil {
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+
+	for _, file := range withParent {
+		if folders[*file.ParentID] || file.CreatedAt.After(cutoff) {
+			continue
+		}
+		if issue := s.fsckOrphanedChild(ctx, file, opts); issue != nil {
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+
+	root := filepath.Clean(s.storagePath)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == filepath.Join(root, quarantineDir) || path == filepath.Join(root, exportsDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		report.BlobsScanned++
+		if referenced[absPath(path)] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			report.SkippedRecent++
+			return nil
+		}
+
+		if issue := s.fsckOrphanedBlob(ctx, root, path, info.Size(), opts); issue != nil {
+			report.Issues = append(report.Issues, *issue)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now()
+	s.logger.Infof("Fsck finished: %d records and %d blobs scanned, %d issues (action: %s, dry run: %t)",
+		report.RecordsScanned, report.BlobsScanned, len(report.Issues), opts.Action, opts.DryRun)
+	return report, nil
+}
+
+// fsckRecord handles a record with missing blobs, re-reading it first
+func (s *FileService) fsckRecord(ctx context.Context, fileID string, opts FsckOptions) *FsckIssue {
+	file, err := s.fileRepo.FindByID(ctx, fileID)
+	if errors.Is(err, repository.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return &FsckIssue{Kind: IssueDanglingRecord, FileID: fileID, Error: err.Error()}
+	}
+
+	missing := missingVersions(file)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	issue := &FsckIssue{
+		Kind:        IssueMissingVersion,
+		FileID:      file.ID,
+		UserID:      file.UserID,
+		WorkspaceID: file.WorkspaceID,
+		Path:        file.Path,
+	}
+	for _, v := range missing {
+		issue.Versions = append(issue.Versions, v.Version)
+		issue.Size += v.Size
+	}
+	if len(missing) == len(file.Versions) {
+		issue.Kind = IssueDanglingRecord
+	}
+
+	if opts.Action == FsckActionReport {
+		return issue
+	}
+
+	if issue.Kind == IssueDanglingRecord {
+		issue.Action = "delete record"
+		if opts.Action == FsckActionQuarantine {
+			issue.Action = "move record to quarantined_files"
+		}
+		if opts.DryRun {
+			return issue
+		}
+
+		err = s.changeStorage(ctx, file, -issue.Size, models.StorageEventDelete, nil, func(ctx context.Context) error {
+			if opts.Action == FsckActionQuarantine {
+				return s.fileRepo.Quarantine(ctx, file.ID)
+			}
+			return s.fileRepo.Delete(ctx, file.ID)
+		})
+		if err != nil {
+			issue.Error = err.Error()
+			return issue
+		}
+		return issue
+	}
+
+	// Some versions survive: drop the missing ones, promoting the newest survivor if the
+	// current version is among them
+	issue.Action = "remove missing versions"
+	var promote *models.FileVersion
+	if current := file.FindVersion(file.CurrentVersion); current == nil || !blobExists(current.Path) {
+		promote = newestExistingVersion(file)
+		issue.Action = "remove missing versions and restore the newest remaining one"
+	}
+	if opts.DryRun {
+		return issue
+	}
+
+	if promote != nil {
+		if err := s.fileRepo.UpdateCurrentVersion(ctx, file.ID, promote.Version, promote.Path, promote.MimeType, promote.Size); err != nil {
+			issue.Error = err.Error()
+			return issue
+		}
+	}
+	for _, v := range missing {
+		version := v.Version
+		err := s.changeStorage(ctx, file, -v.Size, models.StorageEventDeleteVersion, nil, func(ctx context.Context) error {
+			return s.fileRepo.DeleteVersion(ctx, file.ID, version)
+		})
+		if err != nil {
+			issue.Error = err.Error()
+			return issue
+		}
+	}
+	return issue
+}
+
+// fsckOrphanedChild reattaches a record whose parent folder was deleted to the root. Its data still
+// exists, so it is never deleted or quarantined.
+func (s *FileService) fsckOrphanedChild(ctx context.Context, file *models.File, opts FsckOptions) *FsckIssue {
+	issue := &FsckIssue{
+		Kind:        IssueOrphanedChild,
+		FileID:      file.ID,
+		UserID:      file.UserID,
+		WorkspaceID: file.WorkspaceID,
+	}
+
+	// The parent may have been created after the scan started
+	_, err := s.fileRepo.FindByID(ctx, *file.ParentID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, repository.ErrFileNotFound) {
+		issue.Error = err.Error()
+		return issue
+	}
+
+	if opts.Action == FsckActionReport {
+		return issue
+	}
+	issue.Action = "move to root folder"
+	if opts.DryRun {
+		return issue
+	}
+
+	if err := s.fileRepo.ClearParent(ctx, file.ID); err != nil && !errors.Is(err, repository.ErrFileNotFound) {
+		issue.Error = err.Error()
+	}
+	return issue
+}
+
+// fsckOrphanedBlob deletes or quarantines a blob that no record points to
+func (s *FileService) fsckOrphanedBlob(ctx context.Context, root, path string, size int64, opts FsckOptions) *FsckIssue {
+	issue := &FsckIssue{
+		Kind: IssueOrphanedBlob,
+		Path: path,
+		Size: size,
+	}
+
+	// A record may have been created for it since the records were read
+	owner, err := s.fileRepo.FindByVersionPath(ctx, path)
+	if err != nil {
+		issue.Error = err.Error()
+		return issue
+	}
+	if owner != nil {
+		return nil
+	}
+
+	if opts.Action == FsckActionReport {
+		return issue
+	}
+
+	if opts.Action == FsckActionDelete {
+		issue.Action = "delete blob"
+		if !opts.DryRun {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				issue.Error = err.Error()
+			}
+		}
+		return issue
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		issue.Error = err.Error()
+		return issue
+	}
+	target := filepath.Join(root, quarantineDir, rel)
+	issue.Action = "move blob to " + target
+	if opts.DryRun {
+		return issue
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		issue.Error = err.Error()
+		return issue
+	}
+	if err := os.Rename(path, target); err != nil {
+		issue.Error = err.Error()
+	}
+	return issue
+}
+
+func missingVersions(file *models.File) []models.FileVersion {
+	var missing []models.FileVersion
+	for _, v := range file.Versions {
+		if !blobExists(v.Path) {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+func newestExistingVersion(file *models.File) *models.FileVersion {
+	versions := make([]models.FileVersion, len(file.Versions))
+	copy(versions, file.Versions)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+
+	for i := range versions {
+		if blobExists(versions[i].Path) {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+func blobExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ErrMimeTypeNotAllowed is returned when an upload's detected content type is rejected by the MimePolicy
+var ErrMimeTypeNotAllowed = errors.New("file type not allowed")
+
+// sniffLen is the number of bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// Signatures http.DetectContentType does not know about but that we want to be able to deny
+var extraSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+}
+
+// DetectMimeType sniffs the content type of src from its magic bytes, falling back to
+// the file extension when the content is inconclusive. The reader is rewound afterwards.
+func DetectMimeType(src io.ReadSeeker, filename string) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	buf = buf[:n]
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	if isPortableExecutable(buf) {
+		return "application/x-msdownload", nil
+	}
+	for _, sig := range extraSignatures {
+		if bytes.HasPrefix(buf, sig.magic) {
+			return sig.mimeType, nil
+		}
+	}
+
+	detected := http.DetectContentType(buf)
+
+	// Generic results only tell us "binary" or "text"; the extension is more precise there
+	base := baseMimeType(detected)
+	if base == "application/octet-stream" || base == "text/plain" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExt != "" {
+			// Only trust the extension when it agrees with what the content looks like
+			if (base == "text/plain") == isTextualMimeType(byExt) {
+				return byExt, nil
+			}
+		}
+	}
+
+	return detected, nil
+}
+
+func isTextualMimeType(mimeType string) bool {
+	base := baseMimeType(mimeType)
+	if strings.HasPrefix(base, "text/") || strings.HasSuffix(base, "+xml") || strings.HasSuffix(base, "+json") {
+		return true
+	}
+	switch base {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh", "application/x-yaml":
+		return true
+	}
+	return false
+}
+
+// isPortableExecutable checks for the "MZ" DOS header pointing at a "PE\0\0" signature
+func isPortableExecutable(buf []byte) bool {
+	if len(buf) < 0x40 || !bytes.HasPrefix(buf, []byte("MZ")) {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(buf[0x3c:0x40]))
+	return offset+4 <= len(buf) && bytes.Equal(buf[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// MimePolicy decides which content types may be stored. Entries are exact types
+// ("application/pdf"), type wildcards ("image/*") or "*".
+type MimePolicy struct {
+	allowed []string
+	denied  []string
+}
+
+// NewMimePolicy builds a policy from comma-separated allow and deny lists.
+// An empty allow list permits every type that is not denied.
+func NewMimePolicy(allowed, denied string) *MimePolicy {
+	return &MimePolicy{
+		allowed: splitMimeList(allowed),
+		denied:  splitMimeList(denied),
+	}
+}
+
+// Check returns ErrMimeTypeNotAllowed if mimeType is denied or not in the allow list
+func (p *MimePolicy) Check(mimeType string) error {
+	if p == nil {
+		return nil
+	}
+
+	base := baseMimeType(mimeType)
+	if matchesAny(p.denied, base) {
+		return fmt.Errorf("%w: %s", ErrMimeTypeNotAllowed, base)
+	}
+	if len(p.allowed) > 0 && !matchesAny(p.allowed, base) {
+		return fmt.Errorf("%w: %s", ErrMimeTypeNotAllowed, base)
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func splitMimeList(list string) []string {
+	var result []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// baseMimeType strips parameters such as "; charset=utf-8"
+func baseMimeType(mimeType string) string {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// ownerPlan returns the plan of the user or workspace the scope stores into, and the storage
+// limit uploads are checked against, which includes any grace after a downgrade
+func (s *FileService) ownerPlan(ctx context.Context, scope storageScope) (*models.Plan, int64, error) {
+	var planID string
+	var limit int64
+	var grace *models.QuotaGrace
+	if scope.workspace != nil {
+		planID, limit, grace = scope.workspace.Plan(), scope.workspace.StorageLimit, scope.workspace.QuotaGrace
+	} else {
+		quota, err := s.usageRepo.GetUserQuota(ctx, scope.userID)
+		if err != nil {
+			return nil, 0, err
+		}
+		planID, limit, grace = quota.PlanID, quota.StorageLimit, quota.QuotaGrace
+	}
+
+	plan, err := s.plan(ctx, planID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return plan, models.EffectiveStorageLimit(limit, grace), nil
+}
+
+// plan loads a plan. Built-in plans are also found before the user-service has seeded them.
+func (s *FileService) plan(ctx context.Context, id string) (*models.Plan, error) {
+	plan, err := s.planRepo.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrPlanNotFound) {
+		if builtin := models.BuiltinPlan(id); builtin != nil {
+			return builtin, nil
+		}
+	}
+	return plan, err
+}
+
+// pruneVersions deletes the oldest versions of a file until no more than keep are left. The
+// current version is never deleted. Failures are logged, the upload that added the version
+// has succeeded either way.
+func (s *FileService) pruneVersions(ctx context.Context, file *models.File, keep int) {
+	versions := append([]models.FileVersion{}, file.Versions...)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	excess := len(versions) - keep
+	for _, v := range versions {
+		if excess <= 0 {
+			break
+		}
+		if v.Version == file.CurrentVersion {
+			continue
+		}
+		version := v.Version
+		err := s.changeStorage(ctx, file, -v.Size, models.StorageEventDeleteVersion, nil, func(ctx context.Context) error {
+			return s.fileRepo.DeleteVersion(ctx, file.ID, version)
+		})
+		if err != nil {
+			s.logger.Errorf("Failed to prune version %d of file %s: %v", v.Version, file.ID, err)
+			return
+		}
+		s.removeBlob(v.Path)
+		excess--
+	}
+}
+
+// SetWorkspacePlan moves a workspace to another plan, for admins. When the new storage limit is
+// below what the workspace already stores, the previous limit stays in force for the grace period.
+func (s *FileService) SetWorkspacePlan(ctx context.Context, actorID, workspaceID, planID string) (*models.WorkspaceResponse, error) {
+	workspace, err := s.workspaceRepo.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.plan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.usageRepo.GetUsage(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousLimit := models.EffectiveStorageLimit(workspace.StorageLimit, workspace.QuotaGrace)
+	grace := models.NewQuotaGrace(previousLimit, plan.StorageLimit, used, s.downgradeGracePeriod)
+	if err := s.workspaceRepo.SetPlan(ctx, workspaceID, plan, grace); err != nil {
+		return nil, err
+	}
+	s.recordWorkspaceEvent(ctx, models.AuditAdminSetWorkspacePlan, actorID, workspaceID, "", map[string]string{"from": workspace.Plan(), "to": plan.ID})
+
+	workspace.PlanID, workspace.StorageLimit, workspace.QuotaGrace = plan.ID, plan.StorageLimit, grace
+	return s.workspaceResponse(ctx, actorID, workspace)
+}
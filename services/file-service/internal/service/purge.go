@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// PurgeUser deletes everything a deleted user stored: their personal files with every version,
+// their storage directory and quota counter, and their workspace memberships. Workspaces are
+// shared, so they stay with their other members; a workspace the user owned alone passes to the
+// longest-standing other member, and one without other members is deleted with its files.
+// Running it again after a partial failure finishes the job.
+func (s *FileService) PurgeUser(ctx context.Context, userID string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	if err := s.purgeStorage(ctx, userID, ""); err != nil {
+		return err
+	}
+
+	workspaces, err := s.workspaceRepo.FindByMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, workspace := range workspaces {
+		if err := s.leaveWorkspace(ctx, userID, workspace); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Infof("Purged the files of deleted user %s", userID)
+	return nil
+}
+
+// leaveWorkspace removes a deleted user from a workspace, handing it over first if they are its
+// only owner
+func (s *FileService) leaveWorkspace(ctx context.Context, userID string, workspace *models.Workspace) error {
+	if workspace.MemberRole(userID) == models.WorkspaceRoleOwner && workspace.OwnerCount() == 1 {
+		var successor *models.WorkspaceMember
+		for i, member := range workspace.Members {
+			if member.UserID != userID && (successor == nil || member.AddedAt.Before(successor.AddedAt)) {
+				successor = &workspace.Members[i]
+			}
+		}
+
+		if successor == nil {
+			if err := s.purgeStorage(ctx, userID, workspace.ID); err != nil {
+				return err
+			}
+			if err := s.workspaceRepo.Delete(ctx, workspace.ID); err != nil {
+				return err
+			}
+			s.logger.Infof("Workspace %s deleted with its only member %s", workspace.ID, userID)
+			return nil
+		}
+
+		if err := s.workspaceRepo.SetMemberRole(ctx, workspace.ID, successor.UserID, models.WorkspaceRoleOwner); err != nil {
+			return err
+		}
+		s.logger.Infof("Workspace %s passed to %s after its owner %s was deleted", workspace.ID, successor.UserID, userID)
+	}
+
+	return s.workspaceRepo.RemoveMember(ctx, workspace.ID, userID)
+}
+
+// purgeStorage deletes the files of the user's personal storage or of a workspace, with their
+// blobs, directory and quota counter. No storage events are recorded; the owner is going away.
+func (s *FileService) purgeStorage(ctx context.Context, userID, workspaceID string) error {
+	files, err := s.fileRepo.FindAllByOwner(ctx, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsFolder {
+			continue
+		}
+		s.removeBlob(file.Path)
+		for _, v := range file.Versions {
+			if v.Path != file.Path {
+				s.removeBlob(v.Path)
+			}
+		}
+	}
+	if _, err := s.fileRepo.DeleteByOwner(ctx, userID, workspaceID); err != nil {
+		return err
+	}
+
+	ownerID := userID
+	if workspaceID != "" {
+		ownerID = workspaceID
+	}
+	if err := os.RemoveAll(filepath.Join(s.storagePath, ownerID)); err != nil {
+		return err
+	}
+	return s.usageRepo.Delete(ctx, ownerID)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// QuotaExceededError is returned when storing more bytes would take a user or workspace over its storage limit
+type QuotaExceededError struct {
+	Used      int64
+	Limit     int64
+	Requested int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded: %d of %d bytes used, %d more requested", e.Used, e.Limit, e.Requested)
+}
+
+// reservation is storage charged to a user or workspace for an upload that is not stored yet
+type reservation struct {
+	id      string
+	ownerID string
+	size    int64
+}
+
+// reserveStorage atomically charges size bytes to the usage counter of the user or workspace,
+// as long as it stays within limit. Every successful reservation must be followed by either
+// storing the bytes with changeStorage or cancelReservation.
+func (s *FileService) reserveStorage(ctx context.Context, ownerID string, limit, size int64) (*reservation, error) {
+	res := &reservation{id: uuid.New().String(), ownerID: ownerID, size: size}
+	used, ok, err := s.usageRepo.Reserve(ctx, ownerID, res.id, size, limit)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &QuotaExceededError{Used: used, Limit: limit, Requested: size}
+	}
+	return res, nil
+}
+
+// cancelReservation gives the bytes of an upload that failed back to the usage counter. It does
+// nothing if the upload was stored after all, and runs detached from the request context so that
+// a cancelled request cannot leak a reservation.
+func (s *FileService) cancelReservation(res *reservation) {
+	if res == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.usageRepo.Cancel(ctx, res.ownerID, res.id, res.size); err != nil {
+		s.logger.Errorf("Failed to release %d bytes of storage for %s: %v", res.size, res.ownerID, err)
+	}
+}
+
+// changeStorage runs change, the write to the files collection that adds or removes delta bytes,
+// in one transaction with the matching update of the usage counter and, for personal files, the
+// outbox event the user-service applies to User.StorageUsed. Bytes added must have been reserved
+// by res, which is committed; bytes removed are given back to the counter.
+func (s *FileService) changeStorage(ctx context.Context, file *models.File, delta int64, reason string, res *reservation, change func(ctx context.Context) error) error {
+	if delta == 0 && res == nil {
+		return change(ctx)
+	}
+	return s.transactor.Run(ctx, func(ctx context.Context) error {
+		if err := change(ctx); err != nil {
+			return err
+		}
+
+		var err error
+		if res != nil {
+			err = s.usageRepo.Commit(ctx, res.ownerID, res.id)
+		} else {
+			err = s.usageRepo.Release(ctx, file.StorageOwnerID(), -delta)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Workspace files are only counted by the workspace's counter and need no event
+		if file.WorkspaceID != "" {
+			return nil
+		}
+		return s.eventRepo.Create(ctx, models.NewStorageEvent(file.UserID, file.ID, delta, reason))
+	})
+}
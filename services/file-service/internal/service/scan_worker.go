@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/scanner"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const (
+	// scanBatchSize is the number of quarantined files picked up per pass
+	scanBatchSize = 50
+	// A version whose scan keeps erroring is retried with a doubling delay, and marked failed
+	// after maxScanAttempts, so it can not hold back newer uploads forever
+	maxScanAttempts    = 5
+	scanRetryBaseDelay = time.Minute
+	scanRetryMaxDelay  = time.Hour
+)
+
+// ScanWorker moves quarantined file versions to clean or infected by running them through a Scanner.
+// Pending versions are stored in the database, so scans interrupted by a restart are picked up again.
+type ScanWorker struct {
+	fileRepo repository.FileRepository
+	scanner  scanner.Scanner
+	logger   *utils.Logger
+	interval time.Duration
+	wake     chan struct{}
+}
+
+func NewScanWorker(fileRepo repository.FileRepository, s scanner.Scanner, logger *utils.Logger, interval time.Duration) *ScanWorker {
+	return &ScanWorker{
+		fileRepo: fileRepo,
+		scanner:  s,
+		logger:   logger,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Notify asks the worker to process pending versions without waiting for the next tick
+func (w *ScanWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes pending versions until ctx is cancelled
+func (w *ScanWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.scanPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+func (w *ScanWorker) scanPending(ctx context.Context) {
+	now := time.Now()
+	files, err := w.fileRepo.FindPendingScans(ctx, now, scanBatchSize)
+	if err != nil {
+		w.logger.Errorf("Failed to load pending scans: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		for _, v := range file.Versions {
+			if v.ScanStatus != models.ScanStatusPending || (v.NextScanAt != nil && v.NextScanAt.After(now)) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			w.scanVersion(ctx, file.ID, v)
+		}
+	}
+}
+
+func (w *ScanWorker) scanVersion(ctx context.Context, fileID string, v models.FileVersion) {
+	f, err := os.Open(v.Path)
+	if err != nil {
+		w.logger.Errorf("Failed to open %s v%d for scanning: %v", fileID, v.Version, err)
+		w.record(ctx, fileID, v.Version, models.ScanStatusFailed, err.Error())
+		return
+	}
+	defer f.Close()
+
+	result, err := w.scanner.Scan(ctx, f)
+	switch {
+	case errors.Is(err, scanner.ErrScanRejected):
+		// The scanner refused this content; retrying would give the same answer
+		w.logger.Warnf("Scan of %s v%d rejected: %v", fileID, v.Version, err)
+		w.record(ctx, fileID, v.Version, models.ScanStatusFailed, err.Error())
+	case err != nil:
+		w.retryLater(ctx, fileID, v, err)
+	case result.Infected:
+		w.logger.Warnf("Malware detected in %s v%d: %s", fileID, v.Version, result.Signature)
+		w.record(ctx, fileID, v.Version, models.ScanStatusInfected, result.Signature)
+	default:
+		w.record(ctx, fileID, v.Version, models.ScanStatusClean, "")
+	}
+}
+
+// retryLater leaves the version pending and backs off its next attempt, or marks it failed once
+// it has used up its attempts
+func (w *ScanWorker) retryLater(ctx context.Context, fileID string, v models.FileVersion, scanErr error) {
+	attempts := v.ScanAttempts + 1
+	if attempts >= maxScanAttempts {
+		w.logger.Errorf("Failed to scan %s v%d after %d attempts: %v", fileID, v.Version, attempts, scanErr)
+		w.record(ctx, fileID, v.Version, models.ScanStatusFailed, scanErr.Error())
+		return
+	}
+
+	delay := scanRetryBaseDelay
+	for i := 1; i < attempts && delay < scanRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > scanRetryMaxDelay {
+		delay = scanRetryMaxDelay
+	}
+	w.logger.Errorf("Failed to scan %s v%d, retrying in %s: %v", fileID, v.Version, delay, scanErr)
+	if err := w.fileRepo.DeferVersionScan(ctx, fileID, v.Version, scanErr.Error(), time.Now().Add(delay)); err != nil {
+		w.logger.Errorf("Failed to record scan attempt for %s v%d: %v", fileID, v.Version, err)
+	}
+}
+
+func (w *ScanWorker) record(ctx context.Context, fileID string, version int, status, result string) {
+	if err := w.fileRepo.UpdateVersionScan(ctx, fileID, version, status, result, time.Now()); err != nil {
+		w.logger.Errorf("Failed to record scan result for %s v%d: %v", fileID, version, err)
+	}
+}
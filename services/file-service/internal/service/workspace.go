@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/file-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+var (
+	// ErrWorkspacePermission is returned when the member's role does not allow the action
+	ErrWorkspacePermission = errors.New("your workspace role does not allow this")
+	// ErrWorkspaceNotEmpty is returned when deleting a workspace that still has files
+	ErrWorkspaceNotEmpty = errors.New("workspace still contains files")
+)
+
+// storageScope is where a request stores and lists files: the user's personal storage or a
+// workspace the user is a member of
+type storageScope struct {
+	userID    string
+	workspace *models.Workspace // nil for personal storage
+}
+
+func (sc storageScope) workspaceID() string {
+	if sc.workspace == nil {
+		return ""
+	}
+	return sc.workspace.ID
+}
+
+// ownerID identifies the quota counter and storage directory of the scope
+func (sc storageScope) ownerID() string {
+	if sc.workspace == nil {
+		return sc.userID
+	}
+	return sc.workspace.ID
+}
+
+// resolveScope selects the user's personal storage, or with a workspaceID a workspace where the
+// user has at least the required role
+func (s *FileService) resolveScope(ctx context.Context, userID, workspaceID, required string) (storageScope, error) {
+	if workspaceID == "" {
+		return storageScope{userID: userID}, nil
+	}
+	workspace, err := s.memberWorkspace(ctx, userID, workspaceID, required)
+	if err != nil {
+		return storageScope{}, err
+	}
+	return storageScope{userID: userID, workspace: workspace}, nil
+}
+
+// memberWorkspace loads a workspace for a member with at least the required role. Membership is
+// read on every request, so removing a member or changing a role applies at once. Workspaces the
+// user is not a member of are reported as missing.
+func (s *FileService) memberWorkspace(ctx context.Context, userID, workspaceID, required string) (*models.Workspace, error) {
+	workspace, err := s.workspaceRepo.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	role := workspace.MemberRole(userID)
+	if role == "" {
+		return nil, repository.ErrWorkspaceNotFound
+	}
+	if !models.WorkspaceRoleAllows(role, required) {
+		return nil, ErrWorkspacePermission
+	}
+	return workspace, nil
+}
+
+// authorizeFile checks that the user may act on the file. Personal files are only accessible to
+// their owner, workspace files to members with at least the required role.
+func (s *FileService) authorizeFile(ctx context.Context, userID string, file *models.File, required string) error {
+	if file.WorkspaceID == "" {
+		if file.UserID != userID {
+			return ErrUnauthorizedFile
+		}
+		return nil
+	}
+
+	_, err := s.memberWorkspace(ctx, userID, file.WorkspaceID, required)
+	if errors.Is(err, repository.ErrWorkspaceNotFound) {
+		return ErrUnauthorizedFile
+	}
+	return err
+}
+
+// checkParent makes sure a parent folder exists in the same storage as what is created in it
+func (s *FileService) checkParent(ctx context.Context, scope storageScope, parentID *string) error {
+	if parentID == nil {
+		return nil
+	}
+	parent, err := s.fileRepo.FindByID(ctx, *parentID)
+	if errors.Is(err, repository.ErrFileNotFound) {
+		return ErrParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !parent.IsFolder || parent.WorkspaceID != scope.workspaceID() {
+		return ErrParentNotFound
+	}
+	if parent.WorkspaceID == "" && parent.UserID != scope.userID {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+/* Workspace management */
+
+// CreateWorkspace creates a workspace on the default workspace plan with the user as its owner
+func (s *FileService) CreateWorkspace(ctx context.Context, userID string, req *models.WorkspaceCreateRequest) (*models.WorkspaceResponse, error) {
+	plan, err := s.plan(ctx, models.DefaultWorkspacePlanID)
+	if err != nil {
+		return nil, err
+	}
+	workspace := models.NewWorkspace(strings.TrimSpace(req.Name), userID, plan)
+	if err := s.workspaceRepo.Create(ctx, workspace); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Workspace %s created by user %s", workspace.ID, userID)
+	response := workspace.ToResponse(userID, 0)
+	return &response, nil
+}
+
+// ListWorkspaces returns the workspaces the user is a member of
+func (s *FileService) ListWorkspaces(ctx context.Context, userID string) ([]models.WorkspaceResponse, error) {
+	workspaces, err := s.workspaceRepo.FindByMember(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.WorkspaceResponse, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		response, err := s.workspaceResponse(ctx, userID, workspace)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, *response)
+	}
+	return responses, nil
+}
+
+func (s *FileService) GetWorkspace(ctx context.Context, userID, workspaceID string) (*models.WorkspaceResponse, error) {
+	workspace, err := s.memberWorkspace(ctx, userID, workspaceID, models.WorkspaceRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	return s.workspaceResponse(ctx, userID, workspace)
+}
+
+func (s *FileService) RenameWorkspace(ctx context.Context, userID, workspaceID string, req *models.WorkspaceUpdateRequest) (*models.WorkspaceResponse, error) {
+	if _, err := s.memberWorkspace(ctx, userID, workspaceID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+	if err := s.workspaceRepo.Rename(ctx, workspaceID, strings.TrimSpace(req.Name)); err != nil {
+		return nil, err
+	}
+	return s.GetWorkspace(ctx, userID, workspaceID)
+}
+
+// DeleteWorkspace deletes an empty workspace. Files have to be deleted first, so that nothing
+// is lost by accident.
+func (s *FileService) DeleteWorkspace(ctx context.Context, userID, workspaceID string) error {
+	if _, err := s.memberWorkspace(ctx, userID, workspaceID, models.WorkspaceRoleOwner); err != nil {
+		return err
+	}
+	count, err := s.fileRepo.CountByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrWorkspaceNotEmpty
+	}
+	if err := s.workspaceRepo.Delete(ctx, workspaceID); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Workspace %s deleted by user %s", workspaceID, userID)
+	return nil
+}
+
+// AddWorkspaceMember adds a registered user to the workspace, for owners
+func (s *FileService) AddWorkspaceMember(ctx context.Context, userID, workspaceID string, req *models.WorkspaceMemberAddRequest) (*models.WorkspaceResponse, error) {
+	if _, err := s.memberWorkspace(ctx, userID, workspaceID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+	memberID, err := s.workspaceRepo.FindUserIDByEmail(ctx, strings.TrimSpace(req.Email))
+	if err != nil {
+		return nil, err
+	}
+
+	member := models.WorkspaceMember{UserID: memberID, Role: req.Role, AddedAt: time.Now()}
+	if err := s.workspaceRepo.AddMember(ctx, workspaceID, member); err != nil {
+		return nil, err
+	}
+
+	s.recordWorkspaceEvent(ctx, models.AuditWorkspaceMemberAdd, userID, workspaceID, memberID, map[string]string{"role": req.Role})
+	return s.GetWorkspace(ctx, userID, workspaceID)
+}
+
+// SetWorkspaceMemberRole changes a member's role, for owners. The last owner can not be demoted.
+func (s *FileService) SetWorkspaceMemberRole(ctx context.Context, userID, workspaceID, memberID string, req *models.WorkspaceMemberRoleRequest) (*models.WorkspaceResponse, error) {
+	if _, err := s.memberWorkspace(ctx, userID, workspaceID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+	if err := s.workspaceRepo.SetMemberRole(ctx, workspaceID, memberID, req.Role); err != nil {
+		return nil, err
+	}
+
+	s.recordWorkspaceEvent(ctx, models.AuditWorkspaceMemberRole, userID, workspaceID, memberID, map[string]string{"role": req.Role})
+	return s.GetWorkspace(ctx, userID, workspaceID)
+}
+
+// RemoveWorkspaceMember removes a member, for owners. Any member can remove themselves to leave
+// the workspace, except its last owner.
+func (s *FileService) RemoveWorkspaceMember(ctx context.Context, userID, workspaceID, memberID string) error {
+	required := models.WorkspaceRoleOwner
+	if memberID == userID {
+		required = models.WorkspaceRoleViewer
+	}
+	if _, err := s.memberWorkspace(ctx, userID, workspaceID, required); err != nil {
+		return err
+	}
+	if err := s.workspaceRepo.RemoveMember(ctx, workspaceID, memberID); err != nil {
+		return err
+	}
+
+	s.recordWorkspaceEvent(ctx, models.AuditWorkspaceMemberRemove, userID, workspaceID, memberID, nil)
+	return nil
+}
+
+// SetWorkspaceStorageLimit changes a workspace's pooled quota, for admins
+func (s *FileService) SetWorkspaceStorageLimit(ctx context.Context, actorID, workspaceID string, limit int64) (*models.WorkspaceResponse, error) {
+	workspace, err := s.workspaceRepo.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.workspaceRepo.SetStorageLimit(ctx, workspaceID, limit); err != nil {
+		return nil, err
+	}
+	s.recordWorkspaceEvent(ctx, models.AuditAdminSetWorkspaceStorageLimit, actorID, workspaceID, "", map[string]string{
+		"from": strconv.FormatInt(workspace.StorageLimit, 10),
+		"to":   strconv.FormatInt(limit, 10),
+	})
+
+	workspace.StorageLimit = limit
+	return s.workspaceResponse(ctx, actorID, workspace)
+}
+
+func (s *FileService) workspaceResponse(ctx context.Context, userID string, workspace *models.Workspace) (*models.WorkspaceResponse, error) {
+	used, err := s.usageRepo.GetUsage(ctx, workspace.ID)
+	if err != nil {
+		return nil, err
+	}
+	response := workspace.ToResponse(userID, used)
+	return &response, nil
+}
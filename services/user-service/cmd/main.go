@@ -2,15 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/handler"
 	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
 	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/accesstoken"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
 	"github.com/joaquinidiarte/cloudbox/shared/config"
+	"github.com/joaquinidiarte/cloudbox/shared/jwks"
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
 	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/redisclient"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
 	"github.com/joaquinidiarte/cloudbox/shared/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -38,18 +49,96 @@ func main() {
 
 	db := client.Database(cfg.MongoDatabase)
 
+	redisClient, err := redisclient.New(cfg, logger)
+	if err != nil {
+		log.Fatal("Failed to connect to Redis:", err)
+	}
+
 	// Initialize JWT manager
 	tokenDuration, _ := time.ParseDuration(cfg.JWTExpiration)
-	jwtManager := utils.NewJWTManager(cfg.JWTSecret, tokenDuration)
+	jwtManager, err := jwks.NewJWTManager(cfg, tokenDuration, logger)
+	if err != nil {
+		log.Fatal("Refusing to verify tokens with the shared secret:", err)
+	}
+	revocations := revocation.NewStore(redisClient, tokenDuration)
+	accessTokens := accesstoken.NewMongoVerifier(db)
 
 	// Initialize layers
+	verificationTokenTTL, err := time.ParseDuration(cfg.EmailVerificationExpiration)
+	if err != nil {
+		verificationTokenTTL = 24 * time.Hour
+	}
 	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepo)
+	verificationRepo := repository.NewEmailVerificationRepository(db)
+	mail := mailer.New(cfg, logger)
+	auditLog := audit.NewRecorder(db, "user-service", logger)
+	userService := service.NewUserService(userRepo, verificationRepo, mail, logger, verificationTokenTTL, cfg.FrontendURL)
 	userHandler := handler.NewUserHandler(userService, logger)
 
+	deletionGracePeriod, err := time.ParseDuration(cfg.AccountDeletionGracePeriod)
+	if err != nil {
+		deletionGracePeriod = 7 * 24 * time.Hour
+	}
+	deletionService := service.NewAccountDeletionService(userRepo, revocations, mail, logger, auditLog, deletionGracePeriod, cfg.FrontendURL)
+	accountHandler := handler.NewAccountHandler(deletionService, logger)
+
+	usageRepo := repository.NewStorageUsageRepository(db)
+	reconciliationService := service.NewReconciliationService(userRepo, usageRepo, logger)
+	adminService := service.NewAdminService(userRepo, revocations, logger, auditLog)
+	adminHandler := handler.NewAdminHandler(adminService, reconciliationService, logger)
+
+	gracePeriod, err := time.ParseDuration(cfg.PlanDowngradeGracePeriod)
+	if err != nil {
+		gracePeriod = 14 * 24 * time.Hour
+	}
+	planService := service.NewPlanService(repository.NewPlanRepository(db), userRepo, logger, auditLog, gracePeriod)
+	planHandler := handler.NewPlanHandler(planService, logger)
+
+	auditService := service.NewAuditService(repository.NewAuditRepository(db), auditLog, logger)
+	auditHandler := handler.NewAuditHandler(auditService, logger)
+
+	// "user-service reconcile [-dry-run]" runs a single reconciliation and prints the drift report
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcileCommand(reconciliationService, os.Args[2:])
+		return
+	}
+
+	// "user-service grant-admin <email>" makes a user an admin, to set up the first one
+	if len(os.Args) > 1 && os.Args[1] == "grant-admin" {
+		runGrantAdminCommand(adminService, os.Args[2:])
+		return
+	}
+
+	if err := planService.SeedBuiltinPlans(ctx); err != nil {
+		logger.Errorf("Failed to seed the built-in plans: %v", err)
+	}
+
+	// Apply storage usage changes recorded by the file-service
+	pollInterval, err := time.ParseDuration(cfg.StorageEventPollInterval)
+	if err != nil {
+		pollInterval = 5 * time.Second
+	}
+	eventRepo := repository.NewStorageEventRepository(db)
+	eventConsumer := service.NewStorageEventConsumer(userRepo, eventRepo, logger, pollInterval)
+	go eventConsumer.Run(context.Background())
+
+	if reconcileInterval, err := time.ParseDuration(cfg.ReconcileInterval); err == nil && reconcileInterval > 0 {
+		go reconciliationService.RunScheduled(context.Background(), reconcileInterval)
+	}
+
+	// Delete the accounts whose deletion grace period is over
+	purgeInterval, err := time.ParseDuration(cfg.AccountPurgeInterval)
+	if err != nil {
+		purgeInterval = 5 * time.Minute
+	}
+	go deletionService.RunScheduled(context.Background(), purgeInterval)
+
 	// Setup Gin router
 	router := gin.Default()
-	router.Use(middleware.CORS())
+	if err := middleware.TrustProxies(router, cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	router.Use(middleware.CORS(), middleware.AuditContext())
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -58,12 +147,71 @@ func main() {
 
 	// User routes (protected)
 	v1 := router.Group("/api/v1/users")
-	v1.Use(middleware.AuthMiddleware(jwtManager))
+	v1.Use(middleware.AuthMiddleware(jwtManager, revocations, accessTokens))
+	{
+		v1.GET("/me", middleware.RequireScope(models.ScopeUserRead), userHandler.GetCurrentUser)
+		v1.GET("/me/plan", middleware.RequireScope(models.ScopeUserRead), planHandler.GetCurrentPlan)
+		v1.PUT("/me", middleware.RequireScope(models.ScopeUserWrite), userHandler.UpdateCurrentUser)
+		v1.GET("/:id", middleware.RequireScope(models.ScopeUserRead), userHandler.GetUserByID)
+	}
+
+	// Account management for the signed-in user only; access tokens are not accepted
+	account := router.Group("/api/v1/users/me")
+	account.Use(middleware.AuthMiddleware(jwtManager, revocations, nil), middleware.RequireSession())
 	{
-		v1.GET("/me", userHandler.GetCurrentUser)
-		v1.PUT("/me", userHandler.UpdateCurrentUser)
-		v1.POST("/storage", userHandler.UpdateStorageUsed)
-		v1.GET("/:id", userHandler.GetUserByID)
+		account.POST("/deletion", accountHandler.RequestDeletion)
+		account.DELETE("/deletion", accountHandler.CancelDeletion)
+		account.GET("/audit", auditHandler.ListMyEvents)
+		account.GET("/audit/export", auditHandler.ExportMyEvents)
+	}
+
+	// Operational routes for automation, guarded by the shared admin token
+	ops := router.Group("/api/v1/admin")
+	ops.Use(middleware.AdminTokenMiddleware(cfg.AdminToken))
+	{
+		ops.POST("/storage/reconcile", adminHandler.ReconcileStorage)
+	}
+
+	// User administration for signed-in admins
+	admin := router.Group("/api/v1/admin/users")
+	admin.Use(
+		middleware.AuthMiddleware(jwtManager, revocations, nil),
+		middleware.RequireSession(),
+		middleware.RequireRole(models.RoleAdmin),
+	)
+	{
+		admin.GET("", adminHandler.ListUsers)
+		admin.GET("/:id", adminHandler.GetUser)
+		admin.POST("/:id/activate", adminHandler.ActivateUser)
+		admin.POST("/:id/deactivate", adminHandler.DeactivateUser)
+		admin.PUT("/:id/storage-limit", adminHandler.SetStorageLimit)
+		admin.PUT("/:id/roles", adminHandler.SetRoles)
+		admin.PUT("/:id/plan", planHandler.SetUserPlan)
+	}
+
+	// Storage plans for signed-in admins
+	plans := router.Group("/api/v1/admin/plans")
+	plans.Use(
+		middleware.AuthMiddleware(jwtManager, revocations, nil),
+		middleware.RequireSession(),
+		middleware.RequireRole(models.RoleAdmin),
+	)
+	{
+		plans.GET("", planHandler.ListPlans)
+		plans.POST("", planHandler.CreatePlan)
+		plans.PUT("/:id", planHandler.UpdatePlan)
+	}
+
+	// Audit log of every user for signed-in admins
+	auditLogs := router.Group("/api/v1/admin/audit")
+	auditLogs.Use(
+		middleware.AuthMiddleware(jwtManager, revocations, nil),
+		middleware.RequireSession(),
+		middleware.RequireRole(models.RoleAdmin),
+	)
+	{
+		auditLogs.GET("", auditHandler.ListEvents)
+		auditLogs.GET("/export", auditHandler.ExportEvents)
 	}
 
 	// Start server
@@ -76,3 +224,32 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+func runReconcileCommand(reconciliationService *service.ReconciliationService, args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report drift without correcting it")
+	flags.Parse(args)
+
+	report, err := reconciliationService.Reconcile(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatal("Storage reconciliation failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal("Failed to write report:", err)
+	}
+}
+
+func runGrantAdminCommand(adminService *service.AdminService, args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: user-service grant-admin <email>")
+	}
+
+	user, err := adminService.GrantAdmin(context.Background(), args[0])
+	if err != nil {
+		log.Fatal("Failed to grant the admin role:", err)
+	}
+	fmt.Printf("%s (%s) is an admin\n", user.Email, user.ID)
+}
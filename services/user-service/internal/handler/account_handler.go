@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+type AccountHandler struct {
+	deletionService *service.AccountDeletionService
+	logger          *utils.Logger
+}
+
+func NewAccountHandler(deletionService *service.AccountDeletionService, logger *utils.Logger) *AccountHandler {
+	return &AccountHandler{
+		deletionService: deletionService,
+		logger:          logger,
+	}
+}
+
+// RequestDeletion schedules the signed-in user's account for deletion
+func (h *AccountHandler) RequestDeletion(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	user, err := h.deletionService.RequestDeletion(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.SuccessResponse(user, "Account scheduled for deletion"))
+}
+
+func (h *AccountHandler) CancelDeletion(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	user, err := h.deletionService.CancelDeletion(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(user, "Account deletion cancelled"))
+}
+
+func (h *AccountHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, service.ErrNoPendingDeletion):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, service.ErrDeletionPending):
+		c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Account deletion request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Account deletion request failed"))
+	}
+}
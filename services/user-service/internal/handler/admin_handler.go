@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+type AdminHandler struct {
+	adminService          *service.AdminService
+	reconciliationService *service.ReconciliationService
+	logger                *utils.Logger
+}
+
+func NewAdminHandler(adminService *service.AdminService, reconciliationService *service.ReconciliationService, logger *utils.Logger) *AdminHandler {
+	return &AdminHandler{
+		adminService:          adminService,
+		reconciliationService: reconciliationService,
+		logger:                logger,
+	}
+}
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var query models.UserSearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	users, total, err := h.adminService.ListUsers(c.Request.Context(), actorID, query)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	page, limit := query.Page, query.Limit
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = len(users)
+	}
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Success: true,
+		Data:    users,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	})
+}
+
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	user, err := h.adminService.GetUser(c.Request.Context(), actorID, c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(user, "User retrieved successfully"))
+}
+
+func (h *AdminHandler) ActivateUser(c *gin.Context) {
+	h.setActive(c, true, "User activated")
+}
+
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	h.setActive(c, false, "User deactivated")
+}
+
+func (h *AdminHandler) setActive(c *gin.Context, active bool, message string) {
+	actorID, _ := middleware.GetUserID(c)
+
+	user, err := h.adminService.SetActive(c.Request.Context(), actorID, c.Param("id"), active)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(user, message))
+}
+
+func (h *AdminHandler) SetStorageLimit(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var req models.StorageLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	user, err := h.adminService.SetStorageLimit(c.Request.Context(), actorID, c.Param("id"), *req.StorageLimit)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(user, "Storage limit updated"))
+}
+
+func (h *AdminHandler) SetRoles(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var req models.UserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	user, err := h.adminService.SetRoles(c.Request.Context(), actorID, c.Param("id"), req.Roles)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(user, "Roles updated"))
+}
+
+func (h *AdminHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, service.ErrUnknownRole), errors.Is(err, service.ErrSelfModification):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Admin request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Admin request failed"))
+	}
+}
+
+func (h *AdminHandler) ReconcileStorage(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := h.reconciliationService.Reconcile(c.Request.Context(), dryRun)
+	if err != nil {
+		h.logger.Errorf("Storage reconciliation failed: %v", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrReconciliationRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(report, "Storage reconciliation completed"))
+}
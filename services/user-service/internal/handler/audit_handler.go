@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+type AuditHandler struct {
+	auditService *service.AuditService
+	logger       *utils.Logger
+}
+
+func NewAuditHandler(auditService *service.AuditService, logger *utils.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// ListMyEvents returns the signed-in user's audit log
+func (h *AuditHandler) ListMyEvents(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var query models.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	events, total, err := h.auditService.ListUserEvents(c.Request.Context(), userID, query)
+	h.respondPage(c, query, events, total, err)
+}
+
+// ExportMyEvents downloads the signed-in user's audit log as JSON Lines
+func (h *AuditHandler) ExportMyEvents(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	var query models.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	h.export(c, func(ctx context.Context, w io.Writer) error {
+		return h.auditService.ExportUserEvents(ctx, userID, query, w)
+	})
+}
+
+// ListEvents returns the audit log of every user, for admins
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var query models.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	events, total, err := h.auditService.ListEvents(c.Request.Context(), actorID, query)
+	h.respondPage(c, query, events, total, err)
+}
+
+// ExportEvents downloads the audit log of every user as JSON Lines, for admins
+func (h *AuditHandler) ExportEvents(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var query models.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	h.export(c, func(ctx context.Context, w io.Writer) error {
+		return h.auditService.ExportEvents(ctx, actorID, query, w)
+	})
+}
+
+func (h *AuditHandler) respondPage(c *gin.Context, query models.AuditQuery, events []*models.AuditEvent, total int64, err error) {
+	if err != nil {
+		h.logger.Errorf("Audit log request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Audit log request failed"))
+		return
+	}
+
+	page, limit := query.Page, query.Limit
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = len(events)
+	}
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Success: true,
+		Data:    events,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	})
+}
+
+// export streams the events as they are read. Once the first line is out the status can not
+// change any more, so a failure halfway is only logged and leaves the download cut short.
+func (h *AuditHandler) export(c *gin.Context, write func(ctx context.Context, w io.Writer) error) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="cloudbox-audit-%s.jsonl"`, time.Now().Format("2006-01-02")))
+	c.Status(http.StatusOK)
+
+	if err := write(c.Request.Context(), c.Writer); err != nil {
+		h.logger.Errorf("Audit log export failed: %v", err)
+	}
+}
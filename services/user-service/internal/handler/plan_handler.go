@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/service"
+	"github.com/joaquinidiarte/cloudbox/shared/middleware"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+type PlanHandler struct {
+	planService *service.PlanService
+	logger      *utils.Logger
+}
+
+func NewPlanHandler(planService *service.PlanService, logger *utils.Logger) *PlanHandler {
+	return &PlanHandler{
+		planService: planService,
+		logger:      logger,
+	}
+}
+
+// GetCurrentPlan returns the plan of the signed-in user, so clients know the limits that apply
+func (h *PlanHandler) GetCurrentPlan(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
+		return
+	}
+
+	plan, err := h.planService.GetUserPlan(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(plan, ""))
+}
+
+func (h *PlanHandler) ListPlans(c *gin.Context) {
+	plans, err := h.planService.ListPlans(c.Request.Context())
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(plans, ""))
+}
+
+func (h *PlanHandler) CreatePlan(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var req models.PlanCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	plan, err := h.planService.CreatePlan(c.Request.Context(), actorID, &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.SuccessResponse(plan, "Plan created"))
+}
+
+func (h *PlanHandler) UpdatePlan(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var req models.PlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	plan, err := h.planService.UpdatePlan(c.Request.Context(), actorID, c.Param("id"), &req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(plan, "Plan updated"))
+}
+
+func (h *PlanHandler) SetUserPlan(c *gin.Context) {
+	actorID, _ := middleware.GetUserID(c)
+
+	var req models.PlanAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
+		return
+	}
+
+	user, err := h.planService.AssignUserPlan(c.Request.Context(), actorID, c.Param("id"), req.PlanID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(user, "Plan updated"))
+}
+
+func (h *PlanHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrPlanNotFound), errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(err.Error()))
+	case errors.Is(err, repository.ErrPlanExists):
+		c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+	default:
+		h.logger.Errorf("Plan request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Plan request failed"))
+	}
+}
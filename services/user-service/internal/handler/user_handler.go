@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
 	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/service"
 	"github.com/joaquinidiarte/cloudbox/shared/middleware"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
@@ -39,9 +41,17 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(user, "User retrieved successfully"))
 }
 
+// GetUserByID returns the caller's own account. Admins can look up any user; for anyone else
+// other accounts are reported as missing, so user IDs can not be probed.
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	id := c.Param("id")
 
+	claims, _ := middleware.GetClaims(c)
+	if claims == nil || (claims.UserID != id && !claims.HasRole(models.RoleAdmin)) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(repository.ErrUserNotFound.Error()))
+		return
+	}
+
 	user, err := h.userService.GetUserByID(c.Request.Context(), id)
 	if err != nil {
 		h.logger.Errorf("Failed to get user: %v", err)
@@ -67,6 +77,10 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 
 	user, err := h.userService.UpdateUser(c.Request.Context(), userID, &req)
 	if err != nil {
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, models.ErrorResponse(err.Error()))
+			return
+		}
 		h.logger.Errorf("Failed to update user: %v", err)
 		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
 		return
@@ -75,27 +89,3 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 	h.logger.Infof("User updated successfully: %s", userID)
 	c.JSON(http.StatusOK, models.SuccessResponse(user, "User updated successfully"))
 }
-
-func (h *UserHandler) UpdateStorageUsed(c *gin.Context) {
-	userID, exists := middleware.GetUserID(c)
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Unauthorized"))
-		return
-	}
-
-	var req struct {
-		Increment int64 `json:"increment" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid request: "+err.Error()))
-		return
-	}
-
-	if err := h.userService.UpdateStorageUsed(c.Request.Context(), userID, req.Increment); err != nil {
-		h.logger.Errorf("Failed to update storage: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to update storage"))
-		return
-	}
-
-	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Storage updated successfully"))
-}
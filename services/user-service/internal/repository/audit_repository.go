@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository reads the audit log every service writes to (see shared/audit). It has no
+// methods to change events: the log is append-only.
+type AuditRepository interface {
+	Find(ctx context.Context, userID string, query models.AuditQuery, skip, limit int) ([]*models.AuditEvent, int64, error)
+	ForEach(ctx context.Context, userID string, query models.AuditQuery, fn func(*models.AuditEvent) error) error
+}
+
+// MongoDBAuditRepository is the MongoDB implementation of AuditRepository
+type MongoDBAuditRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAuditRepository creates a new MongoDB audit repository
+func NewAuditRepository(db *mongo.Database) AuditRepository {
+	return &MongoDBAuditRepository{
+		collection: db.Collection(audit.Collection),
+	}
+}
+
+// Find returns a page of the events matching the query, newest first, and the number of
+// matches. A non-empty userID limits the events to those the user did or that concern the user.
+func (r *MongoDBAuditRepository) Find(ctx context.Context, userID string, query models.AuditQuery, skip, limit int) ([]*models.AuditEvent, int64, error) {
+	filter := auditFilter(userID, query)
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// ForEach calls fn with every event matching the query, oldest first, without loading them all
+// into memory. It stops at the first error fn returns.
+func (r *MongoDBAuditRepository) ForEach(ctx context.Context, userID string, query models.AuditQuery, fn func(*models.AuditEvent) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, auditFilter(userID, query), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event models.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func auditFilter(userID string, query models.AuditQuery) bson.M {
+	filter := bson.M{}
+	if userID != "" {
+		filter["$or"] = bson.A{bson.M{"actor_id": userID}, bson.M{"subject_id": userID}}
+	}
+	for field, value := range map[string]string{
+		"action":     query.Action,
+		"outcome":    query.Outcome,
+		"service":    query.Service,
+		"actor_id":   query.ActorID,
+		"subject_id": query.SubjectID,
+		"target_id":  query.TargetID,
+	} {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+
+	period := bson.M{}
+	if query.From != nil {
+		period["$gte"] = *query.From
+	}
+	if query.To != nil {
+		period["$lt"] = *query.To
+	}
+	if len(period) > 0 {
+		filter["time"] = period
+	}
+	return filter
+}
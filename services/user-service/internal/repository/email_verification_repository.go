@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EmailVerificationRepository issues the verification tokens for email changes. The tokens are
+// redeemed by the auth-service.
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, token *models.EmailVerificationToken) error
+	InvalidateForUser(ctx context.Context, userID string) error
+}
+
+// MongoDBEmailVerificationRepository is the MongoDB implementation of EmailVerificationRepository
+type MongoDBEmailVerificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewEmailVerificationRepository creates a new MongoDB email verification token repository
+func NewEmailVerificationRepository(db *mongo.Database) EmailVerificationRepository {
+	return &MongoDBEmailVerificationRepository{
+		collection: db.Collection("email_verification_tokens"),
+	}
+}
+
+func (r *MongoDBEmailVerificationRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// InvalidateForUser marks every outstanding token of the user as used
+func (r *MongoDBEmailVerificationRepository) InvalidateForUser(ctx context.Context, userID string) error {
+	_, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	return err
+}
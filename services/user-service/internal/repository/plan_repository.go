@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrPlanNotFound is returned when no plan has the ID
+	ErrPlanNotFound = errors.New("plan not found")
+	// ErrPlanExists is returned when creating a plan with an ID already in use
+	ErrPlanExists = errors.New("a plan with this ID already exists")
+	// ErrWorkspaceNotFound is returned when assigning a plan to a workspace that is gone
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+)
+
+// PlanHolder is a user or workspace assigned to a plan, with the bytes it stores
+type PlanHolder struct {
+	ID           string             `bson:"_id"`
+	Workspace    bool               `bson:"-"`
+	StorageLimit int64              `bson:"storage_limit"`
+	StorageUsed  int64              `bson:"storage_used"`
+	QuotaGrace   *models.QuotaGrace `bson:"quota_grace"`
+}
+
+// PlanRepository stores the storage plans and assigns them to users and workspaces. The
+// file-service reads plans to enforce them.
+type PlanRepository interface {
+	SeedBuiltin(ctx context.Context) error
+	FindAll(ctx context.Context) ([]*models.Plan, error)
+	FindByID(ctx context.Context, id string) (*models.Plan, error)
+	Create(ctx context.Context, plan *models.Plan) error
+	Update(ctx context.Context, plan *models.Plan) error
+	FindHolders(ctx context.Context, planID string, storageLimit int64) ([]PlanHolder, error)
+	FindUserHolder(ctx context.Context, userID string) (*PlanHolder, error)
+	SetHolderPlan(ctx context.Context, holder PlanHolder, plan *models.Plan, grace *models.QuotaGrace) error
+}
+
+// MongoDBPlanRepository is the MongoDB implementation of PlanRepository
+type MongoDBPlanRepository struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+	workspaces *mongo.Collection
+}
+
+// NewPlanRepository creates a new MongoDB plan repository
+func NewPlanRepository(db *mongo.Database) PlanRepository {
+	return &MongoDBPlanRepository{
+		collection: db.Collection("plans"),
+		users:      db.Collection("users"),
+		workspaces: db.Collection("workspaces"),
+	}
+}
+
+// SeedBuiltin inserts the built-in plans that are missing, leaving changed ones alone
+func (r *MongoDBPlanRepository) SeedBuiltin(ctx context.Context) error {
+	for _, plan := range models.BuiltinPlans() {
+		if _, err := r.collection.InsertOne(ctx, plan); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MongoDBPlanRepository) FindAll(ctx context.Context) ([]*models.Plan, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "storage_limit", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	plans := []*models.Plan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+func (r *MongoDBPlanRepository) FindByID(ctx context.Context, id string) (*models.Plan, error) {
+	var plan models.Plan
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (r *MongoDBPlanRepository) Create(ctx context.Context, plan *models.Plan) error {
+	_, err := r.collection.InsertOne(ctx, plan)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPlanExists
+	}
+	return err
+}
+
+func (r *MongoDBPlanRepository) Update(ctx context.Context, plan *models.Plan) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": plan.ID}, plan)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPlanNotFound
+	}
+	return nil
+}
+
+// FindHolders returns the users and workspaces on the plan whose storage limit is storageLimit,
+// which leaves out holders with a limit set by hand
+func (r *MongoDBPlanRepository) FindHolders(ctx context.Context, planID string, storageLimit int64) ([]PlanHolder, error) {
+	users, err := r.findHolders(ctx, r.users, onPlan(planID, models.DefaultUserPlanID, storageLimit))
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := r.findHolders(ctx, r.workspaces, onPlan(planID, models.DefaultWorkspacePlanID, storageLimit))
+	if err != nil {
+		return nil, err
+	}
+	for i := range workspaces {
+		workspaces[i].Workspace = true
+	}
+	return append(users, workspaces...), nil
+}
+
+func (r *MongoDBPlanRepository) FindUserHolder(ctx context.Context, userID string) (*PlanHolder, error) {
+	holders, err := r.findHolders(ctx, r.users, bson.M{"_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(holders) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return &holders[0], nil
+}
+
+// SetHolderPlan moves a user or workspace to plan, taking over its storage limit. A nil grace
+// clears any earlier one.
+func (r *MongoDBPlanRepository) SetHolderPlan(ctx context.Context, holder PlanHolder, plan *models.Plan, grace *models.QuotaGrace) error {
+	collection, notFound := r.users, ErrUserNotFound
+	if holder.Workspace {
+		collection, notFound = r.workspaces, ErrWorkspaceNotFound
+	}
+
+	update := bson.M{"$set": bson.M{"plan_id": plan.ID, "storage_limit": plan.StorageLimit, "updated_at": time.Now()}}
+	if grace != nil {
+		update["$set"].(bson.M)["quota_grace"] = grace
+	} else {
+		update["$unset"] = bson.M{"quota_grace": ""}
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": holder.ID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// findHolders reads holders with their usage from the file-service's quota counter, falling back
+// to the user's recorded usage while the counter has not been created yet
+func (r *MongoDBPlanRepository) findHolders(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]PlanHolder, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$lookup", Value: bson.M{"from": "storage_usage", "localField": "_id", "foreignField": "_id", "as": "usage"}}},
+		{{Key: "$project", Value: bson.M{
+			"storage_limit": 1,
+			"quota_grace":   1,
+			"storage_used": bson.M{"$ifNull": bson.A{
+				bson.M{"$arrayElemAt": bson.A{"$usage.used", 0}},
+				bson.M{"$ifNull": bson.A{"$storage_used", 0}},
+			}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	holders := []PlanHolder{}
+	if err := cursor.All(ctx, &holders); err != nil {
+		return nil, err
+	}
+	return holders, nil
+}
+
+// onPlan matches holders on a plan with the given storage limit. Holders from before plans
+// existed have no plan and are on the default one.
+func onPlan(planID, defaultPlanID string, storageLimit int64) bson.M {
+	filter := bson.M{"plan_id": planID, "storage_limit": storageLimit}
+	if planID == defaultPlanID {
+		filter["plan_id"] = bson.M{"$in": bson.A{planID, nil}}
+	}
+	return filter
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StorageEventRepository reads the storage usage outbox written by the file-service
+type StorageEventRepository interface {
+	FindPending(ctx context.Context, limit int64) ([]*models.StorageEvent, error)
+	MarkApplied(ctx context.Context, id string, lastError string) error
+	MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error
+}
+
+// MongoDBStorageEventRepository is the MongoDB implementation of StorageEventRepository
+type MongoDBStorageEventRepository struct {
+	collection *mongo.Collection
+}
+
+// NewStorageEventRepository creates a new MongoDB storage event repository
+func NewStorageEventRepository(db *mongo.Database) StorageEventRepository {
+	return &MongoDBStorageEventRepository{
+		collection: db.Collection("storage_events"),
+	}
+}
+
+// FindPending returns unapplied events that are due for an attempt, oldest first
+func (r *MongoDBStorageEventRepository) FindPending(ctx context.Context, limit int64) ([]*models.StorageEvent, error) {
+	filter := bson.M{
+		"applied_at":      bson.M{"$exists": false},
+		"next_attempt_at": bson.M{"$lte": time.Now()},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.StorageEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *MongoDBStorageEventRepository) MarkApplied(ctx context.Context, id string, lastError string) error {
+	set := bson.M{"applied_at": time.Now()}
+	if lastError != "" {
+		set["last_error"] = lastError
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func (r *MongoDBStorageEventRepository) MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StorageUsageRepository computes storage usage from the file-service's collections
+// so that User.StorageUsed can be checked against it
+type StorageUsageRepository interface {
+	ActualUsageByUser(ctx context.Context) (map[string]int64, error)
+	PendingDeltaByUser(ctx context.Context) (map[string]int64, error)
+	LedgerUsageByUser(ctx context.Context) (map[string]LedgerUsage, error)
+	SetLedgerUsage(ctx context.Context, userID string, expected LedgerUsage, used int64, staleBefore time.Time) (bool, error)
+}
+
+// LedgerUsage is a file-service quota counter. Used includes the bytes of open reservations,
+// uploads that are not in the files collection yet. Rev changes with every write to the counter.
+type LedgerUsage struct {
+	Used         int64                       `bson:"used"`
+	Rev          int64                       `bson:"rev"`
+	Reservations []models.StorageReservation `bson:"reservations"`
+}
+
+// Reserved sums the open reservations made at or after since
+func (l LedgerUsage) Reserved(since time.Time) int64 {
+	var total int64
+	for _, r := range l.Reservations {
+		if !r.CreatedAt.Before(since) {
+			total += r.Size
+		}
+	}
+	return total
+}
+
+// MongoDBStorageUsageRepository is the MongoDB implementation of StorageUsageRepository
+type MongoDBStorageUsageRepository struct {
+	files  *mongo.Collection
+	events *mongo.Collection
+	ledger *mongo.Collection
+}
+
+// NewStorageUsageRepository creates a new MongoDB storage usage repository
+func NewStorageUsageRepository(db *mongo.Database) StorageUsageRepository {
+	return &MongoDBStorageUsageRepository{
+		files:  db.Collection("files"),
+		events: db.Collection("storage_events"),
+		ledger: db.Collection("storage_usage"),
+	}
+}
+
+// ActualUsageByUser sums the size of every stored version of every personal file, per user.
+// Workspace files count against the workspace's quota, not their uploader's.
+func (r *MongoDBStorageUsageRepository) ActualUsageByUser(ctx context.Context) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"is_folder": false, "workspace_id": bson.M{"$exists": false}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "total": bson.M{"$sum": bson.M{"$sum": "$versions.size"}}}}},
+	}
+	return r.sumByUser(ctx, r.files, pipeline)
+}
+
+// PendingDeltaByUser sums storage events the user-service has not applied yet
+func (r *MongoDBStorageUsageRepository) PendingDeltaByUser(ctx context.Context) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"applied_at": bson.M{"$exists": false}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "total": bson.M{"$sum": "$delta"}}}},
+	}
+	return r.sumByUser(ctx, r.events, pipeline)
+}
+
+// LedgerUsageByUser returns the file-service's quota counters
+func (r *MongoDBStorageUsageRepository) LedgerUsageByUser(ctx context.Context) (map[string]LedgerUsage, error) {
+	cursor, err := r.ledger.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ledger := make(map[string]LedgerUsage)
+	for cursor.Next(ctx) {
+		var row struct {
+			UserID      string `bson:"_id"`
+			LedgerUsage `bson:",inline"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		ledger[row.UserID] = row.LedgerUsage
+	}
+	return ledger, cursor.Err()
+}
+
+// SetLedgerUsage overwrites a quota counter and drops its reservations made before staleBefore,
+// but only if the counter has not been written to since expected was read
+func (r *MongoDBStorageUsageRepository) SetLedgerUsage(ctx context.Context, userID string, expected LedgerUsage, used int64, staleBefore time.Time) (bool, error) {
+	filter := bson.M{"_id": userID, "used": expected.Used, "rev": expected.Rev}
+	if expected.Rev == 0 {
+		// Counters written before rev existed have no rev field
+		filter["rev"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	result, err := r.ledger.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$set":  bson.M{"used": used},
+			"$inc":  bson.M{"rev": 1},
+			"$pull": bson.M{"reservations": bson.M{"created_at": bson.M{"$lt": staleBefore}}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *MongoDBStorageUsageRepository) sumByUser(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) (map[string]int64, error) {
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := make(map[string]int64)
+	for cursor.Next(ctx) {
+		var row struct {
+			UserID string `bson:"_id"`
+			Total  int64  `bson:"total"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		totals[row.UserID] = row.Total
+	}
+	return totals, cursor.Err()
+}
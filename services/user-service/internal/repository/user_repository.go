@@ -3,20 +3,43 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
 	"time"
 
 	"github.com/joaquinidiarte/cloudbox/shared/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrUserNotFound is returned when no user matches the given ID
+var ErrUserNotFound = errors.New("user not found")
+
 // UserRepository defines the interface for user data access
 type UserRepository interface {
 	FindByID(ctx context.Context, id string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Search(ctx context.Context, query models.UserSearchQuery, skip, limit int) ([]*models.User, int64, error)
 	Update(ctx context.Context, id string, update *models.UserUpdateRequest) error
-	UpdateStorageUsed(ctx context.Context, userID string, delta int64) error
+	ExistsByEmail(ctx context.Context, email string) (bool, error)
+	SetPendingEmail(ctx context.Context, id, email string) error
+	ApplyStorageEvent(ctx context.Context, userID, eventID string, delta int64) error
+	FindAllStorageUsage(ctx context.Context) ([]*models.User, error)
+	SetStorageUsed(ctx context.Context, userID string, expected, used int64) (bool, error)
+	SetActive(ctx context.Context, id string, active bool) error
+	SetStorageLimit(ctx context.Context, id string, limit int64) error
+	SetRoles(ctx context.Context, id string, roles []string) error
+	ScheduleDeletion(ctx context.Context, id string, deletion *models.AccountDeletion) error
+	CancelDeletion(ctx context.Context, id string) (bool, error)
+	FindDueDeletions(ctx context.Context, now time.Time) ([]*models.User, error)
+	Tombstone(ctx context.Context, id string, now time.Time) (bool, error)
 }
 
+// appliedEventWindow is how many recently applied storage event IDs are remembered per user.
+// Events are marked applied right after being applied, so only a handful can ever be replayed.
+const appliedEventWindow = 100
+
 // MongoDBUserRepository is the MongoDB implementation of UserRepository
 type MongoDBUserRepository struct {
 	collection *mongo.Collection
@@ -34,13 +57,67 @@ func (r *MongoDBUserRepository) FindByID(ctx context.Context, id string) (*model
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 	return &user, nil
 }
 
+func (r *MongoDBUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Search returns a page of the users matching the query, newest first, and the number of matches
+func (r *MongoDBUserRepository) Search(ctx context.Context, query models.UserSearchQuery, skip, limit int) ([]*models.User, int64, error) {
+	filter := bson.M{}
+	if query.Query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query.Query), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"_id": query.Query},
+			bson.M{"email": pattern},
+			bson.M{"username": pattern},
+			bson.M{"first_name": pattern},
+			bson.M{"last_name": pattern},
+		}
+	}
+	if query.Active != nil {
+		filter["is_active"] = *query.Active
+	}
+	if query.Role != "" {
+		filter["roles"] = query.Role
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
 func (r *MongoDBUserRepository) Update(ctx context.Context, id string, update *models.UserUpdateRequest) error {
 	updateDoc := bson.M{
 		"$set": bson.M{
@@ -54,25 +131,201 @@ func (r *MongoDBUserRepository) Update(ctx context.Context, id string, update *m
 	if update.LastName != "" {
 		updateDoc["$set"].(bson.M)["last_name"] = update.LastName
 	}
-	if update.Email != "" {
-		updateDoc["$set"].(bson.M)["email"] = update.Email
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, updateDoc)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
 	}
+	return nil
+}
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, updateDoc)
+func (r *MongoDBUserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SetPendingEmail records a requested address change. The address only replaces the current one
+// once it is confirmed through the auth-service.
+func (r *MongoDBUserRepository) SetPendingEmail(ctx context.Context, id, email string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"pending_email": email,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ApplyStorageEvent adds delta to the user's storage usage unless the event was already applied.
+// Recording the event ID in the same update makes redelivery harmless.
+func (r *MongoDBUserRepository) ApplyStorageEvent(ctx context.Context, userID, eventID string, delta int64) error {
+	filter := bson.M{
+		"_id":                    userID,
+		"applied_storage_events": bson.M{"$ne": eventID},
+	}
+	update := bson.M{
+		"$inc": bson.M{"storage_used": delta},
+		"$push": bson.M{"applied_storage_events": bson.M{
+			"$each":  bson.A{eventID},
+			"$slice": -appliedEventWindow,
+		}},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("user not found")
+		// Either already applied or the user no longer exists
+		count, err := r.collection.CountDocuments(ctx, bson.M{"_id": userID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUserNotFound
+		}
 	}
 	return nil
 }
 
-func (r *MongoDBUserRepository) UpdateStorageUsed(ctx context.Context, userID string, delta int64) error {
-	_, err := r.collection.UpdateOne(
+// FindAllStorageUsage returns every user with only the storage fields populated
+func (r *MongoDBUserRepository) FindAllStorageUsage(ctx context.Context) ([]*models.User, error) {
+	opts := options.Find().SetProjection(bson.M{"storage_used": 1, "storage_limit": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetStorageUsed overwrites storage_used, but only if it still holds the expected value,
+// so that storage events applied concurrently are not lost
+func (r *MongoDBUserRepository) SetStorageUsed(ctx context.Context, userID string, expected, used int64) (bool, error) {
+	result, err := r.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": userID},
-		bson.M{"$inc": bson.M{"storage_used": delta}},
+		bson.M{"_id": userID, "storage_used": expected},
+		bson.M{"$set": bson.M{"storage_used": used, "updated_at": time.Now()}},
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *MongoDBUserRepository) SetActive(ctx context.Context, id string, active bool) error {
+	return r.set(ctx, id, bson.M{"is_active": active})
+}
+
+func (r *MongoDBUserRepository) SetStorageLimit(ctx context.Context, id string, limit int64) error {
+	return r.set(ctx, id, bson.M{"storage_limit": limit})
+}
+
+func (r *MongoDBUserRepository) SetRoles(ctx context.Context, id string, roles []string) error {
+	return r.set(ctx, id, bson.M{"roles": roles})
+}
+
+// set updates fields of a user and its updated_at timestamp
+func (r *MongoDBUserRepository) set(ctx context.Context, id string, fields bson.M) error {
+	fields["updated_at"] = time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *MongoDBUserRepository) ScheduleDeletion(ctx context.Context, id string, deletion *models.AccountDeletion) error {
+	return r.set(ctx, id, bson.M{"pending_deletion": deletion})
+}
+
+// CancelDeletion clears a pending deletion, reporting false when there was none
+func (r *MongoDBUserRepository) CancelDeletion(ctx context.Context, id string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "pending_deletion": bson.M{"$exists": true}, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$unset": bson.M{"pending_deletion": ""}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// FindDueDeletions returns the users whose deletion grace period ended before now
+func (r *MongoDBUserRepository) FindDueDeletions(ctx context.Context, now time.Time) ([]*models.User, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"pending_deletion.scheduled_for": bson.M{"$lte": now},
+		"deleted_at":                     bson.M{"$exists": false},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Tombstone turns a user whose deletion is due into a deactivated record without personal data.
+// The record is kept so the other services know which user's data to purge. It reports false when
+// the deletion was cancelled in the meantime.
+func (r *MongoDBUserRepository) Tombstone(ctx context.Context, id string, now time.Time) (bool, error) {
+	filter := bson.M{
+		"_id":                            id,
+		"pending_deletion.scheduled_for": bson.M{"$lte": now},
+		"deleted_at":                     bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"email":        "deleted-" + id + "@deleted.invalid",
+			"username":     "deleted-" + id,
+			"password":     "",
+			"first_name":   "",
+			"last_name":    "",
+			"is_active":    false,
+			"totp_enabled": false,
+			"deleted_at":   now,
+			"updated_at":   now,
+		},
+		"$unset": bson.M{
+			"pending_deletion":    "",
+			"pending_email":       "",
+			"email_verified_at":   "",
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_counter":   "",
+			"recovery_codes":      "",
+			"external_identities": "",
+			"roles":               "",
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
 }
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrDeletionPending is returned when deletion is requested for an account already scheduled for it
+	ErrDeletionPending = errors.New("account deletion already requested")
+	// ErrNoPendingDeletion is returned when cancelling a deletion that was never requested
+	ErrNoPendingDeletion = errors.New("no account deletion pending")
+)
+
+// AccountDeletionService schedules account deletions and carries them out once the grace period
+// is over. Deleting turns the user into a tombstone and revokes its tokens; each service then
+// purges the user's data on its own (see shared/accountpurge).
+type AccountDeletionService struct {
+	userRepo    repository.UserRepository
+	revocations revocation.Store
+	mailer      mailer.Mailer
+	logger      *utils.Logger
+	auditLog    *audit.Recorder
+	gracePeriod time.Duration
+	frontendURL string
+}
+
+func NewAccountDeletionService(userRepo repository.UserRepository, revocations revocation.Store, mailer mailer.Mailer, logger *utils.Logger, auditLog *audit.Recorder, gracePeriod time.Duration, frontendURL string) *AccountDeletionService {
+	return &AccountDeletionService{
+		userRepo:    userRepo,
+		revocations: revocations,
+		mailer:      mailer,
+		logger:      logger,
+		auditLog:    auditLog,
+		gracePeriod: gracePeriod,
+		frontendURL: frontendURL,
+	}
+}
+
+// RequestDeletion schedules the user's account for deletion after the grace period and emails
+// the user a link to cancel it
+func (s *AccountDeletionService) RequestDeletion(ctx context.Context, userID string) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.PendingDeletion != nil {
+		return nil, ErrDeletionPending
+	}
+
+	now := time.Now()
+	deletion := &models.AccountDeletion{RequestedAt: now, ScheduledFor: now.Add(s.gracePeriod)}
+	if err := s.userRepo.ScheduleDeletion(ctx, userID, deletion); err != nil {
+		return nil, err
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:    models.AuditAccountDeletionRequest,
+		ActorID:   userID,
+		SubjectID: userID,
+		Details:   map[string]string{"scheduled_for": deletion.ScheduledFor.Format(time.RFC3339)},
+	})
+
+	link := strings.TrimRight(s.frontendURL, "/") + "/settings"
+	mailer.SendAsync(s.mailer, mailer.AccountDeletionMessage(user.Email, user.FirstName, link, deletion.ScheduledFor), s.logger)
+
+	user.PendingDeletion = deletion
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// CancelDeletion keeps an account scheduled for deletion
+func (s *AccountDeletionService) CancelDeletion(ctx context.Context, userID string) (*models.UserResponse, error) {
+	cancelled, err := s.userRepo.CancelDeletion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, ErrNoPendingDeletion
+	}
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:    models.AuditAccountDeletionCancel,
+		ActorID:   userID,
+		SubjectID: userID,
+	})
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// DeleteDue tombstones the accounts whose grace period is over and returns how many were deleted
+func (s *AccountDeletionService) DeleteDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	users, err := s.userRepo.FindDueDeletions(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, user := range users {
+		// Tokens are revoked first: if that fails the account is left as it is and the next run
+		// tries again, rather than deleting it while its tokens still work
+		if err := s.revocations.RevokeUser(ctx, user.ID, now); err != nil {
+			return deleted, err
+		}
+		ok, err := s.userRepo.Tombstone(ctx, user.ID, now)
+		if err != nil {
+			return deleted, err
+		}
+		if !ok {
+			// Cancelled after it was read; the user only has to sign in again
+			continue
+		}
+		s.auditLog.Record(ctx, models.AuditEvent{
+			Action:     models.AuditAccountDeleted,
+			ActorID:    models.AuditActorSystem,
+			SubjectID:  user.ID,
+			TargetType: "user",
+			TargetID:   user.ID,
+			Details:    map[string]string{"requested_at": user.PendingDeletion.RequestedAt.Format(time.RFC3339)},
+		})
+		deleted++
+	}
+	return deleted, nil
+}
+
+// RunScheduled deletes due accounts every interval until ctx is cancelled
+func (s *AccountDeletionService) RunScheduled(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DeleteDue(ctx); err != nil {
+				s.logger.Errorf("Scheduled account deletion failed: %v", err)
+			}
+		}
+	}
+}
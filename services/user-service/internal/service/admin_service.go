@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+var (
+	// ErrUnknownRole is returned when assigning a role that does not exist
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrSelfModification is returned when admins try to lock themselves out
+	ErrSelfModification = errors.New("admins can not deactivate themselves or remove their own admin role")
+)
+
+// defaultUserPageSize users are listed per page unless the request asks for another limit
+const defaultUserPageSize = 20
+
+// AdminService implements the user management actions of the admin API. Every change is audited.
+type AdminService struct {
+	userRepo    repository.UserRepository
+	revocations revocation.Store
+	logger      *utils.Logger
+	auditLog    *audit.Recorder
+}
+
+func NewAdminService(userRepo repository.UserRepository, revocations revocation.Store, logger *utils.Logger, auditLog *audit.Recorder) *AdminService {
+	return &AdminService{
+		userRepo:    userRepo,
+		revocations: revocations,
+		logger:      logger,
+		auditLog:    auditLog,
+	}
+}
+
+// ListUsers returns a page of the users matching the query and the number of matches
+func (s *AdminService) ListUsers(ctx context.Context, actorID string, query models.UserSearchQuery) ([]models.UserResponse, int64, error) {
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.Limit < 1 {
+		query.Limit = defaultUserPageSize
+	}
+
+	users, total, err := s.userRepo.Search(ctx, query, (query.Page-1)*query.Limit, query.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	recordAdmin(ctx, s.auditLog, "list_users", actorID, "", map[string]string{"q": query.Query, "page": strconv.Itoa(query.Page)})
+
+	responses := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, user.ToResponse())
+	}
+	return responses, total, nil
+}
+
+func (s *AdminService) GetUser(ctx context.Context, actorID, id string) (*models.UserResponse, error) {
+	response, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	recordAdmin(ctx, s.auditLog, "view_user", actorID, id, nil)
+	return response, nil
+}
+
+// SetActive activates or deactivates an account. Deactivation also revokes the access tokens
+// already issued; refresh tokens and logins are refused by the auth-service for inactive users.
+func (s *AdminService) SetActive(ctx context.Context, actorID, id string, active bool) (*models.UserResponse, error) {
+	if !active && actorID == id {
+		return nil, ErrSelfModification
+	}
+	if err := s.userRepo.SetActive(ctx, id, active); err != nil {
+		return nil, err
+	}
+	if !active {
+		if err := s.revocations.RevokeUser(ctx, id, time.Now()); err != nil {
+			return nil, err
+		}
+		recordAdmin(ctx, s.auditLog, "deactivate_user", actorID, id, nil)
+	} else {
+		recordAdmin(ctx, s.auditLog, "activate_user", actorID, id, nil)
+	}
+	return s.user(ctx, id)
+}
+
+// SetStorageLimit overrides the storage limit of the user's plan until the user moves to another
+// plan. Lowering it below the current usage only blocks new uploads; nothing already stored is
+// removed.
+func (s *AdminService) SetStorageLimit(ctx context.Context, actorID, id string, limit int64) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetStorageLimit(ctx, id, limit); err != nil {
+		return nil, err
+	}
+	recordAdmin(ctx, s.auditLog, "set_storage_limit", actorID, id, map[string]string{
+		"from": strconv.FormatInt(user.StorageLimit, 10),
+		"to":   strconv.FormatInt(limit, 10),
+	})
+	return s.user(ctx, id)
+}
+
+// SetRoles replaces the user's roles. Access tokens carrying the old roles are revoked, so the
+// change applies with the next token refresh.
+func (s *AdminService) SetRoles(ctx context.Context, actorID, id string, roles []string) (*models.UserResponse, error) {
+	normalized, err := normalizeRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == id && !containsRole(normalized, models.RoleAdmin) {
+		return nil, ErrSelfModification
+	}
+
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetRoles(ctx, id, normalized); err != nil {
+		return nil, err
+	}
+	if err := s.revocations.RevokeUser(ctx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	recordAdmin(ctx, s.auditLog, "set_roles", actorID, id, map[string]string{
+		"from": strings.Join(user.Roles, ","),
+		"to":   strings.Join(normalized, ","),
+	})
+	return s.user(ctx, id)
+}
+
+// GrantAdmin gives the admin role to the user with the given email. It bootstraps the first
+// admin from the command line, where there is no admin to act through the API.
+func (s *AdminService) GrantAdmin(ctx context.Context, email string) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if !user.HasRole(models.RoleAdmin) {
+		roles := append(append([]string{}, user.Roles...), models.RoleAdmin)
+		if err := s.userRepo.SetRoles(ctx, user.ID, roles); err != nil {
+			return nil, err
+		}
+		recordAdmin(ctx, s.auditLog, "grant_admin", "cli", user.ID, nil)
+	}
+	return s.user(ctx, user.ID)
+}
+
+func (s *AdminService) user(ctx context.Context, id string) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// normalizeRoles checks roles against the known ones and drops duplicates
+func normalizeRoles(roles []string) ([]string, error) {
+	normalized := []string{}
+	for _, role := range roles {
+		if !containsRole(models.Roles, role) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownRole, role)
+		}
+		if !containsRole(normalized, role) {
+			normalized = append(normalized, role)
+		}
+	}
+	return normalized, nil
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAdmin records an admin action in the audit log. The user acted on, if any, is the
+// event's subject, so the action also shows up in that user's audit log.
+func recordAdmin(ctx context.Context, auditLog *audit.Recorder, action, actorID, userID string, details map[string]string) {
+	event := models.AuditEvent{
+		Action:    "admin_" + action,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Details:   details,
+	}
+	if userID != "" {
+		event.TargetType = "user"
+		event.TargetID = userID
+	}
+	auditLog.Record(ctx, event)
+}
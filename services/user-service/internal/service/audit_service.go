@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// defaultAuditPageSize events are listed per page unless the request asks for another limit
+const defaultAuditPageSize = 50
+
+// AuditService reads the audit log back. Users see the events they did or that concern them;
+// admins see every event, and their reads of the log are audited too.
+type AuditService struct {
+	auditRepo repository.AuditRepository
+	auditLog  *audit.Recorder
+	logger    *utils.Logger
+}
+
+func NewAuditService(auditRepo repository.AuditRepository, auditLog *audit.Recorder, logger *utils.Logger) *AuditService {
+	return &AuditService{
+		auditRepo: auditRepo,
+		auditLog:  auditLog,
+		logger:    logger,
+	}
+}
+
+// ListUserEvents returns a page of the user's own events and the number of matches
+func (s *AuditService) ListUserEvents(ctx context.Context, userID string, query models.AuditQuery) ([]*models.AuditEvent, int64, error) {
+	query = normalizeAuditQuery(query)
+	return s.auditRepo.Find(ctx, userID, query, (query.Page-1)*query.Limit, query.Limit)
+}
+
+// ListEvents returns a page of all events matching the query, for admins
+func (s *AuditService) ListEvents(ctx context.Context, actorID string, query models.AuditQuery) ([]*models.AuditEvent, int64, error) {
+	query = normalizeAuditQuery(query)
+	events, total, err := s.auditRepo.Find(ctx, "", query, (query.Page-1)*query.Limit, query.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	details := auditQueryDetails(query)
+	details["page"] = strconv.Itoa(query.Page)
+	recordAdmin(ctx, s.auditLog, "view_audit_log", actorID, query.SubjectID, details)
+	return events, total, nil
+}
+
+// ExportUserEvents writes the user's own events matching the query to w as JSON Lines
+func (s *AuditService) ExportUserEvents(ctx context.Context, userID string, query models.AuditQuery, w io.Writer) error {
+	return s.export(ctx, userID, query, w)
+}
+
+// ExportEvents writes all events matching the query to w as JSON Lines, for admins
+func (s *AuditService) ExportEvents(ctx context.Context, actorID string, query models.AuditQuery, w io.Writer) error {
+	recordAdmin(ctx, s.auditLog, "export_audit_log", actorID, query.SubjectID, auditQueryDetails(query))
+	return s.export(ctx, "", query, w)
+}
+
+func (s *AuditService) export(ctx context.Context, userID string, query models.AuditQuery, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return s.auditRepo.ForEach(ctx, userID, query, func(event *models.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+}
+
+func normalizeAuditQuery(query models.AuditQuery) models.AuditQuery {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.Limit < 1 {
+		query.Limit = defaultAuditPageSize
+	}
+	return query
+}
+
+// auditQueryDetails describes the filters of an admin's read of the audit log
+func auditQueryDetails(query models.AuditQuery) map[string]string {
+	details := map[string]string{}
+	for key, value := range map[string]string{
+		"action":    query.Action,
+		"outcome":   query.Outcome,
+		"service":   query.Service,
+		"actor_id":  query.ActorID,
+		"target_id": query.TargetID,
+	} {
+		if value != "" {
+			details[key] = value
+		}
+	}
+	if query.From != nil {
+		details["from"] = query.From.Format(time.RFC3339)
+	}
+	if query.To != nil {
+		details["to"] = query.To.Format(time.RFC3339)
+	}
+	return details
+}
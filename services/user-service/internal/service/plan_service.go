@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// PlanService manages the storage plans and which users are on them. Storage limits are copied
+// to the users and workspaces on a plan; the file-service reads the other limits from the plan.
+type PlanService struct {
+	planRepo    repository.PlanRepository
+	userRepo    repository.UserRepository
+	logger      *utils.Logger
+	auditLog    *audit.Recorder
+	gracePeriod time.Duration
+}
+
+func NewPlanService(planRepo repository.PlanRepository, userRepo repository.UserRepository, logger *utils.Logger, auditLog *audit.Recorder, gracePeriod time.Duration) *PlanService {
+	return &PlanService{
+		planRepo:    planRepo,
+		userRepo:    userRepo,
+		logger:      logger,
+		auditLog:    auditLog,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// SeedBuiltinPlans creates the built-in plans the first time the service starts
+func (s *PlanService) SeedBuiltinPlans(ctx context.Context) error {
+	return s.planRepo.SeedBuiltin(ctx)
+}
+
+func (s *PlanService) ListPlans(ctx context.Context) ([]*models.Plan, error) {
+	return s.planRepo.FindAll(ctx)
+}
+
+// GetUserPlan returns the plan the user is on
+func (s *PlanService) GetUserPlan(ctx context.Context, userID string) (*models.Plan, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.planRepo.FindByID(ctx, user.Plan())
+}
+
+func (s *PlanService) CreatePlan(ctx context.Context, actorID string, req *models.PlanCreateRequest) (*models.Plan, error) {
+	now := time.Now()
+	plan := &models.Plan{ID: strings.ToLower(req.ID), CreatedAt: now}
+	applyPlanRequest(plan, &req.PlanRequest, now)
+
+	if err := s.planRepo.Create(ctx, plan); err != nil {
+		return nil, err
+	}
+	s.recordPlanChange(ctx, "admin_create_plan", actorID, plan)
+	return plan, nil
+}
+
+// UpdatePlan changes a plan's limits. A new storage limit is applied to everyone on the plan
+// except those whose limit was set by hand; anyone left over quota by a lower limit keeps the
+// previous one for the grace period.
+func (s *PlanService) UpdatePlan(ctx context.Context, actorID, id string, req *models.PlanRequest) (*models.Plan, error) {
+	plan, err := s.planRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previousLimit := plan.StorageLimit
+
+	applyPlanRequest(plan, req, time.Now())
+	if err := s.planRepo.Update(ctx, plan); err != nil {
+		return nil, err
+	}
+	s.recordPlanChange(ctx, "admin_update_plan", actorID, plan)
+
+	if plan.StorageLimit != previousLimit {
+		holders, err := s.planRepo.FindHolders(ctx, plan.ID, previousLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, holder := range holders {
+			if err := s.applyPlan(ctx, holder, plan); err != nil {
+				return nil, err
+			}
+		}
+		s.logger.Infof("Applied the new storage limit of plan %s to %d users and workspaces", plan.ID, len(holders))
+	}
+	return plan, nil
+}
+
+// AssignUserPlan moves a user to another plan
+func (s *PlanService) AssignUserPlan(ctx context.Context, actorID, userID, planID string) (*models.UserResponse, error) {
+	plan, err := s.planRepo.FindByID(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	holder, err := s.planRepo.FindUserHolder(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyPlan(ctx, *holder, plan); err != nil {
+		return nil, err
+	}
+	recordAdmin(ctx, s.auditLog, "set_plan", actorID, userID, map[string]string{"from": user.Plan(), "to": plan.ID})
+
+	if user, err = s.userRepo.FindByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	response := user.ToResponse()
+	return &response, nil
+}
+
+// applyPlan moves a holder to plan, with a grace period when the new limit leaves it over quota
+func (s *PlanService) applyPlan(ctx context.Context, holder repository.PlanHolder, plan *models.Plan) error {
+	previousLimit := models.EffectiveStorageLimit(holder.StorageLimit, holder.QuotaGrace)
+	grace := models.NewQuotaGrace(previousLimit, plan.StorageLimit, holder.StorageUsed, s.gracePeriod)
+	if grace != nil {
+		s.logger.Infof("%s is over the %s plan's storage limit, keeping %d bytes until %s", holder.ID, plan.ID, grace.StorageLimit, grace.Until.Format(time.RFC3339))
+	}
+	return s.planRepo.SetHolderPlan(ctx, holder, plan, grace)
+}
+
+func (s *PlanService) recordPlanChange(ctx context.Context, action, actorID string, plan *models.Plan) {
+	s.auditLog.Record(ctx, models.AuditEvent{
+		Action:     action,
+		ActorID:    actorID,
+		TargetType: "plan",
+		TargetID:   plan.ID,
+		Details: map[string]string{
+			"storage_limit": strconv.FormatInt(plan.StorageLimit, 10),
+			"max_file_size": strconv.FormatInt(plan.MaxFileSize, 10),
+		},
+	})
+}
+
+func applyPlanRequest(plan *models.Plan, req *models.PlanRequest, now time.Time) {
+	plan.Name = strings.TrimSpace(req.Name)
+	plan.StorageLimit = *req.StorageLimit
+	plan.MaxFileSize = *req.MaxFileSize
+	plan.MaxVersions = *req.MaxVersions
+	plan.UpdatedAt = now
+}
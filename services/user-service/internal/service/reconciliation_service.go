@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrReconciliationRunning is returned when a reconciliation is requested while one is in progress
+var ErrReconciliationRunning = errors.New("storage reconciliation already running")
+
+// staleReservationAge is how long an upload may hold a quota reservation. Older reservations
+// were left behind by a file-service that stopped mid-upload and are dropped.
+const staleReservationAge = time.Hour
+
+// ReconciliationService recomputes each user's storage usage from the files collection
+// and repairs User.StorageUsed and the file-service quota counter when they have drifted
+type ReconciliationService struct {
+	userRepo  repository.UserRepository
+	usageRepo repository.StorageUsageRepository
+	logger    *utils.Logger
+	running   sync.Mutex
+}
+
+func NewReconciliationService(userRepo repository.UserRepository, usageRepo repository.StorageUsageRepository, logger *utils.Logger) *ReconciliationService {
+	return &ReconciliationService{
+		userRepo:  userRepo,
+		usageRepo: usageRepo,
+		logger:    logger,
+	}
+}
+
+// Reconcile compares every user's recorded usage with the bytes actually stored.
+// With dryRun set it only reports the drift.
+func (s *ReconciliationService) Reconcile(ctx context.Context, dryRun bool) (*models.StorageDriftReport, error) {
+	if !s.running.TryLock() {
+		return nil, ErrReconciliationRunning
+	}
+	defer s.running.Unlock()
+
+	report := &models.StorageDriftReport{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Drifts:    []models.StorageDrift{},
+	}
+
+	// Nothing here is a consistent snapshot: a change made while these are read can make a
+	// user look drifted for one run, and the next run puts it right. The quota counters are
+	// read first: the file-service changes a counter in the same transaction as the files it
+	// accounts for, so a file change after this read also changes the counter's rev and the
+	// compare-and-set in correct leaves it alone.
+	ledger, err := s.usageRepo.LedgerUsageByUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.usageRepo.PendingDeltaByUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := s.usageRepo.ActualUsageByUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	staleBefore := time.Now().Add(-staleReservationAge)
+	users, err := s.userRepo.FindAllStorageUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		report.UsersChecked++
+
+		drift := models.StorageDrift{
+			UserID:       user.ID,
+			RecordedUsed: user.StorageUsed,
+			ActualUsed:   actual[user.ID],
+			PendingDelta: pending[user.ID],
+		}
+		// Pending events will still be added to StorageUsed, so it should lag behind by exactly that much
+		drift.ExpectedUsed = drift.ActualUsed - drift.PendingDelta
+
+		// Uploads in flight have reserved bytes that are not in the files collection yet, and the
+		// counter must keep holding them
+		counter, hasLedger := ledger[user.ID]
+		drift.Reserved = counter.Reserved(staleBefore)
+		expectedLedger := drift.ActualUsed + drift.Reserved
+		userDrifted := drift.RecordedUsed != drift.ExpectedUsed
+		ledgerDrifted := hasLedger && counter.Used != expectedLedger
+		if !userDrifted && !ledgerDrifted {
+			continue
+		}
+
+		report.UsersDrifted++
+		report.TotalDrift += abs(drift.RecordedUsed - drift.ExpectedUsed)
+		if ledgerDrifted {
+			drift.LedgerUsed = &counter.Used
+			report.TotalDrift += abs(counter.Used - expectedLedger)
+		}
+
+		if !dryRun {
+			drift.Corrected, drift.Error = s.correct(ctx, drift, counter, userDrifted, ledgerDrifted, staleBefore)
+		}
+		report.Drifts = append(report.Drifts, drift)
+	}
+
+	report.FinishedAt = time.Now()
+	s.logger.Infof("Storage reconciliation finished: %d users checked, %d drifted, %d bytes total drift (dry run: %t)",
+		report.UsersChecked, report.UsersDrifted, report.TotalDrift, dryRun)
+	return report, nil
+}
+
+// correct applies the expected values with compare-and-set updates. A value that changed since
+// it was read is left alone, because the concurrent change may already have fixed it.
+func (s *ReconciliationService) correct(ctx context.Context, drift models.StorageDrift, counter repository.LedgerUsage, userDrifted, ledgerDrifted bool, staleBefore time.Time) (bool, string) {
+	corrected := true
+
+	if userDrifted {
+		ok, err := s.userRepo.SetStorageUsed(ctx, drift.UserID, drift.RecordedUsed, drift.ExpectedUsed)
+		if err != nil {
+			s.logger.Errorf("Failed to correct storage usage for user %s: %v", drift.UserID, err)
+			return false, err.Error()
+		}
+		corrected = corrected && ok
+	}
+
+	if ledgerDrifted {
+		ok, err := s.usageRepo.SetLedgerUsage(ctx, drift.UserID, counter, drift.ActualUsed+drift.Reserved, staleBefore)
+		if err != nil {
+			s.logger.Errorf("Failed to correct quota counter for user %s: %v", drift.UserID, err)
+			return false, err.Error()
+		}
+		corrected = corrected && ok
+	}
+
+	if !corrected {
+		return false, "usage changed during reconciliation; will be rechecked on the next run"
+	}
+	return true, ""
+}
+
+// RunScheduled reconciles every interval until ctx is cancelled
+func (s *ReconciliationService) RunScheduled(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Reconcile(ctx, false); err != nil {
+				s.logger.Errorf("Scheduled storage reconciliation failed: %v", err)
+			}
+		}
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
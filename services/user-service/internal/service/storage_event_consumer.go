@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const (
+	storageEventBatchSize = 100
+	maxRetryBackoff       = 10 * time.Minute
+)
+
+// StorageEventConsumer applies the file-service's storage usage outbox to User.StorageUsed.
+// Failed events are retried with exponential backoff until they succeed.
+type StorageEventConsumer struct {
+	userRepo  repository.UserRepository
+	eventRepo repository.StorageEventRepository
+	logger    *utils.Logger
+	interval  time.Duration
+}
+
+func NewStorageEventConsumer(userRepo repository.UserRepository, eventRepo repository.StorageEventRepository, logger *utils.Logger, interval time.Duration) *StorageEventConsumer {
+	return &StorageEventConsumer{
+		userRepo:  userRepo,
+		eventRepo: eventRepo,
+		logger:    logger,
+		interval:  interval,
+	}
+}
+
+// Run polls for pending events until ctx is cancelled
+func (c *StorageEventConsumer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.processPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *StorageEventConsumer) processPending(ctx context.Context) {
+	events, err := c.eventRepo.FindPending(ctx, storageEventBatchSize)
+	if err != nil {
+		c.logger.Errorf("Failed to load storage events: %v", err)
+		return
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		c.apply(ctx, event)
+	}
+}
+
+func (c *StorageEventConsumer) apply(ctx context.Context, event *models.StorageEvent) {
+	err := c.userRepo.ApplyStorageEvent(ctx, event.UserID, event.ID, event.Delta)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// Nothing to account against; retrying will never succeed
+		c.logger.Warnf("Dropping storage event %s for missing user %s", event.ID, event.UserID)
+		if err := c.eventRepo.MarkApplied(ctx, event.ID, err.Error()); err != nil {
+			c.logger.Errorf("Failed to mark storage event %s applied: %v", event.ID, err)
+		}
+		return
+	}
+	if err != nil {
+		backoff := retryBackoff(event.Attempts)
+		c.logger.Errorf("Failed to apply storage event %s (attempt %d, retrying in %s): %v", event.ID, event.Attempts+1, backoff, err)
+		if err := c.eventRepo.MarkFailed(ctx, event.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+			c.logger.Errorf("Failed to record storage event %s failure: %v", event.ID, err)
+		}
+		return
+	}
+
+	// If this fails the event is redelivered, which ApplyStorageEvent ignores
+	if err := c.eventRepo.MarkApplied(ctx, event.ID, ""); err != nil {
+		c.logger.Errorf("Failed to mark storage event %s applied: %v", event.ID, err)
+	}
+}
+
+// retryBackoff doubles from one second per failed attempt, capped at maxRetryBackoff
+func retryBackoff(attempts int) time.Duration {
+	if attempts > 20 {
+		return maxRetryBackoff
+	}
+	backoff := time.Second << attempts
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
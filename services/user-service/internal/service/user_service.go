@@ -2,18 +2,38 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/joaquinidiarte/cloudbox/services/user-service/internal/repository"
+	"github.com/joaquinidiarte/cloudbox/shared/mailer"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
 )
 
+// ErrEmailTaken is returned when changing to an address another account uses
+var ErrEmailTaken = errors.New("email already registered")
+
+// verificationTokenBytes is the entropy of an email verification token
+const verificationTokenBytes = 32
+
 type UserService struct {
-	userRepo repository.UserRepository
+	userRepo             repository.UserRepository
+	verificationRepo     repository.EmailVerificationRepository
+	mailer               mailer.Mailer
+	logger               *utils.Logger
+	verificationTokenTTL time.Duration
+	frontendURL          string
 }
 
-func NewUserService(userRepo repository.UserRepository) *UserService {
+func NewUserService(userRepo repository.UserRepository, verificationRepo repository.EmailVerificationRepository, mailer mailer.Mailer, logger *utils.Logger, verificationTokenTTL time.Duration, frontendURL string) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:             userRepo,
+		verificationRepo:     verificationRepo,
+		mailer:               mailer,
+		logger:               logger,
+		verificationTokenTTL: verificationTokenTTL,
+		frontendURL:          frontendURL,
 	}
 }
 
@@ -26,12 +46,34 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.UserR
 	return &response, nil
 }
 
+// UpdateUser updates the profile. A new email is only stored as pending and a verification link is
+// sent to it; the address changes once the link is followed.
 func (s *UserService) UpdateUser(ctx context.Context, id string, req *models.UserUpdateRequest) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Email != "" && req.Email != user.Email && req.Email != user.PendingEmail {
+		// Only an early answer: the auth-service's unique index on email refuses the change when
+		// it is confirmed if someone registered the address in the meantime
+		exists, err := s.userRepo.ExistsByEmail(ctx, req.Email)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrEmailTaken
+		}
+		if err := s.requestEmailChange(ctx, user, req.Email); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := s.userRepo.Update(ctx, id, req); err != nil {
 		return nil, err
 	}
 
-	user, err := s.userRepo.FindByID(ctx, id)
+	user, err = s.userRepo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +81,25 @@ func (s *UserService) UpdateUser(ctx context.Context, id string, req *models.Use
 	return &response, nil
 }
 
-func (s *UserService) UpdateStorageUsed(ctx context.Context, userID string, delta int64) error {
-	return s.userRepo.UpdateStorageUsed(ctx, userID, delta)
+// requestEmailChange stores the pending address and emails it a verification link
+func (s *UserService) requestEmailChange(ctx context.Context, user *models.User, email string) error {
+	if err := s.userRepo.SetPendingEmail(ctx, user.ID, email); err != nil {
+		return err
+	}
+	if err := s.verificationRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	rawToken, err := utils.GenerateToken(verificationTokenBytes)
+	if err != nil {
+		return err
+	}
+	token := models.NewEmailVerificationToken(user.ID, email, utils.HashString(rawToken), s.verificationTokenTTL)
+	if err := s.verificationRepo.Create(ctx, token); err != nil {
+		return err
+	}
+
+	link := mailer.Link(s.frontendURL, "/verify-email", rawToken)
+	mailer.SendAsync(s.mailer, mailer.EmailVerificationMessage(email, user.FirstName, link, s.verificationTokenTTL), s.logger)
+	return nil
 }
@@ -0,0 +1,78 @@
+package accesstoken
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrInvalidToken is returned for tokens that are unknown, revoked or expired, or whose owner is inactive
+var ErrInvalidToken = errors.New("invalid or expired access token")
+
+// lastUsedGranularity limits how often last-use tracking writes to the database
+const lastUsedGranularity = time.Minute
+
+// Verifier checks personal access tokens presented to a service
+type Verifier interface {
+	// Verify returns the token and its owner, and records the use
+	Verify(ctx context.Context, rawToken, clientIP string) (*models.PersonalAccessToken, *models.User, error)
+}
+
+// MongoVerifier reads the tokens the auth-service stores in the shared database
+type MongoVerifier struct {
+	tokens *mongo.Collection
+	users  *mongo.Collection
+}
+
+func NewMongoVerifier(db *mongo.Database) *MongoVerifier {
+	return &MongoVerifier{
+		tokens: db.Collection("personal_access_tokens"),
+		users:  db.Collection("users"),
+	}
+}
+
+func (v *MongoVerifier) Verify(ctx context.Context, rawToken, clientIP string) (*models.PersonalAccessToken, *models.User, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": utils.HashString(rawToken),
+		"revoked_at": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": now}},
+		},
+	}
+
+	var token models.PersonalAccessToken
+	if err := v.tokens.FindOne(ctx, filter).Decode(&token); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := v.users.FindOne(ctx, bson.M{"_id": token.UserID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrInvalidToken
+	}
+
+	// Tracking is best effort and only written once per lastUsedGranularity
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedGranularity {
+		v.tokens.UpdateOne(ctx, bson.M{"_id": token.ID}, bson.M{"$set": bson.M{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}})
+	}
+
+	return &token, &user, nil
+}
@@ -0,0 +1,94 @@
+// Package accountpurge removes the data of deleted accounts. The user-service turns a deleted
+// user into a tombstone; every service holding user data runs a Worker that purges its part and
+// records that it did on the tombstone, so a purge that fails is retried on the next run.
+package accountpurge
+
+import (
+	"context"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PurgeFunc deletes everything a service stores for a user. It must be safe to run again after
+// a partial failure.
+type PurgeFunc func(ctx context.Context, userID string) error
+
+// Worker purges a service's data of deleted users
+type Worker struct {
+	users    *mongo.Collection
+	service  string
+	purge    PurgeFunc
+	auditLog *audit.Recorder
+	logger   *utils.Logger
+	interval time.Duration
+}
+
+func NewWorker(db *mongo.Database, service string, purge PurgeFunc, auditLog *audit.Recorder, logger *utils.Logger, interval time.Duration) *Worker {
+	return &Worker{
+		users:    db.Collection("users"),
+		service:  service,
+		purge:    purge,
+		auditLog: auditLog,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run purges deleted users every interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.PurgeDeleted(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDeleted purges the deleted users this service has not purged yet
+func (w *Worker) PurgeDeleted(ctx context.Context) {
+	filter := bson.M{"deleted_at": bson.M{"$exists": true}, "purged_by": bson.M{"$ne": w.service}}
+	cursor, err := w.users.Find(ctx, filter)
+	if err != nil {
+		w.logger.Errorf("Failed to find deleted users: %v", err)
+		return
+	}
+	var tombstones []struct {
+		ID string `bson:"_id"`
+	}
+	err = cursor.All(ctx, &tombstones)
+	cursor.Close(ctx)
+	if err != nil {
+		w.logger.Errorf("Failed to read deleted users: %v", err)
+		return
+	}
+
+	for _, tombstone := range tombstones {
+		if err := w.purge(ctx, tombstone.ID); err != nil {
+			w.logger.Errorf("Failed to purge the data of deleted user %s: %v", tombstone.ID, err)
+			continue
+		}
+		_, err := w.users.UpdateOne(ctx, bson.M{"_id": tombstone.ID}, bson.M{"$addToSet": bson.M{"purged_by": w.service}})
+		if err != nil {
+			w.logger.Errorf("Failed to mark deleted user %s as purged: %v", tombstone.ID, err)
+			continue
+		}
+		w.auditLog.Record(ctx, models.AuditEvent{
+			Action:     models.AuditAccountPurged,
+			ActorID:    models.AuditActorSystem,
+			SubjectID:  tombstone.ID,
+			TargetType: "user",
+			TargetID:   tombstone.ID,
+		})
+	}
+}
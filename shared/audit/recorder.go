@@ -0,0 +1,130 @@
+// Package audit records security and file events in the append-only audit log shared by all
+// services. Events are only ever inserted; the user-service reads them back for the audit log API.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection is where audit events are stored
+const Collection = "audit_events"
+
+// writeTimeout bounds how long recording an event can hold up the request it belongs to
+const writeTimeout = 5 * time.Second
+
+type clientKey struct{}
+
+type client struct {
+	ip        string
+	userAgent string
+}
+
+// WithClient attaches the client address and user agent of a request to ctx, to be recorded
+// with the events of the request
+func WithClient(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client{ip: ip, userAgent: userAgent})
+}
+
+type impersonatorKey struct{}
+
+// WithImpersonator marks ctx as a request made by an admin impersonating a user. Events of the
+// request are then recorded with the admin as actor, on behalf of the user.
+func WithImpersonator(ctx context.Context, impersonatorID string) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, impersonatorID)
+}
+
+// Recorder writes the audit events of one service
+type Recorder struct {
+	collection *mongo.Collection
+	service    string
+	logger     *utils.Logger
+}
+
+func NewRecorder(db *mongo.Database, service string, logger *utils.Logger) *Recorder {
+	return &Recorder{
+		collection: db.Collection(Collection),
+		service:    service,
+		logger:     logger,
+	}
+}
+
+// Record stores an event, filling in its ID, time, service, outcome and the request's client.
+// The event is logged as well; failing to store it is logged rather than failing the action.
+func (r *Recorder) Record(ctx context.Context, event models.AuditEvent) {
+	event.ID = uuid.New().String()
+	event.Time = time.Now()
+	event.Service = r.service
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+	if c, ok := ctx.Value(clientKey{}).(client); ok {
+		if event.IPAddress == "" {
+			event.IPAddress = c.ip
+		}
+		if event.UserAgent == "" {
+			event.UserAgent = c.userAgent
+		}
+	}
+	if admin, ok := ctx.Value(impersonatorKey{}).(string); ok && admin != "" && event.ActorID != admin {
+		details := make(map[string]string, len(event.Details)+1)
+		for key, value := range event.Details {
+			details[key] = value
+		}
+		details["on_behalf_of"] = event.ActorID
+		event.Details = details
+		if event.SubjectID == "" {
+			event.SubjectID = event.ActorID
+		}
+		event.ActorID = admin
+	}
+
+	r.logger.Infof("AUDIT %s", format(&event))
+
+	// Recorded even when the request is cancelled right after the action
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	if _, err := r.collection.InsertOne(writeCtx, event); err != nil {
+		r.logger.Errorf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// format renders an event as the key=value line written to the service log
+func format(event *models.AuditEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s outcome=%s actor=%s", event.Action, event.Outcome, orDash(event.ActorID))
+	if event.SubjectID != "" && event.SubjectID != event.ActorID {
+		fmt.Fprintf(&b, " subject=%s", event.SubjectID)
+	}
+	if event.TargetID != "" {
+		fmt.Fprintf(&b, " target=%s:%s", event.TargetType, event.TargetID)
+	}
+	if event.IPAddress != "" {
+		fmt.Fprintf(&b, " ip=%s", event.IPAddress)
+	}
+
+	keys := make([]string, 0, len(event.Details))
+	for key := range event.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%q", key, event.Details[key])
+	}
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
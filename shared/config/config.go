@@ -8,6 +8,10 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret is the JWT_SECRET used when none is configured. Tokens signed with it can be
+// forged by anyone who has read this file, so it is never accepted for signing or verification.
+const DefaultJWTSecret = "change-this-secret-key"
+
 type Config struct {
 	Environment string
 	LogLevel    string
@@ -27,15 +31,90 @@ type Config struct {
 	RedisPassword string
 
 	// JWT
-	JWTSecret     string
-	JWTExpiration string
+	JWTSecret              string
+	JWTExpiration          string
+	RefreshTokenExpiration string
+	// Asymmetric signing: the auth-service signs with the keys in JWTSigningKeysDir,
+	// other services verify with the public keys served at JWTJWKSURL
+	JWTSigningKeysDir      string
+	JWTSigningAlgorithm    string
+	JWTKeyRotationInterval string
+	JWTJWKSURL             string
+
+	// Login brute-force protection
+	LoginMaxAttempts     int
+	LoginIPMaxAttempts   int
+	LoginLockoutDuration string
 
 	// File Storage
-	StoragePath string
-	MaxFileSize int64
+	StoragePath      string
+	AllowedMimeTypes string
+	DeniedMimeTypes  string
+
+	// Storage plans: how long a higher storage limit stays in force after a downgrade
+	PlanDowngradeGracePeriod string
+
+	// Account deletion and data export
+	AccountDeletionGracePeriod string
+	AccountPurgeInterval       string
+	DataExportExpiration       string
+
+	// Malware scanning
+	ClamAVAddress string
+	ClamAVTimeout string
+	ScanInterval  string
+
+	// Storage accounting
+	StorageEventPollInterval string
+	ReconcileInterval        string
+
+	// Password reset and email verification
+	PasswordResetExpiration     string
+	EmailVerificationExpiration string
+	RequireEmailVerification    bool
+
+	// Single sign-on with an external OpenID Connect provider; disabled when OIDCIssuer is empty
+	OIDCIssuer          string
+	OIDCDiscoveryURL    string
+	OIDCClientID        string
+	OIDCClientSecret    string
+	OIDCRedirectURL     string
+	OIDCScopes          string
+	OIDCProviderName    string
+	OIDCAllowedDomains  string
+	OIDCAutoCreateUsers bool
+
+	// Password login against an LDAP directory, next to local passwords; disabled when LDAPURL is empty
+	LDAPURL                string
+	LDAPStartTLS           bool
+	LDAPBindDN             string
+	LDAPBindPassword       string
+	LDAPBaseDN             string
+	LDAPUserFilter         string
+	LDAPEmailAttribute     string
+	LDAPUsernameAttribute  string
+	LDAPFirstNameAttribute string
+	LDAPLastNameAttribute  string
+	LDAPIDAttribute        string
+	LDAPAutoCreateUsers    bool
+
+	// Email delivery
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Frontend, used for links in emails
+	FrontendURL string
+
+	// Operational endpoints
+	AdminToken string
 
 	// API Gateway
 	APIGatewayURL string
+	// Addresses or CIDRs of the gateway, whose X-Forwarded-For header the services trust
+	TrustedProxies string
 
 	// Service URLs
 	AuthServiceURL string
@@ -49,8 +128,6 @@ func Load() *Config {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	maxFileSize, _ := strconv.ParseInt(getEnv("MAX_FILE_SIZE", "524288000"), 10, 64)
-
 	return &Config{
 		Environment: getEnv("ENVIRONMENT", "development"),
 		LogLevel:    getEnv("LOG_LEVEL", "info"),
@@ -62,17 +139,78 @@ func Load() *Config {
 		MongoURI:      getEnv("MONGO_URI", "mongodb://localhost:27017"),
 		MongoDatabase: getEnv("MONGO_DATABASE", "cloudbox"),
 
-		RedisHost:     getEnv("REDIS_HOST", "localhost"),
+		RedisHost:     getEnv("REDIS_HOST", ""),
 		RedisPort:     getEnv("REDIS_PORT", "6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 
-		JWTSecret:     getEnv("JWT_SECRET", "change-this-secret-key"),
-		JWTExpiration: getEnv("JWT_EXPIRATION", "24h"),
-
-		StoragePath: getEnv("STORAGE_PATH", "./storage"),
-		MaxFileSize: maxFileSize,
-
-		APIGatewayURL: getEnv("API_GATEWAY_URL", "http://localhost:8080"),
+		JWTSecret:              getEnv("JWT_SECRET", DefaultJWTSecret),
+		JWTExpiration:          getEnv("JWT_EXPIRATION", "15m"),
+		RefreshTokenExpiration: getEnv("REFRESH_TOKEN_EXPIRATION", "720h"),
+		JWTSigningKeysDir:      getEnv("JWT_SIGNING_KEYS_DIR", ""),
+		JWTSigningAlgorithm:    getEnv("JWT_SIGNING_ALGORITHM", "EdDSA"),
+		JWTKeyRotationInterval: getEnv("JWT_KEY_ROTATION_INTERVAL", "720h"),
+		JWTJWKSURL:             getEnv("JWT_JWKS_URL", ""),
+
+		LoginMaxAttempts:     getEnvPositiveInt("LOGIN_MAX_ATTEMPTS", 10),
+		LoginIPMaxAttempts:   getEnvPositiveInt("LOGIN_IP_MAX_ATTEMPTS", 100),
+		LoginLockoutDuration: getEnv("LOGIN_LOCKOUT_DURATION", "15m"),
+
+		StoragePath:      getEnv("STORAGE_PATH", "./storage"),
+		AllowedMimeTypes: getEnv("ALLOWED_MIME_TYPES", ""),
+		DeniedMimeTypes:  getEnv("DENIED_MIME_TYPES", ""),
+
+		PlanDowngradeGracePeriod: getEnv("PLAN_DOWNGRADE_GRACE_PERIOD", "336h"),
+
+		AccountDeletionGracePeriod: getEnv("ACCOUNT_DELETION_GRACE_PERIOD", "168h"),
+		AccountPurgeInterval:       getEnv("ACCOUNT_PURGE_INTERVAL", "5m"),
+		DataExportExpiration:       getEnv("DATA_EXPORT_EXPIRATION", "168h"),
+
+		ClamAVAddress: getEnv("CLAMAV_ADDRESS", ""),
+		ClamAVTimeout: getEnv("CLAMAV_TIMEOUT", "5m"),
+		ScanInterval:  getEnv("SCAN_INTERVAL", "30s"),
+
+		StorageEventPollInterval: getEnv("STORAGE_EVENT_POLL_INTERVAL", "5s"),
+		ReconcileInterval:        getEnv("RECONCILE_INTERVAL", "24h"),
+
+		PasswordResetExpiration:     getEnv("PASSWORD_RESET_EXPIRATION", "1h"),
+		EmailVerificationExpiration: getEnv("EMAIL_VERIFICATION_EXPIRATION", "24h"),
+		RequireEmailVerification:    getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true",
+
+		OIDCIssuer:          getEnv("OIDC_ISSUER", ""),
+		OIDCDiscoveryURL:    getEnv("OIDC_DISCOVERY_URL", ""),
+		OIDCClientID:        getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:    getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:     getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:          getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCProviderName:    getEnv("OIDC_PROVIDER_NAME", "SSO"),
+		OIDCAllowedDomains:  getEnv("OIDC_ALLOWED_DOMAINS", ""),
+		OIDCAutoCreateUsers: getEnv("OIDC_AUTO_CREATE_USERS", "true") == "true",
+
+		LDAPURL:                getEnv("LDAP_URL", ""),
+		LDAPStartTLS:           getEnv("LDAP_START_TLS", "false") == "true",
+		LDAPBindDN:             getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:             getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:         getEnv("LDAP_USER_FILTER", "(mail=%s)"),
+		LDAPEmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPUsernameAttribute:  getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPFirstNameAttribute: getEnv("LDAP_FIRST_NAME_ATTRIBUTE", "givenName"),
+		LDAPLastNameAttribute:  getEnv("LDAP_LAST_NAME_ATTRIBUTE", "sn"),
+		LDAPIDAttribute:        getEnv("LDAP_ID_ATTRIBUTE", ""),
+		LDAPAutoCreateUsers:    getEnv("LDAP_AUTO_CREATE_USERS", "true") == "true",
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "CloudBox <no-reply@cloudbox.local>"),
+
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		APIGatewayURL:  getEnv("API_GATEWAY_URL", "http://localhost:8080"),
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
 
 		AuthServiceURL: getEnv("AUTH_SERVICE_URL", "http://localhost:8081"),
 		UserServiceURL: getEnv("USER_SERVICE_URL", "http://localhost:8082"),
@@ -80,9 +218,29 @@ func Load() *Config {
 	}
 }
 
+// IsDevelopment reports whether the service runs with ENVIRONMENT=development
+func (c *Config) IsDevelopment() bool {
+	return c.Environment == "development"
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvPositiveInt falls back to the default, with a warning, when the value is not a positive
+// integer; a zero limit would otherwise lock on the first failure
+func getEnvPositiveInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Invalid %s %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,134 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/config"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+const (
+	// refetchInterval limits how often an unknown key ID triggers a fetch
+	refetchInterval = 10 * time.Second
+	fetchTimeout    = 5 * time.Second
+)
+
+// Client verifies tokens with the public keys published by the auth-service.
+// Keys are cached for CacheTTL; a token with an unknown key ID triggers an earlier fetch,
+// and the last known keys keep being used while the auth-service is unreachable.
+type Client struct {
+	url        string
+	httpClient *http.Client
+	logger     *utils.Logger
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewClient(url string, logger *utils.Logger) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: fetchTimeout},
+		logger:     logger,
+		keys:       make(map[string]crypto.PublicKey),
+	}
+}
+
+// SigningKey always fails; verifying services can not issue tokens
+func (c *Client) SigningKey() (string, crypto.Signer, error) {
+	return "", nil, errors.New("this service can only verify tokens")
+}
+
+func (c *Client) PublicKey(kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, known := c.keys[kid]
+	stale := time.Since(c.fetchedAt) > CacheTTL
+	if (stale || !known) && time.Since(c.lastAttempt) > refetchInterval {
+		c.lastAttempt = time.Now()
+		if err := c.fetch(); err != nil {
+			c.logger.Errorf("Failed to fetch signing keys from %s: %v", c.url, err)
+		} else {
+			key, known = c.keys[kid]
+		}
+	}
+
+	if !known {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// fetch replaces the cached keys; callers must hold mu
+func (c *Client) fetch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			c.logger.Warnf("Ignoring signing key %s: %v", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+// NewJWTManager returns the token verifier for services other than the auth-service: keys from
+// the JWKS endpoint when JWT_JWKS_URL is set, the shared HS256 secret otherwise. The shared
+// secret is only accepted in development, and never with its default value.
+func NewJWTManager(cfg *config.Config, tokenDuration time.Duration, logger *utils.Logger) (*utils.JWTManager, error) {
+	if cfg.JWTJWKSURL == "" {
+		if err := CheckSharedSecret(cfg, "JWT_JWKS_URL"); err != nil {
+			return nil, err
+		}
+		logger.Warn("JWT_JWKS_URL is not set, verifying tokens with the shared JWT_SECRET")
+		return utils.NewJWTManager(cfg.JWTSecret, tokenDuration), nil
+	}
+	return utils.NewKeySetJWTManager(NewClient(cfg.JWTJWKSURL, logger), tokenDuration), nil
+}
+
+// CheckSharedSecret returns an error when tokens may not fall back to the shared HS256
+// JWT_SECRET because the asymmetric key setting is missing: outside development, or with the
+// default secret, anyone could forge tokens the services accept
+func CheckSharedSecret(cfg *config.Config, setting string) error {
+	if !cfg.IsDevelopment() {
+		return fmt.Errorf("%s is required when ENVIRONMENT is %q", setting, cfg.Environment)
+	}
+	if cfg.JWTSecret == "" || cfg.JWTSecret == config.DefaultJWTSecret {
+		return fmt.Errorf("%s is not set and JWT_SECRET has its default value", setting)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// ErrUnknownKey is returned for a key ID that is not in the set
+var ErrUnknownKey = errors.New("unknown signing key")
+
+const (
+	// rsaKeyBits is the size of generated RSA keys
+	rsaKeyBits = 2048
+	// reloadInterval is how often the key directory is re-read, so keys rotated by another
+	// instance or by hand are picked up without a restart
+	reloadInterval = time.Minute
+)
+
+type signingKey struct {
+	id        string
+	key       crypto.Signer
+	createdAt time.Time
+}
+
+// Keyring holds the auth-service's private signing keys, one PEM file per key named <kid>.pem.
+//
+// Rotation adds a new key, which is published right away but only used for signing once
+// PublishDelay has passed. The previous keys stay published until every token they signed has
+// expired, and are then deleted.
+type Keyring struct {
+	dir           string
+	algorithm     string
+	tokenDuration time.Duration
+	logger        *utils.Logger
+
+	mu     sync.RWMutex
+	keys   []*signingKey // newest first
+	active *signingKey
+}
+
+// NewKeyring loads the keys in dir, generating a first one when there is none.
+// algorithm is the type of generated keys, "EdDSA" or "RS256".
+func NewKeyring(dir, algorithm string, tokenDuration time.Duration, logger *utils.Logger) (*Keyring, error) {
+	if algorithm != "EdDSA" && algorithm != "RS256" {
+		return nil, errors.New("unsupported signing algorithm " + algorithm)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{
+		dir:           dir,
+		algorithm:     algorithm,
+		tokenDuration: tokenDuration,
+		logger:        logger,
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	if len(k.keys) == 0 {
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Reload re-reads the key directory
+func (k *Keyring) Reload() error {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return err
+	}
+
+	var keys []*signingKey
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		path := filepath.Join(k.dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := readPrivateKey(path)
+		if err != nil {
+			k.logger.Errorf("Skipping signing key %s: %v", path, err)
+			continue
+		}
+		keys = append(keys, &signingKey{
+			id:        strings.TrimSuffix(entry.Name(), ".pem"),
+			key:       key,
+			createdAt: info.ModTime(),
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].createdAt.After(keys[j].createdAt)
+	})
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.active = activeKey(keys, time.Now())
+	return nil
+}
+
+// activeKey is the newest key that has been published for PublishDelay, or the longest
+// published one when none has yet (a fresh install)
+func activeKey(keys []*signingKey, now time.Time) *signingKey {
+	for _, key := range keys {
+		if now.Sub(key.createdAt) >= PublishDelay {
+			return key
+		}
+	}
+	if len(keys) > 0 {
+		return keys[len(keys)-1]
+	}
+	return nil
+}
+
+// Rotate generates a new key and returns its ID
+func (k *Keyring) Rotate() (string, error) {
+	key, err := generateKey(k.algorithm)
+	if err != nil {
+		return "", err
+	}
+	suffix, err := utils.GenerateToken(4)
+	if err != nil {
+		return "", err
+	}
+	kid := time.Now().UTC().Format("20060102T150405Z") + "-" + suffix
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(k.dir, kid+".pem"), data, 0600); err != nil {
+		return "", err
+	}
+
+	k.logger.Infof("Generated signing key %s", kid)
+	return kid, k.Reload()
+}
+
+// Prune deletes the keys that were replaced long enough ago that no valid token can use them
+func (k *Keyring) Prune() error {
+	k.mu.RLock()
+	active := k.active
+	var retired []*signingKey
+	if active != nil {
+		activatedAt := active.createdAt.Add(PublishDelay)
+		if time.Since(activatedAt) > k.tokenDuration+CacheTTL {
+			for _, key := range k.keys {
+				if key.createdAt.Before(active.createdAt) {
+					retired = append(retired, key)
+				}
+			}
+		}
+	}
+	k.mu.RUnlock()
+
+	if len(retired) == 0 {
+		return nil
+	}
+	for _, key := range retired {
+		if err := os.Remove(filepath.Join(k.dir, key.id+".pem")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		k.logger.Infof("Removed retired signing key %s", key.id)
+	}
+	return k.Reload()
+}
+
+// Run keeps the keyring current: it picks up keys added elsewhere, activates published keys,
+// generates a new key every rotationInterval (zero disables rotation) and prunes retired keys
+func (k *Keyring) Run(ctx context.Context, rotationInterval time.Duration) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := k.Reload(); err != nil {
+			k.logger.Errorf("Failed to reload signing keys: %v", err)
+			continue
+		}
+		if rotationInterval > 0 && k.newestAge() >= rotationInterval {
+			if _, err := k.Rotate(); err != nil {
+				k.logger.Errorf("Failed to rotate signing key: %v", err)
+			}
+		}
+		if err := k.Prune(); err != nil {
+			k.logger.Errorf("Failed to prune signing keys: %v", err)
+		}
+	}
+}
+
+func (k *Keyring) newestAge() time.Duration {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return 0
+	}
+	return time.Since(k.keys[0].createdAt)
+}
+
+// SigningKey returns the active key
+func (k *Keyring) SigningKey() (string, crypto.Signer, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active == nil {
+		return "", nil, errors.New("no signing key available")
+	}
+	return k.active.id, k.active.key, nil
+}
+
+func (k *Keyring) PublicKey(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.id == kid {
+			return key.key.Public(), nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWKS returns the public halves of every published key
+func (k *Keyring) JWKS() Set {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := Set{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk, err := NewJWK(key.id, key.key.Public())
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func generateKey(algorithm string) (crypto.Signer, error) {
+	if algorithm == "RS256" {
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+// readPrivateKey reads a PKCS#8 or PKCS#1 PEM file holding an RSA or Ed25519 key
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// LogMailer writes messages to the log. It is meant for development without an SMTP server.
+type LogMailer struct {
+	logger *utils.Logger
+}
+
+func NewLogMailer(logger *utils.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Infof("Email to %s, subject %q:\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/config"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to users
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP mailer for the configured server, or a mailer that only logs
+// messages when no SMTP server is configured
+func New(cfg *config.Config, logger *utils.Logger) Mailer {
+	if cfg.SMTPHost == "" {
+		logger.Warn("SMTP is not configured, emails are written to the log instead of being sent")
+		return NewLogMailer(logger)
+	}
+	return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+}
+
+// SendAsync sends a message in the background and logs failures. Request handlers use it so that
+// slow mail delivery neither delays the response nor reveals whether a message was sent.
+func SendAsync(m Mailer, msg Message, logger *utils.Logger) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			logger.Errorf("Failed to send email %q: %v", msg.Subject, err)
+		}
+	}()
+}
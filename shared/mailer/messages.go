@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Link builds a frontend link carrying a token, e.g. for /reset-password
+func Link(frontendURL, path, token string) string {
+	return strings.TrimRight(frontendURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// PasswordResetMessage is sent when a user asks to reset a forgotten password
+func PasswordResetMessage(to, name, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Restablece tu contraseña de CloudBox",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Recibimos una solicitud para restablecer tu contraseña. Usa este enlace para elegir una nueva:\n\n"+
+			"%s\n\n"+
+			"El enlace caduca en %s y solo se puede usar una vez. Si no lo solicitaste, ignora este correo.\n",
+			name, link, ttl),
+	}
+}
+
+// EmailVerificationMessage is sent to confirm the address of a new account or a new address
+func EmailVerificationMessage(to, name, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Confirma tu email de CloudBox",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Confirma que esta dirección es tuya abriendo este enlace:\n\n"+
+			"%s\n\n"+
+			"El enlace caduca en %s. Si no creaste una cuenta ni cambiaste tu email en CloudBox, ignora este correo.\n",
+			name, link, ttl),
+	}
+}
+
+// AccountDeletionMessage is sent when a user asks to delete their account, with a link to cancel it
+func AccountDeletionMessage(to, name, link string, scheduledFor time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Tu cuenta de CloudBox se eliminará",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Recibimos una solicitud para eliminar tu cuenta. El %s se borrarán tu cuenta y todos tus archivos de forma permanente.\n\n"+
+			"Si cambias de opinión, puedes cancelar la eliminación hasta entonces desde:\n\n"+
+			"%s\n\n"+
+			"Si no lo solicitaste, cancela la eliminación y cambia tu contraseña.\n",
+			name, scheduledFor.Format("02/01/2006 15:04 MST"), link),
+	}
+}
@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink is a loopback SMTP server that accepts one message per connection and hands the
+// envelope and the data, with dot-stuffing undone, to the test
+type smtpSink struct {
+	listener net.Listener
+	received chan sinkMessage
+}
+
+type sinkMessage struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func startSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpSink{listener: listener, received: make(chan sinkMessage, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpSink) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host, port
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+
+	var msg sinkMessage
+	text.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 sink")
+		case "MAIL":
+			msg.from = strings.TrimPrefix(line, "MAIL FROM:")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.TrimPrefix(line, "RCPT TO:"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			raw, err := readData(text.R)
+			if err != nil {
+				return
+			}
+			msg.data = raw
+			text.PrintfLine("250 OK")
+			select {
+			case s.received <- msg:
+			default:
+			}
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// readData reads DATA up to the terminating dot line, keeping the line endings exactly as sent
+// so the test can check them. Only dot-stuffing is undone.
+func readData(r *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		if string(line) == ".\r\n" {
+			return data, nil
+		}
+		data = append(data, bytes.TrimPrefix(line, []byte("."))...)
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	sink := startSMTPSink(t)
+	host, port := sink.hostPort()
+	mailer := NewSMTPMailer(host, port, "", "", "CloudBox <no-reply@cloudbox.local>")
+
+	msg := Message{
+		To:      "Jane Doe <jane@example.com>",
+		Subject: "Confirmá tu correo",
+		Body:    "Hello Jane,\n.a line starting with a dot\r\nalready CRLF\nbye\n",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mailer.Send(ctx, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := <-sink.received
+	if got.from != "<no-reply@cloudbox.local>" {
+		t.Errorf("MAIL FROM = %q, want <no-reply@cloudbox.local>", got.from)
+	}
+	if len(got.to) != 1 || got.to[0] != "<jane@example.com>" {
+		t.Errorf("RCPT TO = %q, want [<jane@example.com>]", got.to)
+	}
+	if bytes.Contains(got.data, []byte("\r\r\n")) {
+		t.Errorf("data contains a doubled CR: %q", got.data)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(got.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	headers := parsed.Header
+	if from := headers.Get("From"); from != `"CloudBox" <no-reply@cloudbox.local>` {
+		t.Errorf("From = %q", from)
+	}
+	if to := headers.Get("To"); to != `"Jane Doe" <jane@example.com>` {
+		t.Errorf("To = %q", to)
+	}
+	rawSubject := headers.Get("Subject")
+	if !strings.HasPrefix(rawSubject, "=?utf-8?q?") {
+		t.Errorf("Subject = %q, want it Q-encoded", rawSubject)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(rawSubject)
+	if err != nil || subject != msg.Subject {
+		t.Errorf("decoded Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	for header, want := range map[string]string{
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "8bit",
+	} {
+		if got := headers.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if _, err := headers.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if id := headers.Get("Message-ID"); !strings.HasSuffix(id, "@"+host+">") {
+		t.Errorf("Message-ID = %q", id)
+	}
+
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	wantBody := "Hello Jane,\r\n.a line starting with a dot\r\nalready CRLF\r\nbye\r\n"
+	if string(body) != wantBody {
+		t.Errorf("body = %q, want %q", body, wantBody)
+	}
+}
+
+func TestSMTPMailerInvalidRecipient(t *testing.T) {
+	mailer := NewSMTPMailer("127.0.0.1", "1", "", "", "no-reply@cloudbox.local")
+	if err := mailer.Send(context.Background(), Message{To: "not an address"}); err == nil {
+		t.Error("Send to an invalid address succeeded")
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// AdminTokenMiddleware guards operational endpoints with a shared admin token sent in the
+// X-Admin-Token header. An empty token disables the endpoints entirely.
+func AdminTokenMiddleware(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("Admin endpoints are disabled"))
+			c.Abort()
+			return
+		}
+
+		token := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("Invalid admin token"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
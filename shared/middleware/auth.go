@@ -1,15 +1,21 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/accesstoken"
+	"github.com/joaquinidiarte/cloudbox/shared/audit"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/revocation"
 	"github.com/joaquinidiarte/cloudbox/shared/utils"
 )
 
-func AuthMiddleware(jwtManager *utils.JWTManager) gin.HandlerFunc {
+// AuthMiddleware authenticates requests with a JWT access token or, when accessTokens is not nil,
+// a personal access token. Routes limited by scope use RequireScope after it.
+func AuthMiddleware(jwtManager *utils.JWTManager, revocations revocation.Store, accessTokens accesstoken.Verifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -27,6 +33,11 @@ func AuthMiddleware(jwtManager *utils.JWTManager) gin.HandlerFunc {
 		}
 
 		token := parts[1]
+		if strings.HasPrefix(token, models.AccessTokenPrefix) {
+			authenticateAccessToken(c, accessTokens, token)
+			return
+		}
+
 		claims, err := jwtManager.Verify(token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse("Invalid or expired token"))
@@ -34,15 +45,65 @@ func AuthMiddleware(jwtManager *utils.JWTManager) gin.HandlerFunc {
 			return
 		}
 
+		revoked, err := revocations.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, models.ErrorResponse("Unable to verify token"))
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse("Token has been revoked"))
+			c.Abort()
+			return
+		}
+
 		// Set user info in context
+		c.Set("claims", claims)
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("username", claims.Username)
+		if claims.IsImpersonation() {
+			c.Request = c.Request.WithContext(audit.WithImpersonator(c.Request.Context(), claims.ImpersonatorID))
+		}
 
 		c.Next()
 	}
 }
 
+// authenticateAccessToken handles a request carrying a personal access token
+func authenticateAccessToken(c *gin.Context, accessTokens accesstoken.Verifier, token string) {
+	if accessTokens == nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("Access tokens are not accepted for this endpoint"))
+		c.Abort()
+		return
+	}
+
+	accessToken, user, err := accessTokens.Verify(c.Request.Context(), token, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, accesstoken.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse(err.Error()))
+		} else {
+			c.JSON(http.StatusServiceUnavailable, models.ErrorResponse("Unable to verify token"))
+		}
+		c.Abort()
+		return
+	}
+
+	// Claims without a jti or session, so handlers that end sessions can not act on them
+	c.Set("claims", &utils.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+	})
+	c.Set("access_token", accessToken)
+	c.Set("user_id", user.ID)
+	c.Set("email", user.Email)
+	c.Set("username", user.Username)
+
+	c.Next()
+}
+
 func GetUserID(c *gin.Context) (string, bool) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -50,3 +111,11 @@ func GetUserID(c *gin.Context) (string, bool) {
 	}
 	return userID.(string), true
 }
+
+func GetClaims(c *gin.Context) (*utils.Claims, bool) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	return claims.(*utils.Claims), true
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustProxies makes c.ClientIP() read X-Forwarded-For only on requests from the given
+// comma-separated addresses or CIDRs, normally the API gateway's. With none, the client IP is
+// always the address the request came from, so clients can not choose their own.
+func TrustProxies(router *gin.Engine, proxies string) error {
+	var trusted []string
+	for _, proxy := range strings.Split(proxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trusted = append(trusted, proxy)
+		}
+	}
+	return router.SetTrustedProxies(trusted)
+}
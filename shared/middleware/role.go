@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// RequireRole limits a route to users whose access token carries role. Personal access tokens
+// carry no roles and are always refused. It must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if !ok || !claims.HasRole(role) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("This endpoint requires the "+role+" role"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
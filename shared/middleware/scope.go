@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// RequireScope limits a route to personal access tokens and OAuth client tokens granting scope.
+// Requests authenticated with a login session are not limited. It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, ok := GetAccessToken(c); ok && !token.HasScope(scope) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("Access token is missing the "+scope+" scope"))
+			c.Abort()
+			return
+		}
+		if claims, ok := GetClaims(c); ok && !claims.HasScope(scope) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("Access token is missing the "+scope+" scope"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession refuses personal access tokens and tokens issued to OAuth clients or for
+// impersonation, for routes that manage the account itself
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetAccessToken(c); ok {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("This endpoint requires a login session"))
+			c.Abort()
+			return
+		}
+		if claims, ok := GetClaims(c); ok && (claims.IsDelegated() || claims.IsImpersonation()) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("This endpoint requires a login session"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetAccessToken returns the personal access token the request was authenticated with, if any
+func GetAccessToken(c *gin.Context) (*models.PersonalAccessToken, bool) {
+	token, exists := c.Get("access_token")
+	if !exists {
+		return nil, false
+	}
+	return token.(*models.PersonalAccessToken), true
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// fakeVerifier accepts any personal access token as a token of one user with the given scopes
+type fakeVerifier struct {
+	scopes []string
+}
+
+func (v fakeVerifier) Verify(ctx context.Context, rawToken, clientIP string) (*models.PersonalAccessToken, *models.User, error) {
+	user := &models.User{ID: "user-1", Email: "user@example.com"}
+	return &models.PersonalAccessToken{ID: "pat-1", UserID: user.ID, Scopes: v.scopes}, user, nil
+}
+
+func serve(router *gin.Engine, authorization string) int {
+	req := httptest.NewRequest(http.MethodPost, "/account", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireSessionRefusesAccessTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, scopes := range [][]string{nil, {models.ScopeFilesRead}, {models.ScopeUserWrite}} {
+		router := gin.New()
+		router.POST("/account", AuthMiddleware(nil, nil, fakeVerifier{scopes: scopes}), RequireSession(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		if code := serve(router, "Bearer "+models.AccessTokenPrefix+"secret"); code != http.StatusForbidden {
+			t.Errorf("access token with scopes %v: got status %d, want %d", scopes, code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		claims *utils.Claims
+		want   int
+	}{
+		{"login session", &utils.Claims{UserID: "user-1"}, http.StatusOK},
+		{"oauth client", &utils.Claims{UserID: "user-1", ClientID: "client-1"}, http.StatusForbidden},
+		{"impersonation", &utils.Claims{UserID: "user-1", ImpersonatorID: "admin-1"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.POST("/account", func(c *gin.Context) {
+			c.Set("claims", tt.claims)
+			c.Set("user_id", tt.claims.UserID)
+		}, RequireSession(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		if code := serve(router, ""); code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
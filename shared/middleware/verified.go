@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaquinidiarte/cloudbox/shared/models"
+)
+
+// RequireVerifiedEmail rejects users whose email is not verified yet. It must run after
+// AuthMiddleware and does nothing unless required is set (REQUIRE_EMAIL_VERIFICATION).
+func RequireVerifiedEmail(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !required {
+			c.Next()
+			return
+		}
+
+		claims, exists := GetClaims(c)
+		if !exists || !claims.EmailVerified {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("Email address must be verified first"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them apart from JWTs
+const AccessTokenPrefix = "cbx_"
+
+// Scopes a personal access token can be limited to
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+	ScopeUserRead   = "user:read"
+	ScopeUserWrite  = "user:write"
+)
+
+// AccessTokenScopes lists every valid scope
+var AccessTokenScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeUserRead, ScopeUserWrite}
+
+// PersonalAccessToken is a long-lived credential for scripts and CI. Only its SHA-256 hash is kept.
+// A token without scopes has the same access as its owner.
+type PersonalAccessToken struct {
+	ID         string     `json:"id" bson:"_id"`
+	UserID     string     `json:"user_id" bson:"user_id"`
+	Name       string     `json:"name" bson:"name"`
+	TokenHash  string     `json:"-" bson:"token_hash"`
+	Hint       string     `json:"hint" bson:"hint"` // First characters of the token, to recognize it
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty" bson:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAccessTokenResponse carries the token itself, which is only ever shown once
+type CreateAccessTokenResponse struct {
+	Token       string              `json:"token"`
+	AccessToken PersonalAccessToken `json:"access_token"`
+}
+
+func NewPersonalAccessToken(userID, name, tokenHash, hint string, scopes []string, expiresAt *time.Time) *PersonalAccessToken {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &PersonalAccessToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: tokenHash,
+		Hint:      hint,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+// HasScope reports whether the token grants scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
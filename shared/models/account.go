@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccountDeletion is a requested account deletion. Until ScheduledFor the user can cancel it;
+// after that the user-service tombstones the account and every service purges the user's data.
+type AccountDeletion struct {
+	RequestedAt  time.Time `json:"requested_at" bson:"requested_at"`
+	ScheduledFor time.Time `json:"scheduled_for" bson:"scheduled_for"`
+}
+
+// Statuses of a data export
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a job building an archive with all of a user's files and account data
+type DataExport struct {
+	ID              string     `json:"id" bson:"_id"`
+	UserID          string     `json:"user_id" bson:"user_id"`
+	Status          string     `json:"status" bson:"status"`
+	IncludeVersions bool       `json:"include_versions" bson:"include_versions"`
+	Path            string     `json:"-" bson:"path,omitempty"`
+	Size            int64      `json:"size,omitempty" bson:"size,omitempty"`
+	Error           string     `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"` // Set once ready; the archive is deleted afterwards
+}
+
+func NewDataExport(userID string, includeVersions bool) *DataExport {
+	return &DataExport{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		Status:          DataExportPending,
+		IncludeVersions: includeVersions,
+		CreatedAt:       time.Now(),
+	}
+}
+
+type DataExportRequest struct {
+	// IncludeVersions adds every stored version of each file, not just the current one
+	IncludeVersions bool `json:"include_versions"`
+}
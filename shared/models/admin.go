@@ -0,0 +1,28 @@
+package models
+
+// UserSearchQuery filters the user listing of the admin API
+type UserSearchQuery struct {
+	// Query matches the ID exactly or part of the email, username or name, ignoring case
+	Query  string `form:"q"`
+	Active *bool  `form:"active"`
+	Role   string `form:"role"`
+	Page   int    `form:"page" binding:"omitempty,min=1"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type StorageLimitRequest struct {
+	StorageLimit *int64 `json:"storage_limit" binding:"required,min=0"`
+}
+
+type UserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// ImpersonationResponse is an access token for acting as another user. No refresh token is
+// issued, so the session ends when the token expires.
+type ImpersonationResponse struct {
+	Token          string       `json:"token"`
+	ExpiresAt      int64        `json:"expires_at"`
+	User           UserResponse `json:"user"`
+	ImpersonatorID string       `json:"impersonator_id"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// Outcomes of an audit event
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditActorSystem is the actor of events caused by background jobs rather than a user
+const AuditActorSystem = "system"
+
+// Audit event actions. Admin actions are prefixed with "admin_".
+const (
+	// Authentication and tokens
+	AuditLogin              = "login"
+	AuditLoginLockout       = "login_lockout"
+	AuditLogout             = "logout"
+	AuditLogoutAll          = "logout_all"
+	AuditSessionRevoke      = "session_revoke"
+	AuditTokenRefresh       = "token_refresh"
+	AuditPasswordChange     = "password_change"
+	AuditPasswordReset      = "password_reset"
+	AuditMFAEnable          = "mfa_enable"
+	AuditMFADisable         = "mfa_disable"
+	AuditDeviceApprove      = "device_approve"
+	AuditAccessTokenCreate  = "access_token_create"
+	AuditAccessTokenRevoke  = "access_token_revoke"
+	AuditOAuthConsent       = "oauth_consent"
+	AuditOAuthConsentRevoke = "oauth_consent_revoke"
+	AuditOAuthTokenIssue    = "oauth_token_issue"
+	AuditOAuthTokenRevoke   = "oauth_token_revoke"
+
+	// Files and sharing through workspaces
+	AuditFileUpload            = "file_upload"
+	AuditFileDownload          = "file_download"
+	AuditFileDelete            = "file_delete"
+	AuditFileVersionDownload   = "file_version_download"
+	AuditFileVersionRestore    = "file_version_restore"
+	AuditFileVersionDelete     = "file_version_delete"
+	AuditWorkspaceMemberAdd    = "workspace_member_add"
+	AuditWorkspaceMemberRole   = "workspace_member_role"
+	AuditWorkspaceMemberRemove = "workspace_member_remove"
+
+	// Account
+	AuditDataExportRequest      = "data_export_request"
+	AuditDataExportDownload     = "data_export_download"
+	AuditAccountDeletionRequest = "account_deletion_request"
+	AuditAccountDeletionCancel  = "account_deletion_cancel"
+	AuditAccountDeleted         = "account_deleted"
+	AuditAccountPurged          = "account_purged"
+
+	// Admin actions recorded outside the user-service's admin API
+	AuditAdminForceLogout              = "admin_force_logout"
+	AuditAdminImpersonate              = "admin_impersonate"
+	AuditAdminSetWorkspaceStorageLimit = "admin_set_workspace_storage_limit"
+	AuditAdminSetWorkspacePlan         = "admin_set_workspace_plan"
+)
+
+// AuditEvent is an entry of the append-only audit log. ActorID did the action; SubjectID is the
+// user whose account or data it concerns, which decides whose audit log it shows up in. Actions of
+// an admin impersonating a user have the admin as actor and the user in Details["on_behalf_of"].
+type AuditEvent struct {
+	ID         string            `json:"id" bson:"_id"`
+	Time       time.Time         `json:"time" bson:"time"`
+	Service    string            `json:"service" bson:"service"`
+	Action     string            `json:"action" bson:"action"`
+	Outcome    string            `json:"outcome" bson:"outcome"`
+	ActorID    string            `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	SubjectID  string            `json:"subject_id,omitempty" bson:"subject_id,omitempty"`
+	TargetType string            `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IPAddress  string            `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Details    map[string]string `json:"details,omitempty" bson:"details,omitempty"`
+}
+
+// AuditQuery filters the audit log. Users only see events about themselves, whatever the filters.
+type AuditQuery struct {
+	Action    string     `form:"action"`
+	Outcome   string     `form:"outcome" binding:"omitempty,oneof=success failure"`
+	Service   string     `form:"service"`
+	ActorID   string     `form:"actor_id"`
+	SubjectID string     `form:"subject_id"`
+	TargetID  string     `form:"target_id"`
+	From      *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page      int        `form:"page" binding:"omitempty,min=1"`
+	Limit     int        `form:"limit" binding:"omitempty,min=1,max=100"`
+}
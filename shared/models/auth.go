@@ -1,14 +1,22 @@
 package models
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
 
 type LoginResponse struct {
-	Token     string       `json:"token"`
-	ExpiresAt int64        `json:"expires_at"`
-	User      UserResponse `json:"user"`
+	Token                 string       `json:"token"`
+	ExpiresAt             int64        `json:"expires_at"`
+	RefreshToken          string       `json:"refresh_token"`
+	RefreshTokenExpiresAt int64        `json:"refresh_token_expires_at"`
+	User                  UserResponse `json:"user"`
 }
 
 type RegisterRequest struct {
@@ -27,4 +35,146 @@ type TokenClaims struct {
 
 type RefreshTokenRequest struct {
 	Token string `json:"token" binding:"required"`
-}
\ No newline at end of file
+}
+
+// RefreshToken is a stored long-lived opaque token. Only its SHA-256 hash is kept.
+// Every refresh rotates the token; tokens issued from one login share a FamilyID.
+type RefreshToken struct {
+	ID         string     `json:"id" bson:"_id"`
+	UserID     string     `json:"user_id" bson:"user_id"`
+	FamilyID   string     `json:"family_id" bson:"family_id"`
+	TokenHash  string     `json:"-" bson:"token_hash"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty" bson:"rotated_at,omitempty"`
+	ReplacedBy string     `json:"replaced_by,omitempty" bson:"replaced_by,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+func NewRefreshToken(userID, familyID, tokenHash string, ttl time.Duration) *RefreshToken {
+	now := time.Now()
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	return &RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// PasswordResetToken is a single-use token emailed to reset a forgotten password.
+// Only its SHA-256 hash is kept.
+type PasswordResetToken struct {
+	ID        string     `json:"id" bson:"_id"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	TokenHash string     `json:"-" bson:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func NewPasswordResetToken(userID, tokenHash string, ttl time.Duration) *PasswordResetToken {
+	now := time.Now()
+	return &PasswordResetToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// EmailVerificationToken is a single-use token emailed to confirm an address. Email is the address
+// being confirmed: the user's current one after registration, or a pending new one.
+type EmailVerificationToken struct {
+	ID        string     `json:"id" bson:"_id"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	Email     string     `json:"email" bson:"email"`
+	TokenHash string     `json:"-" bson:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func NewEmailVerificationToken(userID, email, tokenHash string, ttl time.Duration) *EmailVerificationToken {
+	now := time.Now()
+	return &EmailVerificationToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Email:     email,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the user has 2FA enabled.
+// The MFA token is exchanged together with a code for the real token pair.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code is a TOTP code or one of the recovery codes
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge is a pending second login step. Only the hash of its token is kept.
+type MFAChallenge struct {
+	ID        string     `json:"id" bson:"_id"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	TokenHash string     `json:"-" bson:"token_hash"`
+	Attempts  int        `json:"attempts" bson:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func NewMFAChallenge(userID, tokenHash string, ttl time.Duration) *MFAChallenge {
+	now := time.Now()
+	return &MFAChallenge{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeviceCodeGrantType is the grant type a device polls the token endpoint with (RFC 8628)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// States of a device authorization
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorization is a pending login of a device without a browser, such as the CLI. The
+// device polls with the device code while the user approves the short user code from a browser
+// where they are signed in. Only hashes of both codes are kept.
+type DeviceAuthorization struct {
+	ID             string     `json:"id" bson:"_id"`
+	DeviceCodeHash string     `json:"-" bson:"device_code_hash"`
+	UserCodeHash   string     `json:"-" bson:"user_code_hash"`
+	Status         string     `json:"status" bson:"status"`
+	UserID         string     `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	UserAgent      string     `json:"user_agent" bson:"user_agent"` // Of the device
+	IPAddress      string     `json:"ip_address" bson:"ip_address"` // Of the device
+	Interval       int        `json:"interval" bson:"interval"`     // Seconds between polls
+	ExpiresAt      time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	LastPolledAt   *time.Time `json:"last_polled_at,omitempty" bson:"last_polled_at,omitempty"`
+	DecidedAt      *time.Time `json:"decided_at,omitempty" bson:"decided_at,omitempty"`
+	UsedAt         *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func NewDeviceAuthorization(deviceCodeHash, userCodeHash string, client ClientInfo, interval int, ttl time.Duration) *DeviceAuthorization {
+	now := time.Now()
+	return &DeviceAuthorization{
+		ID:             uuid.New().String(),
+		DeviceCodeHash: deviceCodeHash,
+		UserCodeHash:   userCodeHash,
+		Status:         DeviceAuthorizationPending,
+		UserAgent:      client.UserAgent,
+		IPAddress:      client.IPAddress,
+		Interval:       interval,
+		ExpiresAt:      now.Add(ttl),
+		CreatedAt:      now,
+	}
+}
+
+// DeviceCodeResponse is the device authorization response (RFC 8628 section 3.2)
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceTokenRequest is the form a device polls the token endpoint with
+type DeviceTokenRequest struct {
+	GrantType  string `form:"grant_type" binding:"required"`
+	DeviceCode string `form:"device_code" binding:"required"`
+}
+
+// DeviceAuthorizationResponse describes the device asking to sign in, for the user to recognize it
+type DeviceAuthorizationResponse struct {
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
@@ -6,19 +6,39 @@ import (
 	"github.com/google/uuid"
 )
 
+// Scan statuses of a file version. Versions uploaded before scanning existed have an empty status.
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	ScanStatusFailed   = "failed"
+)
+
 // FileVersion represents a specific version of a file
 type FileVersion struct {
-	Version    int       `json:"version" bson:"version"`
-	Size       int64     `json:"size" bson:"size"`
-	Path       string    `json:"path" bson:"path"`
-	MimeType   string    `json:"mime_type" bson:"mime_type"`
-	UploadedAt time.Time `json:"uploaded_at" bson:"uploaded_at"`
-	Comment    string    `json:"comment,omitempty" bson:"comment,omitempty"`
+	Version    int        `json:"version" bson:"version"`
+	Size       int64      `json:"size" bson:"size"`
+	Path       string     `json:"path" bson:"path"`
+	MimeType   string     `json:"mime_type" bson:"mime_type"`
+	UploadedAt time.Time  `json:"uploaded_at" bson:"uploaded_at"`
+	Comment    string     `json:"comment,omitempty" bson:"comment,omitempty"`
+	ScanStatus string     `json:"scan_status,omitempty" bson:"scan_status,omitempty"`
+	ScanResult string     `json:"scan_result,omitempty" bson:"scan_result,omitempty"` // Signature name or scanner error
+	ScannedAt  *time.Time `json:"scanned_at,omitempty" bson:"scanned_at,omitempty"`
+	// Failed scan attempts of a pending version, and when the next one is due
+	ScanAttempts int        `json:"-" bson:"scan_attempts,omitempty"`
+	NextScanAt   *time.Time `json:"-" bson:"next_scan_at,omitempty"`
+}
+
+// IsDownloadable reports whether the version has passed (or predates) malware scanning
+func (v *FileVersion) IsDownloadable() bool {
+	return v.ScanStatus == "" || v.ScanStatus == ScanStatusClean
 }
 
 type File struct {
 	ID             string        ` json:"id" bson:"_id"`
-	UserID         string        `json:"user_id" bson:"user_id"`
+	UserID         string        `json:"user_id" bson:"user_id"`                               // Owner, or the uploader of a workspace file
+	WorkspaceID    string        `json:"workspace_id,omitempty" bson:"workspace_id,omitempty"` // Set for files owned by a shared workspace
 	Name           string        `json:"name" bson:"name"`
 	OriginalName   string        `json:"original_name" bson:"original_name"`
 	Path           string        `json:"path" bson:"path"`
@@ -37,6 +57,7 @@ type File struct {
 type FileResponse struct {
 	ID             string    `json:"id"`
 	UserID         string    `json:"user_id"`
+	WorkspaceID    string    `json:"workspace_id,omitempty"`
 	Name           string    `json:"name"`
 	OriginalName   string    `json:"original_name"`
 	Size           int64     `json:"size"`
@@ -47,11 +68,12 @@ type FileResponse struct {
 	IsPublic       bool      `json:"is_public"`
 	CurrentVersion int       `json:"current_version"`
 	VersionCount   int       `json:"version_count"`
+	ScanStatus     string    `json:"scan_status,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
-func NewFile(userID, name, originalName, path string, size int64, mimeType string, parentID *string) *File {
+func NewFile(userID, workspaceID, name, originalName, path string, size int64, mimeType, scanStatus string, parentID *string) *File {
 	now := time.Now()
 
 	firstVersion := FileVersion{
@@ -60,11 +82,13 @@ func NewFile(userID, name, originalName, path string, size int64, mimeType strin
 		Path:       path,
 		MimeType:   mimeType,
 		UploadedAt: now,
+		ScanStatus: scanStatus,
 	}
 
 	return &File{
 		ID:             uuid.New().String(),
 		UserID:         userID,
+		WorkspaceID:    workspaceID,
 		Name:           name,
 		OriginalName:   originalName,
 		Path:           path,
@@ -81,10 +105,34 @@ func NewFile(userID, name, originalName, path string, size int64, mimeType strin
 	}
 }
 
+// StorageOwnerID is the ID of the quota the file counts against: its workspace or its user
+func (f *File) StorageOwnerID() string {
+	if f.WorkspaceID != "" {
+		return f.WorkspaceID
+	}
+	return f.UserID
+}
+
+// FindVersion returns the version with the given number, or nil
+func (f *File) FindVersion(version int) *FileVersion {
+	for i := range f.Versions {
+		if f.Versions[i].Version == version {
+			return &f.Versions[i]
+		}
+	}
+	return nil
+}
+
 func (f *File) ToResponse() FileResponse {
+	var scanStatus string
+	if current := f.FindVersion(f.CurrentVersion); current != nil {
+		scanStatus = current.ScanStatus
+	}
+
 	return FileResponse{
 		ID:             f.ID,
 		UserID:         f.UserID,
+		WorkspaceID:    f.WorkspaceID,
 		Name:           f.Name,
 		OriginalName:   f.OriginalName,
 		Size:           f.Size,
@@ -95,39 +143,45 @@ func (f *File) ToResponse() FileResponse {
 		IsPublic:       f.IsPublic,
 		CurrentVersion: f.CurrentVersion,
 		VersionCount:   len(f.Versions),
+		ScanStatus:     scanStatus,
 		CreatedAt:      f.CreatedAt,
 		UpdatedAt:      f.UpdatedAt,
 	}
 }
 
 type FolderCreateRequest struct {
-	Name     string  `json:"name" binding:"required"`
-	ParentID *string `json:"parent_id,omitempty"`
+	Name        string  `json:"name" binding:"required"`
+	ParentID    *string `json:"parent_id,omitempty"`
+	WorkspaceID string  `json:"workspace_id,omitempty"`
 }
 
-func NewFolder(userID, name string, parentID *string) *File {
+func NewFolder(userID, workspaceID, name string, parentID *string) *File {
 	now := time.Now()
 	return &File{
-		ID:        uuid.New().String(),
-		UserID:    userID,
-		Name:      name,
-		ParentID:  parentID,
-		IsFolder:  true,
-		IsShared:  false,
-		IsPublic:  false,
-		Size:      0,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Name:        name,
+		ParentID:    parentID,
+		IsFolder:    true,
+		IsShared:    false,
+		IsPublic:    false,
+		Size:        0,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 }
 
 type FileVersionResponse struct {
-	Version    int       `json:"version"`
-	Size       int64     `json:"size"`
-	MimeType   string    `json:"mime_type"`
-	UploadedAt time.Time `json:"uploaded_at"`
-	Comment    string    `json:"comment,omitempty"`
-	IsCurrent  bool      `json:"is_current"`
+	Version    int        `json:"version"`
+	Size       int64      `json:"size"`
+	MimeType   string     `json:"mime_type"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+	Comment    string     `json:"comment,omitempty"`
+	IsCurrent  bool       `json:"is_current"`
+	ScanStatus string     `json:"scan_status,omitempty"`
+	ScanResult string     `json:"scan_result,omitempty"`
+	ScannedAt  *time.Time `json:"scanned_at,omitempty"`
 }
 
 func (f *File) GetVersionResponses() []FileVersionResponse {
@@ -140,7 +194,48 @@ func (f *File) GetVersionResponses() []FileVersionResponse {
 			UploadedAt: v.UploadedAt,
 			Comment:    v.Comment,
 			IsCurrent:  v.Version == f.CurrentVersion,
+			ScanStatus: v.ScanStatus,
+			ScanResult: v.ScanResult,
+			ScannedAt:  v.ScannedAt,
 		}
 	}
 	return responses
 }
+
+// QuotaExceededDetails is returned alongside a 413 when an upload would exceed the storage limit
+type QuotaExceededDetails struct {
+	Code         string `json:"code"`
+	StorageUsed  int64  `json:"storage_used"`
+	StorageLimit int64  `json:"storage_limit"`
+	Requested    int64  `json:"requested"`
+}
+
+// UsageBucket is the bytes and file (or version) count attributed to one group
+type UsageBucket struct {
+	Key   string `json:"key" bson:"_id"`
+	Name  string `json:"name,omitempty" bson:"name,omitempty"`
+	Bytes int64  `json:"bytes" bson:"bytes"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// LargestFile is an entry in the largest files list of a usage breakdown
+type LargestFile struct {
+	ID           string  `json:"id" bson:"_id"`
+	Name         string  `json:"name" bson:"original_name"`
+	ParentID     *string `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	MimeType     string  `json:"mime_type" bson:"mime_type"`
+	Size         int64   `json:"size" bson:"size"`             // Current version
+	TotalSize    int64   `json:"total_size" bson:"total_size"` // All stored versions
+	VersionCount int     `json:"version_count" bson:"version_count"`
+}
+
+// StorageUsageBreakdown shows what is consuming a user's quota
+type StorageUsageBreakdown struct {
+	TotalBytes      int64         `json:"total_bytes"`
+	FileCount       int64         `json:"file_count"`
+	ByFolder        []UsageBucket `json:"by_folder"`   // Keyed by top-level folder ID, "root" for files outside any folder
+	ByCategory      []UsageBucket `json:"by_category"` // image, video, audio, document, archive, other
+	CurrentVersions UsageBucket   `json:"current_versions"`
+	OldVersions     UsageBucket   `json:"old_versions"`
+	Largest         []LargestFile `json:"largest"`
+}
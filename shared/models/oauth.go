@@ -0,0 +1,199 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is a third-party application registered to act on behalf of users.
+// Confidential clients authenticate with a secret, of which only the SHA-256 hash is kept;
+// public clients have none and rely on PKCE alone.
+type OAuthClient struct {
+	ID           string     `json:"client_id" bson:"_id"`
+	OwnerID      string     `json:"owner_id" bson:"owner_id"`
+	Name         string     `json:"name" bson:"name"`
+	SecretHash   string     `json:"-" bson:"secret_hash,omitempty"`
+	Confidential bool       `json:"confidential" bson:"confidential"`
+	RedirectURIs []string   `json:"redirect_uris" bson:"redirect_uris"`
+	Scopes       []string   `json:"scopes" bson:"scopes"` // Scopes the client may request
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// CreateOAuthClientResponse carries the client secret, which is only ever shown once
+type CreateOAuthClientResponse struct {
+	ClientSecret string      `json:"client_secret,omitempty"`
+	Client       OAuthClient `json:"client"`
+}
+
+func NewOAuthClient(ownerID, name, secretHash string, confidential bool, redirectURIs, scopes []string) *OAuthClient {
+	return &OAuthClient{
+		ID:           uuid.New().String(),
+		OwnerID:      ownerID,
+		Name:         name,
+		SecretHash:   secretHash,
+		Confidential: confidential,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// OAuthConsent records the scopes a user granted to a client, so that they are not asked again
+type OAuthConsent struct {
+	ID        string     `json:"id" bson:"_id"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	ClientID  string     `json:"client_id" bson:"client_id"`
+	Scopes    []string   `json:"scopes" bson:"scopes"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" bson:"updated_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// OAuthConsentResponse is a consent together with the name of the client it was given to
+type OAuthConsentResponse struct {
+	OAuthConsent
+	ClientName string `json:"client_name"`
+}
+
+// OAuthAuthorizeRequest holds the parameters of an authorization request (RFC 6749 section 4.1.1)
+// as the consent page received them
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type" binding:"required"`
+	ClientID            string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+}
+
+// OAuthAuthorizationDetails is shown on the consent page
+type OAuthAuthorizationDetails struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+	// Consented is true when the user already granted every requested scope
+	Consented bool `json:"consented"`
+}
+
+type OAuthDecisionRequest struct {
+	OAuthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// OAuthRedirectResponse is where the consent page sends the browser back to the client
+type OAuthRedirectResponse struct {
+	RedirectURL string `json:"redirect_url"`
+}
+
+// OAuthAuthorizationCode is a single-use code issued after consent. Only its hash is kept.
+type OAuthAuthorizationCode struct {
+	ID            string     `json:"id" bson:"_id"`
+	CodeHash      string     `json:"-" bson:"code_hash"`
+	ClientID      string     `json:"client_id" bson:"client_id"`
+	UserID        string     `json:"user_id" bson:"user_id"`
+	RedirectURI   string     `json:"redirect_uri" bson:"redirect_uri"` // As sent in the request, possibly empty
+	Scopes        []string   `json:"scopes" bson:"scopes"`
+	CodeChallenge string     `json:"-" bson:"code_challenge"`
+	ExpiresAt     time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func NewOAuthAuthorizationCode(codeHash, clientID, userID, redirectURI, codeChallenge string, scopes []string, ttl time.Duration) *OAuthAuthorizationCode {
+	now := time.Now()
+	return &OAuthAuthorizationCode{
+		ID:            uuid.New().String(),
+		CodeHash:      codeHash,
+		ClientID:      clientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+		ExpiresAt:     now.Add(ttl),
+		CreatedAt:     now,
+	}
+}
+
+// OAuthRefreshToken is a refresh token issued to a client. Like login refresh tokens it is
+// rotated on every use; the family ID identifies the grant and is the sid of its access tokens.
+type OAuthRefreshToken struct {
+	ID        string     `json:"id" bson:"_id"`
+	FamilyID  string     `json:"family_id" bson:"family_id"`
+	ClientID  string     `json:"client_id" bson:"client_id"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	Scopes    []string   `json:"scopes" bson:"scopes"`
+	TokenHash string     `json:"-" bson:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty" bson:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+func NewOAuthRefreshToken(familyID, clientID, userID, tokenHash string, scopes []string, ttl time.Duration) *OAuthRefreshToken {
+	now := time.Now()
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	return &OAuthRefreshToken{
+		ID:        uuid.New().String(),
+		FamilyID:  familyID,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+}
+
+// OAuthTokenRequest is the form posted to the token endpoint (RFC 6749 sections 4.1.3 and 6).
+// Client credentials may also be sent with HTTP basic authentication.
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// OAuthTokenActionRequest is the form posted to the introspection and revocation endpoints
+type OAuthTokenActionRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// OAuthTokenResponse is the token endpoint response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthIntrospectionResponse is the introspection endpoint response (RFC 7662 section 2.2)
+type OAuthIntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalIdentity links a user to an account at an external identity provider
+type ExternalIdentity struct {
+	// Issuer identifies the provider, Subject the account within it
+	Issuer   string    `json:"issuer" bson:"issuer"`
+	Subject  string    `json:"subject" bson:"subject"`
+	Email    string    `json:"email" bson:"email"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// OIDCConfigResponse tells the frontend whether to offer single sign-on
+type OIDCConfigResponse struct {
+	Enabled      bool   `json:"enabled"`
+	ProviderName string `json:"provider_name,omitempty"`
+}
+
+// OIDCAuthorizeResponse holds the provider URL the browser is sent to. The frontend keeps the
+// state and only completes a callback that carries the same one.
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// OIDCLoginState is a pending authorization request. It is keyed by the hash of the state
+// parameter and holds the nonce and PKCE verifier needed to complete it.
+type OIDCLoginState struct {
+	ID           string     `json:"id" bson:"_id"`
+	StateHash    string     `json:"-" bson:"state_hash"`
+	Nonce        string     `json:"-" bson:"nonce"`
+	CodeVerifier string     `json:"-" bson:"code_verifier"`
+	ExpiresAt    time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func NewOIDCLoginState(stateHash, nonce, codeVerifier string, ttl time.Duration) *OIDCLoginState {
+	now := time.Now()
+	return &OIDCLoginState{
+		ID:           uuid.New().String(),
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    now.Add(ttl),
+		CreatedAt:    now,
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+)
+
+// Built-in plans the plans collection is seeded with. New users start on the free plan and new
+// workspaces on the team plan; admins can change both afterwards.
+const (
+	DefaultUserPlanID      = "free"
+	DefaultWorkspacePlanID = "team"
+)
+
+// Plan is a storage tier assigned to users and workspaces. The storage limit is copied to the
+// holder when the plan is assigned; the other limits are read from the plan on every upload.
+type Plan struct {
+	ID           string    `json:"id" bson:"_id"`
+	Name         string    `json:"name" bson:"name"`
+	StorageLimit int64     `json:"storage_limit" bson:"storage_limit"`
+	MaxFileSize  int64     `json:"max_file_size" bson:"max_file_size"`
+	MaxVersions  int       `json:"max_versions" bson:"max_versions"` // Versions kept per file, 0 keeps all
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// BuiltinPlans returns the plans every installation starts with
+func BuiltinPlans() []*Plan {
+	now := time.Now()
+	return []*Plan{
+		{
+			ID:           DefaultUserPlanID,
+			Name:         "Free",
+			StorageLimit: 5 * 1024 * 1024 * 1024,
+			MaxFileSize:  500 * 1024 * 1024,
+			MaxVersions:  0,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           DefaultWorkspacePlanID,
+			Name:         "Team",
+			StorageLimit: 50 * 1024 * 1024 * 1024,
+			MaxFileSize:  500 * 1024 * 1024,
+			MaxVersions:  0,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+}
+
+// BuiltinPlan returns the built-in plan with the given ID, or nil if there is none
+func BuiltinPlan(id string) *Plan {
+	for _, plan := range BuiltinPlans() {
+		if plan.ID == id {
+			return plan
+		}
+	}
+	return nil
+}
+
+// QuotaGrace keeps a previous, higher storage limit in force for a while after a plan change
+// left the holder over quota, so that they have time to free up space
+type QuotaGrace struct {
+	StorageLimit int64     `json:"storage_limit" bson:"storage_limit"`
+	Until        time.Time `json:"until" bson:"until"`
+}
+
+// NewQuotaGrace returns the grace for a holder whose storage limit is lowered from previousLimit
+// to newLimit while using used bytes, or nil when they still fit or no grace period is configured
+func NewQuotaGrace(previousLimit, newLimit, used int64, period time.Duration) *QuotaGrace {
+	if period <= 0 || newLimit >= previousLimit || used <= newLimit {
+		return nil
+	}
+	return &QuotaGrace{StorageLimit: previousLimit, Until: time.Now().Add(period)}
+}
+
+// EffectiveStorageLimit is the limit uploads are checked against: a grace limit while it lasts,
+// the holder's own limit otherwise
+func EffectiveStorageLimit(limit int64, grace *QuotaGrace) int64 {
+	if grace != nil && time.Now().Before(grace.Until) && grace.StorageLimit > limit {
+		return grace.StorageLimit
+	}
+	return limit
+}
+
+// PlanRequest sets the limits of a plan
+type PlanRequest struct {
+	Name         string `json:"name" binding:"required,max=100"`
+	StorageLimit *int64 `json:"storage_limit" binding:"required,min=0"`
+	MaxFileSize  *int64 `json:"max_file_size" binding:"required,min=1"`
+	MaxVersions  *int   `json:"max_versions" binding:"required,min=0"`
+}
+
+type PlanCreateRequest struct {
+	ID string `json:"id" binding:"required,alphanum,max=50"`
+	PlanRequest
+}
+
+// PlanAssignRequest moves a user or workspace to another plan
+type PlanAssignRequest struct {
+	PlanID string `json:"plan_id" binding:"required"`
+}
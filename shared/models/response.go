@@ -28,4 +28,12 @@ func ErrorResponse(err string) APIResponse {
 		Success: false,
 		Error:   err,
 	}
-}
\ No newline at end of file
+}
+
+func ErrorResponseWithData(err string, data interface{}) APIResponse {
+	return APIResponse{
+		Success: false,
+		Error:   err,
+		Data:    data,
+	}
+}
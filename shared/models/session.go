@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Session is one login of a user on a device. Its ID is the FamilyID of the refresh tokens
+// issued for that login and is carried in access tokens as the sid claim.
+type Session struct {
+	ID             string     `json:"id" bson:"_id"`
+	UserID         string     `json:"user_id" bson:"user_id"`
+	UserAgent      string     `json:"user_agent" bson:"user_agent"`
+	IPAddress      string     `json:"ip_address" bson:"ip_address"`
+	RefreshTokenID string     `json:"-" bson:"refresh_token_id"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt      time.Time  `json:"expires_at" bson:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// ClientInfo describes the client a session is created or refreshed from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func NewSession(id, userID string, client ClientInfo, refreshToken *RefreshToken) *Session {
+	now := time.Now()
+	return &Session{
+		ID:             id,
+		UserID:         userID,
+		UserAgent:      client.UserAgent,
+		IPAddress:      client.IPAddress,
+		RefreshTokenID: refreshToken.ID,
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      refreshToken.ExpiresAt,
+	}
+}
+
+func (s *Session) ToResponse(currentSessionID string) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    s.ID == currentSessionID,
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons a user's storage usage changed
+const (
+	StorageEventUpload        = "upload"
+	StorageEventNewVersion    = "new_version"
+	StorageEventDelete        = "delete"
+	StorageEventDeleteVersion = "delete_version"
+)
+
+// StorageEvent is an outbox entry written by the file-service whenever stored bytes change.
+// The user-service applies each event to User.StorageUsed exactly once.
+type StorageEvent struct {
+	ID            string     `json:"id" bson:"_id"`
+	UserID        string     `json:"user_id" bson:"user_id"`
+	FileID        string     `json:"file_id" bson:"file_id"`
+	Delta         int64      `json:"delta" bson:"delta"`
+	Reason        string     `json:"reason" bson:"reason"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	AppliedAt     *time.Time `json:"applied_at,omitempty" bson:"applied_at,omitempty"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+}
+
+func NewStorageEvent(userID, fileID string, delta int64, reason string) *StorageEvent {
+	now := time.Now()
+	return &StorageEvent{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		FileID:        fileID,
+		Delta:         delta,
+		Reason:        reason,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+}
+
+// StorageReservation is an upload in flight on a file-service quota counter: its bytes are
+// charged to the counter but not in the files collection yet
+type StorageReservation struct {
+	ID        string    `bson:"id"`
+	Size      int64     `bson:"size"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// StorageDrift describes one user whose recorded storage usage disagreed with the files collection
+type StorageDrift struct {
+	UserID       string `json:"user_id"`
+	RecordedUsed int64  `json:"recorded_used"`
+	ActualUsed   int64  `json:"actual_used"`
+	PendingDelta int64  `json:"pending_delta"`         // Unapplied storage events already accounted for in ActualUsed
+	ExpectedUsed int64  `json:"expected_used"`         // ActualUsed minus PendingDelta
+	LedgerUsed   *int64 `json:"ledger_used,omitempty"` // File-service quota counter, if it also drifted
+	Reserved     int64  `json:"reserved,omitempty"`    // Bytes of uploads in flight, which the quota counter should also hold
+	Corrected    bool   `json:"corrected"`
+	Error        string `json:"error,omitempty"`
+}
+
+// StorageDriftReport is the result of one reconciliation run
+type StorageDriftReport struct {
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+	DryRun       bool           `json:"dry_run"`
+	UsersChecked int            `json:"users_checked"`
+	UsersDrifted int            `json:"users_drifted"`
+	TotalDrift   int64          `json:"total_drift"` // Sum of absolute differences in bytes
+	Drifts       []StorageDrift `json:"drifts"`
+}
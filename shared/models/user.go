@@ -6,18 +6,47 @@ import (
 	"github.com/google/uuid"
 )
 
+// RoleAdmin grants access to the admin API
+const RoleAdmin = "admin"
+
+// Roles lists the roles that can be assigned to users
+var Roles = []string{RoleAdmin}
+
 type User struct {
-	ID        string    `json:"id" bson:"_id"`
-	Email     string    `json:"email" bson:"email"`
-	Username  string    `json:"username" bson:"username"`
-	Password  string    `json:"-" bson:"password"`
-	FirstName string    `json:"first_name" bson:"first_name"`
-	LastName  string    `json:"last_name" bson:"last_name"`
-	StorageUsed int64   `json:"storage_used" bson:"storage_used"`
-	StorageLimit int64  `json:"storage_limit" bson:"storage_limit"`
-	IsActive  bool      `json:"is_active" bson:"is_active"`
-	CreatedAt time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	ID              string     `json:"id" bson:"_id"`
+	Email           string     `json:"email" bson:"email"`
+	Username        string     `json:"username" bson:"username"`
+	Password        string     `json:"-" bson:"password"`
+	FirstName       string     `json:"first_name" bson:"first_name"`
+	LastName        string     `json:"last_name" bson:"last_name"`
+	StorageUsed     int64      `json:"storage_used" bson:"storage_used"`
+	StorageLimit    int64      `json:"storage_limit" bson:"storage_limit"`
+	IsActive        bool       `json:"is_active" bson:"is_active"`
+	EmailVerified   bool       `json:"email_verified" bson:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" bson:"email_verified_at,omitempty"`
+	// PlanID is the user's storage plan; accounts created before plans existed have none and are
+	// on the default plan
+	PlanID     string      `json:"plan_id,omitempty" bson:"plan_id,omitempty"`
+	QuotaGrace *QuotaGrace `json:"quota_grace,omitempty" bson:"quota_grace,omitempty"`
+	// Roles are carried in access tokens, so a change applies once the user's tokens are refreshed
+	Roles []string `json:"roles,omitempty" bson:"roles,omitempty"`
+	// PendingEmail is a requested new address that takes effect once confirmed
+	PendingEmail string `json:"pending_email,omitempty" bson:"pending_email,omitempty"`
+	// Two-factor authentication; the secret and recovery code hashes are never serialized to JSON
+	TOTPEnabled       bool     `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret        string   `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret string   `json:"-" bson:"totp_pending_secret,omitempty"`
+	TOTPLastCounter   int64    `json:"-" bson:"totp_last_counter,omitempty"`
+	RecoveryCodes     []string `json:"-" bson:"recovery_codes,omitempty"`
+	// Accounts at external identity providers that can be used to log in
+	ExternalIdentities []ExternalIdentity `json:"-" bson:"external_identities,omitempty"`
+	// Account deletion: a pending request can be cancelled; a deleted account is a tombstone whose
+	// data each service purges, adding its name to PurgedBy when done
+	PendingDeletion *AccountDeletion `json:"pending_deletion,omitempty" bson:"pending_deletion,omitempty"`
+	DeletedAt       *time.Time       `json:"-" bson:"deleted_at,omitempty"`
+	PurgedBy        []string         `json:"-" bson:"purged_by,omitempty"`
+	CreatedAt       time.Time        `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at" bson:"updated_at"`
 }
 
 type UserCreateRequest struct {
@@ -35,17 +64,27 @@ type UserUpdateRequest struct {
 }
 
 type UserResponse struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	Username     string    `json:"username"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	StorageUsed  int64     `json:"storage_used"`
-	StorageLimit int64     `json:"storage_limit"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            string      `json:"id"`
+	Email         string      `json:"email"`
+	Username      string      `json:"username"`
+	FirstName     string      `json:"first_name"`
+	LastName      string      `json:"last_name"`
+	StorageUsed   int64       `json:"storage_used"`
+	StorageLimit  int64       `json:"storage_limit"`
+	IsActive      bool        `json:"is_active"`
+	EmailVerified bool        `json:"email_verified"`
+	PendingEmail  string      `json:"pending_email,omitempty"`
+	TOTPEnabled   bool        `json:"totp_enabled"`
+	Roles         []string    `json:"roles,omitempty"`
+	PlanID        string      `json:"plan_id"`
+	QuotaGrace    *QuotaGrace `json:"quota_grace,omitempty"`
+	// PendingDeletion is set while the account is scheduled for deletion
+	PendingDeletion *AccountDeletion `json:"pending_deletion,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
 }
 
+// NewUser creates a user on the default plan, with the built-in storage limit of that plan until
+// the stored plan is applied
 func NewUser(req UserCreateRequest, hashedPassword string) *User {
 	now := time.Now()
 	return &User{
@@ -56,7 +95,8 @@ func NewUser(req UserCreateRequest, hashedPassword string) *User {
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
 		StorageUsed:  0,
-		StorageLimit: 5 * 1024 * 1024 * 1024,
+		StorageLimit: BuiltinPlan(DefaultUserPlanID).StorageLimit,
+		PlanID:       DefaultUserPlanID,
 		IsActive:     true,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -65,14 +105,39 @@ func NewUser(req UserCreateRequest, hashedPassword string) *User {
 
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:           u.ID,
-		Email:        u.Email,
-		Username:     u.Username,
-		FirstName:    u.FirstName,
-		LastName:     u.LastName,
-		StorageUsed:  u.StorageUsed,
-		StorageLimit: u.StorageLimit,
-		IsActive:     u.IsActive,
-		CreatedAt:    u.CreatedAt,
+		ID:              u.ID,
+		Email:           u.Email,
+		Username:        u.Username,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		StorageUsed:     u.StorageUsed,
+		StorageLimit:    u.StorageLimit,
+		IsActive:        u.IsActive,
+		EmailVerified:   u.EmailVerified,
+		PendingEmail:    u.PendingEmail,
+		TOTPEnabled:     u.TOTPEnabled,
+		Roles:           u.Roles,
+		PlanID:          u.Plan(),
+		QuotaGrace:      u.QuotaGrace,
+		PendingDeletion: u.PendingDeletion,
+		CreatedAt:       u.CreatedAt,
+	}
+}
+
+// Plan returns the ID of the user's storage plan
+func (u *User) Plan() string {
+	if u.PlanID == "" {
+		return DefaultUserPlanID
 	}
-}
\ No newline at end of file
+	return u.PlanID
+}
+
+// HasRole reports whether the user has been assigned role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles of a workspace member, from most to least privileged. Owners manage the workspace and its
+// members, editors change files and viewers only read them.
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+// workspaceRoleRanks orders the roles so that a role allows everything a lower one does
+var workspaceRoleRanks = map[string]int{
+	WorkspaceRoleViewer: 1,
+	WorkspaceRoleEditor: 2,
+	WorkspaceRoleOwner:  3,
+}
+
+// WorkspaceRoleAllows reports whether a member with role may do what required allows
+func WorkspaceRoleAllows(role, required string) bool {
+	rank, ok := workspaceRoleRanks[role]
+	return ok && rank >= workspaceRoleRanks[required]
+}
+
+// Workspace is shared storage owned by its members rather than a single user. Its files count
+// against the workspace's own quota instead of the uploader's StorageLimit.
+type Workspace struct {
+	ID           string            `json:"id" bson:"_id"`
+	Name         string            `json:"name" bson:"name"`
+	PlanID       string            `json:"plan_id" bson:"plan_id"`
+	StorageLimit int64             `json:"storage_limit" bson:"storage_limit"`
+	QuotaGrace   *QuotaGrace       `json:"quota_grace,omitempty" bson:"quota_grace,omitempty"`
+	Members      []WorkspaceMember `json:"members" bson:"members"`
+	CreatedBy    string            `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at" bson:"updated_at"`
+}
+
+type WorkspaceMember struct {
+	UserID  string    `json:"user_id" bson:"user_id"`
+	Role    string    `json:"role" bson:"role"`
+	AddedAt time.Time `json:"added_at" bson:"added_at"`
+}
+
+// NewWorkspace creates a workspace on the given plan with its creator as the only owner
+func NewWorkspace(name, ownerID string, plan *Plan) *Workspace {
+	now := time.Now()
+	return &Workspace{
+		ID:           uuid.New().String(),
+		Name:         name,
+		PlanID:       plan.ID,
+		StorageLimit: plan.StorageLimit,
+		Members: []WorkspaceMember{
+			{UserID: ownerID, Role: WorkspaceRoleOwner, AddedAt: now},
+		},
+		CreatedBy: ownerID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// MemberRole returns the user's role in the workspace, or "" if they are not a member
+func (w *Workspace) MemberRole(userID string) string {
+	for _, member := range w.Members {
+		if member.UserID == userID {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// Plan returns the ID of the workspace's storage plan
+func (w *Workspace) Plan() string {
+	if w.PlanID == "" {
+		return DefaultWorkspacePlanID
+	}
+	return w.PlanID
+}
+
+// OwnerCount is the number of members with the owner role
+func (w *Workspace) OwnerCount() int {
+	count := 0
+	for _, member := range w.Members {
+		if member.Role == WorkspaceRoleOwner {
+			count++
+		}
+	}
+	return count
+}
+
+type WorkspaceCreateRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type WorkspaceUpdateRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// WorkspaceMemberAddRequest adds a registered user to a workspace
+type WorkspaceMemberAddRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+type WorkspaceMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+type WorkspaceStorageLimitRequest struct {
+	StorageLimit *int64 `json:"storage_limit" binding:"required,min=0"`
+}
+
+// WorkspaceResponse is a workspace as seen by one of its members
+type WorkspaceResponse struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Role         string            `json:"role"`
+	PlanID       string            `json:"plan_id"`
+	StorageUsed  int64             `json:"storage_used"`
+	StorageLimit int64             `json:"storage_limit"`
+	QuotaGrace   *QuotaGrace       `json:"quota_grace,omitempty"`
+	Members      []WorkspaceMember `json:"members"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+func (w *Workspace) ToResponse(userID string, storageUsed int64) WorkspaceResponse {
+	return WorkspaceResponse{
+		ID:           w.ID,
+		Name:         w.Name,
+		Role:         w.MemberRole(userID),
+		PlanID:       w.Plan(),
+		StorageUsed:  storageUsed,
+		StorageLimit: w.StorageLimit,
+		QuotaGrace:   w.QuotaGrace,
+		Members:      w.Members,
+		CreatedAt:    w.CreatedAt,
+	}
+}
@@ -0,0 +1,37 @@
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/config"
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// New connects to the configured Redis. Redis is optional: when REDIS_HOST is empty New returns a
+// nil client and callers keep shared state (revocations, login limits) in process memory. A configured Redis that cannot be reached is an error: each
+// instance falling back to its own memory would silently stop sharing revocations and login limits.
+func New(cfg *config.Config, logger *utils.Logger) (*redis.Client, error) {
+	if cfg.RedisHost == "" {
+		logger.Warn("Redis is not configured, shared state is kept in memory: token revocations and login limits only apply within this service")
+		return nil, nil
+	}
+
+	addr := cfg.RedisHost + ":" + cfg.RedisPort
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: cfg.RedisPassword,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis at %s: %w", addr, err)
+	}
+
+	logger.Infof("Connected to Redis at %s", addr)
+	return client, nil
+}
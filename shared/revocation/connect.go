@@ -0,0 +1,15 @@
+package revocation
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewStore returns a Redis-backed store, or an in-memory one when client is nil
+func NewStore(client *redis.Client, maxTokenTTL time.Duration) Store {
+	if client == nil {
+		return NewMemoryStore(maxTokenTTL)
+	}
+	return NewRedisStore(client, maxTokenTTL)
+}
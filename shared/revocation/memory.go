@@ -0,0 +1,98 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// MemoryStore keeps revocations in process memory. It is only shared between requests
+// of one service instance, so it is meant for development and single-process setups.
+type MemoryStore struct {
+	mu          sync.Mutex
+	tokens      map[string]time.Time // jti -> token expiry
+	sessions    map[string]time.Time // sid -> when the entry can be dropped
+	users       map[string]int64     // user ID -> revoke tokens issued up to this unix time in ms
+	userExpires map[string]time.Time
+	maxTokenTTL time.Duration
+}
+
+// NewMemoryStore creates an in-memory store. maxTokenTTL is the longest an access token can live.
+func NewMemoryStore(maxTokenTTL time.Duration) *MemoryStore {
+	return &MemoryStore{
+		tokens:      make(map[string]time.Time),
+		sessions:    make(map[string]time.Time),
+		users:       make(map[string]int64),
+		userExpires: make(map[string]time.Time),
+		maxTokenTTL: maxTokenTTL,
+	}
+}
+
+func (s *MemoryStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	s.sessions[sessionID] = time.Now().Add(s.maxTokenTTL)
+	return nil
+}
+
+func (s *MemoryStore) RevokeUser(ctx context.Context, userID string, issuedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	if cutoff := issuedBefore.UnixMilli(); cutoff > s.users[userID] {
+		s.users[userID] = cutoff
+	}
+	s.userExpires[userID] = issuedBefore.Add(s.maxTokenTTL)
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[claims.ID]; ok && claims.ID != "" {
+		return true, nil
+	}
+	if _, ok := s.sessions[claims.SessionID]; ok && claims.SessionID != "" {
+		return true, nil
+	}
+	if cutoff, ok := s.users[claims.UserID]; ok && issuedBefore(claims, cutoff) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// sweep drops entries whose tokens have expired; callers must hold mu
+func (s *MemoryStore) sweep() {
+	now := time.Now()
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for sid, expiresAt := range s.sessions {
+		if now.After(expiresAt) {
+			delete(s.sessions, sid)
+		}
+	}
+	for userID, expiresAt := range s.userExpires {
+		if now.After(expiresAt) {
+			delete(s.users, userID)
+			delete(s.userExpires, userID)
+		}
+	}
+}
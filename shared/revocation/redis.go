@@ -0,0 +1,78 @@
+package revocation
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	tokenKeyPrefix   = "cloudbox:revoked:token:"
+	sessionKeyPrefix = "cloudbox:revoked:session:"
+	// Holds a cutoff in unix milliseconds
+	userKeyPrefix = "cloudbox:revoked:user-ms:"
+)
+
+// RedisStore keeps revocations in Redis so that every service sees them
+type RedisStore struct {
+	client      *redis.Client
+	maxTokenTTL time.Duration
+}
+
+// NewRedisStore creates a Redis-backed store. maxTokenTTL is the longest an access token can live.
+func NewRedisStore(client *redis.Client, maxTokenTTL time.Duration) *RedisStore {
+	return &RedisStore{
+		client:      client,
+		maxTokenTTL: maxTokenTTL,
+	}
+}
+
+func (s *RedisStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, tokenKeyPrefix+jti, 1, ttl).Err()
+}
+
+func (s *RedisStore) RevokeSession(ctx context.Context, sessionID string) error {
+	return s.client.Set(ctx, sessionKeyPrefix+sessionID, 1, s.maxTokenTTL).Err()
+}
+
+// revokeUserScript only ever moves the cutoff forward
+var revokeUserScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) > current then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+end
+return 1
+`)
+
+func (s *RedisStore) RevokeUser(ctx context.Context, userID string, issuedBefore time.Time) error {
+	return revokeUserScript.Run(ctx, s.client, []string{userKeyPrefix + userID},
+		issuedBefore.UnixMilli(), s.maxTokenTTL.Milliseconds()).Err()
+}
+
+func (s *RedisStore) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	pipe := s.client.Pipeline()
+	tokenCmd := pipe.Exists(ctx, tokenKeyPrefix+claims.ID)
+	sessionCmd := pipe.Exists(ctx, sessionKeyPrefix+claims.SessionID)
+	userCmd := pipe.Get(ctx, userKeyPrefix+claims.UserID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, err
+	}
+
+	if claims.ID != "" && tokenCmd.Val() > 0 {
+		return true, nil
+	}
+	if claims.SessionID != "" && sessionCmd.Val() > 0 {
+		return true, nil
+	}
+	if cutoff, err := strconv.ParseInt(userCmd.Val(), 10, 64); err == nil && issuedBefore(claims, cutoff) {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,34 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/joaquinidiarte/cloudbox/shared/utils"
+)
+
+// Store is a revocation list for access tokens. Entries only need to outlive the tokens
+// they revoke, so every entry expires once those tokens would have expired anyway.
+type Store interface {
+	// RevokeToken revokes a single token by its jti claim
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeSession revokes every token carrying the given sid claim
+	RevokeSession(ctx context.Context, sessionID string) error
+	// RevokeUser revokes every token of a user issued up to issuedBefore
+	RevokeUser(ctx context.Context, userID string, issuedBefore time.Time) error
+	// IsRevoked reports whether a verified token has been revoked
+	IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error)
+}
+
+// issuedBefore reports whether the token was issued at or before the cutoff, in unix milliseconds.
+// Tokens without the iat_ms claim only have whole seconds, so one issued in the same second as
+// the revocation is treated as revoked too.
+func issuedBefore(claims *utils.Claims, cutoff int64) bool {
+	if claims.IssuedAtMs != 0 {
+		return claims.IssuedAtMs <= cutoff
+	}
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return claims.IssuedAt.Unix()*1000 <= cutoff
+}
@@ -1,18 +1,34 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/joaquinidiarte/cloudbox/shared/models"
 )
 
+// KeySet supplies the asymmetric keys of a JWTManager. Signing keys are identified by the
+// token's kid header, so several keys can be valid at once while keys are rotated.
+type KeySet interface {
+	// SigningKey returns the key new tokens are signed with. Verify-only sets return an error.
+	SigningKey() (kid string, key crypto.Signer, err error)
+	// PublicKey returns the verification key with the given ID
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
 type JWTManager struct {
 	secretKey     string
+	keys          KeySet
 	tokenDuration time.Duration
 }
 
+// NewJWTManager creates a manager that signs and verifies HS256 tokens with a shared secret
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
 	return &JWTManager{
 		secretKey:     secretKey,
@@ -20,48 +36,143 @@ func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
 	}
 }
 
+// NewKeySetJWTManager creates a manager that uses RS256 or EdDSA keys from the key set.
+// HS256 tokens are rejected, so holding a verification key is not enough to forge tokens.
+func NewKeySetJWTManager(keys KeySet, tokenDuration time.Duration) *JWTManager {
+	return &JWTManager{
+		keys:          keys,
+		tokenDuration: tokenDuration,
+	}
+}
+
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
+	UserID        string `json:"user_id"`
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	EmailVerified bool   `json:"email_verified"`
+	SessionID     string `json:"sid,omitempty"`
+	// Tokens issued to an OAuth client carry its ID and are limited to the granted scopes
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Roles of the user; tokens issued to OAuth clients or for impersonation carry none
+	Roles []string `json:"roles,omitempty"`
+	// ImpersonatorID is the admin acting as the user in a support session
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
+	// IssuedAtMs is iat in milliseconds, so revocations can tell apart tokens issued within one second
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (m *JWTManager) Generate(user *models.User) (string, int64, error) {
-	expiresAt := time.Now().Add(m.tokenDuration)
+// IsDelegated reports whether the token was issued to a third-party OAuth client
+func (c *Claims) IsDelegated() bool {
+	return c.ClientID != ""
+}
+
+// HasScope reports whether the token grants scope. Login tokens are not limited.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsDelegated() {
+		return true
+	}
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the token carries role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImpersonation reports whether an admin issued the token to act as the user
+func (c *Claims) IsImpersonation() bool {
+	return c.ImpersonatorID != ""
+}
 
-	claims := Claims{
-		UserID:   user.ID,
-		Email:    user.Email,
-		Username: user.Username,
+// TokenDuration is the lifetime of generated tokens
+func (m *JWTManager) TokenDuration() time.Duration {
+	return m.tokenDuration
+}
+
+// Generate issues an access token for the user, bound to the given session
+func (m *JWTManager) Generate(user *models.User, sessionID string) (string, int64, error) {
+	claims := m.newClaims(user, sessionID)
+	claims.Roles = user.Roles
+	return m.issue(claims)
+}
+
+// GenerateDelegated issues an access token acting for the user on behalf of an OAuth client.
+// grantID is used as the sid, so revoking the grant revokes its tokens.
+func (m *JWTManager) GenerateDelegated(user *models.User, grantID, clientID string, scopes []string) (string, int64, error) {
+	claims := m.newClaims(user, grantID)
+	claims.ClientID = clientID
+	claims.Scope = strings.Join(scopes, " ")
+	return m.issue(claims)
+}
+
+// GenerateImpersonation issues an access token that lets an admin act as the user. The user's
+// roles are left out, so impersonating can not grant more than the admin already has.
+func (m *JWTManager) GenerateImpersonation(user *models.User, sessionID, impersonatorID string) (string, int64, error) {
+	claims := m.newClaims(user, sessionID)
+	claims.ImpersonatorID = impersonatorID
+	return m.issue(claims)
+}
+
+func (m *JWTManager) newClaims(user *models.User, sessionID string) Claims {
+	now := time.Now()
+	return Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+		SessionID:     sessionID,
+		IssuedAtMs:    now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.tokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(m.secretKey))
+func (m *JWTManager) issue(claims Claims) (string, int64, error) {
+	tokenString, err := m.sign(claims)
 	if err != nil {
 		return "", 0, err
 	}
+	return tokenString, claims.ExpiresAt.Unix(), nil
+}
+
+func (m *JWTManager) sign(claims Claims) (string, error) {
+	if m.keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(m.secretKey))
+	}
 
-	return tokenString, expiresAt.Unix(), nil
+	kid, key, err := m.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	method, err := SigningMethodFor(key.Public())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
 func (m *JWTManager) Verify(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&Claims{},
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return []byte(m.secretKey), nil
-		},
-	)
-
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, m.verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -73,3 +184,43 @@ func (m *JWTManager) Verify(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+func (m *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if m.keys == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(m.secretKey), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no key ID")
+	}
+	key, err := m.keys.PublicKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// The algorithm has to match the key, not just be one the library accepts
+	method, err := SigningMethodFor(key)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key, nil
+}
+
+// SigningMethodFor returns the JWT algorithm used with a public key: RS256 or EdDSA
+func SigningMethodFor(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
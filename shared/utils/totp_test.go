@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+)
+
+// RFC 4226 and RFC 6238 test secrets, as raw bytes and as the base32 users are given
+var (
+	rfcSeedSHA1   = []byte("12345678901234567890")
+	rfcSeedSHA256 = []byte("12345678901234567890123456789012")
+	rfcSeedSHA512 = []byte("1234567890123456789012345678901234567890123456789012345678901234")
+
+	rfcSecretSHA1 = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+)
+
+// RFC 4226 Appendix D
+func TestHOTPVectors(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := HOTP(rfcSeedSHA1, uint64(counter), 6, sha1.New); got != code {
+			t.Errorf("HOTP(counter=%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238 Appendix B
+func TestTOTPVectors(t *testing.T) {
+	algorithms := []struct {
+		name string
+		seed []byte
+		alg  func() hash.Hash
+	}{
+		{"SHA1", rfcSeedSHA1, sha1.New},
+		{"SHA256", rfcSeedSHA256, sha256.New},
+		{"SHA512", rfcSeedSHA512, sha512.New},
+	}
+	vectors := []struct {
+		unix  int64
+		codes [3]string // SHA1, SHA256, SHA512
+	}{
+		{59, [3]string{"94287082", "46119246", "90693936"}},
+		{1111111109, [3]string{"07081804", "68084774", "25091201"}},
+		{1111111111, [3]string{"14050471", "67062674", "99943326"}},
+		{1234567890, [3]string{"89005924", "91819424", "93441116"}},
+		{2000000000, [3]string{"69279037", "90698825", "38618901"}},
+		{20000000000, [3]string{"65353130", "77737706", "47863826"}},
+	}
+
+	for _, v := range vectors {
+		for i, a := range algorithms {
+			got := TOTP(a.seed, time.Unix(v.unix, 0), 30*time.Second, 8, a.alg)
+			if got != v.codes[i] {
+				t.Errorf("TOTP(%s, t=%d) = %s, want %s", a.name, v.unix, got, v.codes[i])
+			}
+		}
+	}
+}
+
+func TestDecodeTOTPSecret(t *testing.T) {
+	for _, secret := range []string{rfcSecretSHA1, "gezd gnbv gy3t qojq gezd gnbv gy3t qojq", rfcSecretSHA1 + "===="} {
+		key, err := DecodeTOTPSecret(secret)
+		if err != nil || string(key) != string(rfcSeedSHA1) {
+			t.Errorf("DecodeTOTPSecret(%q) = %q, %v", secret, key, err)
+		}
+	}
+	for _, secret := range []string{"", "not base32!"} {
+		if _, err := DecodeTOTPSecret(secret); err == nil {
+			t.Errorf("DecodeTOTPSecret(%q) succeeded, want an error", secret)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	// t=59 is in time step 1; the codes are the RFC 4226 HOTP values of steps 0 to 3
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name string
+		code string
+		step uint64
+		ok   bool
+	}{
+		{"current step", "287082", 1, true},
+		{"with spaces", "287 082", 1, true},
+		{"previous step", "755224", 0, true},
+		{"next step", "359152", 2, true},
+		{"two steps ahead", "969429", 0, false},
+		{"wrong code", "000000", 0, false},
+		{"too short", "28708", 0, false},
+		{"eight digits", "94287082", 0, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecretSHA1, tt.code, now)
+		if ok != tt.ok || step != tt.step {
+			t.Errorf("%s: ValidateTOTP(%q) = %d, %t, want %d, %t", tt.name, tt.code, step, ok, tt.step, tt.ok)
+		}
+	}
+
+	if _, ok := ValidateTOTP("not base32!", "287082", now); ok {
+		t.Error("ValidateTOTP accepted a code for an invalid secret")
+	}
+}
+
+// A code stays valid for the neighbouring time steps, so ValidateTOTP reports the step it
+// belongs to; callers refuse a step at or before the last one accepted to stop replays.
+func TestValidateTOTPReplay(t *testing.T) {
+	first, ok := ValidateTOTP(rfcSecretSHA1, "287082", time.Unix(59, 0))
+	if !ok {
+		t.Fatal("code was not accepted in its own time step")
+	}
+	replayed, ok := ValidateTOTP(rfcSecretSHA1, "287082", time.Unix(89, 0))
+	if !ok {
+		t.Fatal("code was not accepted one time step later")
+	}
+	if replayed != first {
+		t.Errorf("replayed code reported step %d, want %d", replayed, first)
+	}
+
+	// The next code belongs to a later step and is not a replay
+	next, ok := ValidateTOTP(rfcSecretSHA1, "359152", time.Unix(89, 0))
+	if !ok || next <= first {
+		t.Errorf("next code reported step %d, %t, want a step after %d", next, ok, first)
+	}
+}